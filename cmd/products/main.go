@@ -0,0 +1,141 @@
+// Command products imports and exports the product catalog from the shell,
+// with the same validation and upsert rules as the HTTP endpoints.
+//
+//	products import [-format csv|ndjson] [-dry-run] FILE
+//	products export [-format csv|ndjson] [-o FILE]
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/techagentng/ecommerce-api/config"
+	"github.com/techagentng/ecommerce-api/db"
+	"github.com/techagentng/ecommerce-api/models"
+	"github.com/techagentng/ecommerce-api/services"
+)
+
+func main() {
+	log.SetFlags(0)
+	if len(os.Args) < 2 {
+		usage()
+	}
+
+	conf, err := config.Load()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	switch os.Args[1] {
+	case "import":
+		os.Exit(runImport(conf, os.Args[2:]))
+	case "export":
+		os.Exit(runExport(conf, os.Args[2:]))
+	default:
+		usage()
+	}
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: products import [-format csv|ndjson] [-dry-run] FILE")
+	fmt.Fprintln(os.Stderr, "       products export [-format csv|ndjson] [-o FILE]")
+	os.Exit(2)
+}
+
+// newProductService wires the product service against the configured
+// database. Import and export never delete products, so no blob store is
+// needed.
+func newProductService(conf *config.Config) services.ProductService {
+	gormDB := db.GetDB(conf)
+	var searchIndex db.SearchIndex
+	switch conf.SearchIndex {
+	case "memory":
+		searchIndex = db.NewMemorySearchIndex()
+	default:
+		searchIndex = db.NewPostgresSearchIndex(gormDB)
+	}
+	return services.NewProductService(db.NewProductRepo(gormDB), db.NewCategoryRepo(gormDB), db.NewVariantRepo(gormDB), db.NewProductImageRepo(gormDB), searchIndex, nil, conf)
+}
+
+func runImport(conf *config.Config, args []string) int {
+	flags := flag.NewFlagSet("import", flag.ExitOnError)
+	format := flags.String("format", "", "csv or ndjson, taken from the file extension by default")
+	dryRun := flags.Bool("dry-run", false, "validate and report without writing")
+	flags.Parse(args)
+	if flags.NArg() != 1 {
+		usage()
+	}
+
+	file, err := os.Open(flags.Arg(0))
+	if err != nil {
+		log.Print(err)
+		return 1
+	}
+	defer file.Close()
+	if *format == "" {
+		*format = strings.TrimPrefix(strings.ToLower(filepath.Ext(file.Name())), ".")
+		if *format == "jsonl" {
+			*format = models.FormatNDJSON
+		}
+	}
+
+	report, apiErr := newProductService(conf).ImportProducts(*format, file, *dryRun)
+	if apiErr != nil {
+		log.Print(apiErr.Message)
+		return 1
+	}
+	for _, rowErr := range report.Errors {
+		if rowErr.Field != "" {
+			fmt.Printf("line %d: %s: %s\n", rowErr.Line, rowErr.Field, rowErr.Message)
+		} else {
+			fmt.Printf("line %d: %s\n", rowErr.Line, rowErr.Message)
+		}
+	}
+	switch {
+	case len(report.Errors) > 0:
+		fmt.Printf("%d rows, %d errors: nothing was written\n", report.Rows, len(report.Errors))
+		return 1
+	case report.DryRun:
+		fmt.Printf("%d rows would create %d and update %d products (dry run)\n", report.Rows, report.Created, report.Updated)
+	default:
+		fmt.Printf("%d rows created %d and updated %d products\n", report.Rows, report.Created, report.Updated)
+	}
+	return 0
+}
+
+func runExport(conf *config.Config, args []string) int {
+	flags := flag.NewFlagSet("export", flag.ExitOnError)
+	format := flags.String("format", models.FormatCSV, "csv or ndjson")
+	output := flags.String("o", "", "output file, standard output by default")
+	flags.Parse(args)
+	if *format != models.FormatCSV && *format != models.FormatNDJSON {
+		usage()
+	}
+
+	var w io.Writer = os.Stdout
+	if *output != "" {
+		file, err := os.Create(*output)
+		if err != nil {
+			log.Print(err)
+			return 1
+		}
+		defer file.Close()
+		w = file
+	}
+	buffered := bufio.NewWriter(w)
+	if err := newProductService(conf).ExportProducts(*format, buffered); err != nil {
+		log.Print(err)
+		return 1
+	}
+	if err := buffered.Flush(); err != nil {
+		log.Print(err)
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,77 @@
+// Command stock checks the stock columns against the stock ledger.
+//
+//	stock reconcile [-fix]
+//
+// reconcile lists every product and variant whose stock differs from the sum
+// of its ledger movements and exits with status 1 when there is any drift.
+// With -fix the stock is set to the ledger balance.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"text/tabwriter"
+
+	"github.com/techagentng/ecommerce-api/config"
+	"github.com/techagentng/ecommerce-api/db"
+	"github.com/techagentng/ecommerce-api/services"
+)
+
+func main() {
+	log.SetFlags(0)
+	if len(os.Args) < 2 || os.Args[1] != "reconcile" {
+		usage()
+	}
+
+	conf, err := config.Load()
+	if err != nil {
+		log.Fatal(err)
+	}
+	os.Exit(runReconcile(conf, os.Args[2:]))
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: stock reconcile [-fix]")
+	os.Exit(2)
+}
+
+func runReconcile(conf *config.Config, args []string) int {
+	flags := flag.NewFlagSet("reconcile", flag.ExitOnError)
+	fix := flags.Bool("fix", false, "set drifted stock to the ledger balance")
+	flags.Parse(args)
+	if flags.NArg() != 0 {
+		usage()
+	}
+
+	gormDB := db.GetDB(conf)
+	stockService := services.NewStockService(db.NewStockRepo(gormDB), db.NewProductRepo(gormDB), db.NewVariantRepo(gormDB), conf)
+	drift, err := stockService.ReconcileStock(*fix)
+	if err != nil {
+		log.Print(err)
+		return 1
+	}
+	if len(drift) == 0 {
+		fmt.Println("stock matches the ledger")
+		return 0
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "PRODUCT\tVARIANT\tSKU\tSTOCK\tLEDGER\tDRIFT")
+	for _, item := range drift {
+		variant := "-"
+		if item.VariantID != nil {
+			variant = fmt.Sprint(*item.VariantID)
+		}
+		fmt.Fprintf(w, "%d\t%s\t%s\t%d\t%d\t%+d\n", item.ProductID, variant, item.SKU, item.Stock, item.Ledger, item.Stock-item.Ledger)
+	}
+	w.Flush()
+
+	if *fix {
+		fmt.Printf("%d items set to their ledger balance\n", len(drift))
+		return 0
+	}
+	fmt.Printf("%d items drift from the ledger\n", len(drift))
+	return 1
+}
@@ -3,23 +3,100 @@ package config
 import (
 	"log"
 	"os"
+	"time"
 
 	"github.com/joho/godotenv"
 	"github.com/kelseyhightower/envconfig"
 )
 
 type Config struct {
-	Debug                    bool   `envconfig:"debug"`
-	PostgresPort             int    `envconfig:"postgres_port"`
-	PostgresHost             string `envconfig:"postgres_host"`
-	PostgresUser             string `envconfig:"postgres_user"`
-	PostgresDB               string `envconfig:"postgres_db"`
-	BaseUrl                  string `envconfig:"base_url"`
-	Env                      string `envconfig:"env"`
-	PostgresPassword         string `envconfig:"postgres_password"`
-	JWTSecret                string `envconfig:"jwt_secret"`
-	Host                     string `envconfig:"host"`
-	AccessControlAllowOrigin string `envconfig:"accessc_control_allow_origin"`
+	Debug                    bool          `envconfig:"debug"`
+	PostgresPort             int           `envconfig:"postgres_port"`
+	PostgresHost             string        `envconfig:"postgres_host"`
+	PostgresUser             string        `envconfig:"postgres_user"`
+	PostgresDB               string        `envconfig:"postgres_db"`
+	BaseUrl                  string        `envconfig:"base_url"`
+	Env                      string        `envconfig:"env"`
+	PostgresPassword         string        `envconfig:"postgres_password"`
+	JWTSecret                string        `envconfig:"jwt_secret"`
+	Host                     string        `envconfig:"host"`
+	AccessControlAllowOrigin string        `envconfig:"accessc_control_allow_origin"`
+	CatalogCacheMaxAge       time.Duration `envconfig:"catalog_cache_max_age" default:"1m"`
+	TokenSweepInterval       time.Duration `envconfig:"token_sweep_interval" default:"1h"`
+	PermissionCacheTTL       time.Duration `envconfig:"permission_cache_ttl" default:"5m"`
+
+	MailerDriver               string        `envconfig:"mailer_driver" default:"smtp"`
+	SMTPHost                   string        `envconfig:"smtp_host"`
+	SMTPPort                   int           `envconfig:"smtp_port" default:"587"`
+	SMTPUsername               string        `envconfig:"smtp_username"`
+	SMTPPassword               string        `envconfig:"smtp_password"`
+	MailFrom                   string        `envconfig:"mail_from"`
+	MailDir                    string        `envconfig:"mail_dir" default:"mail"`
+	RequireEmailVerification   bool          `envconfig:"require_email_verification"`
+	VerificationResendInterval time.Duration `envconfig:"verification_resend_interval" default:"1m"`
+
+	PasswordMinLength          int           `envconfig:"password_min_length" default:"8"`
+	BreachedPasswordsFile      string        `envconfig:"breached_passwords_file"`
+	PasswordResetTokenValidity time.Duration `envconfig:"password_reset_token_validity" default:"1h"`
+
+	// LoginAttemptStore is "database" or "memory"
+	LoginAttemptStore  string        `envconfig:"login_attempt_store" default:"database"`
+	LoginMaxFailures   int           `envconfig:"login_max_failures" default:"5"`
+	LoginIPMaxFailures int           `envconfig:"login_ip_max_failures" default:"20"`
+	LoginFailureWindow time.Duration `envconfig:"login_failure_window" default:"15m"`
+	LoginLockoutBase   time.Duration `envconfig:"login_lockout_base" default:"1m"`
+	LoginLockoutMax    time.Duration `envconfig:"login_lockout_max" default:"1h"`
+
+	// BlobStore is "s3" or "local". The local store writes to BlobDir, which the
+	// server then serves at the path of BlobBaseURL.
+	BlobStore   string `envconfig:"blob_store" default:"s3"`
+	BlobDir     string `envconfig:"blob_dir" default:"uploads"`
+	BlobBaseURL string `envconfig:"blob_base_url" default:"/uploads"`
+	AWSRegion   string `envconfig:"aws_region"`
+	AWSBucket   string `envconfig:"aws_bucket"`
+	// MaxImageSize is the largest accepted image upload in bytes
+	MaxImageSize int64 `envconfig:"max_image_size" default:"5242880"`
+	// MaxImagePixels guards against decompression bombs: small files that
+	// decode to huge images
+	MaxImagePixels   int `envconfig:"max_image_pixels" default:"40000000"`
+	MaxProductImages int `envconfig:"max_product_images" default:"10"`
+
+	// IdempotencyKeyTTL is how long the response to a request made with an
+	// Idempotency-Key is replayed. IdempotencyLockTimeout is how long a retry
+	// waits for the first request before it may run itself, e.g. after a crash.
+	IdempotencyKeyTTL      time.Duration `envconfig:"idempotency_key_ttl" default:"24h"`
+	IdempotencyLockTimeout time.Duration `envconfig:"idempotency_lock_timeout" default:"1m"`
+
+	// CartTTL is how long a cart is kept after it was last changed. Guests are
+	// identified by a token in the CartCookieName cookie, which is only sent
+	// over HTTPS when CartCookieSecure is set.
+	CartTTL          time.Duration `envconfig:"cart_ttl" default:"720h"`
+	CartCookieName   string        `envconfig:"cart_cookie_name" default:"cart_token"`
+	CartCookieSecure bool          `envconfig:"cart_cookie_secure"`
+
+	// PaymentProvider is "fake", a deterministic provider for local development
+	// that moves no money, or "disabled"; in prod "fake" disables payments.
+	// PaymentCurrency is the ISO 4217 code prices are in.
+	PaymentProvider string `envconfig:"payment_provider" default:"fake"`
+	PaymentCurrency string `envconfig:"payment_currency" default:"NGN"`
+
+	// ImportMaxRows caps the rows of a product import file
+	ImportMaxRows int `envconfig:"import_max_rows" default:"10000"`
+
+	// SearchIndex is "postgres" or "memory". The memory index is rebuilt from
+	// the products table on startup.
+	SearchIndex string `envconfig:"search_index" default:"postgres"`
+
+	// MFAIssuer is the account issuer shown in authenticator apps
+	MFAIssuer string `envconfig:"mfa_issuer" default:"E-Commerce API"`
+
+	// JWTSigningMethod is HS256 (signed with JWTSecret), RS256 or EdDSA
+	JWTSigningMethod  string `envconfig:"jwt_signing_method" default:"HS256"`
+	JWTPrivateKeyFile string `envconfig:"jwt_private_key_file"`
+	// JWTPublicKeyFiles are extra PEM keys tokens are still accepted from, e.g. the previous key after a rotation
+	JWTPublicKeyFiles []string `envconfig:"jwt_public_key_files"`
+	JWTIssuer         string   `envconfig:"jwt_issuer" default:"ecommerce-api"`
+	JWTAudience       string   `envconfig:"jwt_audience" default:"ecommerce-api"`
 }
 
 func Load() (*Config, error) {
@@ -20,6 +20,27 @@ type AuthRepository interface {
 	IsEmailExist(email string) error
 	FindUserByEmail(email string) (*models.User, error)
 	FindRoleByID(roleID uuid.UUID) (*models.Role, error)
+	CreateRefreshToken(token *models.RefreshToken) error
+	FindRefreshTokenByTokenID(tokenID string) (*models.RefreshToken, error)
+	MarkRefreshTokenUsed(tokenID string, usedAt int64) (bool, error)
+	RevokeRefreshTokenFamily(familyID string, revokedAt int64) error
+	RevokeUserRefreshTokens(userID uint, revokedAt int64) error
+	AddToBlacklist(entry *models.Blacklist) error
+	IncrementTokenVersion(userID uint) error
+	DeleteExpiredBlacklist(now int64) (int64, error)
+	DeleteExpiredRefreshTokens(now int64) (int64, error)
+	SetEmailActive(userID uint) error
+	SetVerificationSentAt(userID uint, sentAt int64) error
+	UpdateUserPassword(userID uint, hashedPassword string) error
+	CreatePasswordReset(reset *models.PasswordReset) error
+	FindPasswordResetByTokenHash(tokenHash string) (*models.PasswordReset, error)
+	MarkPasswordResetUsed(id uint, usedAt int64) (bool, error)
+	InvalidatePasswordResets(userID uint, usedAt int64) error
+	UpdateUser(userID uint, fields map[string]interface{}) error
+	IsUserFieldTaken(column string, value string, excludeUserID uint) (bool, error)
+	MarkMFAStepUsed(userID uint, step int64) (bool, error)
+	ReplaceRecoveryCodes(userID uint, codeHashes []string) error
+	UseRecoveryCode(userID uint, codeHash string, usedAt int64) (bool, error)
 }
 
 type authRepo struct {
@@ -102,7 +123,7 @@ func (a *authRepo) FindUserByEmail(email string) (*models.User, error) {
 	err := a.DB.Where("email = ?", email).First(&user).Error
 	if err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
-			return nil, fmt.Errorf("user not found")
+			return nil, fmt.Errorf("user not found: %w", err)
 		}
 		return nil, fmt.Errorf("error finding user by email: %w", err)
 	}
@@ -115,4 +136,177 @@ func (r *authRepo) FindRoleByID(roleID uuid.UUID) (*models.Role, error) {
         return nil, err
     }
     return role, nil
-}
\ No newline at end of file
+}
+
+func (a *authRepo) CreateRefreshToken(token *models.RefreshToken) error {
+	return a.DB.Create(token).Error
+}
+
+func (a *authRepo) FindRefreshTokenByTokenID(tokenID string) (*models.RefreshToken, error) {
+	var token models.RefreshToken
+	if err := a.DB.Where("token_id = ?", tokenID).First(&token).Error; err != nil {
+		return nil, err
+	}
+	return &token, nil
+}
+
+// MarkRefreshTokenUsed flags a refresh token as used. It reports false when the
+// token had already been used or revoked, so concurrent refreshes with the same
+// token cannot both succeed.
+func (a *authRepo) MarkRefreshTokenUsed(tokenID string, usedAt int64) (bool, error) {
+	result := a.DB.Model(&models.RefreshToken{}).
+		Where("token_id = ? AND used_at = 0 AND revoked_at = 0", tokenID).
+		Update("used_at", usedAt)
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected == 1, nil
+}
+
+func (a *authRepo) RevokeRefreshTokenFamily(familyID string, revokedAt int64) error {
+	return a.DB.Model(&models.RefreshToken{}).
+		Where("family_id = ? AND revoked_at = 0", familyID).
+		Update("revoked_at", revokedAt).Error
+}
+
+func (a *authRepo) RevokeUserRefreshTokens(userID uint, revokedAt int64) error {
+	return a.DB.Model(&models.RefreshToken{}).
+		Where("user_id = ? AND revoked_at = 0", userID).
+		Update("revoked_at", revokedAt).Error
+}
+
+func (a *authRepo) AddToBlacklist(entry *models.Blacklist) error {
+	entry.Token = normalizeToken(entry.Token)
+	return a.DB.Create(entry).Error
+}
+
+// IncrementTokenVersion invalidates every token issued to the user so far
+func (a *authRepo) IncrementTokenVersion(userID uint) error {
+	result := a.DB.Model(&models.User{}).Where("id = ?", userID).
+		Update("token_version", gorm.Expr("token_version + 1"))
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+// DeleteExpiredBlacklist removes blacklist entries for tokens that have expired
+// and would be rejected anyway
+func (a *authRepo) DeleteExpiredBlacklist(now int64) (int64, error) {
+	result := a.DB.Where("expires_at < ?", now).Delete(&models.Blacklist{})
+	return result.RowsAffected, result.Error
+}
+
+func (a *authRepo) DeleteExpiredRefreshTokens(now int64) (int64, error) {
+	result := a.DB.Where("expires_at < ?", now).Delete(&models.RefreshToken{})
+	return result.RowsAffected, result.Error
+}
+
+func (a *authRepo) SetEmailActive(userID uint) error {
+	return a.DB.Model(&models.User{}).Where("id = ?", userID).Update("is_email_active", true).Error
+}
+
+func (a *authRepo) SetVerificationSentAt(userID uint, sentAt int64) error {
+	return a.DB.Model(&models.User{}).Where("id = ?", userID).Update("verification_sent_at", sentAt).Error
+}
+
+func (a *authRepo) UpdateUserPassword(userID uint, hashedPassword string) error {
+	return a.DB.Model(&models.User{}).Where("id = ?", userID).Update("hashed_password", hashedPassword).Error
+}
+
+func (a *authRepo) CreatePasswordReset(reset *models.PasswordReset) error {
+	return a.DB.Create(reset).Error
+}
+
+func (a *authRepo) FindPasswordResetByTokenHash(tokenHash string) (*models.PasswordReset, error) {
+	var reset models.PasswordReset
+	if err := a.DB.Where("token_hash = ?", tokenHash).First(&reset).Error; err != nil {
+		return nil, err
+	}
+	return &reset, nil
+}
+
+// MarkPasswordResetUsed consumes a reset token, reporting false if it was
+// already used
+func (a *authRepo) MarkPasswordResetUsed(id uint, usedAt int64) (bool, error) {
+	result := a.DB.Model(&models.PasswordReset{}).
+		Where("id = ? AND used_at = 0", id).
+		Update("used_at", usedAt)
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected == 1, nil
+}
+
+// InvalidatePasswordResets consumes every outstanding reset token of the user
+func (a *authRepo) InvalidatePasswordResets(userID uint, usedAt int64) error {
+	return a.DB.Model(&models.PasswordReset{}).
+		Where("user_id = ? AND used_at = 0", userID).
+		Update("used_at", usedAt).Error
+}
+
+func (a *authRepo) UpdateUser(userID uint, fields map[string]interface{}) error {
+	return a.DB.Model(&models.User{}).Where("id = ?", userID).Updates(fields).Error
+}
+
+// IsUserFieldTaken reports whether another user already has value in column.
+// column must be one of the user's unique columns.
+func (a *authRepo) IsUserFieldTaken(column string, value string, excludeUserID uint) (bool, error) {
+	switch column {
+	case "email", "telephone", "username":
+	default:
+		return false, fmt.Errorf("unsupported unique column %q", column)
+	}
+
+	var count int64
+	err := a.DB.Model(&models.User{}).
+		Where(column+" = ? AND id <> ?", value, excludeUserID).
+		Count(&count).Error
+	if err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
+// MarkMFAStepUsed records the TOTP time step of an accepted code. It reports
+// false if that step or a later one was already used, so a code cannot be replayed.
+func (a *authRepo) MarkMFAStepUsed(userID uint, step int64) (bool, error) {
+	result := a.DB.Model(&models.User{}).
+		Where("id = ? AND mfa_last_used_step < ?", userID, step).
+		Update("mfa_last_used_step", step)
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected == 1, nil
+}
+
+// ReplaceRecoveryCodes deletes the user's recovery codes and stores new ones
+func (a *authRepo) ReplaceRecoveryCodes(userID uint, codeHashes []string) error {
+	return a.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("user_id = ?", userID).Delete(&models.MFARecoveryCode{}).Error; err != nil {
+			return err
+		}
+		if len(codeHashes) == 0 {
+			return nil
+		}
+		codes := make([]models.MFARecoveryCode, 0, len(codeHashes))
+		for _, hash := range codeHashes {
+			codes = append(codes, models.MFARecoveryCode{UserID: userID, CodeHash: hash})
+		}
+		return tx.Create(&codes).Error
+	})
+}
+
+// UseRecoveryCode consumes an unused recovery code, reporting false if there is none
+func (a *authRepo) UseRecoveryCode(userID uint, codeHash string, usedAt int64) (bool, error) {
+	result := a.DB.Model(&models.MFARecoveryCode{}).
+		Where("user_id = ? AND code_hash = ? AND used_at = 0", userID, codeHash).
+		Update("used_at", usedAt)
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected == 1, nil
+}
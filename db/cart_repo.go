@@ -0,0 +1,242 @@
+package db
+
+import (
+	"errors"
+
+	"github.com/techagentng/ecommerce-api/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// CartRepository stores user and guest carts. Changes to a cart's lines lock
+// the cart row, so concurrent requests on one cart apply one after the other,
+// and push the cart's expiry back.
+type CartRepository interface {
+	FindCartByUserID(userID uint) (*models.Cart, error)
+	FindCartByTokenHash(tokenHash string) (*models.Cart, error)
+	CreateCart(cart *models.Cart) (*models.Cart, error)
+	AddCartItem(cartID uint, item *models.CartItem, expiresAt int64) error
+	UpdateCartItemQuantity(cartID uint, itemID uint, quantity int, expiresAt int64) error
+	DeleteCartItem(cartID uint, itemID uint, expiresAt int64) error
+	MergeCarts(fromCartID uint, intoCartID uint, expiresAt int64) error
+	ClearCart(cartID uint) error
+	RemoveOrderedItems(cartID uint, ordered []models.CartItem, expiresAt int64) error
+	DeleteExpiredCarts(now int64) (int64, error)
+}
+
+type cartRepo struct {
+	DB *gorm.DB
+}
+
+// NewCartRepo creates a new instance of CartRepository
+func NewCartRepo(db *GormDB) CartRepository {
+	return &cartRepo{db.DB}
+}
+
+// FindCartByUserID returns the user's cart with its lines, nil if the user has none
+func (r *cartRepo) FindCartByUserID(userID uint) (*models.Cart, error) {
+	return r.findCart(r.DB.Where("user_id = ?", userID))
+}
+
+// FindCartByTokenHash returns the guest cart with the token hash and its
+// lines, nil if there is none
+func (r *cartRepo) FindCartByTokenHash(tokenHash string) (*models.Cart, error) {
+	return r.findCart(r.DB.Where("token_hash = ?", tokenHash))
+}
+
+func (r *cartRepo) findCart(query *gorm.DB) (*models.Cart, error) {
+	var cart models.Cart
+	if err := query.Preload("Items", cartItemsInOrder).First(&cart).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &cart, nil
+}
+
+// CreateCart saves a new empty cart for its user or token hash. When a
+// concurrent request created the owner's cart first, that cart is returned.
+func (r *cartRepo) CreateCart(cart *models.Cart) (*models.Cart, error) {
+	result := r.DB.Clauses(clause.OnConflict{DoNothing: true}).Create(cart)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 1 {
+		return cart, nil
+	}
+	var existing *models.Cart
+	var err error
+	if cart.UserID != nil {
+		existing, err = r.FindCartByUserID(*cart.UserID)
+	} else {
+		existing, err = r.FindCartByTokenHash(*cart.TokenHash)
+	}
+	if err == nil && existing == nil {
+		err = gorm.ErrRecordNotFound
+	}
+	return existing, err
+}
+
+// AddCartItem adds the item's quantity to the cart's line of the same product
+// and variant, or adds the item as a new line. It returns
+// gorm.ErrRecordNotFound when the cart is gone.
+func (r *cartRepo) AddCartItem(cartID uint, item *models.CartItem, expiresAt int64) error {
+	return r.DB.Transaction(func(tx *gorm.DB) error {
+		if err := lockCart(tx, cartID, expiresAt); err != nil {
+			return err
+		}
+		item.CartID = cartID
+		return addCartLine(tx, item)
+	})
+}
+
+// UpdateCartItemQuantity sets the quantity of a line of the cart. It returns
+// gorm.ErrRecordNotFound when the cart or the line is gone.
+func (r *cartRepo) UpdateCartItemQuantity(cartID uint, itemID uint, quantity int, expiresAt int64) error {
+	return r.DB.Transaction(func(tx *gorm.DB) error {
+		if err := lockCart(tx, cartID, expiresAt); err != nil {
+			return err
+		}
+		result := tx.Model(&models.CartItem{}).
+			Where("id = ? AND cart_id = ?", itemID, cartID).
+			Update("quantity", quantity)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+		return nil
+	})
+}
+
+// DeleteCartItem removes a line from the cart. It returns
+// gorm.ErrRecordNotFound when the cart or the line is gone.
+func (r *cartRepo) DeleteCartItem(cartID uint, itemID uint, expiresAt int64) error {
+	return r.DB.Transaction(func(tx *gorm.DB) error {
+		if err := lockCart(tx, cartID, expiresAt); err != nil {
+			return err
+		}
+		result := tx.Where("id = ? AND cart_id = ?", itemID, cartID).Delete(&models.CartItem{})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+		return nil
+	})
+}
+
+// MergeCarts adds every line of one cart to another, as AddCartItem would,
+// and deletes the emptied cart
+func (r *cartRepo) MergeCarts(fromCartID uint, intoCartID uint, expiresAt int64) error {
+	return r.DB.Transaction(func(tx *gorm.DB) error {
+		if err := lockCart(tx, intoCartID, expiresAt); err != nil {
+			return err
+		}
+		var items []models.CartItem
+		if err := cartItemsInOrder(tx.Where("cart_id = ?", fromCartID)).Find(&items).Error; err != nil {
+			return err
+		}
+		for i := range items {
+			item := models.CartItem{
+				CartID:         intoCartID,
+				ProductID:      items[i].ProductID,
+				VariantID:      items[i].VariantID,
+				Quantity:       items[i].Quantity,
+				AddedUnitPrice: items[i].AddedUnitPrice,
+			}
+			if err := addCartLine(tx, &item); err != nil {
+				return err
+			}
+		}
+		if err := tx.Where("cart_id = ?", fromCartID).Delete(&models.CartItem{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&models.Cart{}, fromCartID).Error
+	})
+}
+
+// ClearCart removes every line of the cart
+func (r *cartRepo) ClearCart(cartID uint) error {
+	return r.DB.Where("cart_id = ?", cartID).Delete(&models.CartItem{}).Error
+}
+
+// RemoveOrderedItems takes the lines of a checkout out of the cart. Lines
+// added while the order was placed stay, and a line whose quantity grew since
+// keeps the difference.
+func (r *cartRepo) RemoveOrderedItems(cartID uint, ordered []models.CartItem, expiresAt int64) error {
+	return r.DB.Transaction(func(tx *gorm.DB) error {
+		if err := lockCart(tx, cartID, expiresAt); err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return nil
+			}
+			return err
+		}
+		for _, item := range ordered {
+			err := tx.Model(&models.CartItem{}).
+				Where("id = ? AND cart_id = ? AND quantity > ?", item.ID, cartID, item.Quantity).
+				Update("quantity", gorm.Expr("quantity - ?", item.Quantity)).Error
+			if err != nil {
+				return err
+			}
+			err = tx.Where("id = ? AND cart_id = ? AND quantity <= ?", item.ID, cartID, item.Quantity).
+				Delete(&models.CartItem{}).Error
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// DeleteExpiredCarts deletes the carts that expired before now with their lines
+func (r *cartRepo) DeleteExpiredCarts(now int64) (int64, error) {
+	var deleted int64
+	err := r.DB.Transaction(func(tx *gorm.DB) error {
+		expired := tx.Model(&models.Cart{}).Select("id").Where("expires_at < ?", now)
+		if err := tx.Where("cart_id IN (?)", expired).Delete(&models.CartItem{}).Error; err != nil {
+			return err
+		}
+		result := tx.Where("expires_at < ?", now).Delete(&models.Cart{})
+		deleted = result.RowsAffected
+		return result.Error
+	})
+	return deleted, err
+}
+
+// lockCart locks the cart row for the rest of the transaction and pushes its
+// expiry back to expiresAt
+func lockCart(tx *gorm.DB, cartID uint, expiresAt int64) error {
+	var cart models.Cart
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Select("id").First(&cart, cartID).Error; err != nil {
+		return err
+	}
+	return tx.Model(&cart).Update("expires_at", expiresAt).Error
+}
+
+// addCartLine adds the item's quantity to the cart's line of the same product
+// and variant, or creates the item as a new line. The cart must be locked.
+func addCartLine(tx *gorm.DB, item *models.CartItem) error {
+	line := tx.Model(&models.CartItem{}).Where("cart_id = ? AND product_id = ?", item.CartID, item.ProductID)
+	if item.VariantID != nil {
+		line = line.Where("variant_id = ?", *item.VariantID)
+	} else {
+		line = line.Where("variant_id IS NULL")
+	}
+	result := line.Update("quantity", gorm.Expr("quantity + ?", item.Quantity))
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected > 0 {
+		return nil
+	}
+	return tx.Create(item).Error
+}
+
+// cartItemsInOrder preloads a cart's lines in the order they were added
+func cartItemsInOrder(tx *gorm.DB) *gorm.DB {
+	return tx.Order("id")
+}
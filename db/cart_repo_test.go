@@ -0,0 +1,60 @@
+package db
+
+import (
+	"testing"
+	"time"
+
+	"github.com/techagentng/ecommerce-api/models"
+)
+
+func TestRemoveOrderedItemsKeepsLinesAddedDuringCheckout(t *testing.T) {
+	gormDB := openTestDB(t)
+	repo := NewCartRepo(gormDB)
+	user := createTestUser(t, gormDB)
+	mug := createTestProduct(t, gormDB, 10)
+	hat := createTestProduct(t, gormDB, 10)
+	scarf := createTestProduct(t, gormDB, 10)
+	expiresAt := time.Now().Add(time.Hour).Unix()
+
+	cart, err := repo.CreateCart(&models.Cart{UserID: &user.ID, ExpiresAt: expiresAt})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, item := range []*models.CartItem{
+		{ProductID: mug.ID, Quantity: 2},
+		{ProductID: hat.ID, Quantity: 1},
+	} {
+		if err := repo.AddCartItem(cart.ID, item, expiresAt); err != nil {
+			t.Fatal(err)
+		}
+	}
+	checkedOut, err := repo.FindCartByUserID(user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// While the order is placed, one more mug and a scarf are added
+	for _, item := range []*models.CartItem{
+		{ProductID: mug.ID, Quantity: 1},
+		{ProductID: scarf.ID, Quantity: 3},
+	} {
+		if err := repo.AddCartItem(cart.ID, item, expiresAt); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := repo.RemoveOrderedItems(cart.ID, checkedOut.Items, expiresAt); err != nil {
+		t.Fatal(err)
+	}
+	remaining, err := repo.FindCartByUserID(user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	quantities := map[uint]int{}
+	for _, item := range remaining.Items {
+		quantities[item.ProductID] = item.Quantity
+	}
+	if len(quantities) != 2 || quantities[mug.ID] != 1 || quantities[scarf.ID] != 3 {
+		t.Errorf("got cart lines %v, want 1 mug and 3 scarves", quantities)
+	}
+}
@@ -0,0 +1,213 @@
+package db
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/techagentng/ecommerce-api/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ErrCategoryCycle is returned when a category would move below itself or one
+// of its descendants
+var ErrCategoryCycle = errors.New("a category cannot be moved below itself")
+
+// ErrParentCategoryNotFound is returned when a category would be created or
+// moved below a category that does not exist
+var ErrParentCategoryNotFound = errors.New("parent category not found")
+
+// CategoryRepository defines the methods for category database operations
+type CategoryRepository interface {
+	CreateCategory(category *models.Category) (*models.Category, error)
+	FindCategoryByID(id uint) (*models.Category, error)
+	FindCategoriesByIDs(ids []uint) ([]models.Category, error)
+	ListCategories() ([]models.Category, error)
+	IsSlugTaken(slug string, excludeID uint) (bool, error)
+	UpdateCategory(category *models.Category, move bool) error
+	DeleteCategory(categoryID uint) (*models.Category, error)
+	SetProductCategories(product *models.Product, categories []models.Category) error
+}
+
+type categoryRepo struct {
+	DB *gorm.DB
+}
+
+// NewCategoryRepo creates a new instance of CategoryRepository
+func NewCategoryRepo(db *GormDB) CategoryRepository {
+	return &categoryRepo{db.DB}
+}
+
+// CreateCategory inserts a category below category.ParentID, or as a root when
+// that is nil, and sets its path once its ID is known. The parent is locked and
+// re-read first, so it cannot be moved or deleted while the child is added.
+func (r *categoryRepo) CreateCategory(category *models.Category) (*models.Category, error) {
+	err := r.DB.Transaction(func(tx *gorm.DB) error {
+		parentPath := "/"
+		if category.ParentID != nil {
+			locked, err := lockCategories(tx, []uint{*category.ParentID})
+			if err != nil {
+				return err
+			}
+			parent, ok := locked[*category.ParentID]
+			if !ok {
+				return ErrParentCategoryNotFound
+			}
+			parentPath = parent.Path
+		}
+		category.Path = parentPath
+		if err := tx.Create(category).Error; err != nil {
+			return err
+		}
+		category.Path = fmt.Sprintf("%s%d/", parentPath, category.ID)
+		return tx.Model(category).Update("path", category.Path).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return category, nil
+}
+
+func (r *categoryRepo) FindCategoryByID(id uint) (*models.Category, error) {
+	var category models.Category
+	if err := r.DB.First(&category, id).Error; err != nil {
+		return nil, err
+	}
+	return &category, nil
+}
+
+func (r *categoryRepo) FindCategoriesByIDs(ids []uint) ([]models.Category, error) {
+	var categories []models.Category
+	if len(ids) == 0 {
+		return categories, nil
+	}
+	err := r.DB.Where("id IN ?", ids).Find(&categories).Error
+	return categories, err
+}
+
+// ListCategories returns every category ordered so parents come before their children
+func (r *categoryRepo) ListCategories() ([]models.Category, error) {
+	var categories []models.Category
+	err := r.DB.Order("path").Find(&categories).Error
+	return categories, err
+}
+
+func (r *categoryRepo) IsSlugTaken(slug string, excludeID uint) (bool, error) {
+	var count int64
+	err := r.DB.Model(&models.Category{}).
+		Where("slug = ? AND id <> ?", slug, excludeID).
+		Count(&count).Error
+	return count > 0, err
+}
+
+// UpdateCategory saves the category's name and slug. With move set it also
+// moves the category below category.ParentID, or to the root when that is nil,
+// and rewrites the paths of its whole subtree. The category and its new parent
+// are locked and re-read first, so concurrent moves cannot form a cycle;
+// category.Path and category.ParentID are set from what was stored.
+func (r *categoryRepo) UpdateCategory(category *models.Category, move bool) error {
+	return r.DB.Transaction(func(tx *gorm.DB) error {
+		ids := []uint{category.ID}
+		if move && category.ParentID != nil {
+			ids = append(ids, *category.ParentID)
+		}
+		locked, err := lockCategories(tx, ids)
+		if err != nil {
+			return err
+		}
+		current, ok := locked[category.ID]
+		if !ok {
+			return gorm.ErrRecordNotFound
+		}
+
+		oldPath := current.Path
+		switch {
+		case !move:
+			category.ParentID = current.ParentID
+			category.Path = current.Path
+		case category.ParentID == nil:
+			category.Path = fmt.Sprintf("/%d/", category.ID)
+		default:
+			parent, ok := locked[*category.ParentID]
+			if !ok {
+				return ErrParentCategoryNotFound
+			}
+			if strings.HasPrefix(parent.Path, current.Path) {
+				return ErrCategoryCycle
+			}
+			category.Path = fmt.Sprintf("%s%d/", parent.Path, category.ID)
+		}
+
+		err = tx.Model(category).Select("name", "slug", "parent_id", "updated_at").Updates(category).Error
+		if err != nil {
+			return err
+		}
+		if category.Path == oldPath {
+			return nil
+		}
+		return rewriteSubtreePaths(tx, oldPath, category.Path)
+	})
+}
+
+// DeleteCategory removes the category and its product memberships. Its
+// children move up to its parent. The category is locked and re-read first so
+// its subtree is rewritten from its current path; the deleted category is
+// returned.
+func (r *categoryRepo) DeleteCategory(categoryID uint) (*models.Category, error) {
+	var category models.Category
+	err := r.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&category, categoryID).Error; err != nil {
+			return err
+		}
+		err := tx.Model(&models.Category{}).
+			Where("parent_id = ?", category.ID).
+			Update("parent_id", category.ParentID).Error
+		if err != nil {
+			return err
+		}
+		if err := tx.Exec("DELETE FROM product_categories WHERE category_id = ?", category.ID).Error; err != nil {
+			return err
+		}
+		if err := tx.Delete(&models.Category{}, category.ID).Error; err != nil {
+			return err
+		}
+		parentPath := category.Path[:len(category.Path)-len(fmt.Sprintf("%d/", category.ID))]
+		return rewriteSubtreePaths(tx, category.Path, parentPath)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &category, nil
+}
+
+// SetProductCategories replaces the categories the product belongs to
+func (r *categoryRepo) SetProductCategories(product *models.Product, categories []models.Category) error {
+	return r.DB.Model(product).Association("Categories").Replace(categories)
+}
+
+// lockCategories locks the categories with the IDs, in ID order so concurrent
+// moves do not deadlock, and returns those that exist by ID
+func lockCategories(tx *gorm.DB, ids []uint) (map[uint]models.Category, error) {
+	var categories []models.Category
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("id IN ?", ids).
+		Order("id").
+		Find(&categories).Error
+	if err != nil {
+		return nil, err
+	}
+	locked := make(map[uint]models.Category, len(categories))
+	for _, category := range categories {
+		locked[category.ID] = category
+	}
+	return locked, nil
+}
+
+// rewriteSubtreePaths replaces the oldPrefix of every path below it with newPrefix
+func rewriteSubtreePaths(tx *gorm.DB, oldPrefix string, newPrefix string) error {
+	return tx.Exec(
+		"UPDATE categories SET path = ? || substr(path, ?) WHERE path LIKE ?",
+		newPrefix, len(oldPrefix)+1, oldPrefix+"%",
+	).Error
+}
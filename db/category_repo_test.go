@@ -0,0 +1,91 @@
+package db
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/techagentng/ecommerce-api/models"
+)
+
+func createTestCategory(t *testing.T, repo CategoryRepository, parentID *uint) *models.Category {
+	t.Helper()
+	slug := "test-" + uuid.NewString()
+	category, err := repo.CreateCategory(&models.Category{Name: slug, Slug: slug, ParentID: parentID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return category
+}
+
+func TestCreateCategoryBelowMissingParent(t *testing.T) {
+	gormDB := openTestDB(t)
+	repo := NewCategoryRepo(gormDB)
+	parent := createTestCategory(t, repo, nil)
+	if _, err := repo.DeleteCategory(parent.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	slug := "test-" + uuid.NewString()
+	_, err := repo.CreateCategory(&models.Category{Name: slug, Slug: slug, ParentID: &parent.ID})
+	if !errors.Is(err, ErrParentCategoryNotFound) {
+		t.Fatalf("got %v, want ErrParentCategoryNotFound", err)
+	}
+}
+
+func TestCreateCategoryWhileParentIsMovedOrDeleted(t *testing.T) {
+	gormDB := openTestDB(t)
+	repo := NewCategoryRepo(gormDB)
+	root := createTestCategory(t, repo, nil)
+
+	for i := 0; i < 10; i++ {
+		parent := createTestCategory(t, repo, nil)
+		var child *models.Category
+		var createErr, changeErr error
+		var wg sync.WaitGroup
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			slug := "test-" + uuid.NewString()
+			child, createErr = repo.CreateCategory(&models.Category{Name: slug, Slug: slug, ParentID: &parent.ID})
+		}()
+		go func() {
+			defer wg.Done()
+			if i%2 == 0 {
+				_, changeErr = repo.DeleteCategory(parent.ID)
+				return
+			}
+			moved := *parent
+			moved.ParentID = &root.ID
+			changeErr = repo.UpdateCategory(&moved, true)
+		}()
+		wg.Wait()
+		if changeErr != nil {
+			t.Fatal(changeErr)
+		}
+		if errors.Is(createErr, ErrParentCategoryNotFound) {
+			continue
+		}
+		if createErr != nil {
+			t.Fatal(createErr)
+		}
+
+		stored, err := repo.FindCategoryByID(child.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		wantPath := fmt.Sprintf("/%d/", child.ID)
+		if stored.ParentID != nil {
+			storedParent, err := repo.FindCategoryByID(*stored.ParentID)
+			if err != nil {
+				t.Fatalf("child %d has a dangling parent %d: %v", child.ID, *stored.ParentID, err)
+			}
+			wantPath = fmt.Sprintf("%s%d/", storedParent.Path, child.ID)
+		}
+		if stored.Path != wantPath {
+			t.Errorf("child %d has path %s, want %s", child.ID, stored.Path, wantPath)
+		}
+	}
+}
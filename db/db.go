@@ -3,6 +3,7 @@ package db
 import (
 	"fmt"
 	"log"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/techagentng/ecommerce-api/config"
@@ -28,6 +29,10 @@ func (g *GormDB) Init(c *config.Config) {
 	if err := migrate(g.DB); err != nil {
 		log.Fatalf("unable to run migrations: %v", err)
 	}
+
+	if err := SeedRoles(g.DB); err != nil {
+		log.Fatalf("unable to seed roles: %v", err)
+	}
 }
 
 func getPostgresDB(c *config.Config) *gorm.DB {
@@ -50,37 +55,365 @@ func getPostgresDB(c *config.Config) *gorm.DB {
 	return gormDB
 }
 
+// SeedRoles creates the default permissions and roles. Permissions and roles
+// are looked up by name, so running it again creates nothing new. The Admin
+// role is granted every default permission on each run so new permissions
+// reach existing admins.
 func SeedRoles(db *gorm.DB) error {
-	roles := []models.Role{
-		{ID: uuid.New(), Name: "Admin"},
-		{ID: uuid.New(), Name: "User"},
+	permissions := make([]models.Permission, 0, len(models.DefaultPermissions))
+	for _, permission := range models.DefaultPermissions {
+		err := db.Where("name = ?", permission.Name).
+			Attrs(models.Permission{ID: uuid.New(), Description: permission.Description}).
+			FirstOrCreate(&permission).Error
+		if err != nil {
+			return err
+		}
+		permissions = append(permissions, permission)
 	}
 
-	for _, role := range roles {
-		if err := db.FirstOrCreate(&role, models.Role{Name: role.Name}).Error; err != nil {
+	for _, name := range []string{models.RoleAdmin, models.RoleUser} {
+		role := models.Role{Name: name}
+		if err := db.Where("name = ?", name).Attrs(models.Role{ID: uuid.New()}).FirstOrCreate(&role).Error; err != nil {
 			return err
 		}
+		if role.Name == models.RoleAdmin {
+			if err := db.Model(&role).Association("Permissions").Append(permissions); err != nil {
+				return err
+			}
+		}
 	}
 
 	return nil
 }
 
+// migrateDuplicateRoles merges roles seeded more than once under the same
+// name, so the unique index on roles.name can be created. The role most users
+// have is kept; the others' users and permissions are moved to it.
+func migrateDuplicateRoles(db *gorm.DB) error {
+	if !db.Migrator().HasTable(&models.Role{}) {
+		return nil
+	}
+	var names []string
+	if err := db.Model(&models.Role{}).Group("name").Having("count(*) > 1").Pluck("name", &names).Error; err != nil {
+		return err
+	}
+	return db.Transaction(func(tx *gorm.DB) error {
+		for _, name := range names {
+			var ids []uuid.UUID
+			err := tx.Raw(`SELECT r.id FROM roles r
+				WHERE r.name = ?
+				ORDER BY (SELECT count(*) FROM users u WHERE u.role_id = r.id) DESC, r.id`, name).
+				Scan(&ids).Error
+			if err != nil {
+				return err
+			}
+			keep, duplicates := ids[0], ids[1:]
+			statements := []struct {
+				sql  string
+				args []interface{}
+			}{
+				{`UPDATE users SET role_id = ? WHERE role_id IN ?`, []interface{}{keep, duplicates}},
+				{`INSERT INTO role_permissions (role_id, permission_id)
+					SELECT DISTINCT ?::uuid, permission_id FROM role_permissions WHERE role_id IN ?
+					ON CONFLICT DO NOTHING`, []interface{}{keep, duplicates}},
+				{`UPDATE roles SET require_mfa = true WHERE id = ? AND EXISTS
+					(SELECT 1 FROM roles WHERE id IN ? AND require_mfa)`, []interface{}{keep, duplicates}},
+				{`DELETE FROM role_permissions WHERE role_id IN ?`, []interface{}{duplicates}},
+				{`DELETE FROM roles WHERE id IN ?`, []interface{}{duplicates}},
+			}
+			for _, statement := range statements {
+				if err := tx.Exec(statement.sql, statement.args...).Error; err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+}
+
 func migrate(db *gorm.DB) error {
 		if err := db.Exec(`CREATE EXTENSION IF NOT EXISTS "uuid-ossp";`).Error; err != nil {
 			return fmt.Errorf("failed to create uuid-ossp extension: %v", err)
 		}
+	if err := migrateDuplicateRoles(db); err != nil {
+		return fmt.Errorf("duplicate roles migration error: %v", err)
+	}
+	if err := migrateOrderItemColumn(db); err != nil {
+		return fmt.Errorf("order items migration error: %v", err)
+	}
 	// AutoMigrate all the models
 	err := db.AutoMigrate(
 		&models.User{},
 		&models.Blacklist{},
+		&models.RefreshToken{},
+		&models.PasswordReset{},
+		&models.AdminAuditLog{},
+		&models.LoginAttempt{},
+		&models.MFARecoveryCode{},
 		&models.Role{},
+		&models.Permission{},
+		&models.Category{},
 		&models.Product{},
+		&models.ProductOption{},
+		&models.ProductOptionValue{},
+		&models.ProductVariant{},
+		&models.ProductImage{},
 		&models.Order{},
 		&models.OrderItem{},
+		&models.OrderStatusEvent{},
+		&models.StockMovement{},
+		&models.IdempotencyKey{},
+		&models.Cart{},
+		&models.CartItem{},
+		&models.Payment{},
 	)
 	if err != nil {
 		return fmt.Errorf("migrations error: %v", err)
 	}
 
+	if err := migrateCategoryParents(db); err != nil {
+		return fmt.Errorf("category parents migration error: %v", err)
+	}
+
+	if err := migrateProductSearch(db); err != nil {
+		return fmt.Errorf("product search migration error: %v", err)
+	}
+
+	if err := migrateStockLedger(db); err != nil {
+		return fmt.Errorf("stock ledger migration error: %v", err)
+	}
+
+	if err := migrateOrderLines(db); err != nil {
+		return fmt.Errorf("order lines migration error: %v", err)
+	}
+
+	if err := migrateOrderStatuses(db); err != nil {
+		return fmt.Errorf("order status migration error: %v", err)
+	}
+
+	if err := migrateOrderTotals(db); err != nil {
+		return fmt.Errorf("order totals migration error: %v", err)
+	}
+
+	return nil
+}
+
+// migrateStockLedger opens the ledger of every product and variant that has
+// stock but no movements yet, so stock predating the ledger is accounted for
+func migrateStockLedger(db *gorm.DB) error {
+	statements := []string{
+		`INSERT INTO stock_movements (product_id, change, balance_after, reason, note, created_at)
+		SELECT p.id, p.stock, p.stock, '` + models.StockReasonOpening + `', 'stock before the ledger', extract(epoch from now())::bigint
+		FROM products p
+		WHERE p.stock <> 0 AND NOT EXISTS
+			(SELECT 1 FROM stock_movements m WHERE m.product_id = p.id AND m.variant_id IS NULL)`,
+		`INSERT INTO stock_movements (product_id, variant_id, change, balance_after, reason, note, created_at)
+		SELECT v.product_id, v.id, v.stock, v.stock, '` + models.StockReasonOpening + `', 'stock before the ledger', extract(epoch from now())::bigint
+		FROM product_variants v
+		WHERE v.stock <> 0 AND NOT EXISTS
+			(SELECT 1 FROM stock_movements m WHERE m.variant_id = v.id)`,
+	}
+	for _, statement := range statements {
+		if err := db.Exec(statement).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// migrateOrderItemColumn drops order_items.order_id when it was created as a
+// uuid, which cannot reference the integer order IDs. Lines were never written
+// to the table before it was fixed, so no data is lost; AutoMigrate adds the
+// column back with the right type.
+func migrateOrderItemColumn(db *gorm.DB) error {
+	return db.Exec(`DO $$ BEGIN
+		IF EXISTS (SELECT 1 FROM information_schema.columns
+			WHERE table_name = 'order_items' AND column_name = 'order_id' AND data_type = 'uuid') THEN
+			ALTER TABLE order_items DROP COLUMN order_id;
+		END IF;
+	END $$`).Error
+}
+
+// legacyOrderWindow is how far apart the orders a basket was split into can
+// have been created, all of them being written in one transaction
+const legacyOrderWindow = 2 * time.Second
+
+// legacyOrder is a row of the orders table from when an order was saved per
+// item, with the item held by the order itself
+type legacyOrder struct {
+	ID          uint
+	UserID      uint
+	ProductID   uint
+	VariantID   *uint
+	SKU         string
+	ProductName string
+	Quantity    int
+	TotalPrice  float64
+	Status      string
+	CreatedAt   time.Time
+}
+
+// migrateOrderLines folds the orders a basket was split into, one per item,
+// into a single order with a line per item, then drops the item columns from
+// the orders table. Orders of the same user and status created within
+// legacyOrderWindow of the first one are folded into that first order, and
+// their stock movements are moved to it. It runs once: the orders table no
+// longer has a product_id column afterwards.
+func migrateOrderLines(db *gorm.DB) error {
+	if !db.Migrator().HasColumn("orders", "product_id") {
+		return nil
+	}
+	return db.Transaction(func(tx *gorm.DB) error {
+		columns := "o.id, o.user_id, o.product_id, o.quantity, o.total_price, o.status, o.created_at, coalesce(p.name, '') AS product_name"
+		// Orders saved before variants were added have no variant columns
+		if tx.Migrator().HasColumn("orders", "variant_id") {
+			columns += ", o.variant_id, coalesce(o.sku, '') AS sku"
+		}
+		var orders []legacyOrder
+		err := tx.Raw(`SELECT ` + columns + ` FROM orders o
+			LEFT JOIN products p ON p.id = o.product_id
+			WHERE o.product_id IS NOT NULL
+			ORDER BY o.user_id, o.created_at, o.id`).
+			Scan(&orders).Error
+		if err != nil {
+			return err
+		}
+
+		var header *legacyOrder
+		var folded []uint
+		for i := range orders {
+			order := &orders[i]
+			if header == nil || order.UserID != header.UserID || order.Status != header.Status ||
+				order.CreatedAt.Sub(header.CreatedAt) > legacyOrderWindow {
+				header = order
+			} else {
+				folded = append(folded, order.ID)
+			}
+
+			item := models.OrderItem{
+				OrderID:    header.ID,
+				ProductID:  order.ProductID,
+				VariantID:  order.VariantID,
+				SKU:        order.SKU,
+				Name:       order.ProductName,
+				Quantity:   order.Quantity,
+				TotalPrice: order.TotalPrice,
+			}
+			if order.Quantity > 0 {
+				item.UnitPrice = order.TotalPrice / float64(order.Quantity)
+			}
+			if err := tx.Create(&item).Error; err != nil {
+				return err
+			}
+			if header != order {
+				if err := tx.Model(&models.StockMovement{}).Where("order_id = ?", order.ID).Update("order_id", header.ID).Error; err != nil {
+					return err
+				}
+			}
+		}
+
+		if len(folded) > 0 {
+			if err := tx.Exec("DELETE FROM orders WHERE id IN ?", folded).Error; err != nil {
+				return err
+			}
+		}
+		statements := []string{
+			`UPDATE orders SET total_price = (SELECT coalesce(sum(total_price), 0) FROM order_items WHERE order_items.order_id = orders.id)`,
+			`ALTER TABLE orders DROP COLUMN IF EXISTS product_id, DROP COLUMN IF EXISTS variant_id, DROP COLUMN IF EXISTS sku, DROP COLUMN IF EXISTS quantity`,
+		}
+		for _, statement := range statements {
+			if err := tx.Exec(statement).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// migrateOrderStatuses renames the statuses used before the order status
+// graph, Completed and the Cancelled spelling, and starts the status history
+// of orders that have none with their current status
+func migrateOrderStatuses(db *gorm.DB) error {
+	statements := []string{
+		`UPDATE orders SET status = '` + string(models.OrderStatusDelivered) + `' WHERE status = 'Completed'`,
+		`UPDATE orders SET status = '` + string(models.OrderStatusCanceled) + `' WHERE status = 'Cancelled'`,
+		`INSERT INTO order_status_events (order_id, from_status, to_status, actor_id, reason, created_at)
+		SELECT o.id, '', o.status, NULL, 'status before the history was recorded', o.updated_at
+		FROM orders o
+		WHERE NOT EXISTS (SELECT 1 FROM order_status_events e WHERE e.order_id = o.id)`,
+	}
+	for _, statement := range statements {
+		if err := db.Exec(statement).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// migrateOrderTotals recomputes the totals of unpaid orders in minor units, as
+// Order.CalculateTotals does, so what a customer is shown is what PayOrder
+// charges. Totals of orders already paid are left as they were charged.
+func migrateOrderTotals(db *gorm.DB) error {
+	statements := []string{
+		`UPDATE order_items SET total_price = round(unit_price * 100) * quantity / 100
+		WHERE order_id IN (SELECT id FROM orders WHERE status = '` + string(models.OrderStatusPending) + `')`,
+		`UPDATE orders SET total_price = (SELECT coalesce(sum(round(unit_price * 100) * quantity), 0) / 100
+			FROM order_items WHERE order_items.order_id = orders.id)
+		WHERE status = '` + string(models.OrderStatusPending) + `'`,
+	}
+	for _, statement := range statements {
+		if err := db.Exec(statement).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// migrateCategoryParents adds the foreign key from categories.parent_id to the
+// parent category. Categories left below a deleted parent before the key
+// existed become roots first, with their subtrees' paths rewritten.
+func migrateCategoryParents(db *gorm.DB) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		var constraints int64
+		err := tx.Raw(`SELECT count(*) FROM pg_constraint WHERE conname = 'fk_categories_parent'`).
+			Scan(&constraints).Error
+		if err != nil || constraints > 0 {
+			return err
+		}
+
+		var orphans []models.Category
+		err = tx.Where("parent_id IS NOT NULL AND parent_id NOT IN (SELECT id FROM categories)").
+			Find(&orphans).Error
+		if err != nil {
+			return err
+		}
+		for _, orphan := range orphans {
+			if err := tx.Model(&orphan).Update("parent_id", nil).Error; err != nil {
+				return err
+			}
+			if err := rewriteSubtreePaths(tx, orphan.Path, fmt.Sprintf("/%d/", orphan.ID)); err != nil {
+				return err
+			}
+		}
+		return tx.Exec(`ALTER TABLE categories ADD CONSTRAINT fk_categories_parent
+			FOREIGN KEY (parent_id) REFERENCES categories (id)`).Error
+	})
+}
+
+// migrateProductSearch adds the columns and indexes the Postgres SearchIndex
+// needs and fills in the search vector of products that have none
+func migrateProductSearch(db *gorm.DB) error {
+	statements := []string{
+		`CREATE EXTENSION IF NOT EXISTS pg_trgm`,
+		`ALTER TABLE products ADD COLUMN IF NOT EXISTS search_vector tsvector`,
+		`CREATE INDEX IF NOT EXISTS idx_products_search_vector ON products USING GIN (search_vector)`,
+		`CREATE INDEX IF NOT EXISTS idx_products_name_trgm ON products USING GIN (name gin_trgm_ops)`,
+		`UPDATE products SET search_vector = ` + searchVectorSQL + ` WHERE search_vector IS NULL`,
+	}
+	for _, statement := range statements {
+		if err := db.Exec(statement).Error; err != nil {
+			return err
+		}
+	}
 	return nil
 }
@@ -0,0 +1,128 @@
+package db
+
+import (
+	"fmt"
+	"os"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/techagentng/ecommerce-api/models"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// testDatabaseURLEnv names the Postgres DSN the database tests run against,
+// e.g. "host=localhost user=postgres password=postgres dbname=ecommerce_test".
+// The tests are skipped without it. They create their own rows and leave
+// them behind, so use a database meant for tests.
+const testDatabaseURLEnv = "ECOMM_TEST_DATABASE_URL"
+
+func openTestDB(t *testing.T) *GormDB {
+	t.Helper()
+	dsn := os.Getenv(testDatabaseURLEnv)
+	if dsn == "" {
+		t.Skipf("%s is not set", testDatabaseURLEnv)
+	}
+	gormDB, err := gorm.Open(postgres.Open(dsn), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := migrate(gormDB); err != nil {
+		t.Fatalf("unable to run migrations: %v", err)
+	}
+	if err := SeedRoles(gormDB); err != nil {
+		t.Fatalf("unable to seed roles: %v", err)
+	}
+	return &GormDB{DB: gormDB}
+}
+
+func createTestUser(t *testing.T, gormDB *GormDB) *models.User {
+	t.Helper()
+	var role models.Role
+	if err := gormDB.DB.Where("name = ?", models.RoleUser).First(&role).Error; err != nil {
+		t.Fatal(err)
+	}
+	id := uuid.NewString()
+	user := &models.User{
+		Fullname:  "Test User",
+		Username:  "test-" + id,
+		Telephone: id,
+		Email:     id + "@example.com",
+		RoleID:    role.ID,
+	}
+	if err := gormDB.DB.Create(user).Error; err != nil {
+		t.Fatal(err)
+	}
+	return user
+}
+
+func createTestProduct(t *testing.T, gormDB *GormDB, stock int) *models.Product {
+	t.Helper()
+	product := &models.Product{Name: "Test product " + uuid.NewString(), Price: 10, Stock: stock}
+	if err := gormDB.DB.Create(product).Error; err != nil {
+		t.Fatal(err)
+	}
+	return product
+}
+
+func createTestVariant(t *testing.T, gormDB *GormDB, product *models.Product, stock int) *models.ProductVariant {
+	t.Helper()
+	variant := &models.ProductVariant{
+		ProductID: product.ID,
+		SKU:       "TEST-" + uuid.NewString(),
+		Stock:     stock,
+		OptionKey: fmt.Sprintf("test-%d", stock),
+	}
+	if err := gormDB.DB.Create(variant).Error; err != nil {
+		t.Fatal(err)
+	}
+	return variant
+}
+
+// testStock reads the stock of a product, or of its variant when variantID is set
+func testStock(t *testing.T, gormDB *GormDB, productID uint, variantID uint) int {
+	t.Helper()
+	line := stockLine{productID: productID, variantID: variantID}
+	var stocks []int
+	if err := stockItem(gormDB.DB, line).Pluck("stock", &stocks).Error; err != nil {
+		t.Fatal(err)
+	}
+	if len(stocks) != 1 {
+		t.Fatalf("product %d variant %d not found", productID, variantID)
+	}
+	return stocks[0]
+}
+
+func TestSeedRolesIsIdempotent(t *testing.T) {
+	gormDB := openTestDB(t)
+	// openTestDB seeded once already, as a previous boot would have
+	for i := 0; i < 2; i++ {
+		if err := SeedRoles(gormDB.DB); err != nil {
+			t.Fatalf("seeding again: %v", err)
+		}
+	}
+
+	for _, name := range []string{models.RoleAdmin, models.RoleUser} {
+		var count int64
+		if err := gormDB.DB.Model(&models.Role{}).Where("name = ?", name).Count(&count).Error; err != nil {
+			t.Fatal(err)
+		}
+		if count != 1 {
+			t.Errorf("%d %s roles, want 1", count, name)
+		}
+	}
+	var admin models.Role
+	if err := gormDB.DB.Preload("Permissions").Where("name = ?", models.RoleAdmin).First(&admin).Error; err != nil {
+		t.Fatal(err)
+	}
+	granted := map[string]bool{}
+	for _, permission := range admin.Permissions {
+		granted[permission.Name] = true
+	}
+	for _, permission := range models.DefaultPermissions {
+		if !granted[permission.Name] {
+			t.Errorf("the Admin role lacks %s", permission.Name)
+		}
+	}
+}
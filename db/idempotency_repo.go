@@ -0,0 +1,98 @@
+package db
+
+import (
+	"github.com/techagentng/ecommerce-api/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// IdempotencyRepository stores idempotency keys and the responses of the
+// requests made with them. The unique (user_id, key) index is the lock that
+// lets only one of several concurrent requests with a key run.
+type IdempotencyRepository interface {
+	AcquireIdempotencyKey(record *models.IdempotencyKey, now int64) (*models.IdempotencyKey, error)
+	SaveIdempotentResponse(record *models.IdempotencyKey) error
+	ReleaseIdempotencyKey(record *models.IdempotencyKey) error
+	DeleteExpiredIdempotencyKeys(now int64) (int64, error)
+}
+
+type idempotencyRepo struct {
+	DB *gorm.DB
+}
+
+// NewIdempotencyRepo creates a new instance of IdempotencyRepository
+func NewIdempotencyRepo(db *GormDB) IdempotencyRepository {
+	return &idempotencyRepo{db.DB}
+}
+
+// AcquireIdempotencyKey inserts the in-flight record, or takes over the
+// existing record of its key when that has expired or its lock has passed. It
+// returns nil when the caller now holds the key, and the existing record
+// otherwise.
+func (r *idempotencyRepo) AcquireIdempotencyKey(record *models.IdempotencyKey, now int64) (*models.IdempotencyKey, error) {
+	result := r.DB.Clauses(clause.OnConflict{DoNothing: true}).Create(record)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 1 {
+		return nil, nil
+	}
+
+	var existing models.IdempotencyKey
+	if err := r.DB.Where("user_id = ? AND key = ?", record.UserID, record.Key).First(&existing).Error; err != nil {
+		return nil, err
+	}
+	expired := existing.ExpiresAt < now
+	lockPassed := existing.StatusCode == 0 && existing.LockedUntil < now
+	if !expired && !lockPassed {
+		return &existing, nil
+	}
+
+	// Matching on the values just read lets only one request take the key over
+	result = r.DB.Model(&models.IdempotencyKey{}).
+		Where("id = ? AND status_code = ? AND locked_until = ? AND expires_at = ?",
+			existing.ID, existing.StatusCode, existing.LockedUntil, existing.ExpiresAt).
+		Updates(map[string]interface{}{
+			"request_hash":  record.RequestHash,
+			"status_code":   0,
+			"content_type":  "",
+			"response_body": nil,
+			"locked_until":  record.LockedUntil,
+			"expires_at":    record.ExpiresAt,
+			"created_at":    now,
+		})
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 1 {
+		record.ID = existing.ID
+		return nil, nil
+	}
+	if err := r.DB.First(&existing, existing.ID).Error; err != nil {
+		return nil, err
+	}
+	return &existing, nil
+}
+
+// SaveIdempotentResponse stores the response of a held key and releases its lock
+func (r *idempotencyRepo) SaveIdempotentResponse(record *models.IdempotencyKey) error {
+	return r.DB.Model(&models.IdempotencyKey{}).
+		Where("id = ?", record.ID).
+		Updates(map[string]interface{}{
+			"status_code":   record.StatusCode,
+			"content_type":  record.ContentType,
+			"response_body": record.ResponseBody,
+			"locked_until":  0,
+		}).Error
+}
+
+// ReleaseIdempotencyKey deletes a held key without a response, so the request
+// can be retried
+func (r *idempotencyRepo) ReleaseIdempotencyKey(record *models.IdempotencyKey) error {
+	return r.DB.Where("id = ? AND status_code = 0", record.ID).Delete(&models.IdempotencyKey{}).Error
+}
+
+func (r *idempotencyRepo) DeleteExpiredIdempotencyKeys(now int64) (int64, error) {
+	result := r.DB.Where("expires_at < ? AND (status_code <> 0 OR locked_until < ?)", now, now).Delete(&models.IdempotencyKey{})
+	return result.RowsAffected, result.Error
+}
@@ -0,0 +1,68 @@
+package db
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/techagentng/ecommerce-api/models"
+)
+
+// acquireConcurrently has n requests acquire the key at once and returns how
+// many got to hold it
+func acquireConcurrently(t *testing.T, repo IdempotencyRepository, userID uint, key string, n int) int {
+	t.Helper()
+	now := time.Now()
+	var mu sync.Mutex
+	held := 0
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			record := &models.IdempotencyKey{
+				UserID:      userID,
+				Key:         key,
+				RequestHash: "hash",
+				LockedUntil: now.Add(time.Minute).Unix(),
+				ExpiresAt:   now.Add(time.Hour).Unix(),
+				CreatedAt:   now.Unix(),
+			}
+			existing, err := repo.AcquireIdempotencyKey(record, now.Unix())
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			if existing == nil {
+				mu.Lock()
+				held++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	return held
+}
+
+func TestAcquireIdempotencyKeyConcurrently(t *testing.T) {
+	gormDB := openTestDB(t)
+	repo := NewIdempotencyRepo(gormDB)
+	user := createTestUser(t, gormDB)
+	key := uuid.NewString()
+
+	if held := acquireConcurrently(t, repo, user.ID, key, 10); held != 1 {
+		t.Errorf("%d requests hold the new key, want 1", held)
+	}
+
+	// The holder crashes: once its lock has passed, one request takes over
+	err := gormDB.DB.Model(&models.IdempotencyKey{}).
+		Where("user_id = ? AND key = ?", user.ID, key).
+		Update("locked_until", time.Now().Add(-time.Minute).Unix()).Error
+	if err != nil {
+		t.Fatal(err)
+	}
+	if held := acquireConcurrently(t, repo, user.ID, key, 10); held != 1 {
+		t.Errorf("%d requests took over the stale key, want 1", held)
+	}
+}
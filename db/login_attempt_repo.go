@@ -0,0 +1,152 @@
+package db
+
+import (
+	"errors"
+	"sync"
+
+	"github.com/techagentng/ecommerce-api/models"
+	"gorm.io/gorm"
+)
+
+// LoginAttemptStore persists failed login counters. The database store keeps
+// lockouts across restarts and shares them between instances; the memory store
+// is for single instance development.
+type LoginAttemptStore interface {
+	GetLoginAttempt(key string) (*models.LoginAttempt, error)
+	// IncrementLoginFailures atomically counts a failure at now and returns the
+	// updated record. Failures before windowStart are dropped first, and the
+	// record is kept at least until expiresAt.
+	IncrementLoginFailures(key string, now int64, windowStart int64, expiresAt int64) (*models.LoginAttempt, error)
+	// LockLoginAttempt locks key until lockedUntil unless it is already locked
+	// for longer
+	LockLoginAttempt(key string, lockedUntil int64) error
+	DeleteLoginAttempt(key string) error
+	DeleteExpiredLoginAttempts(now int64) (int64, error)
+}
+
+type loginAttemptRepo struct {
+	DB *gorm.DB
+}
+
+// NewLoginAttemptRepo creates a LoginAttemptStore backed by the database
+func NewLoginAttemptRepo(db *GormDB) LoginAttemptStore {
+	return &loginAttemptRepo{db.DB}
+}
+
+// GetLoginAttempt returns nil when there is no record for key
+func (l *loginAttemptRepo) GetLoginAttempt(key string) (*models.LoginAttempt, error) {
+	var attempt models.LoginAttempt
+	if err := l.DB.Where("key = ?", key).First(&attempt).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &attempt, nil
+}
+
+func (l *loginAttemptRepo) IncrementLoginFailures(key string, now int64, windowStart int64, expiresAt int64) (*models.LoginAttempt, error) {
+	var attempt models.LoginAttempt
+	err := l.DB.Raw(`INSERT INTO login_attempts (key, failures, last_failure_at, locked_until, expires_at)
+		VALUES (?, 1, ?, 0, ?)
+		ON CONFLICT (key) DO UPDATE SET
+			failures = CASE WHEN login_attempts.last_failure_at < ? THEN 1 ELSE login_attempts.failures + 1 END,
+			locked_until = CASE WHEN login_attempts.last_failure_at < ? THEN 0 ELSE login_attempts.locked_until END,
+			last_failure_at = EXCLUDED.last_failure_at,
+			expires_at = GREATEST(login_attempts.expires_at, EXCLUDED.expires_at)
+		RETURNING *`, key, now, expiresAt, windowStart, windowStart).Scan(&attempt).Error
+	if err != nil {
+		return nil, err
+	}
+	return &attempt, nil
+}
+
+func (l *loginAttemptRepo) LockLoginAttempt(key string, lockedUntil int64) error {
+	return l.DB.Model(&models.LoginAttempt{}).Where("key = ?", key).Updates(map[string]interface{}{
+		"locked_until": gorm.Expr("GREATEST(locked_until, ?)", lockedUntil),
+		"expires_at":   gorm.Expr("GREATEST(expires_at, ?)", lockedUntil),
+	}).Error
+}
+
+func (l *loginAttemptRepo) DeleteLoginAttempt(key string) error {
+	return l.DB.Where("key = ?", key).Delete(&models.LoginAttempt{}).Error
+}
+
+func (l *loginAttemptRepo) DeleteExpiredLoginAttempts(now int64) (int64, error) {
+	result := l.DB.Where("expires_at < ?", now).Delete(&models.LoginAttempt{})
+	return result.RowsAffected, result.Error
+}
+
+type memoryLoginAttemptStore struct {
+	mu       sync.Mutex
+	attempts map[string]models.LoginAttempt
+}
+
+// NewMemoryLoginAttemptStore creates a LoginAttemptStore that lives in process
+// memory. Lockouts are lost on restart.
+func NewMemoryLoginAttemptStore() LoginAttemptStore {
+	return &memoryLoginAttemptStore{attempts: map[string]models.LoginAttempt{}}
+}
+
+func (m *memoryLoginAttemptStore) GetLoginAttempt(key string) (*models.LoginAttempt, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	attempt, ok := m.attempts[key]
+	if !ok {
+		return nil, nil
+	}
+	return &attempt, nil
+}
+
+func (m *memoryLoginAttemptStore) IncrementLoginFailures(key string, now int64, windowStart int64, expiresAt int64) (*models.LoginAttempt, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	attempt, ok := m.attempts[key]
+	if !ok || attempt.LastFailureAt < windowStart {
+		attempt = models.LoginAttempt{Key: key}
+	}
+	attempt.Failures++
+	attempt.LastFailureAt = now
+	if expiresAt > attempt.ExpiresAt {
+		attempt.ExpiresAt = expiresAt
+	}
+	m.attempts[key] = attempt
+	return &attempt, nil
+}
+
+func (m *memoryLoginAttemptStore) LockLoginAttempt(key string, lockedUntil int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	attempt, ok := m.attempts[key]
+	if !ok {
+		return nil
+	}
+	if lockedUntil > attempt.LockedUntil {
+		attempt.LockedUntil = lockedUntil
+	}
+	if lockedUntil > attempt.ExpiresAt {
+		attempt.ExpiresAt = lockedUntil
+	}
+	m.attempts[key] = attempt
+	return nil
+}
+
+func (m *memoryLoginAttemptStore) DeleteLoginAttempt(key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.attempts, key)
+	return nil
+}
+
+func (m *memoryLoginAttemptStore) DeleteExpiredLoginAttempts(now int64) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var deleted int64
+	for key, attempt := range m.attempts {
+		if attempt.ExpiresAt < now {
+			delete(m.attempts, key)
+			deleted++
+		}
+	}
+	return deleted, nil
+}
@@ -2,8 +2,10 @@ package db
 
 import (
 	"errors"
+	"fmt"
 	"log"
 	"net/http"
+	"sort"
 
 	"github.com/google/uuid"
 	apiError "github.com/techagentng/ecommerce-api/errors"
@@ -12,13 +14,11 @@ import (
 )
 
 type OrderRepository interface {
-	CreateOrder(orderRequest *models.Order) ([]*models.Order, error)
-	FindOrderByID(id uuid.UUID) (*models.Order, error)
+	CreateOrder(order *models.Order) error
 	FindOrdersByUserID(userID uint) ([]*models.Order, error)
-	UpdateOrderStatus(id uint, status string) error
-	CancelOrder(id uint) error
+	TransitionOrderStatus(order *models.Order, to models.OrderStatus, actorID uint, reason string) error
+	ListOrderStatusEvents(orderID uint) ([]models.OrderStatusEvent, error)
 	UpdateOrder(order *models.Order) error
-	GetOrderByID(orderID uuid.UUID) (*models.Order, error)
 	GetOrdersByUserID(userID uint) ([]*models.Order, error)
 	GetUserIDFromUUID(userUUID uuid.UUID) (uint, error)
 	FindUserByID(userID uint, user *models.User) error
@@ -33,70 +33,258 @@ func NewOrderRepo(db *GormDB) OrderRepository {
 	return &orderRepo{db.DB}
 }
 
-func (o *orderRepo) CreateOrder(orderRequest *models.Order) ([]*models.Order, error) {
-    var createdOrders []*models.Order
-    for _, item := range orderRequest.Items {
-        var product models.Product
-        
-        if err := o.DB.First(&product, item.ProductID).Error; err != nil {
-            return nil, err 
-        }
+// ErrOrderStatusChanged is returned when an order's status changed between
+// reading the order and moving it to another status
+var ErrOrderStatusChanged = errors.New("order status changed")
 
-        order := &models.Order{
-            UserID:     orderRequest.UserID, 
-            ProductID:  item.ProductID,
-            Quantity:   item.Quantity,
-            TotalPrice: float64(item.Quantity) * product.Price, 
-            Status:     "Pending", 
-        }
+// ErrInsufficientStock is returned when a product or variant does not have
+// enough stock left to reserve an order item's quantity
+var ErrInsufficientStock = errors.New("insufficient stock")
 
-        // Save the order to the database
-        if err := o.DB.Create(order).Error; err != nil {
-            return nil, err 
-        }
+// InsufficientStockError lists every order line that is short of stock
+type InsufficientStockError struct {
+	Items []models.StockShortage
+}
 
-        // Populate related user data
-        var user models.User
-        if err := o.DB.First(&user, order.UserID).Error; err == nil {
-            order.User = user 
-        } else {
-            order.User = models.User{} 
-        }
+func (e *InsufficientStockError) Error() string {
+	return fmt.Sprintf("%v for %d items", ErrInsufficientStock, len(e.Items))
+}
 
-        order.Product = product
-        createdOrders = append(createdOrders, order)
-    }
+func (e *InsufficientStockError) Unwrap() error {
+	return ErrInsufficientStock
+}
 
-    return createdOrders, nil
+// CreateOrder saves an order with its lines in one transaction. The lines
+// must be priced by the caller; their totals and the order's total are
+// computed from them. Stock is reserved from the variant, or from the product
+// for lines without one, and nothing is saved unless every line can be
+// reserved. Each line is recorded in the stock ledger as a sale, and the order
+// starts its status history as Pending.
+func (o *orderRepo) CreateOrder(order *models.Order) error {
+	return o.DB.Transaction(func(tx *gorm.DB) error {
+		if err := reserveStock(tx, order.Items); err != nil {
+			return err
+		}
+
+		order.CalculateTotals()
+		order.Status = models.OrderStatusPending
+		if err := tx.Create(order).Error; err != nil {
+			return err
+		}
+		if err := recordOrderStatusEvent(tx, order.ID, "", order.Status, order.UserID, "order placed"); err != nil {
+			return err
+		}
+
+		for _, item := range order.Items {
+			orderID := order.ID
+			err := recordStockMovement(tx, &models.StockMovement{
+				ProductID: item.ProductID,
+				VariantID: item.VariantID,
+				Change:    -item.Quantity,
+				Reason:    models.StockReasonSale,
+				ActorID:   optionalID(order.UserID),
+				OrderID:   &orderID,
+			})
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
 }
 
-func (o *orderRepo) FindOrderByID(id uuid.UUID) (*models.Order, error) {
-	var order models.Order
-	if err := o.DB.First(&order, "id = ?", id).Error; err != nil {
-		if errors.Is(err, gorm.ErrRecordNotFound) {
-			return nil, nil
+// stockLine is a product, or one of its variants, that stock is reserved from
+type stockLine struct {
+	productID uint
+	variantID uint
+}
+
+func itemStockLine(item models.OrderItem) stockLine {
+	line := stockLine{productID: item.ProductID}
+	if item.VariantID != nil {
+		line.variantID = *item.VariantID
+	}
+	return line
+}
+
+// before orders lines by product, then variant. Stock rows are always updated
+// in this order, so two orders for the same products lock them in the same
+// order and cannot deadlock.
+func (l stockLine) before(other stockLine) bool {
+	if l.productID != other.productID {
+		return l.productID < other.productID
+	}
+	return l.variantID < other.variantID
+}
+
+// reserveStock decrements the stock of every item with a conditional UPDATE
+// ... WHERE stock >= quantity. The row lock the UPDATE takes serialises
+// concurrent orders for the same product, and the condition is re-checked
+// once a competing transaction commits, so stock never goes negative. Items
+// for the same product or variant are reserved together, in stockLine.before
+// order. When any line is short, all short lines are reported and the
+// caller's transaction must be rolled back.
+func reserveStock(tx *gorm.DB, items []models.OrderItem) error {
+	var lines []stockLine
+	requested := map[stockLine]int{}
+	skus := map[stockLine]string{}
+	for _, item := range items {
+		line := itemStockLine(item)
+		if _, ok := requested[line]; !ok {
+			lines = append(lines, line)
 		}
-		return nil, err
+		requested[line] += item.Quantity
+		skus[line] = item.SKU
+	}
+	sort.Slice(lines, func(i, j int) bool { return lines[i].before(lines[j]) })
+
+	var shortages []models.StockShortage
+	for _, line := range lines {
+		quantity := requested[line]
+		result := stockItem(tx, line).
+			Where("stock >= ?", quantity).
+			Update("stock", gorm.Expr("stock - ?", quantity))
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 1 {
+			continue
+		}
+
+		available, err := currentStock(tx, line)
+		if err != nil {
+			return err
+		}
+		shortage := models.StockShortage{
+			ProductID: line.productID,
+			SKU:       skus[line],
+			Requested: quantity,
+			Available: available,
+		}
+		if line.variantID != 0 {
+			variantID := line.variantID
+			shortage.VariantID = &variantID
+		}
+		shortages = append(shortages, shortage)
+	}
+	if len(shortages) > 0 {
+		return &InsufficientStockError{Items: shortages}
 	}
-	return &order, nil
+	return nil
 }
 
-func (o *orderRepo) UpdateOrderStatus(id uint, status string) error {
-	return o.DB.Model(&models.Order{}).Where("id = ?", id).Update("status", status).Error
+// currentStock returns the stock of a line, 0 if the product or variant is gone
+func currentStock(tx *gorm.DB, line stockLine) (int, error) {
+	var stocks []int
+	err := stockItem(tx, line).Pluck("stock", &stocks).Error
+	if err != nil || len(stocks) == 0 {
+		return 0, err
+	}
+	if stocks[0] < 0 {
+		return 0, nil
+	}
+	return stocks[0], nil
 }
 
-func (o *orderRepo) CancelOrder(id uint) error {
-    result := o.DB.Model(&models.Order{}).Where("id = ? AND status = ?", id, "Pending").Update("status", "Cancelled")
-    
-    if result.Error != nil {
-        return result.Error 
-    }
+// releaseStock returns the reserved quantity of an order's lines to their
+// variant or product, in stockLine.before order, and records the returns in
+// the ledger
+func releaseStock(tx *gorm.DB, order *models.Order, actorID uint) error {
+	items := append([]models.OrderItem(nil), order.Items...)
+	sort.SliceStable(items, func(i, j int) bool { return itemStockLine(items[i]).before(itemStockLine(items[j])) })
+	for _, item := range items {
+		line := itemStockLine(item)
+		result := stockItem(tx, line).Update("stock", gorm.Expr("stock + ?", item.Quantity))
+		if result.Error != nil {
+			return result.Error
+		}
+		// The variant or product was deleted since, there is nothing to return to
+		if result.RowsAffected == 0 {
+			continue
+		}
+		orderID := order.ID
+		err := recordStockMovement(tx, &models.StockMovement{
+			ProductID: item.ProductID,
+			VariantID: item.VariantID,
+			Change:    item.Quantity,
+			Reason:    models.StockReasonCancellation,
+			ActorID:   optionalID(actorID),
+			OrderID:   &orderID,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
 
-    if result.RowsAffected == 0 {
-        return errors.New("no order found with the specified ID or the order is not in a cancellable state")
-    }
+// orderItemsInOrder preloads an order's lines in the order they were placed
+func orderItemsInOrder(tx *gorm.DB) *gorm.DB {
+	return tx.Order("id")
+}
 
-    return nil 
+// optionalID returns nil for the zero ID
+func optionalID(id uint) *uint {
+	if id == 0 {
+		return nil
+	}
+	return &id
+}
+
+// TransitionOrderStatus moves an order from its current status to another on
+// behalf of actorID and records the transition as an OrderStatusEvent. The
+// status is switched with a conditional UPDATE on the order's current status,
+// so of two concurrent transitions only one succeeds; the other gets
+// ErrOrderStatusChanged. When the transition calls the order off before it
+// was shipped, its stock is returned in the same transaction. The caller
+// checks that the transition is allowed.
+func (o *orderRepo) TransitionOrderStatus(order *models.Order, to models.OrderStatus, actorID uint, reason string) error {
+	err := o.DB.Transaction(func(tx *gorm.DB) error {
+		return transitionOrderStatus(tx, order, to, actorID, reason)
+	})
+	if err != nil {
+		return err
+	}
+	order.Status = to
+	return nil
+}
+
+// transitionOrderStatus is TransitionOrderStatus within the caller's
+// transaction; it leaves order.Status to the caller
+func transitionOrderStatus(tx *gorm.DB, order *models.Order, to models.OrderStatus, actorID uint, reason string) error {
+	from := order.Status
+	result := tx.Model(&models.Order{}).Where("id = ? AND status = ?", order.ID, from).Update("status", to)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrOrderStatusChanged
+	}
+
+	if from.ReleasesStock(to) {
+		if err := releaseStock(tx, order, actorID); err != nil {
+			return err
+		}
+	}
+	return recordOrderStatusEvent(tx, order.ID, from, to, actorID, reason)
+}
+
+// recordOrderStatusEvent appends a transition to the order's status history
+func recordOrderStatusEvent(tx *gorm.DB, orderID uint, from models.OrderStatus, to models.OrderStatus, actorID uint, reason string) error {
+	return tx.Create(&models.OrderStatusEvent{
+		OrderID:    orderID,
+		FromStatus: from,
+		ToStatus:   to,
+		ActorID:    optionalID(actorID),
+		Reason:     reason,
+	}).Error
+}
+
+// ListOrderStatusEvents returns an order's status history, oldest first
+func (o *orderRepo) ListOrderStatusEvents(orderID uint) ([]models.OrderStatusEvent, error) {
+	var events []models.OrderStatusEvent
+	err := o.DB.Where("order_id = ?", orderID).Order("created_at, id").Find(&events).Error
+	return events, err
 }
 
 func (o *orderRepo) UpdateOrder(order *models.Order) error {
@@ -109,19 +297,11 @@ func (o *orderRepo) UpdateOrder(order *models.Order) error {
 	return nil
 }
 
-func (o *orderRepo) GetOrderByID(orderID uuid.UUID) (*models.Order, error) {
-	var order models.Order
-	if err := o.DB.First(&order, "id = ?", orderID).Error; err != nil {
-		return nil, err 
-	}
-	return &order, nil 
-}
-
 func (o *orderRepo) GetOrdersByUserID(userID uint) ([]*models.Order, error) {
 	var orders []*models.Order
 
 	// Perform the query to fetch orders by userID
-	if err := o.DB.Where("user_id = ?", userID).Find(&orders).Error; err != nil {
+	if err := o.DB.Where("user_id = ?", userID).Preload("Items", orderItemsInOrder).Order("created_at DESC, id DESC").Find(&orders).Error; err != nil {
 		return nil, err // Return the error for further handling
 	}
 
@@ -167,17 +347,20 @@ func (o *orderRepo) FindUserByID(userID uint, user *models.User) error {
     return nil // User found successfully
 }
 
+// FindOrdersByUserID returns the user's orders with their lines, newest first
 func (o *orderRepo) FindOrdersByUserID(userID uint) ([]*models.Order, error) {
 	var orders []*models.Order
-	if err := o.DB.Where("user_id = ?", userID).Find(&orders).Error; err != nil {
+	if err := o.DB.Where("user_id = ?", userID).Preload("Items", orderItemsInOrder).Order("created_at DESC, id DESC").Find(&orders).Error; err != nil {
 		return nil, err
 	}
 	return orders, nil
 }
 
+// LoadOrderDetails returns an order with its lines and payments, or nil if
+// there is none
 func (o *orderRepo) LoadOrderDetails(orderID uint) (*models.Order, error) {
     var order models.Order
-    if err := o.DB.Preload("User").Preload("Product").First(&order, "id = ?", orderID).Error; err != nil {
+    if err := o.DB.Preload("Items", orderItemsInOrder).Preload("Payments", paymentsInOrder).First(&order, "id = ?", orderID).Error; err != nil {
         if err == gorm.ErrRecordNotFound {
             return nil, nil 
         }
@@ -0,0 +1,149 @@
+package db
+
+import (
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/techagentng/ecommerce-api/models"
+)
+
+func TestCreateOrderDoesNotOversellConcurrentOrders(t *testing.T) {
+	gormDB := openTestDB(t)
+	repo := NewOrderRepo(gormDB)
+	user := createTestUser(t, gormDB)
+
+	const stock = 5
+	first := createTestProduct(t, gormDB, stock)
+	second := createTestProduct(t, gormDB, stock)
+	withVariants := createTestProduct(t, gormDB, 0)
+	variant := createTestVariant(t, gormDB, withVariants, stock)
+
+	lines := []models.OrderItem{
+		{ProductID: first.ID, Quantity: 1, UnitPrice: first.Price},
+		{ProductID: second.ID, Quantity: 1, UnitPrice: second.Price},
+		{ProductID: withVariants.ID, VariantID: &variant.ID, SKU: variant.SKU, Quantity: 1, UnitPrice: withVariants.Price},
+	}
+
+	const orders = 4 * stock
+	var wg sync.WaitGroup
+	errs := make([]error, orders)
+	for i := 0; i < orders; i++ {
+		// Half of the orders list the lines in reverse, which deadlocks
+		// unless stock rows are locked in the same order
+		items := append([]models.OrderItem(nil), lines...)
+		if i%2 == 1 {
+			for l, r := 0, len(items)-1; l < r; l, r = l+1, r-1 {
+				items[l], items[r] = items[r], items[l]
+			}
+		}
+		wg.Add(1)
+		go func(i int, items []models.OrderItem) {
+			defer wg.Done()
+			errs[i] = repo.CreateOrder(&models.Order{UserID: user.ID, Items: items})
+		}(i, items)
+	}
+	wg.Wait()
+
+	placed := 0
+	for _, err := range errs {
+		if err == nil {
+			placed++
+			continue
+		}
+		var stockErr *InsufficientStockError
+		if !errors.As(err, &stockErr) {
+			t.Errorf("got error %v, want an InsufficientStockError", err)
+			continue
+		}
+		if len(stockErr.Items) != len(lines) {
+			t.Errorf("got %d short lines, want all %d: %+v", len(stockErr.Items), len(lines), stockErr.Items)
+		}
+		for _, shortage := range stockErr.Items {
+			if shortage.Requested != 1 || shortage.Available != 0 {
+				t.Errorf("got shortage %+v, want 1 requested and none available", shortage)
+			}
+		}
+	}
+	if placed != stock {
+		t.Errorf("placed %d orders, want %d", placed, stock)
+	}
+	for _, line := range lines {
+		variantID := uint(0)
+		if line.VariantID != nil {
+			variantID = *line.VariantID
+		}
+		if got := testStock(t, gormDB, line.ProductID, variantID); got != 0 {
+			t.Errorf("product %d variant %d has stock %d, want 0", line.ProductID, variantID, got)
+		}
+	}
+}
+
+func TestCancelingOrderReleasesStock(t *testing.T) {
+	gormDB := openTestDB(t)
+	repo := NewOrderRepo(gormDB)
+	user := createTestUser(t, gormDB)
+
+	product := createTestProduct(t, gormDB, 10)
+	withVariants := createTestProduct(t, gormDB, 0)
+	variant := createTestVariant(t, gormDB, withVariants, 4)
+
+	order := &models.Order{UserID: user.ID, Items: []models.OrderItem{
+		{ProductID: withVariants.ID, VariantID: &variant.ID, SKU: variant.SKU, Quantity: 3, UnitPrice: withVariants.Price},
+		{ProductID: product.ID, Quantity: 2, UnitPrice: product.Price},
+		{ProductID: product.ID, Quantity: 1, UnitPrice: product.Price},
+	}}
+	if err := repo.CreateOrder(order); err != nil {
+		t.Fatal(err)
+	}
+	if got := testStock(t, gormDB, product.ID, 0); got != 7 {
+		t.Fatalf("product stock is %d after the order, want 7", got)
+	}
+	if got := testStock(t, gormDB, withVariants.ID, variant.ID); got != 1 {
+		t.Fatalf("variant stock is %d after the order, want 1", got)
+	}
+
+	// A second request read the order while it was still pending
+	stale := *order
+	if err := repo.TransitionOrderStatus(order, models.OrderStatusCanceled, user.ID, "changed my mind"); err != nil {
+		t.Fatal(err)
+	}
+	if got := testStock(t, gormDB, product.ID, 0); got != 10 {
+		t.Errorf("product stock is %d after canceling, want 10", got)
+	}
+	if got := testStock(t, gormDB, withVariants.ID, variant.ID); got != 4 {
+		t.Errorf("variant stock is %d after canceling, want 4", got)
+	}
+
+	var returned int64
+	err := gormDB.DB.Model(&models.StockMovement{}).
+		Where("order_id = ? AND reason = ?", order.ID, models.StockReasonCancellation).
+		Count(&returned).Error
+	if err != nil {
+		t.Fatal(err)
+	}
+	if returned != 3 {
+		t.Errorf("recorded %d cancellation movements, want one per line", returned)
+	}
+
+	// Its cancel must not return the stock again
+	if err := repo.TransitionOrderStatus(&stale, models.OrderStatusCanceled, user.ID, "again"); !errors.Is(err, ErrOrderStatusChanged) {
+		t.Errorf("got %v canceling twice, want ErrOrderStatusChanged", err)
+	}
+	if got := testStock(t, gormDB, product.ID, 0); got != 10 {
+		t.Errorf("product stock is %d after canceling twice, want 10", got)
+	}
+}
+
+func TestStockLinesSortByProductThenVariant(t *testing.T) {
+	variant := uint(3)
+	items := []models.OrderItem{
+		{ProductID: 2},
+		{ProductID: 1, VariantID: &variant},
+		{ProductID: 1},
+	}
+	lines := []stockLine{itemStockLine(items[0]), itemStockLine(items[1]), itemStockLine(items[2])}
+	if !lines[2].before(lines[1]) || !lines[1].before(lines[0]) || lines[0].before(lines[2]) {
+		t.Errorf("lines %v are not ordered by product, then variant", lines)
+	}
+}
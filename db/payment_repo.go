@@ -0,0 +1,202 @@
+package db
+
+import (
+	"errors"
+	"time"
+
+	"github.com/techagentng/ecommerce-api/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ErrPaymentInProgress is returned when an order already has a payment that
+// is being made or was captured
+var ErrPaymentInProgress = errors.New("the order already has a payment in progress")
+
+// ErrRefundInProgress is returned when an order's payment is already being
+// refunded
+var ErrRefundInProgress = errors.New("the order's payment is already being refunded")
+
+// ErrRefundNotClaimed is returned when a refund is completed or released for
+// a payment that is not refunding
+var ErrRefundNotClaimed = errors.New("the payment is not being refunded")
+
+// PaymentRepository stores the payment attempts of orders
+type PaymentRepository interface {
+	CreatePayment(payment *models.Payment, staleBefore time.Time) error
+	UpdatePayment(payment *models.Payment) error
+	ListPaymentsByOrderID(orderID uint) ([]models.Payment, error)
+	ClaimRefund(orderID uint) (*models.Payment, error)
+	ReleaseRefund(payment *models.Payment) error
+	CompleteRefund(payment *models.Payment, order *models.Order, actorID uint, reason string) error
+}
+
+type paymentRepo struct {
+	DB *gorm.DB
+}
+
+// NewPaymentRepo creates a new instance of PaymentRepository
+func NewPaymentRepo(db *GormDB) PaymentRepository {
+	return &paymentRepo{db.DB}
+}
+
+// CreatePayment saves a new attempt to pay a pending order. The order row is
+// locked, so only one attempt starts at a time: ErrPaymentInProgress is
+// returned while another attempt is captured, or is pending or authorized and
+// was updated after staleBefore, and ErrOrderStatusChanged when the order is
+// no longer pending.
+func (r *paymentRepo) CreatePayment(payment *models.Payment, staleBefore time.Time) error {
+	return r.DB.Transaction(func(tx *gorm.DB) error {
+		var order models.Order
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Select("id", "status").First(&order, payment.OrderID).Error; err != nil {
+			return err
+		}
+		if order.Status != models.OrderStatusPending {
+			return ErrOrderStatusChanged
+		}
+
+		var active int64
+		err := tx.Model(&models.Payment{}).
+			Where("order_id = ?", payment.OrderID).
+			Where("status IN ? OR (status IN ? AND updated_at > ?)",
+				[]models.PaymentStatus{models.PaymentStatusCaptured, models.PaymentStatusRefunding},
+				[]models.PaymentStatus{models.PaymentStatusPending, models.PaymentStatusAuthorized}, staleBefore).
+			Count(&active).Error
+		if err != nil {
+			return err
+		}
+		if active > 0 {
+			return ErrPaymentInProgress
+		}
+		return tx.Create(payment).Error
+	})
+}
+
+// UpdatePayment saves the provider's outcome of a payment attempt
+func (r *paymentRepo) UpdatePayment(payment *models.Payment) error {
+	return r.DB.Model(payment).
+		Select("transaction_id", "status", "refunded_amount", "failure_code", "failure_message", "updated_at").
+		Updates(payment).Error
+}
+
+// ListPaymentsByOrderID returns an order's payment attempts, oldest first
+func (r *paymentRepo) ListPaymentsByOrderID(orderID uint) ([]models.Payment, error) {
+	var payments []models.Payment
+	err := paymentsInOrder(r.DB.Where("order_id = ?", orderID)).Find(&payments).Error
+	return payments, err
+}
+
+// ClaimRefund marks the captured payment of an order that can be refunded as
+// refunding, so the provider is asked for the refund once, and returns it; nil
+// when the order has no captured payment. The order row is locked while the
+// claim is made. ErrOrderStatusChanged is returned when the order cannot move
+// to Refunded, and ErrRefundInProgress when its payment is already refunding.
+// A claim ends with CompleteRefund, or ReleaseRefund when the provider did not
+// refund; a payment left refunding, e.g. after a crash, needs to be checked
+// with the provider by hand.
+func (r *paymentRepo) ClaimRefund(orderID uint) (*models.Payment, error) {
+	var claimed *models.Payment
+	err := r.DB.Transaction(func(tx *gorm.DB) error {
+		var order models.Order
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Select("id", "status").First(&order, orderID).Error; err != nil {
+			return err
+		}
+		if !order.Status.CanTransitionTo(models.OrderStatusRefunded) {
+			return ErrOrderStatusChanged
+		}
+
+		var payments []models.Payment
+		err := paymentsInOrder(tx.Where("order_id = ? AND status IN ?", orderID,
+			[]models.PaymentStatus{models.PaymentStatusCaptured, models.PaymentStatusRefunding})).
+			Find(&payments).Error
+		if err != nil {
+			return err
+		}
+		for i := range payments {
+			if payments[i].Status == models.PaymentStatusRefunding {
+				return ErrRefundInProgress
+			}
+		}
+		if len(payments) == 0 {
+			return nil
+		}
+
+		payment := &payments[0]
+		result := tx.Model(payment).
+			Where("status = ?", models.PaymentStatusCaptured).
+			Update("status", models.PaymentStatusRefunding)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrRefundInProgress
+		}
+		claimed = payment
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return claimed, nil
+}
+
+// ReleaseRefund returns a claimed payment to captured after the provider did
+// not refund it, so the refund can be tried again
+func (r *paymentRepo) ReleaseRefund(payment *models.Payment) error {
+	result := r.DB.Model(payment).
+		Where("status = ?", models.PaymentStatusRefunding).
+		Update("status", models.PaymentStatusCaptured)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrRefundNotClaimed
+	}
+	return nil
+}
+
+// CompleteRefund records a claimed payment as refunded and, in the same
+// transaction, moves its order to Refunded on behalf of actorID. Should the
+// order have moved meanwhile to a status it cannot be refunded from, only the
+// payment is recorded; order.Status is set to the status the order is left in.
+func (r *paymentRepo) CompleteRefund(payment *models.Payment, order *models.Order, actorID uint, reason string) error {
+	var status models.OrderStatus
+	err := r.DB.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(payment).
+			Where("status = ?", models.PaymentStatusRefunding).
+			Select("status", "refunded_amount", "updated_at").
+			Updates(payment)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrRefundNotClaimed
+		}
+
+		var current models.Order
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Select("id", "status").First(&current, order.ID).Error; err != nil {
+			return err
+		}
+		status = current.Status
+		if !current.Status.CanTransitionTo(models.OrderStatusRefunded) {
+			return nil
+		}
+		locked := *order
+		locked.Status = current.Status
+		if err := transitionOrderStatus(tx, &locked, models.OrderStatusRefunded, actorID, reason); err != nil {
+			return err
+		}
+		status = models.OrderStatusRefunded
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	order.Status = status
+	return nil
+}
+
+// paymentsInOrder preloads an order's payments in the order they were made
+func paymentsInOrder(tx *gorm.DB) *gorm.DB {
+	return tx.Order("id")
+}
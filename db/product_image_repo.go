@@ -0,0 +1,91 @@
+package db
+
+import (
+	"github.com/techagentng/ecommerce-api/models"
+	"gorm.io/gorm"
+)
+
+// ProductImageRepository stores the image galleries of products
+type ProductImageRepository interface {
+	ListProductImages(productID uint) ([]models.ProductImage, error)
+	FindProductImageByID(id uint) (*models.ProductImage, error)
+	CountProductImages(productID uint) (int64, error)
+	CountProductImagesByKey(key string) (int64, error)
+	CreateProductImage(image *models.ProductImage) error
+	UpdateProductImage(image *models.ProductImage) error
+	DeleteProductImage(image *models.ProductImage) error
+	SetProductImagePositions(productID uint, imageIDs []uint) error
+}
+
+type productImageRepo struct {
+	DB *gorm.DB
+}
+
+func NewProductImageRepo(db *GormDB) ProductImageRepository {
+	return &productImageRepo{db.DB}
+}
+
+func (r *productImageRepo) ListProductImages(productID uint) ([]models.ProductImage, error) {
+	var images []models.ProductImage
+	err := r.DB.Where("product_id = ?", productID).Order("position, id").Find(&images).Error
+	return images, err
+}
+
+func (r *productImageRepo) FindProductImageByID(id uint) (*models.ProductImage, error) {
+	var image models.ProductImage
+	if err := r.DB.First(&image, id).Error; err != nil {
+		return nil, err
+	}
+	return &image, nil
+}
+
+func (r *productImageRepo) CountProductImages(productID uint) (int64, error) {
+	var count int64
+	err := r.DB.Model(&models.ProductImage{}).Where("product_id = ?", productID).Count(&count).Error
+	return count, err
+}
+
+// CountProductImagesByKey counts the gallery images, of any product, that
+// share stored renditions
+func (r *productImageRepo) CountProductImagesByKey(key string) (int64, error) {
+	var count int64
+	err := r.DB.Model(&models.ProductImage{}).Where("key = ?", key).Count(&count).Error
+	return count, err
+}
+
+func (r *productImageRepo) CreateProductImage(image *models.ProductImage) error {
+	return r.DB.Create(image).Error
+}
+
+// UpdateProductImage saves the image's alt text
+func (r *productImageRepo) UpdateProductImage(image *models.ProductImage) error {
+	return r.DB.Model(image).Select("alt_text").Updates(image).Error
+}
+
+// DeleteProductImage removes the image record and closes the gap it leaves in
+// the gallery order
+func (r *productImageRepo) DeleteProductImage(image *models.ProductImage) error {
+	return r.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Delete(image).Error; err != nil {
+			return err
+		}
+		return tx.Model(&models.ProductImage{}).
+			Where("product_id = ? AND position > ?", image.ProductID, image.Position).
+			Update("position", gorm.Expr("position - 1")).Error
+	})
+}
+
+// SetProductImagePositions numbers the product's images in the order of imageIDs
+func (r *productImageRepo) SetProductImagePositions(productID uint, imageIDs []uint) error {
+	return r.DB.Transaction(func(tx *gorm.DB) error {
+		for position, id := range imageIDs {
+			err := tx.Model(&models.ProductImage{}).
+				Where("id = ? AND product_id = ?", id, productID).
+				Update("position", position).Error
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
@@ -2,20 +2,46 @@ package db
 
 import (
 	"errors"
+	"fmt"
 	"log"
+
 	"github.com/techagentng/ecommerce-api/models"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 // ProductRepository interface defines the methods for product-related database operations
 type ProductRepository interface {
 	CreateProduct(product *models.Product) (*models.Product, error)
 	FindProductByID(id uint) (*models.Product, error)
-	FindAllProducts() ([]*models.Product, error)
+	FindProductsByIDs(ids []uint) ([]*models.Product, error)
+	ListProducts(query *models.ProductListQuery) ([]*models.Product, int64, error)
 	UpdateProduct(product *models.Product) error
 	DeleteProduct(id uint) error
+	ImportProducts(products []*models.Product, dryRun bool) ([]bool, error)
+	EachProduct(batchSize int, fn func(products []*models.Product) error) error
+}
+
+// ImportRowError is returned by ImportProducts when writing a row failed.
+// Index is the row's position in the imported slice.
+type ImportRowError struct {
+	Index int
+	Err   error
 }
 
+func (e *ImportRowError) Error() string {
+	return fmt.Sprintf("row %d: %v", e.Index, e.Err)
+}
+
+// errDryRun rolls back the transaction of a dry run import
+var errDryRun = errors.New("dry run")
+
+// productAvailableSQL is true for products customers can buy: one with
+// variants needs a variant in stock, others their own stock
+const productAvailableSQL = `(CASE WHEN EXISTS (SELECT 1 FROM product_variants WHERE product_variants.product_id = products.id)
+	THEN EXISTS (SELECT 1 FROM product_variants WHERE product_variants.product_id = products.id AND product_variants.stock > 0)
+	ELSE products.stock > 0 END)`
+
 // productRepo struct holds the database connection
 type productRepo struct {
 	DB *gorm.DB
@@ -26,14 +52,34 @@ func NewProductRepo(db *GormDB) ProductRepository {
 	return &productRepo{db.DB}
 }
 
-// CreateProduct inserts a new product into the database
+// CreateProduct inserts a new product into the database and records its
+// stock as the opening movement of its ledger
 func (p *productRepo) CreateProduct(product *models.Product) (*models.Product, error) {
-	if err := p.DB.Create(product).Error; err != nil {
+	err := p.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(product).Error; err != nil {
+			return err
+		}
+		return recordOpeningStock(tx, product.ID, nil, product.Stock)
+	})
+	if err != nil {
 		return nil, err
 	}
 	return product, nil
 }
 
+// recordOpeningStock records the stock a new product or variant starts with
+func recordOpeningStock(tx *gorm.DB, productID uint, variantID *uint, stock int) error {
+	if stock == 0 {
+		return nil
+	}
+	return recordStockMovement(tx, &models.StockMovement{
+		ProductID: productID,
+		VariantID: variantID,
+		Change:    stock,
+		Reason:    models.StockReasonOpening,
+	})
+}
+
 // FindProductByID retrieves a product by its ID
 func (p *productRepo) FindProductByID(id uint) (*models.Product, error) {
     var product models.Product
@@ -52,21 +98,208 @@ func (p *productRepo) FindProductByID(id uint) (*models.Product, error) {
     return &product, nil
 }
 
-// FindAllProducts retrieves all products from the database
-func (p *productRepo) FindAllProducts() ([]*models.Product, error) {
+// FindProductsByIDs retrieves the products with the given IDs, in no particular order
+func (p *productRepo) FindProductsByIDs(ids []uint) ([]*models.Product, error) {
 	var products []*models.Product
-	if err := p.DB.Find(&products).Error; err != nil {
-		return nil, err
+	if len(ids) == 0 {
+		return products, nil
 	}
-	return products, nil
+	err := p.DB.Where("id IN ?", ids).Find(&products).Error
+	return products, err
 }
 
-// UpdateProduct updates an existing product in the database
+// ListProducts returns a page of products matching the query's filters and the
+// total number of matches. Up to PageSize+1 products are returned so the
+// caller can tell whether another page follows.
+func (p *productRepo) ListProducts(query *models.ProductListQuery) ([]*models.Product, int64, error) {
+	tx := p.DB.Model(&models.Product{})
+	if query.Name != "" {
+		tx = tx.Where("name ILIKE ?", "%"+query.Name+"%")
+	}
+	if query.MinPrice != nil {
+		tx = tx.Where("price >= ?", *query.MinPrice)
+	}
+	if query.MaxPrice != nil {
+		tx = tx.Where("price <= ?", *query.MaxPrice)
+	}
+	if query.InStock != nil {
+		if *query.InStock {
+			tx = tx.Where(productAvailableSQL)
+		} else {
+			tx = tx.Where("NOT " + productAvailableSQL)
+		}
+	}
+
+	if query.CategoryPath != "" {
+		tx = tx.Where("id IN (?)", p.DB.Table("product_categories").
+			Select("product_categories.product_id").
+			Joins("JOIN categories ON categories.id = product_categories.category_id").
+			Where("categories.path LIKE ?", query.CategoryPath+"%"))
+	}
+
+	var total int64
+	if err := tx.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	column := query.SortKey()
+	direction, compare := "ASC", ">"
+	if query.SortDescending() {
+		direction, compare = "DESC", "<"
+	}
+
+	if cursor := query.After; cursor != nil {
+		switch column {
+		case models.ProductSortName:
+			tx = tx.Where("(name, id) "+compare+" (?, ?)", cursor.Name, cursor.ID)
+		case models.ProductSortPrice:
+			tx = tx.Where("(price, id) "+compare+" (?, ?)", cursor.Price, cursor.ID)
+		default:
+			tx = tx.Where("id "+compare+" ?", cursor.ID)
+		}
+	} else if query.Page > 1 {
+		tx = tx.Offset((query.Page - 1) * query.PageSize)
+	}
+	switch column {
+	case models.ProductSortName, models.ProductSortPrice:
+		tx = tx.Order(column + " " + direction)
+	}
+
+	var products []*models.Product
+	err := tx.Order("id " + direction).
+		Limit(query.PageSize + 1).
+		Find(&products).Error
+	if err != nil {
+		return nil, 0, err
+	}
+	return products, total, nil
+}
+
+// UpdateProduct updates an existing product in the database. Its stock is
+// left alone; stock only changes through the ledger.
 func (p *productRepo) UpdateProduct(product *models.Product) error {
-	return p.DB.Save(product).Error
+	return p.DB.Omit("created_at", "stock").Save(product).Error
 }
 
-// DeleteProduct removes a product from the database
+// DeleteProduct removes a product with its options, variants and image records
+// from the database. The image blobs are left to the caller.
 func (p *productRepo) DeleteProduct(id uint) error {
-	return p.DB.Delete(&models.Product{}, id).Error
+	return p.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("product_id = ?", id).Delete(&models.ProductImage{}).Error; err != nil {
+			return err
+		}
+		variantIDs := tx.Model(&models.ProductVariant{}).Select("id").Where("product_id = ?", id)
+		if err := tx.Exec("DELETE FROM variant_option_values WHERE product_variant_id IN (?)", variantIDs).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("product_id = ?", id).Delete(&models.ProductVariant{}).Error; err != nil {
+			return err
+		}
+		optionIDs := tx.Model(&models.ProductOption{}).Select("id").Where("product_id = ?", id)
+		if err := tx.Where("option_id IN (?)", optionIDs).Delete(&models.ProductOptionValue{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("product_id = ?", id).Delete(&models.ProductOption{}).Error; err != nil {
+			return err
+		}
+		// Selecting Categories also removes the product's category memberships
+		return tx.Select("Categories").Delete(&models.Product{ID: id}).Error
+	})
+}
+
+// ImportProducts upserts the products in a single transaction. Existing
+// products are matched by SKU, then by name; a product matched by name keeps
+// its SKU when the row has none. The returned slice reports for each row
+// whether a product was created. A changed stock level is recorded in the
+// ledger as an adjustment. A dry run writes everything and then rolls back, so
+// it catches the same constraint violations as a real import.
+func (p *productRepo) ImportProducts(products []*models.Product, dryRun bool) ([]bool, error) {
+	created := make([]bool, len(products))
+	err := p.DB.Transaction(func(tx *gorm.DB) error {
+		for i, product := range products {
+			existing, err := findImportMatch(tx, product)
+			if err != nil {
+				return &ImportRowError{Index: i, Err: err}
+			}
+			if existing == nil {
+				if err := tx.Omit(clause.Associations).Create(product).Error; err != nil {
+					return &ImportRowError{Index: i, Err: err}
+				}
+				if err := recordOpeningStock(tx, product.ID, nil, product.Stock); err != nil {
+					return &ImportRowError{Index: i, Err: err}
+				}
+				created[i] = true
+				continue
+			}
+
+			// Updates copies the new values into existing
+			previousStock := existing.Stock
+			product.ID = existing.ID
+			product.CreatedAt = existing.CreatedAt
+			if product.SKU == nil {
+				product.SKU = existing.SKU
+			}
+			err = tx.Model(existing).
+				Select("sku", "name", "description", "price", "quantity", "stock", "updated_at").
+				Updates(product).Error
+			if err != nil {
+				return &ImportRowError{Index: i, Err: err}
+			}
+			if change := product.Stock - previousStock; change != 0 {
+				err := recordStockMovement(tx, &models.StockMovement{
+					ProductID: product.ID,
+					Change:    change,
+					Reason:    models.StockReasonAdjustment,
+					Note:      "product import",
+				})
+				if err != nil {
+					return &ImportRowError{Index: i, Err: err}
+				}
+			}
+		}
+		if dryRun {
+			return errDryRun
+		}
+		return nil
+	})
+	if err != nil && !errors.Is(err, errDryRun) {
+		return nil, err
+	}
+	return created, nil
+}
+
+// findImportMatch returns the product an imported row updates, or nil. The
+// match is locked so its stock cannot change before the row is written.
+func findImportMatch(tx *gorm.DB, product *models.Product) (*models.Product, error) {
+	var matches []*models.Product
+	tx = tx.Clauses(clause.Locking{Strength: "UPDATE"}).Session(&gorm.Session{})
+	if product.SKU != nil {
+		if err := tx.Where("sku = ?", *product.SKU).Limit(1).Find(&matches).Error; err != nil {
+			return nil, err
+		}
+		if len(matches) > 0 {
+			return matches[0], nil
+		}
+	}
+	// A product with another SKU is a different product that shares the name
+	query := tx.Where("name = ?", product.Name)
+	if product.SKU != nil {
+		query = query.Where("sku IS NULL")
+	}
+	if err := query.Order("id").Limit(1).Find(&matches).Error; err != nil {
+		return nil, err
+	}
+	if len(matches) > 0 {
+		return matches[0], nil
+	}
+	return nil, nil
+}
+
+// EachProduct calls fn with every product in ID order, batchSize at a time, so
+// the catalog can be streamed without loading it into memory at once
+func (p *productRepo) EachProduct(batchSize int, fn func(products []*models.Product) error) error {
+	var batch []*models.Product
+	return p.DB.FindInBatches(&batch, batchSize, func(tx *gorm.DB, _ int) error {
+		return fn(batch)
+	}).Error
 }
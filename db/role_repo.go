@@ -0,0 +1,84 @@
+package db
+
+import (
+	"github.com/google/uuid"
+	"github.com/techagentng/ecommerce-api/models"
+	"gorm.io/gorm"
+)
+
+// RoleRepository defines the methods for role and permission database operations
+type RoleRepository interface {
+	CreateRole(role *models.Role) (*models.Role, error)
+	FindRoleWithPermissions(name string) (*models.Role, error)
+	ListRoles() ([]*models.Role, error)
+	ListPermissions() ([]*models.Permission, error)
+	FindPermissionsByNames(names []string) ([]models.Permission, error)
+	ReplaceRolePermissions(role *models.Role, permissions []models.Permission) error
+	SetRoleRequireMFA(roleID uuid.UUID, requireMFA bool) error
+}
+
+type roleRepo struct {
+	DB *gorm.DB
+}
+
+// NewRoleRepo creates a new instance of RoleRepository
+func NewRoleRepo(db *GormDB) RoleRepository {
+	return &roleRepo{db.DB}
+}
+
+// CreateRole inserts a role together with its permissions
+func (r *roleRepo) CreateRole(role *models.Role) (*models.Role, error) {
+	if role.ID == uuid.Nil {
+		role.ID = uuid.New()
+	}
+	if err := r.DB.Omit("Permissions.*").Create(role).Error; err != nil {
+		return nil, err
+	}
+	return role, nil
+}
+
+// FindRoleWithPermissions retrieves a role by name with its permissions loaded
+func (r *roleRepo) FindRoleWithPermissions(name string) (*models.Role, error) {
+	var role models.Role
+	if err := r.DB.Preload("Permissions").Where("name = ?", name).First(&role).Error; err != nil {
+		return nil, err
+	}
+	return &role, nil
+}
+
+func (r *roleRepo) ListRoles() ([]*models.Role, error) {
+	var roles []*models.Role
+	if err := r.DB.Preload("Permissions").Order("name").Find(&roles).Error; err != nil {
+		return nil, err
+	}
+	return roles, nil
+}
+
+func (r *roleRepo) ListPermissions() ([]*models.Permission, error) {
+	var permissions []*models.Permission
+	if err := r.DB.Order("name").Find(&permissions).Error; err != nil {
+		return nil, err
+	}
+	return permissions, nil
+}
+
+func (r *roleRepo) FindPermissionsByNames(names []string) ([]models.Permission, error) {
+	var permissions []models.Permission
+	if len(names) == 0 {
+		return permissions, nil
+	}
+	if err := r.DB.Where("name IN ?", names).Find(&permissions).Error; err != nil {
+		return nil, err
+	}
+	return permissions, nil
+}
+
+// ReplaceRolePermissions sets the role's permissions to exactly the given set
+func (r *roleRepo) ReplaceRolePermissions(role *models.Role, permissions []models.Permission) error {
+	return r.DB.Model(role).Omit("Permissions.*").Association("Permissions").Replace(permissions)
+}
+
+// SetRoleRequireMFA sets whether members of the role must enroll in MFA
+func (r *roleRepo) SetRoleRequireMFA(roleID uuid.UUID, requireMFA bool) error {
+	return r.DB.Model(&models.Role{}).Where("id = ?", roleID).Update("require_mfa", requireMFA).Error
+}
@@ -0,0 +1,336 @@
+package db
+
+import (
+	"html"
+	"sort"
+	"strings"
+	"sync"
+	"unicode"
+
+	"github.com/techagentng/ecommerce-api/models"
+	"gorm.io/gorm"
+)
+
+// SearchIndex ranks products against a free text query over their name and
+// description. Each term of the query matches words it is a prefix of, and
+// tolerates a typo in longer terms. The Postgres index searches the
+// products.search_vector column; the memory index is for development and tests.
+type SearchIndex interface {
+	IndexProduct(product *models.Product) error
+	RemoveProduct(id uint) error
+	Search(query string, limit int, offset int) ([]models.SearchHit, int64, error)
+}
+
+const (
+	highlightStart = "<mark>"
+	highlightStop  = "</mark>"
+	snippetWords   = 30
+	// typoMinLength is the shortest term a typo is tolerated in
+	typoMinLength = 4
+)
+
+type postgresSearchIndex struct {
+	DB *gorm.DB
+}
+
+// NewPostgresSearchIndex creates a SearchIndex backed by a weighted tsvector
+// over the product name (A) and description (B), with pg_trgm word
+// similarity on the name as a fallback for misspelled terms
+func NewPostgresSearchIndex(db *GormDB) SearchIndex {
+	return &postgresSearchIndex{db.DB}
+}
+
+// escapeHTMLSQL escapes a text column like html.EscapeString, so the only
+// markup in a ts_headline of it is what StartSel and StopSel add
+func escapeHTMLSQL(column string) string {
+	return `replace(replace(replace(replace(replace(` + column +
+		`, '&', '&amp;'), '<', '&lt;'), '>', '&gt;'), '"', '&#34;'), '''', '&#39;')`
+}
+
+// searchVectorSQL computes a product's search vector from its own columns
+const searchVectorSQL = `setweight(to_tsvector('english', coalesce(name, '')), 'A') ||
+	setweight(to_tsvector('english', coalesce(description, '')), 'B')`
+
+func (p *postgresSearchIndex) IndexProduct(product *models.Product) error {
+	return p.DB.Exec("UPDATE products SET search_vector = "+searchVectorSQL+" WHERE id = ?", product.ID).Error
+}
+
+// RemoveProduct is a no-op, the vector is deleted with the product row
+func (p *postgresSearchIndex) RemoveProduct(id uint) error {
+	return nil
+}
+
+func (p *postgresSearchIndex) Search(query string, limit int, offset int) ([]models.SearchHit, int64, error) {
+	terms := searchTerms(query)
+	if len(terms) == 0 {
+		return []models.SearchHit{}, 0, nil
+	}
+	// Terms only hold letters and digits, so they are safe to join into a
+	// tsquery: "runn shoe" becomes "runn:* & shoe:*"
+	prefixes := make([]string, len(terms))
+	for i, term := range terms {
+		prefixes[i] = term + ":*"
+	}
+	tsquery := strings.Join(prefixes, " & ")
+	text := strings.Join(terms, " ")
+
+	match := p.DB.Table("products").
+		Where("search_vector @@ to_tsquery('english', ?) OR ? <% name", tsquery, text).
+		Session(&gorm.Session{})
+
+	var total int64
+	if err := match.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	var hits []models.SearchHit
+	headline := "StartSel=" + highlightStart + ", StopSel=" + highlightStop
+	err := match.
+		Select(`id AS product_id,
+			ts_rank(search_vector, to_tsquery('english', ?)) + word_similarity(?, name) AS rank,
+			ts_headline('english', `+escapeHTMLSQL("name")+`, to_tsquery('english', ?), ?) AS name_highlight,
+			ts_headline('english', `+escapeHTMLSQL("coalesce(description, '')")+`, to_tsquery('english', ?), ?) AS snippet`,
+			tsquery, text,
+			tsquery, headline+", HighlightAll=true",
+			tsquery, headline+", MinWords=15, MaxWords=30").
+		Order("rank DESC, id").
+		Limit(limit).
+		Offset(offset).
+		Scan(&hits).Error
+	if err != nil {
+		return nil, 0, err
+	}
+	return hits, total, nil
+}
+
+// searchDocument is a product as held by the memory index
+type searchDocument struct {
+	name        string
+	description string
+}
+
+type memorySearchIndex struct {
+	mu        sync.RWMutex
+	documents map[uint]searchDocument
+}
+
+// NewMemorySearchIndex creates a SearchIndex that lives in process memory. It
+// ranks a term matching a name word above one matching a description word,
+// and exact or prefix matches above typo matches.
+func NewMemorySearchIndex() SearchIndex {
+	return &memorySearchIndex{documents: map[uint]searchDocument{}}
+}
+
+func (m *memorySearchIndex) IndexProduct(product *models.Product) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.documents[product.ID] = searchDocument{name: product.Name, description: product.Description}
+	return nil
+}
+
+func (m *memorySearchIndex) RemoveProduct(id uint) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.documents, id)
+	return nil
+}
+
+func (m *memorySearchIndex) Search(query string, limit int, offset int) ([]models.SearchHit, int64, error) {
+	terms := searchTerms(query)
+	if len(terms) == 0 {
+		return []models.SearchHit{}, 0, nil
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var hits []models.SearchHit
+	for id, document := range m.documents {
+		nameWords := searchTerms(document.name)
+		descriptionWords := searchTerms(document.description)
+
+		// Every term has to match, each scoring its best match
+		var rank float64
+		matched := true
+		for _, term := range terms {
+			score := 2 * termScore(term, nameWords)
+			if s := termScore(term, descriptionWords); s > score {
+				score = s
+			}
+			if score == 0 {
+				matched = false
+				break
+			}
+			rank += score
+		}
+		if !matched {
+			continue
+		}
+		hits = append(hits, models.SearchHit{
+			ProductID:     id,
+			Rank:          rank,
+			NameHighlight: highlight(splitWords(document.name), terms),
+			Snippet:       snippet(document.description, terms),
+		})
+	}
+
+	sort.Slice(hits, func(i, j int) bool {
+		if hits[i].Rank != hits[j].Rank {
+			return hits[i].Rank > hits[j].Rank
+		}
+		return hits[i].ProductID < hits[j].ProductID
+	})
+
+	total := int64(len(hits))
+	if offset >= len(hits) {
+		return []models.SearchHit{}, total, nil
+	}
+	hits = hits[offset:]
+	if len(hits) > limit {
+		hits = hits[:limit]
+	}
+	return hits, total, nil
+}
+
+// termScore scores the best match of a term against a list of words: 1 for an
+// exact match, 0.75 for a prefix and 0.5 for a prefix with a single typo
+func termScore(term string, words []string) float64 {
+	var best float64
+	for _, word := range words {
+		if score := matchWord(term, word); score > best {
+			best = score
+		}
+	}
+	return best
+}
+
+func matchWord(term string, word string) float64 {
+	switch {
+	case word == term:
+		return 1
+	case strings.HasPrefix(word, term):
+		return 0.75
+	case len(term) < typoMinLength:
+		return 0
+	}
+	// Compare with the word itself and with its prefix of the term's length,
+	// so "runing" matches "running" and "runnign" matches "running"
+	runes := []rune(word)
+	if withinOneEdit(term, word) || (len(runes) > len([]rune(term)) && withinOneEdit(term, string(runes[:len([]rune(term))]))) {
+		return 0.5
+	}
+	return 0
+}
+
+// withinOneEdit reports whether a and b are at most one insertion, deletion,
+// substitution or transposition of adjacent letters apart
+func withinOneEdit(a string, b string) bool {
+	x, y := []rune(a), []rune(b)
+	if len(x) > len(y) {
+		x, y = y, x
+	}
+	if len(y)-len(x) > 1 {
+		return false
+	}
+	i := 0
+	for i < len(x) && x[i] == y[i] {
+		i++
+	}
+	if i == len(x) {
+		return true
+	}
+	if len(x) == len(y) {
+		if string(x[i+1:]) == string(y[i+1:]) {
+			return true
+		}
+		return i+1 < len(x) && x[i] == y[i+1] && x[i+1] == y[i] && string(x[i+2:]) == string(y[i+2:])
+	}
+	return string(x[i:]) == string(y[i+1:])
+}
+
+// searchTerms splits text into lower case words of letters and digits
+func searchTerms(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// textSegment is a run of word or non-word characters of the original text
+type textSegment struct {
+	text string
+	word bool
+}
+
+func splitWords(text string) []textSegment {
+	var segments []textSegment
+	start := 0
+	var inWord bool
+	for i, r := range text {
+		isWord := unicode.IsLetter(r) || unicode.IsDigit(r)
+		if i > 0 && isWord != inWord {
+			segments = append(segments, textSegment{text: text[start:i], word: inWord})
+			start = i
+		}
+		inWord = isWord
+	}
+	if start < len(text) {
+		segments = append(segments, textSegment{text: text[start:], word: inWord})
+	}
+	return segments
+}
+
+// highlight HTML-escapes the segments and wraps the words matching a term in
+// highlightStart and highlightStop
+func highlight(segments []textSegment, terms []string) string {
+	var b strings.Builder
+	for _, segment := range segments {
+		text := html.EscapeString(segment.text)
+		if segment.word && wordMatches(segment.text, terms) {
+			b.WriteString(highlightStart + text + highlightStop)
+			continue
+		}
+		b.WriteString(text)
+	}
+	return b.String()
+}
+
+func wordMatches(word string, terms []string) bool {
+	word = strings.ToLower(word)
+	for _, term := range terms {
+		if matchWord(term, word) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// snippet highlights a window of up to snippetWords words of the description,
+// starting shortly before the first matching word
+func snippet(description string, terms []string) string {
+	segments := splitWords(description)
+	var wordIndexes []int
+	first := -1
+	for i, segment := range segments {
+		if !segment.word {
+			continue
+		}
+		if first < 0 && wordMatches(segment.text, terms) {
+			first = len(wordIndexes)
+		}
+		wordIndexes = append(wordIndexes, i)
+	}
+	if len(wordIndexes) <= snippetWords {
+		return strings.TrimSpace(highlight(segments, terms))
+	}
+
+	startWord := 0
+	if first > 3 {
+		startWord = first - 3
+	}
+	if startWord+snippetWords > len(wordIndexes) {
+		startWord = len(wordIndexes) - snippetWords
+	}
+	from := wordIndexes[startWord]
+	to := wordIndexes[startWord+snippetWords-1] + 1
+	return highlight(segments[from:to], terms)
+}
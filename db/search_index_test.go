@@ -0,0 +1,183 @@
+package db
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/techagentng/ecommerce-api/models"
+)
+
+func newTestSearchIndex(t *testing.T, products ...models.Product) SearchIndex {
+	t.Helper()
+	index := NewMemorySearchIndex()
+	for i := range products {
+		if err := index.IndexProduct(&products[i]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return index
+}
+
+func hitIDs(hits []models.SearchHit) []uint {
+	ids := make([]uint, len(hits))
+	for i, hit := range hits {
+		ids[i] = hit.ProductID
+	}
+	return ids
+}
+
+func TestMemorySearchRanksNameMatchesAboveDescriptionMatches(t *testing.T) {
+	index := newTestSearchIndex(t,
+		models.Product{ID: 1, Name: "Leather belt", Description: "Goes well with running shoes"},
+		models.Product{ID: 2, Name: "Running shoes", Description: "Light and breathable"},
+		models.Product{ID: 3, Name: "Runner socks", Description: "For long runs"},
+	)
+
+	hits, total, err := index.Search("running", 10, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if total != 2 {
+		t.Errorf("got total %d, want 2", total)
+	}
+	if got := hitIDs(hits); len(got) != 2 || got[0] != 2 || got[1] != 1 {
+		t.Errorf("got products %v, want [2 1]", got)
+	}
+}
+
+func TestMemorySearchRanksExactAbovePrefixAndTypoMatches(t *testing.T) {
+	index := newTestSearchIndex(t,
+		models.Product{ID: 1, Name: "Shoes"},
+		models.Product{ID: 2, Name: "Shoe rack"},
+		models.Product{ID: 3, Name: "Sheo horn"},
+	)
+
+	hits, _, err := index.Search("shoe", 10, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := hitIDs(hits); len(got) != 3 || got[0] != 2 || got[1] != 1 || got[2] != 3 {
+		t.Errorf("got products %v, want exact, prefix then typo match [2 1 3]", got)
+	}
+}
+
+func TestMemorySearchRequiresEveryTerm(t *testing.T) {
+	index := newTestSearchIndex(t,
+		models.Product{ID: 1, Name: "Red running shoes"},
+		models.Product{ID: 2, Name: "Blue running shoes"},
+		models.Product{ID: 3, Name: "Red scarf"},
+	)
+
+	hits, total, err := index.Search("red shoes", 10, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := hitIDs(hits); total != 1 || len(got) != 1 || got[0] != 1 {
+		t.Errorf("got products %v of %d, want [1]", got, total)
+	}
+
+	hits, total, err = index.Search("  ,;  ", 10, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if total != 0 || len(hits) != 0 {
+		t.Errorf("a query without terms matched %d products", total)
+	}
+}
+
+func TestMemorySearchPagesAndRemoves(t *testing.T) {
+	index := newTestSearchIndex(t,
+		models.Product{ID: 1, Name: "Mug"},
+		models.Product{ID: 2, Name: "Mug"},
+		models.Product{ID: 3, Name: "Mug"},
+	)
+
+	hits, total, err := index.Search("mug", 2, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := hitIDs(hits); total != 3 || len(got) != 1 || got[0] != 3 {
+		t.Errorf("got products %v of %d on the second page, want [3] of 3", got, total)
+	}
+
+	if err := index.RemoveProduct(2); err != nil {
+		t.Fatal(err)
+	}
+	hits, total, err = index.Search("mug", 10, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := hitIDs(hits); total != 2 || len(got) != 2 || got[0] != 1 || got[1] != 3 {
+		t.Errorf("got products %v of %d after removing 2, want [1 3]", got, total)
+	}
+}
+
+func TestMemorySearchHighlightsMatchedWords(t *testing.T) {
+	index := newTestSearchIndex(t,
+		models.Product{ID: 1, Name: "Trail Running Shoes", Description: "Grippy shoes for muddy trails."},
+	)
+
+	hits, _, err := index.Search("runing trail", 10, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(hits) != 1 {
+		t.Fatalf("got %d hits, want 1", len(hits))
+	}
+	if want := "<mark>Trail</mark> <mark>Running</mark> Shoes"; hits[0].NameHighlight != want {
+		t.Errorf("got name highlight %q, want %q", hits[0].NameHighlight, want)
+	}
+	if want := "Grippy shoes for muddy <mark>trails</mark>."; hits[0].Snippet != want {
+		t.Errorf("got snippet %q, want %q", hits[0].Snippet, want)
+	}
+}
+
+func TestMemorySearchEscapesHTML(t *testing.T) {
+	index := newTestSearchIndex(t,
+		models.Product{
+			ID:          1,
+			Name:        `<script>alert("x")</script> Mug`,
+			Description: `A mug & saucer <img src=x onerror=alert(1)> 'set'`,
+		},
+	)
+
+	hits, _, err := index.Search("mug", 10, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(hits) != 1 {
+		t.Fatalf("got %d hits, want 1", len(hits))
+	}
+	if want := "&lt;script&gt;alert(&#34;x&#34;)&lt;/script&gt; <mark>Mug</mark>"; hits[0].NameHighlight != want {
+		t.Errorf("got name highlight %q, want %q", hits[0].NameHighlight, want)
+	}
+	if want := "A <mark>mug</mark> &amp; saucer &lt;img src=x onerror=alert(1)&gt; &#39;set&#39;"; hits[0].Snippet != want {
+		t.Errorf("got snippet %q, want %q", hits[0].Snippet, want)
+	}
+}
+
+func TestMemorySearchSnippetStartsNearFirstMatch(t *testing.T) {
+	words := make([]string, 60)
+	for i := range words {
+		words[i] = "filler"
+	}
+	words[20] = "waterproof"
+	index := newTestSearchIndex(t,
+		models.Product{ID: 1, Name: "Jacket", Description: strings.Join(words, " ")},
+	)
+
+	hits, _, err := index.Search("waterproof", 10, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(hits) != 1 {
+		t.Fatalf("got %d hits, want 1", len(hits))
+	}
+	snippet := hits[0].Snippet
+	if got := len(strings.Fields(snippet)); got != snippetWords {
+		t.Errorf("got a snippet of %d words, want %d", got, snippetWords)
+	}
+	if !strings.HasPrefix(snippet, "filler filler filler <mark>waterproof</mark>") {
+		t.Errorf("snippet does not start shortly before the match: %q", snippet)
+	}
+}
@@ -0,0 +1,141 @@
+package db
+
+import (
+	"github.com/techagentng/ecommerce-api/models"
+	"gorm.io/gorm"
+)
+
+// StockRepository reads and appends to the stock ledger. Writes elsewhere
+// that change stock record their movement with recordStockMovement in the
+// same transaction.
+type StockRepository interface {
+	AdjustStock(movement *models.StockMovement) error
+	ListStockMovements(productID uint, query *models.StockMovementQuery) ([]models.StockMovement, int64, error)
+	FindStockDrift() ([]models.StockDrift, error)
+	SyncStockToLedger(drift *models.StockDrift) error
+}
+
+type stockRepo struct {
+	DB *gorm.DB
+}
+
+// NewStockRepo creates a new instance of StockRepository
+func NewStockRepo(db *GormDB) StockRepository {
+	return &stockRepo{db.DB}
+}
+
+// AdjustStock applies the movement's change to its product or variant and
+// records it. The change is applied with a conditional UPDATE, so stock never
+// goes below zero; ErrInsufficientStock is returned when it would.
+// gorm.ErrRecordNotFound is returned when the variant does not belong to the
+// product or either does not exist.
+func (s *stockRepo) AdjustStock(movement *models.StockMovement) error {
+	return s.DB.Transaction(func(tx *gorm.DB) error {
+		line := stockLine{productID: movement.ProductID}
+		if movement.VariantID != nil {
+			line.variantID = *movement.VariantID
+		}
+		result := stockItem(tx, line).
+			Where("stock + ? >= 0", movement.Change).
+			Update("stock", gorm.Expr("stock + ?", movement.Change))
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			var count int64
+			if err := stockItem(tx, line).Count(&count).Error; err != nil {
+				return err
+			}
+			if count == 0 {
+				return gorm.ErrRecordNotFound
+			}
+			return ErrInsufficientStock
+		}
+		return recordStockMovement(tx, movement)
+	})
+}
+
+// ListStockMovements returns a page of a product's movements, newest first,
+// and the total number of movements. Without a variant the product's own
+// movements are listed.
+func (s *stockRepo) ListStockMovements(productID uint, query *models.StockMovementQuery) ([]models.StockMovement, int64, error) {
+	tx := s.DB.Model(&models.StockMovement{}).Where("product_id = ?", productID)
+	if query.VariantID != nil {
+		tx = tx.Where("variant_id = ?", *query.VariantID)
+	} else {
+		tx = tx.Where("variant_id IS NULL")
+	}
+
+	var total int64
+	if err := tx.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	var movements []models.StockMovement
+	err := tx.Order("id DESC").
+		Limit(query.PageSize).
+		Offset((query.Page - 1) * query.PageSize).
+		Find(&movements).Error
+	return movements, total, err
+}
+
+// FindStockDrift compares the stock of every product and variant with the sum
+// of its movements and returns those that differ
+func (s *stockRepo) FindStockDrift() ([]models.StockDrift, error) {
+	var drift []models.StockDrift
+	err := s.DB.Raw(`SELECT p.id AS product_id, NULL AS variant_id, coalesce(p.sku, '') AS sku, p.stock, coalesce(l.balance, 0) AS ledger
+		FROM products p
+		LEFT JOIN (SELECT product_id, sum(change) AS balance FROM stock_movements WHERE variant_id IS NULL GROUP BY product_id) l
+			ON l.product_id = p.id
+		WHERE p.stock <> coalesce(l.balance, 0)
+		UNION ALL
+		SELECT v.product_id, v.id, v.sku, v.stock, coalesce(l.balance, 0)
+		FROM product_variants v
+		LEFT JOIN (SELECT variant_id, sum(change) AS balance FROM stock_movements WHERE variant_id IS NOT NULL GROUP BY variant_id) l
+			ON l.variant_id = v.id
+		WHERE v.stock <> coalesce(l.balance, 0)
+		ORDER BY product_id, variant_id NULLS FIRST`).
+		Scan(&drift).Error
+	return drift, err
+}
+
+// SyncStockToLedger sets the stock of a drifted product or variant to the sum
+// of its movements, the ledger being the record of truth
+func (s *stockRepo) SyncStockToLedger(drift *models.StockDrift) error {
+	if drift.VariantID != nil {
+		return s.DB.Exec(`UPDATE product_variants SET stock =
+			(SELECT coalesce(sum(change), 0) FROM stock_movements WHERE variant_id = ?)
+			WHERE id = ?`, *drift.VariantID, *drift.VariantID).Error
+	}
+	return s.DB.Exec(`UPDATE products SET stock =
+		(SELECT coalesce(sum(change), 0) FROM stock_movements WHERE product_id = ? AND variant_id IS NULL)
+		WHERE id = ?`, drift.ProductID, drift.ProductID).Error
+}
+
+// stockItem scopes a query to the product or variant of a stock line
+func stockItem(tx *gorm.DB, line stockLine) *gorm.DB {
+	if line.variantID != 0 {
+		return tx.Model(&models.ProductVariant{}).Where("id = ? AND product_id = ?", line.variantID, line.productID)
+	}
+	return tx.Model(&models.Product{}).Where("id = ?", line.productID)
+}
+
+// recordStockMovement appends a movement to the ledger, computing its balance
+// from the item's previous movement. The caller must already have updated the
+// item's stock in tx: the row lock that takes orders the movements of an item.
+func recordStockMovement(tx *gorm.DB, movement *models.StockMovement) error {
+	previous := tx.Model(&models.StockMovement{}).Where("product_id = ?", movement.ProductID)
+	if movement.VariantID != nil {
+		previous = previous.Where("variant_id = ?", *movement.VariantID)
+	} else {
+		previous = previous.Where("variant_id IS NULL")
+	}
+	var balances []int
+	if err := previous.Order("id DESC").Limit(1).Pluck("balance_after", &balances).Error; err != nil {
+		return err
+	}
+	movement.BalanceAfter = movement.Change
+	if len(balances) > 0 {
+		movement.BalanceAfter += balances[0]
+	}
+	return tx.Create(movement).Error
+}
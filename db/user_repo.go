@@ -0,0 +1,96 @@
+package db
+
+import (
+	"github.com/google/uuid"
+	"github.com/techagentng/ecommerce-api/models"
+	"gorm.io/gorm"
+)
+
+// UserRepository defines the methods the admin API uses to manage users
+type UserRepository interface {
+	ListUsers(query *models.UserListQuery) ([]*models.User, int64, error)
+	FindUserWithRole(id uint) (*models.User, error)
+	UpdateUserRole(userID uint, roleID uuid.UUID) error
+	SetUserSuspended(userID uint, suspendedAt int64, reason string) error
+	SoftDeleteUser(userID uint, deletedAt int64) error
+	CreateAuditLog(entry *models.AdminAuditLog) error
+}
+
+type userRepo struct {
+	DB *gorm.DB
+}
+
+// NewUserRepo creates a new instance of UserRepository
+func NewUserRepo(db *GormDB) UserRepository {
+	return &userRepo{db.DB}
+}
+
+// ListUsers returns one page of users matching the query and the total number
+// of matches
+func (u *userRepo) ListUsers(query *models.UserListQuery) ([]*models.User, int64, error) {
+	tx := u.DB.Model(&models.User{})
+	if query.Email != "" {
+		tx = tx.Where("users.email ILIKE ?", "%"+query.Email+"%")
+	}
+	if query.Role != "" {
+		tx = tx.Joins("JOIN roles ON roles.id = users.role_id").Where("roles.name = ?", query.Role)
+	}
+	switch query.Status {
+	case "deleted":
+		tx = tx.Where("users.deleted_at <> 0")
+	case "suspended":
+		tx = tx.Where("users.deleted_at = 0 AND users.suspended_at <> 0")
+	case "unverified":
+		tx = tx.Where("users.deleted_at = 0 AND users.is_email_active = ?", false)
+	case "active":
+		tx = tx.Where("users.deleted_at = 0 AND users.suspended_at = 0")
+	default:
+		tx = tx.Where("users.deleted_at = 0")
+	}
+
+	var total int64
+	if err := tx.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	var users []*models.User
+	err := tx.Preload("Role").
+		Order("users.id").
+		Offset((query.Page - 1) * query.PageSize).
+		Limit(query.PageSize).
+		Find(&users).Error
+	if err != nil {
+		return nil, 0, err
+	}
+	return users, total, nil
+}
+
+// FindUserWithRole retrieves a user, including deleted ones, with the role loaded
+func (u *userRepo) FindUserWithRole(id uint) (*models.User, error) {
+	var user models.User
+	if err := u.DB.Preload("Role").Where("id = ?", id).First(&user).Error; err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+func (u *userRepo) UpdateUserRole(userID uint, roleID uuid.UUID) error {
+	return u.DB.Model(&models.User{}).Where("id = ?", userID).Update("role_id", roleID).Error
+}
+
+// SetUserSuspended suspends the user, or lifts the suspension when suspendedAt is 0
+func (u *userRepo) SetUserSuspended(userID uint, suspendedAt int64, reason string) error {
+	return u.DB.Model(&models.User{}).Where("id = ?", userID).Updates(map[string]interface{}{
+		"suspended_at":     suspendedAt,
+		"suspended_reason": reason,
+	}).Error
+}
+
+// SoftDeleteUser marks the user as deleted, keeping the row for order history
+func (u *userRepo) SoftDeleteUser(userID uint, deletedAt int64) error {
+	return u.DB.Model(&models.User{}).Where("id = ?", userID).Update("deleted_at", deletedAt).Error
+}
+
+func (u *userRepo) CreateAuditLog(entry *models.AdminAuditLog) error {
+	return u.DB.Create(entry).Error
+}
@@ -0,0 +1,175 @@
+package db
+
+import (
+	"github.com/techagentng/ecommerce-api/models"
+	"gorm.io/gorm"
+)
+
+// VariantRepository defines the methods for product option and variant database operations
+type VariantRepository interface {
+	ListProductOptions(productID uint) ([]models.ProductOption, error)
+	EnsureOptionValues(productID uint, options []models.OptionRequest) ([]models.ProductOption, error)
+	ListVariants(productID uint) ([]*models.ProductVariant, error)
+	FindVariantByID(id uint) (*models.ProductVariant, error)
+	FindVariantsByIDs(ids []uint) ([]*models.ProductVariant, error)
+	CountVariants(productID uint) (int64, error)
+	CountVariantsByProductIDs(productIDs []uint) (map[uint]VariantCounts, error)
+	IsSKUTaken(sku string, excludeID uint) (bool, error)
+	CreateVariants(variants []*models.ProductVariant) error
+	UpdateVariant(variant *models.ProductVariant) error
+	DeleteVariant(variant *models.ProductVariant) error
+}
+
+// VariantCounts is how many variants a product has and how many are in stock
+type VariantCounts struct {
+	Variants int64
+	InStock  int64
+}
+
+type variantRepo struct {
+	DB *gorm.DB
+}
+
+// NewVariantRepo creates a new instance of VariantRepository
+func NewVariantRepo(db *GormDB) VariantRepository {
+	return &variantRepo{db.DB}
+}
+
+// ListProductOptions returns the product's options and their values in position order
+func (r *variantRepo) ListProductOptions(productID uint) ([]models.ProductOption, error) {
+	var options []models.ProductOption
+	err := r.DB.Where("product_id = ?", productID).
+		Preload("Values", func(tx *gorm.DB) *gorm.DB { return tx.Order("position, id") }).
+		Order("position, id").
+		Find(&options).Error
+	return options, err
+}
+
+// EnsureOptionValues adds any of the named options and values the product does
+// not have yet, and returns all of the product's options
+func (r *variantRepo) EnsureOptionValues(productID uint, requested []models.OptionRequest) ([]models.ProductOption, error) {
+	err := r.DB.Transaction(func(tx *gorm.DB) error {
+		for position, request := range requested {
+			option := models.ProductOption{ProductID: productID, Name: request.Name}
+			err := tx.Where("product_id = ? AND name = ?", productID, request.Name).
+				Attrs(models.ProductOption{Position: position}).
+				FirstOrCreate(&option).Error
+			if err != nil {
+				return err
+			}
+			for valuePosition, value := range request.Values {
+				optionValue := models.ProductOptionValue{OptionID: option.ID, Value: value}
+				err := tx.Where("option_id = ? AND value = ?", option.ID, value).
+					Attrs(models.ProductOptionValue{Position: valuePosition}).
+					FirstOrCreate(&optionValue).Error
+				if err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return r.ListProductOptions(productID)
+}
+
+func (r *variantRepo) ListVariants(productID uint) ([]*models.ProductVariant, error) {
+	var variants []*models.ProductVariant
+	err := r.DB.Where("product_id = ?", productID).
+		Preload("OptionValues.Option").
+		Order("id").
+		Find(&variants).Error
+	return variants, err
+}
+
+func (r *variantRepo) FindVariantByID(id uint) (*models.ProductVariant, error) {
+	var variant models.ProductVariant
+	if err := r.DB.Preload("OptionValues.Option").First(&variant, id).Error; err != nil {
+		return nil, err
+	}
+	return &variant, nil
+}
+
+// FindVariantsByIDs retrieves the variants with the given IDs, in no particular order
+func (r *variantRepo) FindVariantsByIDs(ids []uint) ([]*models.ProductVariant, error) {
+	var variants []*models.ProductVariant
+	if len(ids) == 0 {
+		return variants, nil
+	}
+	err := r.DB.Where("id IN ?", ids).Find(&variants).Error
+	return variants, err
+}
+
+func (r *variantRepo) CountVariants(productID uint) (int64, error) {
+	var count int64
+	err := r.DB.Model(&models.ProductVariant{}).Where("product_id = ?", productID).Count(&count).Error
+	return count, err
+}
+
+// CountVariantsByProductIDs counts the variants of the products in one query.
+// Products without variants are left out of the map.
+func (r *variantRepo) CountVariantsByProductIDs(productIDs []uint) (map[uint]VariantCounts, error) {
+	counts := map[uint]VariantCounts{}
+	if len(productIDs) == 0 {
+		return counts, nil
+	}
+	var rows []struct {
+		ProductID uint
+		Variants  int64
+		InStock   int64
+	}
+	err := r.DB.Model(&models.ProductVariant{}).
+		Select("product_id, COUNT(*) AS variants, COUNT(*) FILTER (WHERE stock > 0) AS in_stock").
+		Where("product_id IN ?", productIDs).
+		Group("product_id").
+		Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+	for _, row := range rows {
+		counts[row.ProductID] = VariantCounts{Variants: row.Variants, InStock: row.InStock}
+	}
+	return counts, nil
+}
+
+func (r *variantRepo) IsSKUTaken(sku string, excludeID uint) (bool, error) {
+	var count int64
+	err := r.DB.Model(&models.ProductVariant{}).
+		Where("sku = ? AND id <> ?", sku, excludeID).
+		Count(&count).Error
+	return count > 0, err
+}
+
+// CreateVariants inserts the variants and their option values in one
+// transaction, recording each variant's stock as its opening movement
+func (r *variantRepo) CreateVariants(variants []*models.ProductVariant) error {
+	if len(variants) == 0 {
+		return nil
+	}
+	return r.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Omit("OptionValues.*").Create(variants).Error; err != nil {
+			return err
+		}
+		for _, variant := range variants {
+			variantID := variant.ID
+			if err := recordOpeningStock(tx, variant.ProductID, &variantID, variant.Stock); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// UpdateVariant saves the variant's SKU and price. Stock only changes through
+// the ledger.
+func (r *variantRepo) UpdateVariant(variant *models.ProductVariant) error {
+	return r.DB.Model(variant).Select("sku", "price", "updated_at").Updates(variant).Error
+}
+
+// DeleteVariant removes the variant and its option value links. Order items
+// keep the variant's ID and SKU.
+func (r *variantRepo) DeleteVariant(variant *models.ProductVariant) error {
+	return r.DB.Select("OptionValues").Delete(variant).Error
+}
@@ -4,7 +4,9 @@ import (
 	"errors"
 	"fmt"
 	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5/pgconn"
 	"net/http"
+	"regexp"
 	"strings"
 )
 
@@ -47,7 +49,29 @@ var ErrDuplicateRequest = New("entity already exist", http.StatusBadRequest)
 // InValidPasswordError
 var ErrInvalidPassword = New("invalid email or password", http.StatusUnauthorized)
 
+// uniqueKeyDetail matches the column in the detail of a Postgres unique
+// violation, e.g. `Key (email)=(ada@example.com) already exists.`
+var uniqueKeyDetail = regexp.MustCompile(`^Key \(([^)]+)\)=`)
+
+// IsUniqueConstraintError reports whether err is a unique constraint violation
+func IsUniqueConstraintError(err error) bool {
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		return pgErr.Code == "23505"
+	}
+	return strings.Contains(err.Error(), "UNIQUE constraint failed")
+}
+
 func GetUniqueContraintError(err error) *Error {
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		if match := uniqueKeyDetail.FindStringSubmatch(pgErr.Detail); match != nil {
+			return &Error{
+				Message: fmt.Sprintf("%s must be unique", match[1]),
+				Status:  http.StatusBadRequest,
+			}
+		}
+	}
 	fields := strings.Split(err.Error(), "UNIQUE constraint failed: ")
 	if len(fields) < 2 {
 		return &Error{
@@ -3,9 +3,13 @@ package main
 import (
 	"github.com/techagentng/ecommerce-api/config"
 	"github.com/techagentng/ecommerce-api/db"
+	"github.com/techagentng/ecommerce-api/docs"
 	"github.com/techagentng/ecommerce-api/server"
 	"github.com/techagentng/ecommerce-api/services"
-	 "github.com/techagentng/ecommerce-api/docs"
+	"github.com/techagentng/ecommerce-api/services/blobstore"
+	"github.com/techagentng/ecommerce-api/services/jwt"
+	"github.com/techagentng/ecommerce-api/services/mailer"
+	"github.com/techagentng/ecommerce-api/services/payment"
 	"log"
 	_ "net/url"
 )
@@ -16,21 +20,95 @@ func main() {
 		log.Fatal(err)
 	}
 
+	keyring, err := jwt.LoadKeyring(conf)
+	if err != nil {
+		log.Fatal(err)
+	}
+
 	gormDB := db.GetDB(conf)
 	authRepo := db.NewAuthRepo(gormDB)
 	orderRepo := db.NewOrderRepo(gormDB)
 	productRepo := db.NewProductRepo(gormDB)
-	authService := services.NewAuthService(authRepo, conf)
-	orderService := services.NewOrderService(orderRepo, conf)
+	categoryRepo := db.NewCategoryRepo(gormDB)
+	variantRepo := db.NewVariantRepo(gormDB)
+	productImageRepo := db.NewProductImageRepo(gormDB)
+	stockRepo := db.NewStockRepo(gormDB)
+	idempotencyRepo := db.NewIdempotencyRepo(gormDB)
+	cartRepo := db.NewCartRepo(gormDB)
+	paymentRepo := db.NewPaymentRepo(gormDB)
+	roleRepo := db.NewRoleRepo(gormDB)
+	userRepo := db.NewUserRepo(gormDB)
+	mailSender, err := mailer.New(conf)
+	if err != nil {
+		log.Fatal(err)
+	}
+	passwordPolicy, err := services.NewPasswordPolicy(conf)
+	if err != nil {
+		log.Fatal(err)
+	}
+	var loginAttemptStore db.LoginAttemptStore
+	switch conf.LoginAttemptStore {
+	case "memory":
+		loginAttemptStore = db.NewMemoryLoginAttemptStore()
+	default:
+		loginAttemptStore = db.NewLoginAttemptRepo(gormDB)
+	}
+	loginThrottle := services.NewLoginThrottle(loginAttemptStore, conf)
+	authService := services.NewAuthService(authRepo, mailSender, passwordPolicy, loginThrottle, keyring, conf)
+	orderService := services.NewOrderService(orderRepo, productRepo, variantRepo, conf)
+	blobStore, err := blobstore.New(conf)
+	if err != nil {
+		log.Fatal(err)
+	}
+	mediaService := services.NewMediaService(blobStore, conf)
+	var searchIndex db.SearchIndex
+	switch conf.SearchIndex {
+	case "memory":
+		searchIndex = db.NewMemorySearchIndex()
+	default:
+		searchIndex = db.NewPostgresSearchIndex(gormDB)
+	}
+	productService := services.NewProductService(productRepo, categoryRepo, variantRepo, productImageRepo, searchIndex, mediaService, conf)
+	if conf.SearchIndex == "memory" {
+		if err := productService.RebuildSearchIndex(); err != nil {
+			log.Fatal(err)
+		}
+	}
+	categoryService := services.NewCategoryService(categoryRepo, productRepo, conf)
+	variantService := services.NewVariantService(variantRepo, productRepo, conf)
+	productImageService := services.NewProductImageService(productImageRepo, productRepo, mediaService, conf)
+	stockService := services.NewStockService(stockRepo, productRepo, variantRepo, conf)
+	idempotencyService := services.NewIdempotencyService(idempotencyRepo, conf)
+	cartService := services.NewCartService(cartRepo, productRepo, variantRepo, orderService, conf)
+	paymentProvider, err := payment.New(conf)
+	if err != nil {
+		log.Fatal(err)
+	}
+	paymentService := services.NewPaymentService(paymentRepo, orderService, paymentProvider, conf)
+	roleService := services.NewRoleService(roleRepo, conf)
+	userAdminService := services.NewUserAdminService(userRepo, authRepo, authService, loginThrottle, conf)
 
 	s := &server.Server{
-		Config:         conf,
-		AuthRepository: authRepo,
-        OrderRepo: orderRepo,
-		AuthService:    authService,
-		OrderService:   orderService,
-		ProductRepo: productRepo,
-		DB:             db.GormDB{},
+		Config:              conf,
+		Keyring:             keyring,
+		AuthRepository:      authRepo,
+		OrderRepo:           orderRepo,
+		AuthService:         authService,
+		OrderService:        orderService,
+		ProductService:      productService,
+		CategoryService:     categoryService,
+		VariantService:      variantService,
+		ProductImageService: productImageService,
+		MediaService:        mediaService,
+		StockService:        stockService,
+		IdempotencyService:  idempotencyService,
+		CartService:         cartService,
+		PaymentService:      paymentService,
+		RoleService:         roleService,
+		UserAdminService:    userAdminService,
+		ProductRepo:         productRepo,
+		VariantRepo:         variantRepo,
+		DB:                  db.GormDB{},
 	}
 
 	s.Start()
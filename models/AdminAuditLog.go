@@ -0,0 +1,20 @@
+package models
+
+// AdminAuditLog records a change an admin made to a user account
+type AdminAuditLog struct {
+	Model
+	ActorID      uint   `json:"actor_id" gorm:"index;not null"`
+	TargetUserID uint   `json:"target_user_id" gorm:"index;not null"`
+	Action       string `json:"action" gorm:"not null"`
+	Details      string `json:"details"`
+}
+
+const (
+	AuditActionAssignRole     = "assign_role"
+	AuditActionSuspend        = "suspend"
+	AuditActionUnsuspend      = "unsuspend"
+	AuditActionDelete         = "delete"
+	AuditActionRevokeSessions = "revoke_sessions"
+	AuditActionUnlock         = "unlock"
+	AuditActionResetMFA       = "reset_mfa"
+)
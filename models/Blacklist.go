@@ -1,7 +1,16 @@
 package models
 
+// Blacklist holds revoked access tokens until they expire. Token is the
+// token's jti claim (or a SHA-256 hash for tokens without one), never the raw
+// JWT.
 type Blacklist struct {
 	Model
-	Token string `json:"token"`
-	Email string `json:"email"`
+	Token     string `json:"-" gorm:"index"`
+	Email     string `json:"email"`
+	UserID    uint   `json:"user_id"`
+	ExpiresAt int64  `json:"expires_at" gorm:"index"`
+}
+
+type LogoutRequest struct {
+	RefreshToken string `json:"refresh_token"`
 }
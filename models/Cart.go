@@ -0,0 +1,89 @@
+package models
+
+// Cart holds what a customer means to order. A cart belongs either to a user
+// or to a guest, who is identified by a random token kept in a cookie; only
+// the token's hash is stored. A guest cart is merged into the user's cart when
+// the guest logs in. Carts untouched until ExpiresAt are deleted.
+type Cart struct {
+	ID        uint       `json:"id" gorm:"primaryKey"`
+	UserID    *uint      `json:"user_id,omitempty" gorm:"uniqueIndex"`
+	TokenHash *string    `json:"-" gorm:"uniqueIndex"`
+	Items     []CartItem `json:"items" gorm:"foreignKey:CartID"`
+	ExpiresAt int64      `json:"expires_at" gorm:"not null;index"`
+	CreatedAt int64      `json:"created_at"`
+	UpdatedAt int64      `json:"updated_at"`
+}
+
+// CartItem is a line of a cart. It only records what was added; the line is
+// priced from the catalog each time the cart is read. AddedUnitPrice is the
+// price when the line was added, so a price change can be pointed out.
+type CartItem struct {
+	ID             uint    `json:"id" gorm:"primaryKey"`
+	CartID         uint    `json:"cart_id" gorm:"not null;index"`
+	ProductID      uint    `json:"product_id" gorm:"not null"`
+	VariantID      *uint   `json:"variant_id"`
+	Quantity       int     `json:"quantity" gorm:"not null"`
+	AddedUnitPrice float64 `json:"added_unit_price"`
+	CreatedAt      int64   `json:"created_at"`
+	UpdatedAt      int64   `json:"updated_at"`
+}
+
+// CartOwner identifies the cart a request works on: the cart of the user with
+// UserID, or else the guest cart of GuestToken
+type CartOwner struct {
+	UserID     uint
+	GuestToken string
+}
+
+// Warnings of a cart line. Every warning but a price change keeps the cart
+// from being checked out.
+const (
+	CartWarningUnavailable     = "unavailable"
+	CartWarningVariantRequired = "variant_required"
+	CartWarningOutOfStock      = "out_of_stock"
+	CartWarningLowStock        = "insufficient_stock"
+	CartWarningPriceChanged    = "price_changed"
+)
+
+// AddCartItemRequest adds a quantity of a product, or of one of its variants,
+// to the cart. Adding a line that is already in the cart raises its quantity.
+type AddCartItemRequest struct {
+	ProductID uint  `json:"product_id" binding:"required"`
+	VariantID *uint `json:"variant_id"`
+	Quantity  int   `json:"quantity" binding:"required,min=1,max=1000"`
+}
+
+// UpdateCartItemRequest sets the quantity of a cart line
+type UpdateCartItemRequest struct {
+	Quantity int `json:"quantity" binding:"required,min=1,max=1000"`
+}
+
+// CartResponse is a cart priced from the current catalog. Subtotal is the sum
+// of the lines that can be ordered.
+type CartResponse struct {
+	ID        uint               `json:"id,omitempty"`
+	Items     []CartLineResponse `json:"items"`
+	Subtotal  float64            `json:"subtotal"`
+	ItemCount int                `json:"item_count"`
+	// CanCheckout is false while a line has a warning other than a price change
+	CanCheckout bool  `json:"can_checkout"`
+	ExpiresAt   int64 `json:"expires_at,omitempty"`
+}
+
+// CartLineResponse is a cart line with its current name, price and stock.
+// Available is the quantity that can be ordered now; Warning says why it is
+// less than Quantity, or that the price changed since the line was added.
+type CartLineResponse struct {
+	ID             uint    `json:"id"`
+	ProductID      uint    `json:"product_id"`
+	VariantID      *uint   `json:"variant_id"`
+	SKU            string  `json:"sku"`
+	Name           string  `json:"name"`
+	Quantity       int     `json:"quantity"`
+	UnitPrice      float64 `json:"unit_price"`
+	AddedUnitPrice float64 `json:"added_unit_price"`
+	TotalPrice     float64 `json:"total_price"`
+	Available      int     `json:"available"`
+	Warning        string  `json:"warning,omitempty"`
+	Message        string  `json:"message,omitempty"`
+}
@@ -0,0 +1,22 @@
+package models
+
+// CatalogProduct is the customer-facing view of a product. Stock levels are
+// internal, customers only see whether the product can be ordered.
+type CatalogProduct struct {
+	ID          uint    `json:"id"`
+	Name        string  `json:"name"`
+	Description string  `json:"description"`
+	Price       float64 `json:"price"`
+	Available   bool    `json:"available"`
+	// Variants and Images are only set when a single product is requested
+	Variants []CatalogVariant `json:"variants,omitempty"`
+	Images   []CatalogImage   `json:"images,omitempty"`
+}
+
+type CatalogListResponse struct {
+	Products   []CatalogProduct `json:"products"`
+	Total      int64            `json:"total"`
+	Page       int              `json:"page,omitempty"`
+	PageSize   int              `json:"page_size"`
+	NextCursor string           `json:"next_cursor,omitempty"`
+}
@@ -0,0 +1,59 @@
+package models
+
+// Category groups products into a tree. Path lists the IDs from the root down
+// to and including the category, e.g. "/1/4/9/", so a subtree is every
+// category whose path starts with its root's path. ParentID references the
+// parent category, so a parent with children cannot be deleted.
+type Category struct {
+	ID        uint   `gorm:"primaryKey" json:"id"`
+	Name      string `gorm:"not null" json:"name"`
+	Slug      string `gorm:"uniqueIndex;not null" json:"slug"`
+	ParentID  *uint  `gorm:"index" json:"parent_id"`
+	Path      string `gorm:"index;not null" json:"-"`
+	CreatedAt int64  `json:"created_at"`
+	UpdatedAt int64  `json:"updated_at"`
+}
+
+// CategoryCrumb is one step of a breadcrumb path
+type CategoryCrumb struct {
+	ID   uint   `json:"id"`
+	Name string `json:"name"`
+	Slug string `json:"slug"`
+}
+
+type CategoryResponse struct {
+	ID       uint   `json:"id"`
+	Name     string `json:"name"`
+	Slug     string `json:"slug"`
+	ParentID *uint  `json:"parent_id"`
+	// Breadcrumbs runs from the root category down to this one
+	Breadcrumbs []CategoryCrumb `json:"breadcrumbs"`
+}
+
+// CategoryNode is a category with its subcategories
+type CategoryNode struct {
+	ID       uint           `json:"id"`
+	Name     string         `json:"name"`
+	Slug     string         `json:"slug"`
+	Children []CategoryNode `json:"children"`
+}
+
+type CreateCategoryRequest struct {
+	Name     string `json:"name" binding:"required"`
+	Slug     string `json:"slug"`
+	ParentID *uint  `json:"parent_id"`
+}
+
+// UpdateCategoryRequest renames or moves a category. ParentID moves it under
+// another category and MoveToRoot makes it a root; with neither the parent is
+// unchanged.
+type UpdateCategoryRequest struct {
+	Name       *string `json:"name"`
+	Slug       *string `json:"slug"`
+	ParentID   *uint   `json:"parent_id"`
+	MoveToRoot bool    `json:"move_to_root"`
+}
+
+type SetProductCategoriesRequest struct {
+	CategoryIDs []uint `json:"category_ids"`
+}
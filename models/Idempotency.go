@@ -0,0 +1,21 @@
+package models
+
+// IdempotencyKey is a request made with an Idempotency-Key header and, once
+// it was handled, its response. Keys are unique per user. While StatusCode is
+// zero the request is in flight and LockedUntil holds off other requests with
+// the same key; a lock left behind by a crashed request is taken over once it
+// has passed.
+type IdempotencyKey struct {
+	ID     uint   `gorm:"primaryKey"`
+	UserID uint   `gorm:"not null;uniqueIndex:idx_idempotency_user_key"`
+	Key    string `gorm:"not null;uniqueIndex:idx_idempotency_user_key"`
+	// RequestHash is the SHA-256 of the request's method, path and body
+	RequestHash  string `gorm:"not null"`
+	StatusCode   int
+	ContentType  string
+	ResponseBody []byte
+	LockedUntil  int64
+	// ExpiresAt is when the key can be reused for a new request
+	ExpiresAt int64 `gorm:"index"`
+	CreatedAt int64
+}
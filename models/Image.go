@@ -0,0 +1,62 @@
+package models
+
+// ProductImage is an image in a product's gallery, shown in Position order.
+// URL is the large rendition.
+type ProductImage struct {
+	ID           uint   `json:"id" gorm:"primaryKey"`
+	ProductID    uint   `json:"product_id" gorm:"index;not null"`
+	Key          string `json:"-" gorm:"index;not null"`
+	URL          string `json:"url" gorm:"not null"`
+	MediumURL    string `json:"medium_url"`
+	ThumbnailURL string `json:"thumbnail_url"`
+	Width        int    `json:"width"`
+	Height       int    `json:"height"`
+	AltText      string `json:"alt_text"`
+	Position     int    `json:"position"`
+	ContentType  string `json:"content_type"`
+	Size         int64  `json:"size"`
+	CreatedAt    int64  `json:"created_at"`
+}
+
+// Renditions stored for every uploaded image
+const (
+	RenditionThumbnail = "thumbnail"
+	RenditionMedium    = "medium"
+	RenditionLarge     = "large"
+)
+
+// ImageRendition is a resized copy of an uploaded image
+type ImageRendition struct {
+	Key    string
+	URL    string
+	Width  int
+	Height int
+	Size   int64
+}
+
+// StoredImage is an uploaded image processed into its renditions. Key is the
+// directory holding them, named after the hash of the uploaded content so the
+// same upload is stored once.
+type StoredImage struct {
+	Key         string
+	ContentType string
+	Renditions  map[string]ImageRendition
+}
+
+type UpdateProductImageRequest struct {
+	AltText  *string `json:"alt_text" binding:"omitempty,max=255"`
+	Position *int    `json:"position" binding:"omitempty,min=0"`
+}
+
+// ReorderProductImagesRequest lists every image of the product in its new order
+type ReorderProductImagesRequest struct {
+	ImageIDs []uint `json:"image_ids" binding:"required"`
+}
+
+// CatalogImage is the customer-facing view of a product image
+type CatalogImage struct {
+	URL          string `json:"url"`
+	MediumURL    string `json:"medium_url"`
+	ThumbnailURL string `json:"thumbnail_url"`
+	AltText      string `json:"alt_text"`
+}
@@ -0,0 +1,36 @@
+package models
+
+// Formats accepted for product import and export
+const (
+	FormatCSV    = "csv"
+	FormatNDJSON = "ndjson"
+)
+
+// ProductCSVHeader is the column order of product CSV files. Import matches
+// columns by name, so they may come in any order.
+var ProductCSVHeader = []string{"sku", "name", "description", "price", "quantity", "stock"}
+
+// ImportRowError reports why a row of an import file was rejected. Line is the
+// line number in the file.
+type ImportRowError struct {
+	Line    int    `json:"line"`
+	Field   string `json:"field,omitempty"`
+	Message string `json:"message"`
+}
+
+// ImportReport summarises an import. Nothing is written unless every row is
+// valid; Committed is false for dry runs and rejected files.
+type ImportReport struct {
+	DryRun    bool             `json:"dry_run"`
+	Committed bool             `json:"committed"`
+	Rows      int              `json:"rows"`
+	Created   int              `json:"created"`
+	Updated   int              `json:"updated"`
+	Errors    []ImportRowError `json:"errors"`
+}
+
+// ImportRow is a parsed row of an import file
+type ImportRow struct {
+	Line    int
+	Product Product
+}
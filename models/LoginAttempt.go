@@ -0,0 +1,12 @@
+package models
+
+// LoginAttempt tracks recent failed logins for an account or client IP
+type LoginAttempt struct {
+	// Key identifies what is throttled, e.g. "account:jane@example.com" or "ip:10.0.0.1"
+	Key           string `json:"key" gorm:"primaryKey"`
+	Failures      int    `json:"failures"`
+	LastFailureAt int64  `json:"last_failure_at"`
+	LockedUntil   int64  `json:"locked_until"`
+	// ExpiresAt is when the record can be forgotten
+	ExpiresAt int64 `json:"expires_at" gorm:"index"`
+}
@@ -0,0 +1,34 @@
+package models
+
+// MFARecoveryCode is a one-time code that can stand in for a TOTP code. Only
+// the SHA-256 hash of the code is stored.
+type MFARecoveryCode struct {
+	Model
+	UserID   uint   `json:"user_id" gorm:"index;not null"`
+	CodeHash string `json:"-" gorm:"index;not null"`
+	UsedAt   int64  `json:"used_at"`
+}
+
+type MFAEnrollResponse struct {
+	Secret string `json:"secret"`
+	URI    string `json:"otpauth_uri"`
+}
+
+type MFACodeRequest struct {
+	Code string `json:"code" binding:"required"`
+}
+
+// MFAVerifyRequest completes a login that returned an MFA challenge. Code is a
+// TOTP code or a recovery code.
+type MFAVerifyRequest struct {
+	MFAToken string `json:"mfa_token" binding:"required"`
+	Code     string `json:"code" binding:"required"`
+}
+
+type MFARecoveryCodesResponse struct {
+	RecoveryCodes []string `json:"recovery_codes"`
+}
+
+type SetRoleMFARequest struct {
+	RequireMFA bool `json:"require_mfa"`
+}
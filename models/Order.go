@@ -4,38 +4,54 @@ import (
 	"time"
 )
 
+// Order is the header of an order; what was ordered is held by its Items.
+// TotalPrice is the sum of the lines' totals.
 type Order struct {
-	ID         uint       `json:"id" gorm:"primaryKey"` 
-	UserID     uint      `json:"user_id" gorm:"not null"`
-	ProductID  uint      `json:"product_id" gorm:"not null"`
-	Quantity   int       `json:"quantity" binding:"required"`
-	TotalPrice float64   `json:"total_price"`
-	Status     string    `json:"status" gorm:"default:'Pending'"`
-	CreatedAt  time.Time `json:"created_at"`
-	UpdatedAt  time.Time `json:"updated_at"`
+	ID         uint        `json:"id" gorm:"primaryKey"`
+	UserID     uint        `json:"user_id" gorm:"not null;index"`
+	TotalPrice float64     `json:"total_price"`
+	Status     OrderStatus `json:"status" gorm:"default:'Pending'"`
+	CreatedAt  time.Time   `json:"created_at"`
+	UpdatedAt  time.Time   `json:"updated_at"`
 	Items      []OrderItem `json:"items" gorm:"foreignKey:OrderID"`
-	User    User    `json:"user" gorm:"foreignKey:UserID"`
-	Product Product `json:"product" gorm:"foreignKey:ProductID"`
+	Payments   []Payment   `json:"payments,omitempty" gorm:"foreignKey:OrderID"`
+	User       *User       `json:"user,omitempty" gorm:"foreignKey:UserID"`
 }
 
+// OrderItem is a line of an order. The product's name, SKU and price are
+// copied when the order is placed, so the line still reads the same after
+// the product changes or is deleted.
 type OrderItem struct {
-    ID         uint    `json:"id" gorm:"primaryKey"`
-    OrderID    uint `json:"order_id" gorm:"type:uuid"`
-    ProductID  uint    `json:"product_id" binding:"required"`
-    Quantity   int     `json:"quantity" binding:"required"`
-    UnitPrice  float64 `json:"unit_price"`
-    TotalPrice float64 `json:"total_price"`
+	ID         uint    `json:"id" gorm:"primaryKey"`
+	OrderID    uint    `json:"order_id" gorm:"not null;index"`
+	ProductID  uint    `json:"product_id" gorm:"not null;index"`
+	VariantID  *uint   `json:"variant_id"`
+	SKU        string  `json:"sku"`
+	Name       string  `json:"name"`
+	Quantity   int     `json:"quantity" gorm:"not null"`
+	UnitPrice  float64 `json:"unit_price"`
+	TotalPrice float64 `json:"total_price"`
 }
 
-type OrderRequest struct {
-    UserID uint        `json:"user_id" binding:"required"` 
-    Items  []OrderItem `json:"items" binding:"required"`   
+// CalculateTotals sets each line's total from its quantity and unit price,
+// and the order's total from its lines. Both are summed in minor units, so
+// TotalPrice is the amount TotalMinorUnits charges.
+func (o *Order) CalculateTotals() {
+	for i := range o.Items {
+		item := &o.Items[i]
+		item.TotalPrice = FromMinorUnits(MinorUnits(item.UnitPrice) * int64(item.Quantity))
+	}
+	o.TotalPrice = FromMinorUnits(o.TotalMinorUnits())
 }
 
-type PlaceOrderResponse struct {
-    OrderID     uint `json:"order_id"`
-    UserID      uint   `json:"user_id"`
-    TotalPrice  float64 `json:"total_price"`
-    Status      string `json:"status"`
-    CreatedAt   string `json:"created_at"`
-}
\ No newline at end of file
+// PlaceOrderRequest is a customer's order. Items of products with variants
+// must name a variant.
+type PlaceOrderRequest struct {
+	Items []OrderItemRequest `json:"items" binding:"required,min=1,dive"`
+}
+
+type OrderItemRequest struct {
+	ProductID uint  `json:"product_id" binding:"required"`
+	VariantID *uint `json:"variant_id"`
+	Quantity  int   `json:"quantity" binding:"required,min=1"`
+}
@@ -0,0 +1,89 @@
+package models
+
+import "time"
+
+// OrderStatus is a step of an order's life cycle. An order only moves along
+// the transitions in orderTransitions:
+//
+//	Pending -> Paid -> Processing -> Shipped -> Delivered
+//	Pending -> Canceled
+//	Paid, Processing, Delivered -> Refunded
+type OrderStatus string
+
+const (
+	OrderStatusPending    OrderStatus = "Pending"
+	OrderStatusPaid       OrderStatus = "Paid"
+	OrderStatusProcessing OrderStatus = "Processing"
+	OrderStatusShipped    OrderStatus = "Shipped"
+	OrderStatusDelivered  OrderStatus = "Delivered"
+	OrderStatusCanceled   OrderStatus = "Canceled"
+	OrderStatusRefunded   OrderStatus = "Refunded"
+)
+
+var orderTransitions = map[OrderStatus][]OrderStatus{
+	OrderStatusPending:    {OrderStatusPaid, OrderStatusCanceled},
+	OrderStatusPaid:       {OrderStatusProcessing, OrderStatusRefunded},
+	OrderStatusProcessing: {OrderStatusShipped, OrderStatusRefunded},
+	OrderStatusShipped:    {OrderStatusDelivered},
+	OrderStatusDelivered:  {OrderStatusRefunded},
+}
+
+// Valid reports whether s is a known status
+func (s OrderStatus) Valid() bool {
+	switch s {
+	case OrderStatusPending, OrderStatusPaid, OrderStatusProcessing, OrderStatusShipped,
+		OrderStatusDelivered, OrderStatusCanceled, OrderStatusRefunded:
+		return true
+	}
+	return false
+}
+
+// CanTransitionTo reports whether an order in status s may move to next
+func (s OrderStatus) CanTransitionTo(next OrderStatus) bool {
+	for _, allowed := range orderTransitions[s] {
+		if allowed == next {
+			return true
+		}
+	}
+	return false
+}
+
+// Transitions returns the statuses an order in status s may move to
+func (s OrderStatus) Transitions() []OrderStatus {
+	return orderTransitions[s]
+}
+
+// ReleasesStock reports whether moving from s to next returns the order's
+// stock: the order is called off before it was shipped. Goods refunded after
+// delivery are restocked with a stock adjustment once they are back.
+func (s OrderStatus) ReleasesStock(next OrderStatus) bool {
+	switch next {
+	case OrderStatusCanceled, OrderStatusRefunded:
+		return s == OrderStatusPending || s == OrderStatusPaid || s == OrderStatusProcessing
+	}
+	return false
+}
+
+// OrderStatusEvent records a transition of an order's status. FromStatus is
+// empty for the event of the order being placed.
+type OrderStatusEvent struct {
+	ID         uint        `json:"id" gorm:"primaryKey"`
+	OrderID    uint        `json:"order_id" gorm:"not null;index"`
+	FromStatus OrderStatus `json:"from_status,omitempty"`
+	ToStatus   OrderStatus `json:"to_status" gorm:"not null"`
+	// ActorID is the user who made the change, nil for system changes
+	ActorID   *uint     `json:"actor_id,omitempty"`
+	Reason    string    `json:"reason,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// UpdateOrderStatusRequest moves an order to another status
+type UpdateOrderStatusRequest struct {
+	Status OrderStatus `json:"status" binding:"required"`
+	Reason string      `json:"reason" binding:"max=500"`
+}
+
+// CancelOrderRequest optionally explains a cancellation
+type CancelOrderRequest struct {
+	Reason string `json:"reason" binding:"max=500"`
+}
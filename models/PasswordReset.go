@@ -0,0 +1,25 @@
+package models
+
+// PasswordReset is a single-use password reset token. Only the SHA-256 hash of
+// the token is stored.
+type PasswordReset struct {
+	Model
+	UserID    uint   `json:"user_id" gorm:"index;not null"`
+	TokenHash string `json:"-" gorm:"uniqueIndex;not null"`
+	ExpiresAt int64  `json:"expires_at"`
+	UsedAt    int64  `json:"used_at"`
+}
+
+type ForgotPasswordRequest struct {
+	Email string `json:"email" binding:"required,email"`
+}
+
+type ResetPasswordRequest struct {
+	Token       string `json:"token" binding:"required"`
+	NewPassword string `json:"new_password" binding:"required"`
+}
+
+type ChangePasswordRequest struct {
+	OldPassword string `json:"old_password" binding:"required"`
+	NewPassword string `json:"new_password" binding:"required"`
+}
@@ -0,0 +1,73 @@
+package models
+
+import (
+	"math"
+	"time"
+)
+
+// PaymentStatus is a step of a payment attempt. An attempt is created pending,
+// authorized by the provider, then captured; it fails when the provider
+// declines, and a captured payment can be refunded. A payment is refunding
+// while the provider is asked for the refund, so it is refunded only once.
+type PaymentStatus string
+
+const (
+	PaymentStatusPending    PaymentStatus = "pending"
+	PaymentStatusAuthorized PaymentStatus = "authorized"
+	PaymentStatusCaptured   PaymentStatus = "captured"
+	PaymentStatusFailed     PaymentStatus = "failed"
+	PaymentStatusRefunding  PaymentStatus = "refunding"
+	PaymentStatusRefunded   PaymentStatus = "refunded"
+)
+
+// Payment is an attempt to pay an order through a payment provider. Amounts
+// are in minor units of Currency, e.g. kobo or cents, never floats.
+// TransactionID is the provider's reference for the attempt.
+type Payment struct {
+	ID             uint          `json:"id" gorm:"primaryKey"`
+	OrderID        uint          `json:"order_id" gorm:"not null;index"`
+	Provider       string        `json:"provider" gorm:"not null"`
+	TransactionID  string        `json:"transaction_id,omitempty" gorm:"index"`
+	Amount         int64         `json:"amount" gorm:"not null"`
+	RefundedAmount int64         `json:"refunded_amount"`
+	Currency       string        `json:"currency" gorm:"not null"`
+	Status         PaymentStatus `json:"status" gorm:"not null;index"`
+	FailureCode    string        `json:"failure_code,omitempty"`
+	FailureMessage string        `json:"failure_message,omitempty"`
+	CreatedAt      time.Time     `json:"created_at"`
+	UpdatedAt      time.Time     `json:"updated_at"`
+}
+
+// PayOrderRequest pays a pending order. PaymentMethod is the token the client
+// got from the payment provider for the customer's card or account.
+type PayOrderRequest struct {
+	PaymentMethod string `json:"payment_method" binding:"required,max=255"`
+}
+
+// RefundOrderRequest optionally explains a refund
+type RefundOrderRequest struct {
+	Reason string `json:"reason" binding:"max=500"`
+}
+
+// MinorUnits converts an amount of a currency with two decimals, as prices
+// are stored, to minor units, rounding to the nearest unit
+func MinorUnits(amount float64) int64 {
+	return int64(math.Round(amount * 100))
+}
+
+// FromMinorUnits converts minor units back to an amount with two decimals.
+// Totals are summed in minor units and converted once, so they show exactly
+// what is charged.
+func FromMinorUnits(amount int64) float64 {
+	return float64(amount) / 100
+}
+
+// TotalMinorUnits is the order's total in minor units, summed from the lines'
+// unit prices so no float rounding accumulates
+func (o *Order) TotalMinorUnits() int64 {
+	var total int64
+	for _, item := range o.Items {
+		total += MinorUnits(item.UnitPrice) * int64(item.Quantity)
+	}
+	return total
+}
@@ -0,0 +1,45 @@
+package models
+
+import "github.com/google/uuid"
+
+// Permission is a named action a role may perform, written as resource:action
+type Permission struct {
+	ID          uuid.UUID `gorm:"type:uuid;primary_key" json:"id"`
+	Name        string    `gorm:"uniqueIndex;not null" json:"name"`
+	Description string    `json:"description"`
+}
+
+const (
+	PermissionProductsCreate      = "products:create"
+	PermissionProductsRead        = "products:read"
+	PermissionProductsUpdate      = "products:update"
+	PermissionProductsDelete      = "products:delete"
+	PermissionCategoriesManage    = "categories:manage"
+	PermissionInventoryManage     = "inventory:manage"
+	PermissionOrdersUpdateStatus  = "orders:update_status"
+	PermissionOrdersCancelAny     = "orders:cancel_any"
+	PermissionOrdersRead          = "orders:read"
+	PermissionPaymentsRefund      = "payments:refund"
+	PermissionUsersRevokeSessions = "users:revoke_sessions"
+	PermissionUsersRead           = "users:read"
+	PermissionUsersManage         = "users:manage"
+	PermissionRolesManage         = "roles:manage"
+)
+
+// DefaultPermissions are seeded on startup; the Admin role always holds all of them
+var DefaultPermissions = []Permission{
+	{Name: PermissionProductsCreate, Description: "Create products"},
+	{Name: PermissionProductsRead, Description: "Read product management details"},
+	{Name: PermissionProductsUpdate, Description: "Update products"},
+	{Name: PermissionProductsDelete, Description: "Delete products"},
+	{Name: PermissionCategoriesManage, Description: "Create, move and delete categories"},
+	{Name: PermissionInventoryManage, Description: "Adjust stock and view stock history"},
+	{Name: PermissionOrdersUpdateStatus, Description: "Change the status of any order"},
+	{Name: PermissionOrdersCancelAny, Description: "Cancel orders placed by other users"},
+	{Name: PermissionOrdersRead, Description: "Read orders placed by other users"},
+	{Name: PermissionPaymentsRefund, Description: "Refund paid orders"},
+	{Name: PermissionUsersRevokeSessions, Description: "Revoke another user's sessions"},
+	{Name: PermissionUsersRead, Description: "List and inspect user accounts"},
+	{Name: PermissionUsersManage, Description: "Assign roles, suspend and delete user accounts"},
+	{Name: PermissionRolesManage, Description: "Create roles and assign permissions"},
+}
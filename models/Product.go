@@ -2,12 +2,24 @@ package models
 
 type Product struct {
 	ID        uint      `gorm:"primaryKey"`
+	SKU         *string `json:"sku,omitempty" gorm:"uniqueIndex" binding:"omitempty,max=64"`
 	Name        string  `json:"name" binding:"required"`
 	Description string  `json:"description"`
 	Price       float64 `json:"price" binding:"required,gt=0"`
-	Quantity    int     `json:"quantity" binding:"required"`
-	Orders   []Order   `json:"orders" gorm:"foreignKey:ProductID"`
-	Stock       int     `json:"stock"`
+	// Quantity is deprecated and kept for older clients: a product created
+	// with a quantity and no stock opens its stock with it. It is not used
+	// for inventory otherwise.
+	Quantity    int     `json:"quantity"`
+	// Stock is the number of units on hand. It is maintained through the
+	// stock ledger (StockMovement) and always equals the sum of the product's
+	// movements; updating a product does not change it.
+	Stock       int     `json:"stock" binding:"min=0"`
+	Categories  []Category `json:"categories,omitempty" gorm:"many2many:product_categories;"`
+	Options     []ProductOption  `json:"options,omitempty" gorm:"foreignKey:ProductID"`
+	Variants    []ProductVariant `json:"variants,omitempty" gorm:"foreignKey:ProductID"`
+	Images      []ProductImage   `json:"images,omitempty" gorm:"foreignKey:ProductID"`
+	CreatedAt   int64   `json:"created_at"`
+	UpdatedAt   int64   `json:"updated_at"`
 }
 
 type UpdateProductRequest struct {
@@ -15,4 +27,60 @@ type UpdateProductRequest struct {
     Description string  `json:"description"` 
     Price       float64 `json:"price"`       
     Stock       int     `json:"stock"`       
-}
\ No newline at end of file
+}
+
+// Sort keys accepted by ProductListQuery.Sort. Prefix with "-" to sort descending.
+const (
+	ProductSortID    = "id"
+	ProductSortName  = "name"
+	ProductSortPrice = "price"
+)
+
+// ProductListQuery holds the pagination, filters and sort order for listing
+// products. Pages are selected either by Page (offset) or Cursor (keyset).
+type ProductListQuery struct {
+	Page     int      `form:"page"`
+	PageSize int      `form:"page_size"`
+	Cursor   string   `form:"cursor"`
+	Name     string   `form:"name"`
+	MinPrice *float64 `form:"min_price"`
+	MaxPrice *float64 `form:"max_price"`
+	InStock  *bool    `form:"in_stock"`
+	Category *uint    `form:"category"`
+	Sort     string   `form:"sort"`
+
+	// After is the decoded Cursor; the page starts after this product
+	After *ProductCursor `form:"-"`
+	// CategoryPath is the Path of Category; products in it or any descendant match
+	CategoryPath string `form:"-"`
+}
+
+// SortKey returns the sort key without its direction prefix
+func (q *ProductListQuery) SortKey() string {
+	if len(q.Sort) > 0 && q.Sort[0] == '-' {
+		return q.Sort[1:]
+	}
+	return q.Sort
+}
+
+// SortDescending reports whether the sort key has the "-" prefix
+func (q *ProductListQuery) SortDescending() bool {
+	return len(q.Sort) > 0 && q.Sort[0] == '-'
+}
+
+// ProductCursor identifies the last product of a page by its sort key value
+// and ID, which breaks ties
+type ProductCursor struct {
+	Sort  string  `json:"s"`
+	ID    uint    `json:"id"`
+	Name  string  `json:"n,omitempty"`
+	Price float64 `json:"p,omitempty"`
+}
+
+type ProductListResponse struct {
+	Products   []*Product `json:"products"`
+	Total      int64      `json:"total"`
+	Page       int        `json:"page,omitempty"`
+	PageSize   int        `json:"page_size"`
+	NextCursor string     `json:"next_cursor,omitempty"`
+}
@@ -0,0 +1,18 @@
+package models
+
+// RefreshToken tracks an issued refresh token so it can be used exactly once.
+// Tokens minted from the same login share a FamilyID; replaying a used token
+// revokes the whole family.
+type RefreshToken struct {
+	Model
+	TokenID   string `json:"token_id" gorm:"uniqueIndex;not null"`
+	FamilyID  string `json:"family_id" gorm:"index;not null"`
+	UserID    uint   `json:"user_id" gorm:"index;not null"`
+	ExpiresAt int64  `json:"expires_at"`
+	UsedAt    int64  `json:"used_at"`
+	RevokedAt int64  `json:"revoked_at"`
+}
+
+type RefreshTokenRequest struct {
+	RefreshToken string `json:"refresh_token" binding:"required"`
+}
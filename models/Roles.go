@@ -3,12 +3,23 @@ package models
 import "github.com/google/uuid"
 
 type Role struct {
-	ID   uuid.UUID `gorm:"type:uuid;primary_key" json:"id"`
-	Name string    `json:"name"`
-	UserID      uint   `json:"user_id"`
+	ID          uuid.UUID    `gorm:"type:uuid;primary_key" json:"id"`
+	Name        string       `gorm:"uniqueIndex" json:"name"`
+	UserID      uint         `json:"user_id"`
+	Permissions []Permission `gorm:"many2many:role_permissions;" json:"permissions,omitempty"`
+	RequireMFA  bool         `json:"require_mfa"` // members must enroll in and use MFA
 }
 
 const (
 	RoleUser  = "User"
 	RoleAdmin = "Admin"
 )
+
+type CreateRoleRequest struct {
+	Name        string   `json:"name" binding:"required,min=2"`
+	Permissions []string `json:"permissions"`
+}
+
+type AssignPermissionsRequest struct {
+	Permissions []string `json:"permissions" binding:"required"`
+}
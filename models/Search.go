@@ -0,0 +1,37 @@
+package models
+
+// SearchHit is a product matched by the search index, best matches first.
+// NameHighlight and Snippet are HTML-escaped text with the matched words
+// marked by <mark> tags.
+type SearchHit struct {
+	ProductID     uint
+	Rank          float64
+	NameHighlight string
+	Snippet       string
+}
+
+// ProductSearchQuery holds a full-text search and the page to return
+type ProductSearchQuery struct {
+	Q        string `form:"q"`
+	Page     int    `form:"page"`
+	PageSize int    `form:"page_size"`
+}
+
+// SearchHighlight is the product name and an excerpt of its description as
+// HTML-escaped text, with the matched words wrapped in <mark> tags
+type SearchHighlight struct {
+	Name    string `json:"name"`
+	Snippet string `json:"snippet"`
+}
+
+type ProductSearchResult struct {
+	CatalogProduct
+	Highlight SearchHighlight `json:"highlight"`
+}
+
+type ProductSearchResponse struct {
+	Results  []ProductSearchResult `json:"results"`
+	Total    int64                 `json:"total"`
+	Page     int                   `json:"page"`
+	PageSize int                   `json:"page_size"`
+}
@@ -0,0 +1,79 @@
+package models
+
+// StockShortage is an order line that cannot be filled from stock
+type StockShortage struct {
+	ProductID uint   `json:"product_id"`
+	VariantID *uint  `json:"variant_id,omitempty"`
+	SKU       string `json:"sku,omitempty"`
+	Requested int    `json:"requested"`
+	Available int    `json:"available"`
+}
+
+// InsufficientStockResponse lists every line of a rejected order that is short of stock
+type InsufficientStockResponse struct {
+	Items []StockShortage `json:"items"`
+}
+
+// Reasons a StockMovement is recorded for
+const (
+	// StockReasonOpening is the stock an item had when it was created, or
+	// when the ledger was introduced
+	StockReasonOpening      = "opening"
+	StockReasonRestock      = "restock"
+	StockReasonSale         = "sale"
+	StockReasonCancellation = "cancellation"
+	StockReasonAdjustment   = "adjustment"
+)
+
+// StockMovement is an entry of the append-only stock ledger. Every change to
+// the stock of a product, or of one of its variants, is recorded as a
+// movement; the sum of an item's movements is its stock level, which
+// Product.Stock and ProductVariant.Stock hold for fast reads. Movements are
+// kept when the product is deleted.
+type StockMovement struct {
+	ID        uint  `gorm:"primaryKey" json:"id"`
+	ProductID uint  `gorm:"not null;index:idx_stock_movements_item" json:"product_id"`
+	VariantID *uint `gorm:"index:idx_stock_movements_item" json:"variant_id,omitempty"`
+	Change    int   `gorm:"not null" json:"change"`
+	// BalanceAfter is the item's ledger balance including this movement
+	BalanceAfter int    `gorm:"not null" json:"balance_after"`
+	Reason       string `gorm:"not null" json:"reason"`
+	// ActorID is the user who made the change, nil for system changes
+	ActorID   *uint  `json:"actor_id,omitempty"`
+	OrderID   *uint  `gorm:"index" json:"order_id,omitempty"`
+	Note      string `json:"note,omitempty"`
+	CreatedAt int64  `json:"created_at"`
+}
+
+// StockAdjustmentRequest changes the stock of a product, or of one of its
+// variants, by Change units
+type StockAdjustmentRequest struct {
+	VariantID *uint  `json:"variant_id"`
+	Change    int    `json:"change" binding:"required"`
+	Reason    string `json:"reason" binding:"required,oneof=restock adjustment"`
+	Note      string `json:"note" binding:"max=500"`
+}
+
+// StockMovementQuery selects a page of a product's stock history, newest first
+type StockMovementQuery struct {
+	VariantID *uint `form:"variant_id"`
+	Page      int   `form:"page"`
+	PageSize  int   `form:"page_size"`
+}
+
+type StockMovementListResponse struct {
+	Movements []StockMovement `json:"movements"`
+	Total     int64           `json:"total"`
+	Page      int             `json:"page"`
+	PageSize  int             `json:"page_size"`
+}
+
+// StockDrift is a product or variant whose stock column differs from the sum
+// of its ledger movements
+type StockDrift struct {
+	ProductID uint   `json:"product_id"`
+	VariantID *uint  `json:"variant_id,omitempty"`
+	SKU       string `json:"sku,omitempty"`
+	Stock     int    `json:"stock"`
+	Ledger    int    `json:"ledger"`
+}
@@ -7,20 +7,32 @@ import (
 
 type User struct {
 	Model
-	ID             uint      `gorm:"primaryKey"`
-	Name           string    `gorm:"size:255"`
-	Fullname       string    `json:"fullname" binding:"required,min=2"`
-	Username       string    `json:"username" binding:"required,min=2"`
-	Telephone      string    `json:"telephone" gorm:"unique;default:null" binding:"required"`
-	Email          string    `gorm:"unique;not null"`
-	Password       string    `json:"password,omitempty" gorm:"-"`
-	IsEmailActive  bool      `json:"-"`
-	HashedPassword string    `json:"-"`
-	AdminStatus    bool      `json:"is_admin" gorm:"foreignKey:Status"`
-	ThumbNailURL   string    `json:"thumbnail_url,omitempty"`
-	RoleID         uuid.UUID `gorm:"type:uuid" json:"role_id"`
-	Role           Role      `gorm:"foreignKey:RoleID" json:"role"`
-	Orders   []Order   `json:"orders" gorm:"foreignKey:UserID"`
+	ID                 uint      `gorm:"primaryKey"`
+	Name               string    `gorm:"size:255"`
+	Fullname           string    `json:"fullname" binding:"required,min=2"`
+	Username           string    `json:"username" binding:"required,min=2"`
+	Telephone          string    `json:"telephone" gorm:"unique;default:null" binding:"required"`
+	Email              string    `gorm:"unique;not null"`
+	Password           string    `json:"password,omitempty" gorm:"-"`
+	IsEmailActive      bool      `json:"-"`
+	VerificationSentAt int64     `json:"-"` // throttles verification email resends
+	HashedPassword     string    `json:"-"`
+	TokenVersion       int       `json:"-" gorm:"not null;default:0"`
+	SuspendedAt        int64     `json:"suspended_at"`
+	SuspendedReason    string    `json:"suspended_reason,omitempty"`
+	MFASecret          string    `json:"-"` // TOTP secret, active once MFAEnabled is set
+	MFAEnabled         bool      `json:"mfa_enabled"`
+	MFALastUsedStep    int64     `json:"-"` // rejects replay of an accepted TOTP code
+	AdminStatus        bool      `json:"is_admin" gorm:"foreignKey:Status"`
+	ThumbNailURL       string    `json:"thumbnail_url,omitempty"`
+	RoleID             uuid.UUID `gorm:"type:uuid" json:"role_id"`
+	Role               Role      `gorm:"foreignKey:RoleID" json:"role"`
+	Orders             []Order   `json:"orders" gorm:"foreignKey:UserID"`
+}
+
+// IsActive reports whether the account may authenticate
+func (u *User) IsActive() bool {
+	return u.SuspendedAt == 0 && u.DeletedAt == 0
 }
 
 type LoginRequest struct {
@@ -28,19 +40,72 @@ type LoginRequest struct {
 	Password string `json:"password" binding:"required"`
 }
 
+type ResendVerificationRequest struct {
+	Email string `json:"email" binding:"required,email"`
+}
+
 type UserResponse struct {
-	ID        uint   `json:"id"`
-	Fullname  string `json:"fullname"`
-	Username  string `json:"username"`
-	Telephone string `json:"telephone"`
-	Email     string `json:"email"`
-	RoleName      string             `json:"role_name"`
+	ID              uint   `json:"id"`
+	Fullname        string `json:"fullname"`
+	Username        string `json:"username"`
+	Telephone       string `json:"telephone"`
+	Email           string `json:"email"`
+	RoleName        string `json:"role_name"`
+	ThumbNailURL    string `json:"thumbnail_url,omitempty"`
+	IsEmailVerified bool   `json:"is_email_verified"`
+}
+
+// UpdateProfileRequest holds the profile fields a user can change; omitted
+// fields are left unchanged
+type UpdateProfileRequest struct {
+	Fullname  *string `json:"fullname" binding:"omitempty,min=2"`
+	Username  *string `json:"username" binding:"omitempty,min=2"`
+	Telephone *string `json:"telephone" binding:"omitempty,min=1"`
+	Email     *string `json:"email" binding:"omitempty,email"`
+}
+
+// AdminUserResponse is the view of a user returned by the admin API
+type AdminUserResponse struct {
+	UserResponse
+	SuspendedAt     int64  `json:"suspended_at"`
+	SuspendedReason string `json:"suspended_reason,omitempty"`
+	CreatedAt       int64  `json:"created_at"`
+	DeletedAt       int64  `json:"deleted_at"`
 }
 
+// UserListQuery holds the pagination and filters for listing users
+type UserListQuery struct {
+	Page     int    `form:"page"`
+	PageSize int    `form:"page_size"`
+	Email    string `form:"email"`
+	Role     string `form:"role"`
+	// Status is one of active, suspended, unverified or deleted
+	Status string `form:"status"`
+}
+
+type UserListResponse struct {
+	Users    []AdminUserResponse `json:"users"`
+	Total    int64               `json:"total"`
+	Page     int                 `json:"page"`
+	PageSize int                 `json:"page_size"`
+}
+
+type AssignRoleRequest struct {
+	Role string `json:"role" binding:"required"`
+}
+
+type SuspendUserRequest struct {
+	Reason string `json:"reason"`
+}
+
+// LoginResponse carries the token pair, or an MFA challenge token to exchange
+// at /auth/mfa/verify when MFARequired is set
 type LoginResponse struct {
 	UserResponse
-	AccessToken  string `json:"access_token"`
-	RefreshToken string `json:"refresh_token"`
+	AccessToken  string `json:"access_token,omitempty"`
+	RefreshToken string `json:"refresh_token,omitempty"`
+	MFARequired  bool   `json:"mfa_required,omitempty"`
+	MFAToken     string `json:"mfa_token,omitempty"`
 }
 
 func (u *User) VerifyPassword(password string) error {
@@ -49,4 +114,4 @@ func (u *User) VerifyPassword(password string) error {
 		return err // Passwords do not match
 	}
 	return nil // Passwords match
-}
\ No newline at end of file
+}
@@ -0,0 +1,104 @@
+package models
+
+// ProductOption is an axis a product varies along, such as size or colour
+type ProductOption struct {
+	ID        uint                 `gorm:"primaryKey" json:"id"`
+	ProductID uint                 `gorm:"index;not null" json:"product_id"`
+	Name      string               `gorm:"not null" json:"name"`
+	Position  int                  `json:"position"`
+	Values    []ProductOptionValue `gorm:"foreignKey:OptionID" json:"values"`
+}
+
+// ProductOptionValue is one value of an option, such as "M" for size
+type ProductOptionValue struct {
+	ID       uint          `gorm:"primaryKey" json:"id"`
+	OptionID uint          `gorm:"index;not null" json:"option_id"`
+	Option   ProductOption `gorm:"foreignKey:OptionID" json:"-"`
+	Value    string        `gorm:"not null" json:"value"`
+	Position int           `json:"position"`
+}
+
+// ProductVariant is a purchasable combination of option values with its own
+// SKU and stock. Price overrides the product's price when set.
+type ProductVariant struct {
+	ID           uint                 `gorm:"primaryKey" json:"id"`
+	ProductID    uint                 `gorm:"index;not null;uniqueIndex:idx_variant_options" json:"product_id"`
+	SKU          string               `gorm:"uniqueIndex;not null" json:"sku"`
+	Price        *float64             `json:"price"`
+	Stock        int                  `json:"stock"`
+	OptionValues []ProductOptionValue `gorm:"many2many:variant_option_values;" json:"-"`
+	// OptionKey is the sorted IDs of OptionValues, so a combination exists once per product
+	OptionKey string `gorm:"not null;uniqueIndex:idx_variant_options" json:"-"`
+	CreatedAt int64  `json:"created_at"`
+	UpdatedAt int64  `json:"updated_at"`
+}
+
+// EffectivePrice is the variant's price override, or the product's price
+func (v *ProductVariant) EffectivePrice(product *Product) float64 {
+	if v.Price != nil {
+		return *v.Price
+	}
+	return product.Price
+}
+
+// Options maps option names to the variant's values
+func (v *ProductVariant) Options() map[string]string {
+	options := make(map[string]string, len(v.OptionValues))
+	for _, value := range v.OptionValues {
+		options[value.Option.Name] = value.Value
+	}
+	return options
+}
+
+type VariantResponse struct {
+	ID            uint              `json:"id"`
+	ProductID     uint              `json:"product_id"`
+	SKU           string            `json:"sku"`
+	Price         float64           `json:"price"`
+	PriceOverride *float64          `json:"price_override"`
+	Stock         int               `json:"stock"`
+	Options       map[string]string `json:"options"`
+}
+
+type OptionRequest struct {
+	Name   string   `json:"name" binding:"required"`
+	Values []string `json:"values" binding:"required,min=1"`
+}
+
+// CreateVariantRequest creates one variant. Options maps each option name to
+// a value; unknown options and values are added to the product.
+type CreateVariantRequest struct {
+	SKU     string            `json:"sku" binding:"required"`
+	Price   *float64          `json:"price"`
+	Stock   int               `json:"stock"`
+	Options map[string]string `json:"options" binding:"required"`
+}
+
+// UpdateVariantRequest changes a variant. ClearPrice removes the price
+// override so the product's price applies. Stock is rejected: it is changed
+// with a stock adjustment, which records it in the ledger.
+type UpdateVariantRequest struct {
+	SKU        *string  `json:"sku"`
+	Price      *float64 `json:"price"`
+	ClearPrice bool     `json:"clear_price"`
+	Stock      *int     `json:"stock"`
+}
+
+// GenerateVariantsRequest creates a variant for every combination of the
+// option values that does not have one yet
+type GenerateVariantsRequest struct {
+	Options []OptionRequest `json:"options" binding:"required,min=1,dive"`
+	// SKUPrefix defaults to "P<product id>"; each value is appended to it
+	SKUPrefix string   `json:"sku_prefix"`
+	Price     *float64 `json:"price"`
+	Stock     int      `json:"stock"`
+}
+
+// CatalogVariant is the customer-facing view of a variant
+type CatalogVariant struct {
+	ID        uint              `json:"id"`
+	SKU       string            `json:"sku"`
+	Price     float64           `json:"price"`
+	Available bool              `json:"available"`
+	Options   map[string]string `json:"options"`
+}
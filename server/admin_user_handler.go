@@ -0,0 +1,269 @@
+package server
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/techagentng/ecommerce-api/errors"
+	"github.com/techagentng/ecommerce-api/models"
+	"github.com/techagentng/ecommerce-api/server/response"
+)
+
+// handleListUsers lists user accounts
+// @Summary List users
+// @Description List users with pagination, filtering by email, role and status (requires the users:read permission)
+// @Tags admin
+// @Produce json
+// @Param page query int false "Page number, starting at 1"
+// @Param page_size query int false "Page size, at most 100"
+// @Param email query string false "Email contains"
+// @Param role query string false "Role name"
+// @Param status query string false "active, suspended, unverified or deleted"
+// @Success 200 {object} models.UserListResponse
+// @Failure 400 {object} response.ErrorResponse "Invalid query"
+// @Failure 403 {object} response.ErrorResponse "Missing permission"
+// @Router /admin/users [get]
+func (s *Server) handleListUsers() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var query models.UserListQuery
+		if err := c.ShouldBindQuery(&query); err != nil {
+			response.JSON(c, "Invalid query", http.StatusBadRequest, nil, err)
+			return
+		}
+		users, err := s.UserAdminService.ListUsers(&query)
+		if err != nil {
+			response.JSON(c, "", err.Status, nil, err)
+			return
+		}
+		response.JSON(c, "Users retrieved successfully", http.StatusOK, users, nil)
+	}
+}
+
+// handleGetUser retrieves a user account
+// @Summary Get a user
+// @Description Get a user account by ID (requires the users:read permission)
+// @Tags admin
+// @Produce json
+// @Param user_id path int true "User ID"
+// @Success 200 {object} models.AdminUserResponse
+// @Failure 400 {object} response.ErrorResponse "Invalid user ID"
+// @Failure 403 {object} response.ErrorResponse "Missing permission"
+// @Failure 404 {object} response.ErrorResponse "User not found"
+// @Router /admin/users/{user_id} [get]
+func (s *Server) handleGetUser() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, ok := userIDParam(c)
+		if !ok {
+			return
+		}
+		user, err := s.UserAdminService.GetUser(userID)
+		if err != nil {
+			response.JSON(c, "", err.Status, nil, err)
+			return
+		}
+		response.JSON(c, "User retrieved successfully", http.StatusOK, user, nil)
+	}
+}
+
+// handleAssignUserRole assigns a role to a user
+// @Summary Assign a role to a user
+// @Description Move a user to another role. The user's sessions are revoked. (requires the users:manage permission)
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Param user_id path int true "User ID"
+// @Param role body models.AssignRoleRequest true "Role name"
+// @Success 200 {object} models.AdminUserResponse
+// @Failure 400 {object} response.ErrorResponse "Invalid request or unknown role"
+// @Failure 403 {object} response.ErrorResponse "Missing permission"
+// @Failure 404 {object} response.ErrorResponse "User not found"
+// @Router /admin/users/{user_id}/role [put]
+func (s *Server) handleAssignUserRole() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, ok := userIDParam(c)
+		if !ok {
+			return
+		}
+		var roleRequest models.AssignRoleRequest
+		if err := decode(c, &roleRequest); err != nil {
+			response.JSON(c, "", errors.ErrBadRequest.Status, nil, err)
+			return
+		}
+		user, err := s.UserAdminService.AssignRole(c.GetUint("userID"), userID, roleRequest.Role)
+		if err != nil {
+			response.JSON(c, "", err.Status, nil, err)
+			return
+		}
+		response.JSON(c, "Role assigned successfully", http.StatusOK, user, nil)
+	}
+}
+
+// handleSuspendUser suspends a user account
+// @Summary Suspend a user
+// @Description Block a user from authenticating and revoke their sessions (requires the users:manage permission)
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Param user_id path int true "User ID"
+// @Param request body models.SuspendUserRequest false "Reason for the suspension"
+// @Success 200 {string} string "User suspended"
+// @Failure 400 {object} response.ErrorResponse "Invalid request"
+// @Failure 403 {object} response.ErrorResponse "Missing permission"
+// @Failure 404 {object} response.ErrorResponse "User not found"
+// @Router /admin/users/{user_id}/suspend [post]
+func (s *Server) handleSuspendUser() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, ok := userIDParam(c)
+		if !ok {
+			return
+		}
+		var suspendRequest models.SuspendUserRequest
+		if c.Request.ContentLength > 0 {
+			if err := decode(c, &suspendRequest); err != nil {
+				response.JSON(c, "", errors.ErrBadRequest.Status, nil, err)
+				return
+			}
+		}
+		if err := s.UserAdminService.SuspendUser(c.GetUint("userID"), userID, suspendRequest.Reason); err != nil {
+			response.JSON(c, "", err.Status, nil, err)
+			return
+		}
+		response.JSON(c, "User suspended", http.StatusOK, nil, nil)
+	}
+}
+
+// handleUnsuspendUser lifts a user's suspension
+// @Summary Unsuspend a user
+// @Description Allow a suspended user to authenticate again (requires the users:manage permission)
+// @Tags admin
+// @Produce json
+// @Param user_id path int true "User ID"
+// @Success 200 {string} string "User unsuspended"
+// @Failure 400 {object} response.ErrorResponse "Invalid user ID"
+// @Failure 403 {object} response.ErrorResponse "Missing permission"
+// @Failure 404 {object} response.ErrorResponse "User not found"
+// @Router /admin/users/{user_id}/unsuspend [post]
+func (s *Server) handleUnsuspendUser() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, ok := userIDParam(c)
+		if !ok {
+			return
+		}
+		if err := s.UserAdminService.UnsuspendUser(c.GetUint("userID"), userID); err != nil {
+			response.JSON(c, "", err.Status, nil, err)
+			return
+		}
+		response.JSON(c, "User unsuspended", http.StatusOK, nil, nil)
+	}
+}
+
+// handleDeleteUser soft deletes a user account
+// @Summary Delete a user
+// @Description Soft delete a user and revoke their sessions; their orders are kept (requires the users:manage permission)
+// @Tags admin
+// @Produce json
+// @Param user_id path int true "User ID"
+// @Success 204 "No Content"
+// @Failure 400 {object} response.ErrorResponse "Invalid user ID"
+// @Failure 403 {object} response.ErrorResponse "Missing permission"
+// @Failure 404 {object} response.ErrorResponse "User not found"
+// @Router /admin/users/{user_id} [delete]
+func (s *Server) handleDeleteUser() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, ok := userIDParam(c)
+		if !ok {
+			return
+		}
+		if err := s.UserAdminService.DeleteUser(c.GetUint("userID"), userID); err != nil {
+			response.JSON(c, "", err.Status, nil, err)
+			return
+		}
+		c.Status(http.StatusNoContent)
+	}
+}
+
+// handleRevokeUserSessions lets an admin revoke every token issued to a user
+// @Summary Revoke a user's sessions
+// @Description Revoke every access and refresh token issued to the given user (requires the users:revoke_sessions permission)
+// @Tags admin
+// @Produce json
+// @Param user_id path int true "User ID"
+// @Success 200 {string} string "user sessions revoked"
+// @Failure 400 {object} response.ErrorResponse "Invalid user ID"
+// @Failure 403 {object} response.ErrorResponse "Missing permission"
+// @Failure 404 {object} response.ErrorResponse "User not found"
+// @Router /admin/users/{user_id}/revoke-sessions [post]
+func (s *Server) handleRevokeUserSessions() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, ok := userIDParam(c)
+		if !ok {
+			return
+		}
+		if err := s.UserAdminService.RevokeSessions(c.GetUint("userID"), userID); err != nil {
+			response.JSON(c, "", err.Status, nil, err)
+			return
+		}
+		response.JSON(c, "user sessions revoked", http.StatusOK, nil, nil)
+	}
+}
+
+// handleUnlockUser clears a login lockout
+// @Summary Unlock a user
+// @Description Clear the lockout placed on a user's account after repeated failed logins (requires the users:manage permission)
+// @Tags admin
+// @Produce json
+// @Param user_id path int true "User ID"
+// @Success 200 {string} string "User unlocked"
+// @Failure 400 {object} response.ErrorResponse "Invalid user ID"
+// @Failure 403 {object} response.ErrorResponse "Missing permission"
+// @Failure 404 {object} response.ErrorResponse "User not found"
+// @Router /admin/users/{user_id}/unlock [post]
+func (s *Server) handleUnlockUser() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, ok := userIDParam(c)
+		if !ok {
+			return
+		}
+		if err := s.UserAdminService.UnlockUser(c.GetUint("userID"), userID); err != nil {
+			response.JSON(c, "", err.Status, nil, err)
+			return
+		}
+		response.JSON(c, "User unlocked", http.StatusOK, nil, nil)
+	}
+}
+
+// handleResetUserMFA removes a user's MFA enrollment
+// @Summary Reset a user's MFA
+// @Description Remove a user's TOTP secret and recovery codes, e.g. after they lose their device, and revoke their sessions (requires the users:manage permission)
+// @Tags admin
+// @Produce json
+// @Param user_id path int true "User ID"
+// @Success 200 {string} string "MFA reset"
+// @Failure 400 {object} response.ErrorResponse "Invalid user ID"
+// @Failure 403 {object} response.ErrorResponse "Missing permission"
+// @Failure 404 {object} response.ErrorResponse "User not found"
+// @Router /admin/users/{user_id}/reset-mfa [post]
+func (s *Server) handleResetUserMFA() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, ok := userIDParam(c)
+		if !ok {
+			return
+		}
+		if err := s.UserAdminService.ResetMFA(c.GetUint("userID"), userID); err != nil {
+			response.JSON(c, "", err.Status, nil, err)
+			return
+		}
+		response.JSON(c, "MFA reset", http.StatusOK, nil, nil)
+	}
+}
+
+// userIDParam parses the user_id path parameter, responding with 400 if it is invalid
+func userIDParam(c *gin.Context) (uint, bool) {
+	userID64, err := strconv.ParseUint(c.Param("user_id"), 10, 32)
+	if err != nil {
+		response.JSON(c, "Invalid user ID", http.StatusBadRequest, nil, err)
+		return 0, false
+	}
+	return uint(userID64), true
+}
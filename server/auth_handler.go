@@ -1,21 +1,10 @@
 package server
 
 import (
-	"bytes"
-	"context"
-	"fmt"
-	"io"
 	"log"
 	"mime/multipart"
 	"net/http"
-	"os"
-	"path/filepath"
-	"strings"
-
-	"github.com/aws/aws-sdk-go-v2/config"
-	"github.com/aws/aws-sdk-go-v2/service/s3"
-	"github.com/aws/aws-sdk-go-v2/service/s3/types"
-	"github.com/aws/aws-sdk-go/aws"
+
 	"github.com/gin-gonic/gin"
 	"github.com/go-playground/validator/v10"
 	"github.com/techagentng/ecommerce-api/errors"
@@ -23,52 +12,16 @@ import (
 	"github.com/techagentng/ecommerce-api/server/response"
 )
 
-func createS3Client() (*s3.Client, error) {
-	cfg, err := config.LoadDefaultConfig(context.TODO(), config.WithRegion(os.Getenv("AWS_REGION")))
-	if err != nil {
-		return nil, fmt.Errorf("unable to load SDK config, %v", err)
-	}
-	return s3.NewFromConfig(cfg), nil
-}
-
-// A map to hold content types based on file extensions
-var contentTypes = map[string]string{
-	".jpg":  "image/jpeg",
-	".jpeg": "image/jpeg",
-	".png":  "image/png",
-	".mp4":  "video/mp4",
-	".avi":  "video/x-msvideo",
-}
-
-func uploadFileToS3(client *s3.Client, file multipart.File, bucketName, key string) (string, error) {
+// uploadProfileImage stores a profile image in the blob store and returns the
+// URL of its thumbnail rendition
+func (s *Server) uploadProfileImage(file multipart.File) (string, *errors.Error) {
 	defer file.Close()
-	fileContent, err := io.ReadAll(file)
-	if err != nil {
-		return "", fmt.Errorf("failed to read file content: %v", err)
-	}
 
-	extension := filepath.Ext(key)
-	contentType, exists := contentTypes[extension]
-	if !exists {
-		contentType = "application/octet-stream" 
-	}
-
-	trimmedContent := strings.TrimSpace(string(fileContent))
-	fileContent = []byte(trimmedContent)
-	key = strings.ReplaceAll(key, " ", "_")
-	_, err = client.PutObject(context.TODO(), &s3.PutObjectInput{
-		Bucket:      aws.String(bucketName),
-		Key:         aws.String(key),
-		Body:        bytes.NewReader(fileContent),
-		ContentType: aws.String(contentType),
-		ACL:         types.ObjectCannedACLPublicRead,
-	})
+	image, err := s.MediaService.StoreImage("profiles", file)
 	if err != nil {
-		return "", fmt.Errorf("failed to upload file to S3: %v", err)
+		return "", err
 	}
-
-	fileURL := fmt.Sprintf("https://%s.s3.%s.amazonaws.com/%s", bucketName, os.Getenv("AWS_REGION"), key)
-	return fileURL, nil
+	return image.Renditions[models.RenditionThumbnail].URL, nil
 }
 
 func (s *Server) handleSignup() gin.HandlerFunc {
@@ -80,20 +33,12 @@ func (s *Server) handleSignup() gin.HandlerFunc {
 
 		var filePath string 
 
-		file, handler, err := c.Request.FormFile("profile_image")
+		file, _, err := c.Request.FormFile("profile_image")
 		if err == nil {
-			defer file.Close()
-
-			s3Client, err := createS3Client()
-			if err != nil {
-				response.JSON(c, "", http.StatusInternalServerError, nil, err)
-				return
-			}
-			userID := c.PostForm("user_id")
-			filename := fmt.Sprintf("%s_%s", userID, handler.Filename)
-			filePath, err = uploadFileToS3(s3Client, file, os.Getenv("AWS_BUCKET"), filename)
-			if err != nil {
-				response.JSON(c, "", http.StatusInternalServerError, nil, err)
+			var uploadErr *errors.Error
+			filePath, uploadErr = s.uploadProfileImage(file)
+			if uploadErr != nil {
+				response.JSON(c, "", uploadErr.Status, nil, uploadErr)
 				return
 			}
 		} else if err == http.ErrMissingFile {
@@ -142,11 +87,213 @@ func (s *Server) handleLogin() gin.HandlerFunc {
 			response.JSON(c, "", errors.ErrBadRequest.Status, nil, err)
 			return
 		}
-		userResponse, err := s.AuthService.LoginUser(&loginRequest)
+		userResponse, err := s.AuthService.LoginUser(&loginRequest, c.ClientIP())
 		if err != nil {
 			response.JSON(c, "", err.Status, nil, err)
 			return
 		}
+		if userResponse.MFARequired {
+			response.JSON(c, "MFA code required", http.StatusOK, userResponse, nil)
+			return
+		}
+		s.mergeGuestCartOnLogin(c, userResponse.ID)
 		response.JSON(c, "login successful", http.StatusOK, userResponse, nil)
 	}
-}
\ No newline at end of file
+}
+
+// handleRefreshToken exchanges a refresh token for a new token pair
+// @Summary Refresh the access token
+// @Description Exchange a refresh token for a new access and refresh token. Each refresh token can only be used once.
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param request body models.RefreshTokenRequest true "Refresh token"
+// @Success 200 {object} models.LoginResponse
+// @Failure 400 {object} response.ErrorResponse "Invalid request"
+// @Failure 401 {object} response.ErrorResponse "Invalid, expired or reused refresh token"
+// @Router /auth/refresh [post]
+func (s *Server) handleRefreshToken() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var refreshRequest models.RefreshTokenRequest
+		if err := decode(c, &refreshRequest); err != nil {
+			response.JSON(c, "", errors.ErrBadRequest.Status, nil, err)
+			return
+		}
+		loginResponse, err := s.AuthService.RefreshToken(refreshRequest.RefreshToken)
+		if err != nil {
+			response.JSON(c, "", err.Status, nil, err)
+			return
+		}
+		response.JSON(c, "token refreshed", http.StatusOK, loginResponse, nil)
+	}
+}
+
+// handleLogout revokes the current access token
+// @Summary Log out
+// @Description Revoke the current access token. If a refresh token is supplied its whole token family is revoked too.
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param request body models.LogoutRequest false "Refresh token to revoke"
+// @Success 200 {string} string "logout successful"
+// @Failure 401 {object} response.ErrorResponse "Unauthorized"
+// @Router /auth/logout [post]
+func (s *Server) handleLogout() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var logoutRequest models.LogoutRequest
+		if c.Request.ContentLength > 0 {
+			if err := decode(c, &logoutRequest); err != nil {
+				response.JSON(c, "", errors.ErrBadRequest.Status, nil, err)
+				return
+			}
+		}
+		if err := s.AuthService.Logout(c.GetString("access_token"), logoutRequest.RefreshToken); err != nil {
+			response.JSON(c, "", err.Status, nil, err)
+			return
+		}
+		response.JSON(c, "logout successful", http.StatusOK, nil, nil)
+	}
+}
+
+// handleLogoutEverywhere revokes every token issued to the current user
+// @Summary Log out of all sessions
+// @Description Revoke every access and refresh token issued to the authenticated user
+// @Tags auth
+// @Produce json
+// @Success 200 {string} string "logged out of all sessions"
+// @Failure 401 {object} response.ErrorResponse "Unauthorized"
+// @Router /auth/logout/all [post]
+func (s *Server) handleLogoutEverywhere() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if err := s.AuthService.RevokeAllSessions(c.GetUint("userID")); err != nil {
+			response.JSON(c, "", err.Status, nil, err)
+			return
+		}
+		response.JSON(c, "logged out of all sessions", http.StatusOK, nil, nil)
+	}
+}
+
+// handleVerifyEmail verifies a user's email address
+// @Summary Verify email address
+// @Description Verify the email address in a token sent at signup
+// @Tags auth
+// @Produce json
+// @Param token query string true "Verification token"
+// @Success 200 {string} string "email verified"
+// @Failure 400 {object} response.ErrorResponse "Invalid or expired token"
+// @Router /auth/verify [get]
+func (s *Server) handleVerifyEmail() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		token := c.Query("token")
+		if token == "" {
+			response.JSON(c, "verification token is required", http.StatusBadRequest, nil, nil)
+			return
+		}
+		if err := s.AuthService.VerifyEmail(token); err != nil {
+			response.JSON(c, "", err.Status, nil, err)
+			return
+		}
+		response.JSON(c, "email verified", http.StatusOK, nil, nil)
+	}
+}
+
+// handleResendVerification sends a new verification email
+// @Summary Resend verification email
+// @Description Send a new verification email. Mails are throttled per account; unknown, verified and throttled addresses get the same response.
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param request body models.ResendVerificationRequest true "Email address"
+// @Success 200 {string} string "verification email sent"
+// @Failure 400 {object} response.ErrorResponse "Invalid request"
+// @Router /auth/verify/resend [post]
+func (s *Server) handleResendVerification() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var resendRequest models.ResendVerificationRequest
+		if err := decode(c, &resendRequest); err != nil {
+			response.JSON(c, "", errors.ErrBadRequest.Status, nil, err)
+			return
+		}
+		if err := s.AuthService.ResendVerificationEmail(resendRequest.Email); err != nil {
+			response.JSON(c, "", err.Status, nil, err)
+			return
+		}
+		response.JSON(c, "if the account exists, a verification email has been sent", http.StatusOK, nil, nil)
+	}
+}
+
+// handleForgotPassword emails a password reset token
+// @Summary Request a password reset
+// @Description Email a single-use, time-limited password reset token
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param request body models.ForgotPasswordRequest true "Email address"
+// @Success 200 {string} string "password reset email sent"
+// @Failure 400 {object} response.ErrorResponse "Invalid request"
+// @Router /auth/password/forgot [post]
+func (s *Server) handleForgotPassword() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var forgotRequest models.ForgotPasswordRequest
+		if err := decode(c, &forgotRequest); err != nil {
+			response.JSON(c, "", errors.ErrBadRequest.Status, nil, err)
+			return
+		}
+		if err := s.AuthService.ForgotPassword(forgotRequest.Email); err != nil {
+			response.JSON(c, "", err.Status, nil, err)
+			return
+		}
+		response.JSON(c, "if the account exists, a password reset email has been sent", http.StatusOK, nil, nil)
+	}
+}
+
+// handleResetPassword sets a new password using a reset token
+// @Summary Reset password
+// @Description Set a new password using a token from the password reset email. All existing sessions are revoked.
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param request body models.ResetPasswordRequest true "Reset token and new password"
+// @Success 200 {string} string "password reset successful"
+// @Failure 400 {object} response.ErrorResponse "Invalid or expired token, or password rejected by policy"
+// @Router /auth/password/reset [post]
+func (s *Server) handleResetPassword() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var resetRequest models.ResetPasswordRequest
+		if err := decode(c, &resetRequest); err != nil {
+			response.JSON(c, "", errors.ErrBadRequest.Status, nil, err)
+			return
+		}
+		if err := s.AuthService.ResetPassword(resetRequest.Token, resetRequest.NewPassword); err != nil {
+			response.JSON(c, "", err.Status, nil, err)
+			return
+		}
+		response.JSON(c, "password reset successful, please log in again", http.StatusOK, nil, nil)
+	}
+}
+
+// handleChangePassword changes the password of the authenticated user
+// @Summary Change password
+// @Description Change the authenticated user's password. All existing sessions, including the current one, are revoked.
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param request body models.ChangePasswordRequest true "Old and new password"
+// @Success 200 {string} string "password changed"
+// @Failure 400 {object} response.ErrorResponse "Password rejected by policy"
+// @Failure 401 {object} response.ErrorResponse "Old password is incorrect"
+// @Router /auth/password/change [post]
+func (s *Server) handleChangePassword() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var changeRequest models.ChangePasswordRequest
+		if err := decode(c, &changeRequest); err != nil {
+			response.JSON(c, "", errors.ErrBadRequest.Status, nil, err)
+			return
+		}
+		if err := s.AuthService.ChangePassword(c.GetUint("userID"), changeRequest.OldPassword, changeRequest.NewPassword); err != nil {
+			response.JSON(c, "", err.Status, nil, err)
+			return
+		}
+		response.JSON(c, "password changed, please log in again", http.StatusOK, nil, nil)
+	}
+}
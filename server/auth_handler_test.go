@@ -0,0 +1,268 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/techagentng/ecommerce-api/config"
+	"github.com/techagentng/ecommerce-api/db"
+	"github.com/techagentng/ecommerce-api/models"
+	"github.com/techagentng/ecommerce-api/services"
+	"github.com/techagentng/ecommerce-api/services/jwt"
+	"github.com/techagentng/ecommerce-api/services/mailer"
+)
+
+// memoryAuthRepo keeps the users of a test in memory. Methods the tests do
+// not reach panic through the embedded nil interface.
+type memoryAuthRepo struct {
+	db.AuthRepository
+	mu    sync.Mutex
+	users map[uint]*models.User
+}
+
+func newMemoryAuthRepo() *memoryAuthRepo {
+	return &memoryAuthRepo{users: map[uint]*models.User{}}
+}
+
+func (r *memoryAuthRepo) FindRoleByName(name string) (*models.Role, error) {
+	return &models.Role{ID: uuid.New(), Name: name}, nil
+}
+
+func (r *memoryAuthRepo) IsEmailExist(email string) error {
+	if _, err := r.FindUserByEmail(email); err == nil {
+		return errors.New("email already in use")
+	}
+	return nil
+}
+
+func (r *memoryAuthRepo) CreateUser(user *models.User) (*models.User, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	user.ID = uint(len(r.users) + 1)
+	stored := *user
+	r.users[user.ID] = &stored
+	return user, nil
+}
+
+func (r *memoryAuthRepo) FindUserByEmail(email string) (*models.User, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, user := range r.users {
+		if user.Email == email {
+			found := *user
+			return &found, nil
+		}
+	}
+	return nil, errors.New("user not found")
+}
+
+func (r *memoryAuthRepo) FindUserByID(id uint) (*models.User, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	user, ok := r.users[id]
+	if !ok {
+		return nil, errors.New("user not found")
+	}
+	found := *user
+	return &found, nil
+}
+
+func (r *memoryAuthRepo) SetVerificationSentAt(userID uint, sentAt int64) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.users[userID].VerificationSentAt = sentAt
+	return nil
+}
+
+func (r *memoryAuthRepo) SetEmailActive(userID uint) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.users[userID].IsEmailActive = true
+	return nil
+}
+
+func newAuthTestServer(t *testing.T) (*gin.Engine, *memoryAuthRepo, *mailer.MemoryMailer) {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	conf := &config.Config{
+		BaseUrl:           "http://shop.test",
+		JWTSecret:         "test-secret",
+		JWTIssuer:         "ecommerce-api",
+		JWTAudience:       "ecommerce-api",
+		PasswordMinLength: 8,
+
+		VerificationResendInterval: time.Minute,
+	}
+	keyring, err := jwt.LoadKeyring(conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	policy, err := services.NewPasswordPolicy(conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	repo := newMemoryAuthRepo()
+	mail := mailer.NewMemoryMailer()
+	throttle := services.NewLoginThrottle(db.NewMemoryLoginAttemptStore(), conf)
+	s := &Server{
+		Config:         conf,
+		Keyring:        keyring,
+		AuthRepository: repo,
+		AuthService:    services.NewAuthService(repo, mail, policy, throttle, keyring, conf),
+	}
+	router := gin.New()
+	s.defineRoutes(router)
+	return router, repo, mail
+}
+
+func signupRequest(t *testing.T, fields map[string]string) *http.Request {
+	t.Helper()
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	for name, value := range fields {
+		if err := form.WriteField(name, value); err != nil {
+			t.Fatal(err)
+		}
+	}
+	form.Close()
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/auth/signup", &body)
+	req.Header.Set("Content-Type", form.FormDataContentType())
+	return req
+}
+
+func TestSignupSendsVerificationMailAndVerifyActivatesAccount(t *testing.T) {
+	router, repo, mail := newAuthTestServer(t)
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, signupRequest(t, map[string]string{
+		"fullname":  "Ada Obi",
+		"username":  "adaobi",
+		"telephone": "08030000000",
+		"email":     "ada@example.com",
+		"password":  "correct horse battery",
+	}))
+	if w.Code != http.StatusCreated {
+		t.Fatalf("signup: got status %d, body %s", w.Code, w.Body.String())
+	}
+
+	messages := mail.Messages()
+	if len(messages) != 1 {
+		t.Fatalf("got %d mails after signup, want 1", len(messages))
+	}
+	if messages[0].To != "ada@example.com" {
+		t.Errorf("verification mail sent to %q", messages[0].To)
+	}
+	user, err := repo.FindUserByEmail("ada@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user.IsEmailActive {
+		t.Fatal("account is active before the email was verified")
+	}
+	if user.VerificationSentAt == 0 {
+		t.Error("the time the verification mail was sent is not recorded")
+	}
+
+	link := verificationLink(t, messages[0].Body)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, link.RequestURI(), nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("verify: got status %d, body %s", w.Code, w.Body.String())
+	}
+	user, err = repo.FindUserByEmail("ada@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !user.IsEmailActive {
+		t.Error("account is not active after verifying the email")
+	}
+}
+
+func TestVerifyEmailRejectsInvalidToken(t *testing.T) {
+	router, _, _ := newAuthTestServer(t)
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/v1/auth/verify?token=not-a-token", nil))
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("got status %d, want %d", w.Code, http.StatusBadRequest)
+	}
+	var body struct {
+		Errors string `json:"errors"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(body.Errors, "invalid or expired verification token") {
+		t.Errorf("got error %q", body.Errors)
+	}
+}
+
+func TestResendVerificationAnswersAlikeForEveryAddress(t *testing.T) {
+	router, repo, mail := newAuthTestServer(t)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, signupRequest(t, map[string]string{
+		"fullname":  "Ada Obi",
+		"username":  "adaobi",
+		"telephone": "08030000000",
+		"email":     "ada@example.com",
+		"password":  "correct horse battery",
+	}))
+	if w.Code != http.StatusCreated {
+		t.Fatalf("signup: got status %d, body %s", w.Code, w.Body.String())
+	}
+	verified, err := repo.CreateUser(&models.User{Email: "obi@example.com", IsEmailActive: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resend := func(email string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/auth/verify/resend", strings.NewReader(`{"email":"`+email+`"}`))
+		req.Header.Set("Content-Type", "application/json")
+		router.ServeHTTP(w, req)
+		return w
+	}
+	unknown := resend("nobody@example.com")
+	if unknown.Code != http.StatusOK {
+		t.Fatalf("unknown address: got status %d, body %s", unknown.Code, unknown.Body.String())
+	}
+	for name, email := range map[string]string{
+		"verified address":        verified.Email,
+		"recently mailed address": "ada@example.com",
+	} {
+		w := resend(email)
+		if w.Code != unknown.Code || w.Body.String() != unknown.Body.String() {
+			t.Errorf("%s: got %d %s, want the unknown address's %d %s", name, w.Code, w.Body.String(), unknown.Code, unknown.Body.String())
+		}
+	}
+	if messages := mail.Messages(); len(messages) != 1 {
+		t.Errorf("got %d mails, want only the one sent at signup", len(messages))
+	}
+}
+
+// verificationLink finds the verification link in a mail body
+func verificationLink(t *testing.T, body string) *url.URL {
+	t.Helper()
+	for _, field := range strings.Fields(body) {
+		if strings.Contains(field, "/api/v1/auth/verify?token=") {
+			link, err := url.Parse(field)
+			if err != nil {
+				t.Fatal(err)
+			}
+			return link
+		}
+	}
+	t.Fatalf("no verification link in mail:\n%s", body)
+	return nil
+}
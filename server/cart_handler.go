@@ -0,0 +1,218 @@
+package server
+
+import (
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/techagentng/ecommerce-api/errors"
+	"github.com/techagentng/ecommerce-api/models"
+	"github.com/techagentng/ecommerce-api/server/response"
+)
+
+// handleGetCart returns the cart of the user or guest
+// @Summary Get the cart
+// @Description Return the cart of the authenticated user, or of the guest identified by the cart cookie. Lines are priced from the current catalog; a line that is unavailable, needs a variant, is short of stock or changed price carries a warning. Without a cart the response is an empty cart.
+// @Tags cart
+// @Produce json
+// @Success 200 {object} models.CartResponse
+// @Failure 401 {object} response.ErrorResponse "Invalid access token"
+// @Router /cart [get]
+func (s *Server) handleGetCart() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		owner, ok := s.cartOwner(c, false)
+		if !ok {
+			return
+		}
+		cart, err := s.CartService.GetCart(owner)
+		if err != nil {
+			response.JSON(c, "", err.Status, nil, err)
+			return
+		}
+		response.JSON(c, "Cart retrieved successfully", http.StatusOK, cart, nil)
+	}
+}
+
+// handleAddCartItem adds a product to the cart
+// @Summary Add an item to the cart
+// @Description Add a quantity of a product, or of one of its variants, to the cart. Products with variants must name a variant. Adding a line that is already in the cart raises its quantity. A guest without a cart cookie gets one.
+// @Tags cart
+// @Accept json
+// @Produce json
+// @Param item body models.AddCartItemRequest true "Product, variant and quantity"
+// @Success 200 {object} models.CartResponse
+// @Failure 400 {object} response.ErrorResponse "Invalid request"
+// @Failure 404 {object} response.ErrorResponse "Product or variant not found"
+// @Router /cart/items [post]
+func (s *Server) handleAddCartItem() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var request models.AddCartItemRequest
+		if err := decode(c, &request); err != nil {
+			response.JSON(c, "", errors.ErrBadRequest.Status, nil, err)
+			return
+		}
+		owner, ok := s.cartOwner(c, true)
+		if !ok {
+			return
+		}
+		cart, err := s.CartService.AddItem(owner, &request)
+		if err != nil {
+			response.JSON(c, "", err.Status, nil, err)
+			return
+		}
+		response.JSON(c, "Item added to cart", http.StatusOK, cart, nil)
+	}
+}
+
+// handleUpdateCartItem changes the quantity of a cart line
+// @Summary Update a cart item
+// @Description Set the quantity of a line of the cart.
+// @Tags cart
+// @Accept json
+// @Produce json
+// @Param item_id path int true "Cart item ID"
+// @Param item body models.UpdateCartItemRequest true "New quantity"
+// @Success 200 {object} models.CartResponse
+// @Failure 400 {object} response.ErrorResponse "Invalid request"
+// @Failure 404 {object} response.ErrorResponse "Cart item not found"
+// @Router /cart/items/{item_id} [patch]
+func (s *Server) handleUpdateCartItem() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		itemID, ok := cartItemIDParam(c)
+		if !ok {
+			return
+		}
+		var request models.UpdateCartItemRequest
+		if err := decode(c, &request); err != nil {
+			response.JSON(c, "", errors.ErrBadRequest.Status, nil, err)
+			return
+		}
+		owner, ok := s.cartOwner(c, false)
+		if !ok {
+			return
+		}
+		cart, err := s.CartService.UpdateItem(owner, itemID, &request)
+		if err != nil {
+			response.JSON(c, "", err.Status, nil, err)
+			return
+		}
+		response.JSON(c, "Cart item updated", http.StatusOK, cart, nil)
+	}
+}
+
+// handleRemoveCartItem removes a line from the cart
+// @Summary Remove a cart item
+// @Description Remove a line from the cart.
+// @Tags cart
+// @Produce json
+// @Param item_id path int true "Cart item ID"
+// @Success 200 {object} models.CartResponse
+// @Failure 400 {object} response.ErrorResponse "Invalid cart item ID"
+// @Failure 404 {object} response.ErrorResponse "Cart item not found"
+// @Router /cart/items/{item_id} [delete]
+func (s *Server) handleRemoveCartItem() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		itemID, ok := cartItemIDParam(c)
+		if !ok {
+			return
+		}
+		owner, ok := s.cartOwner(c, false)
+		if !ok {
+			return
+		}
+		cart, err := s.CartService.RemoveItem(owner, itemID)
+		if err != nil {
+			response.JSON(c, "", err.Status, nil, err)
+			return
+		}
+		response.JSON(c, "Cart item removed", http.StatusOK, cart, nil)
+	}
+}
+
+// handleCheckoutCart turns the user's cart into an order
+// @Summary Check out the cart
+// @Description Place an order for the lines of the authenticated user's cart, as placing an order with the same lines would, and empty the cart. A guest cart in the cart cookie is merged first. Lines are priced from the catalog and stock is reserved for every line; if any line is short, nothing is ordered and the cart is kept. The pending order is then paid at /user/orders/{order_id}/pay.
+// @Tags cart
+// @Produce json
+// @Param Idempotency-Key header string false "Unique key per checkout attempt; a retry with the same key replays the first response"
+// @Success 201 {object} models.Order "Order placed successfully, with its lines"
+// @Failure 400 {object} response.ErrorResponse "The cart is empty, or a line cannot be ordered"
+// @Failure 409 {object} models.InsufficientStockResponse "Insufficient stock, lists every item that is short; or a request with the same Idempotency-Key is in progress"
+// @Failure 422 {object} response.ErrorResponse "Idempotency-Key reused with a different request"
+// @Router /cart/checkout [post]
+func (s *Server) handleCheckoutCart() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		owner, ok := s.cartOwner(c, false)
+		if !ok {
+			return
+		}
+		order, err := s.CartService.Checkout(owner.UserID)
+		if err != nil {
+			respondPlaceOrderError(c, err)
+			return
+		}
+		response.JSON(c, "Order placed successfully", http.StatusCreated, order, nil)
+	}
+}
+
+// cartOwner identifies the cart of the request. An authenticated user works on
+// their own cart, into which the guest cart of the cart cookie is merged
+// first. A guest works on the cart of the cookie, which is issued when create
+// is set and the guest has none. It responds and returns false on failure.
+func (s *Server) cartOwner(c *gin.Context, create bool) (models.CartOwner, bool) {
+	token, _ := c.Cookie(s.Config.CartCookieName)
+	if userID := c.GetUint("userID"); userID != 0 {
+		if token != "" {
+			if err := s.CartService.MergeGuestCart(userID, token); err != nil {
+				response.JSON(c, "", err.Status, nil, err)
+				return models.CartOwner{}, false
+			}
+			s.setCartCookie(c, "", -1)
+		}
+		return models.CartOwner{UserID: userID}, true
+	}
+
+	if token == "" && create {
+		var err *errors.Error
+		if token, err = s.CartService.NewGuestToken(); err != nil {
+			response.JSON(c, "", err.Status, nil, err)
+			return models.CartOwner{}, false
+		}
+	}
+	if token != "" {
+		// Renewing the cookie keeps it as long as the cart
+		s.setCartCookie(c, token, int(s.Config.CartTTL.Seconds()))
+	}
+	return models.CartOwner{GuestToken: token}, true
+}
+
+// mergeGuestCartOnLogin merges the guest cart of the cart cookie into the cart
+// of a user who just logged in. A failure only is logged: the login stands
+// and the cart is merged on the user's next cart request.
+func (s *Server) mergeGuestCartOnLogin(c *gin.Context, userID uint) {
+	token, _ := c.Cookie(s.Config.CartCookieName)
+	if token == "" {
+		return
+	}
+	if err := s.CartService.MergeGuestCart(userID, token); err != nil {
+		log.Printf("Error merging guest cart into cart of user %d: %v", userID, err)
+		return
+	}
+	s.setCartCookie(c, "", -1)
+}
+
+// setCartCookie sets the cart cookie, or deletes it for a negative maxAge
+func (s *Server) setCartCookie(c *gin.Context, token string, maxAge int) {
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(s.Config.CartCookieName, token, maxAge, "/", "", s.Config.CartCookieSecure, true)
+}
+
+func cartItemIDParam(c *gin.Context) (uint, bool) {
+	itemID64, err := strconv.ParseUint(c.Param("item_id"), 10, 32)
+	if err != nil {
+		response.JSON(c, "Invalid cart item ID", http.StatusBadRequest, nil, err)
+		return 0, false
+	}
+	return uint(itemID64), true
+}
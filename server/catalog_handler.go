@@ -0,0 +1,71 @@
+package server
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/techagentng/ecommerce-api/models"
+	"github.com/techagentng/ecommerce-api/server/response"
+)
+
+// handleListCatalog lists products for customers
+// @Summary Browse the catalog
+// @Description List products as customers see them, with the same pagination, filters and sorting as the admin listing. Supports ETag conditional requests.
+// @Tags catalog
+// @Produce json
+// @Param page query int false "Page number, starting at 1"
+// @Param page_size query int false "Page size, at most 100"
+// @Param cursor query string false "next_cursor of the previous page"
+// @Param name query string false "Name contains"
+// @Param min_price query number false "Minimum price"
+// @Param max_price query number false "Maximum price"
+// @Param in_stock query bool false "Only available (true) or unavailable (false) products"
+// @Param category query int false "Category ID, including its subcategories"
+// @Param sort query string false "id, name or price, prefixed with - for descending"
+// @Success 200 {object} models.CatalogListResponse
+// @Success 304 "Not Modified"
+// @Failure 400 {object} response.ErrorResponse "Invalid query"
+// @Router /catalog/products [get]
+func (s *Server) handleListCatalog() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var query models.ProductListQuery
+		if err := c.ShouldBindQuery(&query); err != nil {
+			response.JSON(c, "Invalid query", http.StatusBadRequest, nil, err)
+			return
+		}
+		catalog, err := s.ProductService.ListCatalog(&query)
+		if err != nil {
+			response.JSON(c, "", err.Status, nil, err)
+			return
+		}
+		response.CacheableJSON(c, "Products retrieved successfully", catalog, s.Config.CatalogCacheMaxAge)
+	}
+}
+
+// handleGetCatalogProduct retrieves a product for customers
+// @Summary Get a catalog product
+// @Description Get a product as customers see it, with its variants and images. Supports ETag conditional requests.
+// @Tags catalog
+// @Produce json
+// @Param product_id path int true "Product ID"
+// @Success 200 {object} models.CatalogProduct
+// @Success 304 "Not Modified"
+// @Failure 400 {object} response.ErrorResponse "Invalid product ID"
+// @Failure 404 {object} response.ErrorResponse "Product not found"
+// @Router /catalog/products/{product_id} [get]
+func (s *Server) handleGetCatalogProduct() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		productID64, err := strconv.ParseUint(c.Param("product_id"), 10, 32)
+		if err != nil {
+			response.JSON(c, "Invalid product ID", http.StatusBadRequest, nil, err)
+			return
+		}
+		product, apiErr := s.ProductService.GetCatalogProduct(uint(productID64))
+		if apiErr != nil {
+			response.JSON(c, "", apiErr.Status, nil, apiErr)
+			return
+		}
+		response.CacheableJSON(c, "Product retrieved successfully", product, s.Config.CatalogCacheMaxAge)
+	}
+}
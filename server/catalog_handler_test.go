@@ -0,0 +1,88 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/techagentng/ecommerce-api/config"
+	"github.com/techagentng/ecommerce-api/db"
+	"github.com/techagentng/ecommerce-api/models"
+	"github.com/techagentng/ecommerce-api/services"
+)
+
+func (r *memoryProductRepo) FindProductByID(id uint) (*models.Product, error) {
+	return r.products[id], nil
+}
+
+// memoryCatalogVariantRepo holds the variants of a test's products
+type memoryCatalogVariantRepo struct {
+	db.VariantRepository
+	variants map[uint][]*models.ProductVariant
+}
+
+func (r *memoryCatalogVariantRepo) ListVariants(productID uint) ([]*models.ProductVariant, error) {
+	return r.variants[productID], nil
+}
+
+// memoryImageRepo holds the images of a test's products
+type memoryImageRepo struct {
+	db.ProductImageRepository
+	images map[uint][]models.ProductImage
+}
+
+func (r *memoryImageRepo) ListProductImages(productID uint) ([]models.ProductImage, error) {
+	return r.images[productID], nil
+}
+
+func getCatalogProduct(router *gin.Engine, header string, value string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/catalog/products/1", nil)
+	if header != "" {
+		req.Header.Set(header, value)
+	}
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func TestCatalogProductRevalidatesByETagWhenImagesChange(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	conf := &config.Config{CatalogCacheMaxAge: time.Minute}
+	product := &models.Product{ID: 1, Name: "Mug", Price: 12.5, Stock: 3}
+	product.UpdatedAt = time.Now().Add(-time.Hour).Unix()
+	images := &memoryImageRepo{images: map[uint][]models.ProductImage{
+		1: {{ProductID: 1, URL: "https://cdn.test/mug.jpg"}},
+	}}
+	s := &Server{
+		Config: conf,
+		ProductService: services.NewProductService(
+			&memoryProductRepo{products: map[uint]*models.Product{1: product}}, nil,
+			&memoryCatalogVariantRepo{}, images, db.NewMemorySearchIndex(), nil, conf),
+	}
+	router := gin.New()
+	s.defineRoutes(router)
+
+	first := getCatalogProduct(router, "", "")
+	if first.Code != http.StatusOK {
+		t.Fatalf("got status %d, body %s", first.Code, first.Body.String())
+	}
+	if first.Header().Get("Last-Modified") != "" {
+		t.Errorf("got Last-Modified %q, want none", first.Header().Get("Last-Modified"))
+	}
+	etag := first.Header().Get("ETag")
+	if w := getCatalogProduct(router, "If-None-Match", etag); w.Code != http.StatusNotModified {
+		t.Errorf("revalidating an unchanged product got status %d, want %d", w.Code, http.StatusNotModified)
+	}
+
+	// Deleting the image leaves the product's updated_at as it was
+	images.images[1] = nil
+	w := getCatalogProduct(router, "If-None-Match", etag)
+	if w.Code != http.StatusOK || w.Header().Get("ETag") == etag {
+		t.Errorf("revalidating after the image was deleted got status %d with ETag %s, want a new 200", w.Code, w.Header().Get("ETag"))
+	}
+	if w := getCatalogProduct(router, "If-Modified-Since", time.Now().UTC().Format(http.TimeFormat)); w.Code != http.StatusOK {
+		t.Errorf("If-Modified-Since got status %d, want it ignored", w.Code)
+	}
+}
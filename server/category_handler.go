@@ -0,0 +1,183 @@
+package server
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/techagentng/ecommerce-api/errors"
+	"github.com/techagentng/ecommerce-api/models"
+	"github.com/techagentng/ecommerce-api/server/response"
+)
+
+// handleListCategories returns the category tree
+// @Summary List categories
+// @Description Get the category tree, root categories first with their subcategories nested
+// @Tags catalog
+// @Produce json
+// @Success 200 {array} models.CategoryNode
+// @Router /catalog/categories [get]
+func (s *Server) handleListCategories() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		tree, err := s.CategoryService.ListCategoryTree()
+		if err != nil {
+			response.JSON(c, "", err.Status, nil, err)
+			return
+		}
+		response.JSON(c, "Categories retrieved successfully", http.StatusOK, tree, nil)
+	}
+}
+
+// handleGetCategory retrieves a category with its breadcrumb path
+// @Summary Get a category
+// @Description Get a category and the breadcrumb path from its root category
+// @Tags catalog
+// @Produce json
+// @Param category_id path int true "Category ID"
+// @Success 200 {object} models.CategoryResponse
+// @Failure 400 {object} response.ErrorResponse "Invalid category ID"
+// @Failure 404 {object} response.ErrorResponse "Category not found"
+// @Router /catalog/categories/{category_id} [get]
+func (s *Server) handleGetCategory() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		categoryID, ok := categoryIDParam(c)
+		if !ok {
+			return
+		}
+		category, err := s.CategoryService.GetCategory(categoryID)
+		if err != nil {
+			response.JSON(c, "", err.Status, nil, err)
+			return
+		}
+		response.JSON(c, "Category retrieved successfully", http.StatusOK, category, nil)
+	}
+}
+
+// handleCreateCategory creates a category
+// @Summary Create a category
+// @Description Create a category, optionally below a parent category (requires the categories:manage permission)
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Param category body models.CreateCategoryRequest true "Category"
+// @Success 201 {object} models.CategoryResponse
+// @Failure 400 {object} response.ErrorResponse "Invalid request or unknown parent"
+// @Failure 403 {object} response.ErrorResponse "Missing permission"
+// @Failure 409 {object} response.ErrorResponse "Slug in use"
+// @Router /admin/categories [post]
+func (s *Server) handleCreateCategory() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var categoryRequest models.CreateCategoryRequest
+		if err := decode(c, &categoryRequest); err != nil {
+			response.JSON(c, "", errors.ErrBadRequest.Status, nil, err)
+			return
+		}
+		category, err := s.CategoryService.CreateCategory(&categoryRequest)
+		if err != nil {
+			response.JSON(c, "", err.Status, nil, err)
+			return
+		}
+		response.JSON(c, "Category created successfully", http.StatusCreated, category, nil)
+	}
+}
+
+// handleUpdateCategory renames or moves a category
+// @Summary Update a category
+// @Description Rename a category or move it, with its subcategories, below another parent or to the root (requires the categories:manage permission)
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Param category_id path int true "Category ID"
+// @Param category body models.UpdateCategoryRequest true "Changes"
+// @Success 200 {object} models.CategoryResponse
+// @Failure 400 {object} response.ErrorResponse "Invalid request or move"
+// @Failure 403 {object} response.ErrorResponse "Missing permission"
+// @Failure 404 {object} response.ErrorResponse "Category not found"
+// @Failure 409 {object} response.ErrorResponse "Slug in use"
+// @Router /admin/categories/{category_id} [patch]
+func (s *Server) handleUpdateCategory() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		categoryID, ok := categoryIDParam(c)
+		if !ok {
+			return
+		}
+		var updateRequest models.UpdateCategoryRequest
+		if err := decode(c, &updateRequest); err != nil {
+			response.JSON(c, "", errors.ErrBadRequest.Status, nil, err)
+			return
+		}
+		category, err := s.CategoryService.UpdateCategory(categoryID, &updateRequest)
+		if err != nil {
+			response.JSON(c, "", err.Status, nil, err)
+			return
+		}
+		response.JSON(c, "Category updated successfully", http.StatusOK, category, nil)
+	}
+}
+
+// handleDeleteCategory deletes a category
+// @Summary Delete a category
+// @Description Delete a category. Its subcategories move up to its parent and its products are kept. (requires the categories:manage permission)
+// @Tags admin
+// @Produce json
+// @Param category_id path int true "Category ID"
+// @Success 204 "No Content"
+// @Failure 403 {object} response.ErrorResponse "Missing permission"
+// @Failure 404 {object} response.ErrorResponse "Category not found"
+// @Router /admin/categories/{category_id} [delete]
+func (s *Server) handleDeleteCategory() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		categoryID, ok := categoryIDParam(c)
+		if !ok {
+			return
+		}
+		if err := s.CategoryService.DeleteCategory(categoryID); err != nil {
+			response.JSON(c, "", err.Status, nil, err)
+			return
+		}
+		c.Status(http.StatusNoContent)
+	}
+}
+
+// handleSetProductCategories replaces the categories of a product
+// @Summary Set product categories
+// @Description Replace the categories a product belongs to (requires the products:update permission)
+// @Tags Products
+// @Accept json
+// @Produce json
+// @Param product_id path int true "Product ID"
+// @Param categories body models.SetProductCategoriesRequest true "Category IDs"
+// @Success 200 {array} models.Category
+// @Failure 400 {object} response.ErrorResponse "Invalid request or unknown category"
+// @Failure 403 {object} response.ErrorResponse "Missing permission"
+// @Failure 404 {object} response.ErrorResponse "Product not found"
+// @Router /products/{product_id}/categories [put]
+func (s *Server) handleSetProductCategories() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		productID, ok := productIDParam(c)
+		if !ok {
+			return
+		}
+		var categoriesRequest models.SetProductCategoriesRequest
+		if err := decode(c, &categoriesRequest); err != nil {
+			response.JSON(c, "", errors.ErrBadRequest.Status, nil, err)
+			return
+		}
+		categories, err := s.CategoryService.SetProductCategories(productID, categoriesRequest.CategoryIDs)
+		if err != nil {
+			response.JSON(c, "", err.Status, nil, err)
+			return
+		}
+		response.JSON(c, "Product categories updated", http.StatusOK, categories, nil)
+	}
+}
+
+// categoryIDParam parses the category_id path parameter, responding with 400 if it is invalid
+func categoryIDParam(c *gin.Context) (uint, bool) {
+	categoryID64, err := strconv.ParseUint(c.Param("category_id"), 10, 32)
+	if err != nil {
+		response.JSON(c, "Invalid category ID", http.StatusBadRequest, nil, err)
+		return 0, false
+	}
+	return uint(categoryID64), true
+}
@@ -0,0 +1,93 @@
+package server
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	errs "github.com/techagentng/ecommerce-api/errors"
+)
+
+const (
+	idempotencyKeyHeader      = "Idempotency-Key"
+	idempotentReplayedHeader  = "Idempotent-Replayed"
+	maxIdempotencyKeyLength   = 255
+	maxIdempotentRequestBytes = 1 << 20
+)
+
+// Idempotent lets clients retry a mutating endpoint safely. A request with an
+// Idempotency-Key header runs once per user and key; an identical retry gets
+// the stored response with the Idempotent-Replayed header, a retry while the
+// first request is still running gets 409, and reusing the key for a
+// different request gets 422. Server errors are not stored, so the request
+// can be retried. Requests without the header run as usual. It must run
+// after Authorize.
+func (s *Server) Idempotent() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		key := c.GetHeader(idempotencyKeyHeader)
+		if key == "" {
+			c.Next()
+			return
+		}
+		if len(key) > maxIdempotencyKeyLength {
+			respondAndAbort(c, "", http.StatusBadRequest, nil, errs.New("Idempotency-Key is too long", http.StatusBadRequest))
+			return
+		}
+
+		body, err := io.ReadAll(http.MaxBytesReader(c.Writer, c.Request.Body, maxIdempotentRequestBytes))
+		if err != nil {
+			respondAndAbort(c, "", http.StatusRequestEntityTooLarge, nil, errs.New("request body is too large", http.StatusRequestEntityTooLarge))
+			return
+		}
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
+
+		record, apiErr := s.IdempotencyService.BeginRequest(c.GetUint("userID"), key, requestHash(c.Request, body))
+		if apiErr != nil {
+			respondAndAbort(c, "", apiErr.Status, nil, apiErr)
+			return
+		}
+		if record.StatusCode != 0 {
+			c.Header(idempotentReplayedHeader, "true")
+			c.Data(record.StatusCode, record.ContentType, record.ResponseBody)
+			c.Abort()
+			return
+		}
+
+		recorder := &responseRecorder{ResponseWriter: c.Writer}
+		c.Writer = recorder
+		c.Next()
+
+		if recorder.Status() >= http.StatusInternalServerError {
+			s.IdempotencyService.ReleaseRequest(record)
+			return
+		}
+		s.IdempotencyService.CompleteRequest(record, recorder.Status(), recorder.Header().Get("Content-Type"), recorder.body.Bytes())
+	}
+}
+
+// requestHash identifies a request by its method, path and body
+func requestHash(r *http.Request, body []byte) string {
+	hash := sha256.New()
+	hash.Write([]byte(r.Method + " " + r.URL.Path + "\n"))
+	hash.Write(body)
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// responseRecorder keeps a copy of the response body as it is written
+type responseRecorder struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (w *responseRecorder) Write(data []byte) (int, error) {
+	w.body.Write(data)
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *responseRecorder) WriteString(data string) (int, error) {
+	w.body.WriteString(data)
+	return w.ResponseWriter.WriteString(data)
+}
@@ -0,0 +1,234 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/techagentng/ecommerce-api/config"
+	"github.com/techagentng/ecommerce-api/models"
+	"github.com/techagentng/ecommerce-api/services"
+)
+
+// memoryIdempotencyRepo holds the keys of a test in memory, with the
+// semantics of the unique (user_id, key) index the Postgres repo relies on
+type memoryIdempotencyRepo struct {
+	mu      sync.Mutex
+	records map[string]*models.IdempotencyKey
+	nextID  uint
+}
+
+func newMemoryIdempotencyRepo() *memoryIdempotencyRepo {
+	return &memoryIdempotencyRepo{records: map[string]*models.IdempotencyKey{}}
+}
+
+func idempotencyRecordKey(userID uint, key string) string {
+	return fmt.Sprintf("%d/%s", userID, key)
+}
+
+func (r *memoryIdempotencyRepo) AcquireIdempotencyKey(record *models.IdempotencyKey, now int64) (*models.IdempotencyKey, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	existing, ok := r.records[idempotencyRecordKey(record.UserID, record.Key)]
+	switch {
+	case !ok:
+		r.nextID++
+		record.ID = r.nextID
+	case existing.ExpiresAt < now || (existing.StatusCode == 0 && existing.LockedUntil < now):
+		record.ID = existing.ID
+	default:
+		found := *existing
+		return &found, nil
+	}
+	stored := *record
+	r.records[idempotencyRecordKey(record.UserID, record.Key)] = &stored
+	return nil, nil
+}
+
+func (r *memoryIdempotencyRepo) SaveIdempotentResponse(record *models.IdempotencyKey) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	stored := r.records[idempotencyRecordKey(record.UserID, record.Key)]
+	stored.StatusCode = record.StatusCode
+	stored.ContentType = record.ContentType
+	stored.ResponseBody = record.ResponseBody
+	stored.LockedUntil = 0
+	return nil
+}
+
+func (r *memoryIdempotencyRepo) ReleaseIdempotencyKey(record *models.IdempotencyKey) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	key := idempotencyRecordKey(record.UserID, record.Key)
+	if stored, ok := r.records[key]; ok && stored.ID == record.ID && stored.StatusCode == 0 {
+		delete(r.records, key)
+	}
+	return nil
+}
+
+func (r *memoryIdempotencyRepo) DeleteExpiredIdempotencyKeys(now int64) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var deleted int64
+	for key, record := range r.records {
+		if record.ExpiresAt < now && (record.StatusCode != 0 || record.LockedUntil < now) {
+			delete(r.records, key)
+			deleted++
+		}
+	}
+	return deleted, nil
+}
+
+// newIdempotencyTestServer serves POST /orders behind Idempotent for user 7,
+// with handler answering the requests that get through
+func newIdempotencyTestServer(repo *memoryIdempotencyRepo, handler gin.HandlerFunc) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	conf := &config.Config{IdempotencyKeyTTL: time.Hour, IdempotencyLockTimeout: time.Minute}
+	s := &Server{Config: conf, IdempotencyService: services.NewIdempotencyService(repo, conf)}
+	router := gin.New()
+	router.POST("/orders", func(c *gin.Context) {
+		c.Set("userID", uint(7))
+	}, s.Idempotent(), handler)
+	return router
+}
+
+func postWithIdempotencyKey(router *gin.Engine, key string, body string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/orders", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(idempotencyKeyHeader, key)
+	router.ServeHTTP(w, req)
+	return w
+}
+
+// countingHandler answers 201 with the number of requests it handled
+func countingHandler(calls *int32) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		n := atomic.AddInt32(calls, 1)
+		c.JSON(http.StatusCreated, gin.H{"order": n})
+	}
+}
+
+func TestIdempotentReplaysStoredResponse(t *testing.T) {
+	var calls int32
+	router := newIdempotencyTestServer(newMemoryIdempotencyRepo(), countingHandler(&calls))
+
+	first := postWithIdempotencyKey(router, "key-1", `{"items":[1]}`)
+	if first.Code != http.StatusCreated {
+		t.Fatalf("got status %d, body %s", first.Code, first.Body.String())
+	}
+	retry := postWithIdempotencyKey(router, "key-1", `{"items":[1]}`)
+	if retry.Code != first.Code || retry.Body.String() != first.Body.String() {
+		t.Errorf("retry got %d %s, want the stored %d %s", retry.Code, retry.Body.String(), first.Code, first.Body.String())
+	}
+	if retry.Header().Get(idempotentReplayedHeader) != "true" {
+		t.Errorf("the replayed response lacks %s", idempotentReplayedHeader)
+	}
+	if first.Header().Get(idempotentReplayedHeader) != "" {
+		t.Errorf("the first response has %s", idempotentReplayedHeader)
+	}
+
+	other := postWithIdempotencyKey(router, "key-2", `{"items":[1]}`)
+	if other.Code != http.StatusCreated || calls != 2 {
+		t.Errorf("a new key got status %d after %d calls, want it handled as the second", other.Code, calls)
+	}
+}
+
+func TestIdempotentRejectsKeyReusedForDifferentRequest(t *testing.T) {
+	var calls int32
+	router := newIdempotencyTestServer(newMemoryIdempotencyRepo(), countingHandler(&calls))
+
+	postWithIdempotencyKey(router, "key-1", `{"items":[1]}`)
+	w := postWithIdempotencyKey(router, "key-1", `{"items":[2]}`)
+	if w.Code != http.StatusUnprocessableEntity {
+		t.Errorf("got status %d, want %d", w.Code, http.StatusUnprocessableEntity)
+	}
+	if calls != 1 {
+		t.Errorf("the handler ran %d times, want once", calls)
+	}
+}
+
+func TestIdempotentRunsConcurrentDuplicatesOnce(t *testing.T) {
+	var calls int32
+	release := make(chan struct{})
+	router := newIdempotencyTestServer(newMemoryIdempotencyRepo(), func(c *gin.Context) {
+		atomic.AddInt32(&calls, 1)
+		<-release
+		c.JSON(http.StatusCreated, gin.H{"order": 1})
+	})
+
+	const requests = 10
+	codes := make(chan int, requests)
+	var wg sync.WaitGroup
+	for i := 0; i < requests; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			codes <- postWithIdempotencyKey(router, "key-1", `{"items":[1]}`).Code
+		}()
+	}
+	// Every duplicate is turned away while the request holding the key waits
+	for i := 0; i < requests-1; i++ {
+		if code := <-codes; code != http.StatusConflict {
+			t.Errorf("a duplicate in flight got status %d, want %d", code, http.StatusConflict)
+		}
+	}
+	close(release)
+	wg.Wait()
+	if code := <-codes; code != http.StatusCreated {
+		t.Errorf("the request holding the key got status %d, want %d", code, http.StatusCreated)
+	}
+	if calls != 1 {
+		t.Errorf("the handler ran %d times, want once", calls)
+	}
+
+	if w := postWithIdempotencyKey(router, "key-1", `{"items":[1]}`); w.Code != http.StatusCreated || w.Header().Get(idempotentReplayedHeader) != "true" {
+		t.Errorf("a retry after completion got status %d, want the replayed %d", w.Code, http.StatusCreated)
+	}
+}
+
+func TestIdempotentTakesOverKeyWhoseLockPassed(t *testing.T) {
+	repo := newMemoryIdempotencyRepo()
+	// A request that crashed while holding the key a minute ago
+	past := time.Now().Add(-time.Minute).Unix()
+	repo.records[idempotencyRecordKey(7, "key-1")] = &models.IdempotencyKey{
+		ID: 1, UserID: 7, Key: "key-1", RequestHash: "crashed",
+		LockedUntil: past, ExpiresAt: time.Now().Add(time.Hour).Unix(), CreatedAt: past,
+	}
+	repo.nextID = 1
+	var calls int32
+	router := newIdempotencyTestServer(repo, countingHandler(&calls))
+
+	w := postWithIdempotencyKey(router, "key-1", `{"items":[1]}`)
+	if w.Code != http.StatusCreated || calls != 1 {
+		t.Errorf("got status %d after %d calls, want the request to take the key over and run", w.Code, calls)
+	}
+}
+
+func TestIdempotentReleasesKeyAfterServerError(t *testing.T) {
+	var calls int32
+	router := newIdempotencyTestServer(newMemoryIdempotencyRepo(), func(c *gin.Context) {
+		if atomic.AddInt32(&calls, 1) == 1 {
+			c.JSON(http.StatusInternalServerError, gin.H{"errors": "internal server error"})
+			return
+		}
+		c.JSON(http.StatusCreated, gin.H{"order": 1})
+	})
+
+	if w := postWithIdempotencyKey(router, "key-1", `{"items":[1]}`); w.Code != http.StatusInternalServerError {
+		t.Fatalf("got status %d, want %d", w.Code, http.StatusInternalServerError)
+	}
+	w := postWithIdempotencyKey(router, "key-1", `{"items":[1]}`)
+	if w.Code != http.StatusCreated || w.Header().Get(idempotentReplayedHeader) != "" {
+		t.Errorf("the retry got status %d replayed %q, want it run again", w.Code, w.Header().Get(idempotentReplayedHeader))
+	}
+	if calls != 2 {
+		t.Errorf("the handler ran %d times, want twice", calls)
+	}
+}
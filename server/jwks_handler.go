@@ -0,0 +1,23 @@
+package server
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// handleJWKS publishes the public keys access tokens can be verified with.
+// The key set is returned as is rather than in the response envelope so
+// standard JWT libraries can consume it.
+// @Summary JSON Web Key Set
+// @Description Public keys for verifying access tokens, selected by the token's kid header. Empty when tokens are signed with HS256.
+// @Tags auth
+// @Produce json
+// @Success 200 {object} jwt.JWKS
+// @Router /.well-known/jwks.json [get]
+func (s *Server) handleJWKS() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Header("Cache-Control", "public, max-age=300")
+		c.JSON(http.StatusOK, s.Keyring.JWKS())
+	}
+}
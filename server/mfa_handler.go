@@ -0,0 +1,137 @@
+package server
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/techagentng/ecommerce-api/errors"
+	"github.com/techagentng/ecommerce-api/models"
+	"github.com/techagentng/ecommerce-api/server/response"
+)
+
+// handleEnrollMFA starts TOTP enrollment
+// @Summary Start MFA enrollment
+// @Description Generate a TOTP secret and otpauth URI for an authenticator app. MFA is enabled once a code is confirmed.
+// @Tags auth
+// @Produce json
+// @Success 200 {object} models.MFAEnrollResponse
+// @Failure 401 {object} response.ErrorResponse "Unauthorized"
+// @Failure 409 {object} response.ErrorResponse "MFA already enabled"
+// @Router /auth/mfa/enroll [post]
+func (s *Server) handleEnrollMFA() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		enrollment, err := s.AuthService.EnrollMFA(c.GetUint("userID"))
+		if err != nil {
+			response.JSON(c, "", err.Status, nil, err)
+			return
+		}
+		response.JSON(c, "Scan the otpauth URI with your authenticator app and confirm a code", http.StatusOK, enrollment, nil)
+	}
+}
+
+// handleConfirmMFA enables MFA
+// @Summary Confirm MFA enrollment
+// @Description Enable MFA with a code from the authenticator app. Returns one-time recovery codes, which are only shown once.
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param request body models.MFACodeRequest true "TOTP code"
+// @Success 200 {object} models.MFARecoveryCodesResponse
+// @Failure 400 {object} response.ErrorResponse "Enrollment not started"
+// @Failure 401 {object} response.ErrorResponse "Invalid code"
+// @Router /auth/mfa/confirm [post]
+func (s *Server) handleConfirmMFA() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var codeRequest models.MFACodeRequest
+		if err := decode(c, &codeRequest); err != nil {
+			response.JSON(c, "", errors.ErrBadRequest.Status, nil, err)
+			return
+		}
+		codes, err := s.AuthService.ConfirmMFA(c.GetUint("userID"), codeRequest.Code)
+		if err != nil {
+			response.JSON(c, "", err.Status, nil, err)
+			return
+		}
+		response.JSON(c, "MFA enabled", http.StatusOK, codes, nil)
+	}
+}
+
+// handleDisableMFA disables MFA
+// @Summary Disable MFA
+// @Description Disable MFA with a TOTP or recovery code. Not allowed when the user's role requires MFA.
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param request body models.MFACodeRequest true "TOTP or recovery code"
+// @Success 200 {string} string "MFA disabled"
+// @Failure 401 {object} response.ErrorResponse "Invalid code"
+// @Failure 403 {object} response.ErrorResponse "Role requires MFA"
+// @Router /auth/mfa/disable [post]
+func (s *Server) handleDisableMFA() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var codeRequest models.MFACodeRequest
+		if err := decode(c, &codeRequest); err != nil {
+			response.JSON(c, "", errors.ErrBadRequest.Status, nil, err)
+			return
+		}
+		if err := s.AuthService.DisableMFA(c.GetUint("userID"), codeRequest.Code); err != nil {
+			response.JSON(c, "", err.Status, nil, err)
+			return
+		}
+		response.JSON(c, "MFA disabled", http.StatusOK, nil, nil)
+	}
+}
+
+// handleRegenerateRecoveryCodes replaces the user's recovery codes
+// @Summary Regenerate recovery codes
+// @Description Replace all recovery codes after checking a TOTP code
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param request body models.MFACodeRequest true "TOTP code"
+// @Success 200 {object} models.MFARecoveryCodesResponse
+// @Failure 401 {object} response.ErrorResponse "Invalid code"
+// @Router /auth/mfa/recovery-codes [post]
+func (s *Server) handleRegenerateRecoveryCodes() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var codeRequest models.MFACodeRequest
+		if err := decode(c, &codeRequest); err != nil {
+			response.JSON(c, "", errors.ErrBadRequest.Status, nil, err)
+			return
+		}
+		codes, err := s.AuthService.RegenerateRecoveryCodes(c.GetUint("userID"), codeRequest.Code)
+		if err != nil {
+			response.JSON(c, "", err.Status, nil, err)
+			return
+		}
+		response.JSON(c, "Recovery codes regenerated", http.StatusOK, codes, nil)
+	}
+}
+
+// handleVerifyMFA completes a login that required MFA
+// @Summary Verify an MFA code
+// @Description Exchange the MFA token returned by login and a TOTP or recovery code for an access and refresh token
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param request body models.MFAVerifyRequest true "MFA token and code"
+// @Success 200 {object} models.LoginResponse
+// @Failure 401 {object} response.ErrorResponse "Invalid MFA token or code"
+// @Failure 423 {object} response.ErrorResponse "Account locked"
+// @Router /auth/mfa/verify [post]
+func (s *Server) handleVerifyMFA() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var verifyRequest models.MFAVerifyRequest
+		if err := decode(c, &verifyRequest); err != nil {
+			response.JSON(c, "", errors.ErrBadRequest.Status, nil, err)
+			return
+		}
+		loginResponse, err := s.AuthService.VerifyMFA(verifyRequest.MFAToken, verifyRequest.Code, c.ClientIP())
+		if err != nil {
+			response.JSON(c, "", err.Status, nil, err)
+			return
+		}
+		s.mergeGuestCartOnLogin(c, loginResponse.ID)
+		response.JSON(c, "login successful", http.StatusOK, loginResponse, nil)
+	}
+}
@@ -8,6 +8,7 @@ import (
 
 	"github.com/gin-gonic/gin"
 	errs "github.com/techagentng/ecommerce-api/errors"
+	"github.com/techagentng/ecommerce-api/models"
 	"github.com/techagentng/ecommerce-api/server/response"
 	"github.com/techagentng/ecommerce-api/services/jwt"
 	"gorm.io/gorm"
@@ -21,15 +22,20 @@ func (s *Server) Authorize() gin.HandlerFunc {
 			return
 		}
 
-		if s.AuthRepository.IsTokenInBlacklist(accessToken) {
+		accessClaims, err := jwt.ValidateAndGetClaims(accessToken, s.Keyring)
+		if err != nil {
+			respondAndAbort(c, "", http.StatusUnauthorized, nil, errs.New("Unauthorized", http.StatusUnauthorized))
+			return
+		}
+
+		if s.AuthRepository.IsTokenInBlacklist(jwt.TokenKey(accessToken, accessClaims)) {
 			respondAndAbort(c, "Access token is blacklisted", http.StatusUnauthorized, nil, errs.New("Unauthorized", http.StatusUnauthorized))
 			return
 		}
 
-		secret := s.Config.JWTSecret
-		accessClaims, err := jwt.ValidateAndGetClaims(accessToken, secret)
-		if err != nil {
-			respondAndAbort(c, "", http.StatusUnauthorized, nil, errs.New("Unauthorized", http.StatusUnauthorized))
+		// Refresh tokens may only be exchanged at /auth/refresh
+		if jwt.TokenType(accessClaims) != jwt.AccessTokenType {
+			respondAndAbort(c, "invalid token type", http.StatusUnauthorized, nil, errs.New("Unauthorized", http.StatusUnauthorized))
 			return
 		}
 
@@ -58,6 +64,22 @@ func (s *Server) Authorize() gin.HandlerFunc {
 			}
 		}
 
+		if !user.IsActive() {
+			respondAndAbort(c, "inactive user", http.StatusUnauthorized, nil, errs.New(errs.InActiveUserError.Error(), http.StatusUnauthorized))
+			return
+		}
+
+		if s.Config.RequireEmailVerification && !user.IsEmailActive {
+			respondAndAbort(c, "email address is not verified", http.StatusUnauthorized, nil, errs.New(errs.InActiveUserError.Error(), http.StatusUnauthorized))
+			return
+		}
+
+		// Tokens issued before the user's sessions were revoked carry an older version
+		if jwt.TokenVersion(accessClaims) != user.TokenVersion {
+			respondAndAbort(c, "Access token has been revoked", http.StatusUnauthorized, nil, errs.New("Unauthorized", http.StatusUnauthorized))
+			return
+		}
+
 		// Extract role from claims
 		role, ok := accessClaims["role"].(string)
 		if !ok {
@@ -74,6 +96,68 @@ func (s *Server) Authorize() gin.HandlerFunc {
 	}
 }
 
+// OptionalAuthorize authenticates the request like Authorize when it carries
+// an access token, and lets it through as a guest's otherwise
+func (s *Server) OptionalAuthorize() gin.HandlerFunc {
+	authorize := s.Authorize()
+	return func(c *gin.Context) {
+		if getTokenFromHeader(c) == "" {
+			c.Next()
+			return
+		}
+		authorize(c)
+	}
+}
+
+// RequirePermission aborts with 403 unless the authenticated user's role
+// grants permission. It must run after Authorize.
+func (s *Server) RequirePermission(permission string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		allowed, err := s.RoleService.HasPermission(c.GetString("user_role"), permission)
+		if err != nil {
+			log.Printf("Error resolving permissions for role %s: %v", c.GetString("user_role"), err)
+			respondAndAbort(c, "", http.StatusInternalServerError, nil, errs.New("internal server error", http.StatusInternalServerError))
+			return
+		}
+		if !allowed {
+			respondAndAbort(c, "missing permission "+permission, http.StatusForbidden, nil, errs.New("Forbidden", http.StatusForbidden))
+			return
+		}
+		c.Next()
+	}
+}
+
+// EnforceMFAPolicy aborts with 403 when the user's role requires MFA and the
+// user has not enabled it. It must run after Authorize.
+func (s *Server) EnforceMFAPolicy() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		required, err := s.RoleService.RequiresMFA(c.GetString("user_role"))
+		if err != nil {
+			log.Printf("Error resolving MFA policy for role %s: %v", c.GetString("user_role"), err)
+			respondAndAbort(c, "", http.StatusInternalServerError, nil, errs.New("internal server error", http.StatusInternalServerError))
+			return
+		}
+		if required {
+			user, ok := c.MustGet("user").(*models.User)
+			if !ok || !user.MFAEnabled {
+				respondAndAbort(c, "MFA enrollment required", http.StatusForbidden, nil, errs.New("Forbidden", http.StatusForbidden))
+				return
+			}
+		}
+		c.Next()
+	}
+}
+
+// hasPermission reports whether the authenticated user's role grants permission
+func (s *Server) hasPermission(c *gin.Context, permission string) bool {
+	allowed, err := s.RoleService.HasPermission(c.GetString("user_role"), permission)
+	if err != nil {
+		log.Printf("Error resolving permissions for role %s: %v", c.GetString("user_role"), err)
+		return false
+	}
+	return allowed
+}
+
 // respondAndAbort calls response.JSON and aborts the Context
 func respondAndAbort(c *gin.Context, message string, status int, data interface{}, e *errs.Error) {
 	response.JSON(c, message, status, data, e)
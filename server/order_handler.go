@@ -1,44 +1,35 @@
 package server
 
 import (
-	"fmt"
+	"errors"
 	"log"
 	"net/http"
 	"strconv"
-	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/techagentng/ecommerce-api/db"
+	apiError "github.com/techagentng/ecommerce-api/errors"
 	"github.com/techagentng/ecommerce-api/models"
 	"github.com/techagentng/ecommerce-api/server/response"
 )
 
-type OrderRequest struct {
-    Items []struct {
-        ProductID uint `json:"product_id" binding:"required"`
-        Quantity  int  `json:"quantity" binding:"required,min=1"`
-    } `json:"items" binding:"required"`
-}
-
 // handlePlaceOrder handles placing a new order.
 // @Summary Place a new order
-// @Description Place a new order with specified items
+// @Description Place an order with one line per item. Items of products with variants must name a variant, which sets the price. Lines are priced from the catalog and the total is the sum of the lines. Stock is reserved atomically for every line; if any line is short, nothing is ordered.
 // @Tags orders
 // @Accept json
 // @Produce json
-// @Param order body OrderRequest true "Order details"
-// @Success 201 {object} response.OrderResponse "Order placed successfully"
+// @Param Idempotency-Key header string false "Unique key per order attempt; a retry with the same key and body replays the first response"
+// @Param order body models.PlaceOrderRequest true "Order details"
+// @Success 201 {object} models.Order "Order placed successfully, with its lines"
 // @Failure 400 {object} response.ErrorResponse "Invalid request"
+// @Failure 409 {object} models.InsufficientStockResponse "Insufficient stock, lists every item that is short; or a request with the same Idempotency-Key is in progress"
+// @Failure 422 {object} response.ErrorResponse "Idempotency-Key reused with a different request"
 // @Failure 500 {object} response.ErrorResponse "Internal server error"
 // @Router /user/place/order [post]
 func (s *Server) handlePlaceOrder() gin.HandlerFunc {
     return func(c *gin.Context) {
-        var orderRequest struct {
-            Items []struct {
-                ProductID uint `json:"product_id" binding:"required"`
-                Quantity  int  `json:"quantity" binding:"required"`
-            } `json:"items" binding:"required"`
-        }
-
+        var orderRequest models.PlaceOrderRequest
         if err := c.ShouldBindJSON(&orderRequest); err != nil {
             response.JSON(c, "Invalid order request", http.StatusBadRequest, nil, err)
             return
@@ -50,83 +41,47 @@ func (s *Server) handlePlaceOrder() gin.HandlerFunc {
             return
         }
 
-        var user models.User
-        if err := s.OrderRepo.FindUserByID(userID, &user); err != nil || user.ID == 0 {
-            response.JSON(c, "User not found", http.StatusBadRequest, nil, nil)
-            return
-        }
-
-        var totalOrderPrice float64
-        var orderItems []models.OrderItem
+        order := &models.Order{UserID: userID}
         for _, item := range orderRequest.Items {
-            product, err := s.ProductRepo.FindProductByID(item.ProductID)
-            if err != nil {
-                response.JSON(c, "Error retrieving product", http.StatusInternalServerError, nil, err)
-                return
-            }
-
-            if product == nil {
-                response.JSON(c, "Product not found", http.StatusBadRequest, nil, nil)
-                return
-            }
-
-            itemTotal := float64(item.Quantity) * product.Price
-            totalOrderPrice += itemTotal
-            orderItems = append(orderItems, models.OrderItem{
+            order.Items = append(order.Items, models.OrderItem{
                 ProductID: item.ProductID,
+                VariantID: item.VariantID,
                 Quantity:  item.Quantity,
-                UnitPrice: product.Price,
-                TotalPrice: itemTotal,
             })
         }
 
-        order := models.Order{
-            UserID:     userID,
-            TotalPrice: totalOrderPrice,
-            Status:     "Pending",
-            Items:      orderItems,
-        }
-
-        createdOrders, err := s.OrderRepo.CreateOrder(&order)
+        order, err := s.OrderService.PlaceOrder(order)
         if err != nil {
-            response.JSON(c, "Failed to place order", http.StatusInternalServerError, nil, err)
+            respondPlaceOrderError(c, err)
             return
         }
 
-        // Load order details for each created order
-        var ordersWithDetails []*models.Order 
-        for _, createdOrder := range createdOrders {
-            orderWithDetails, err := s.OrderRepo.LoadOrderDetails(createdOrder.ID)
-            if err != nil {
-                response.JSON(c, "Failed to load order details", http.StatusInternalServerError, nil, err)
-                return
-            }
-            if orderWithDetails != nil { // Check for nil before appending
-                ordersWithDetails = append(ordersWithDetails, orderWithDetails)
-            }
-        }
-
-        // Create response DTO
-        responseDTO := models.PlaceOrderResponse{
-            OrderID:    ordersWithDetails[0].ID, // Assuming you want the ID of the first order
-            UserID:     userID,
-            TotalPrice: totalOrderPrice,
-            Status:     ordersWithDetails[0].Status,
-            CreatedAt:  ordersWithDetails[0].CreatedAt.Format(time.RFC3339),
-        }
+        response.JSON(c, "Order placed successfully", http.StatusCreated, order, nil)
+    }
+}
 
-        response.JSON(c, "Order placed successfully", http.StatusOK, responseDTO, nil)
+// respondPlaceOrderError responds with an error of OrderService.PlaceOrder:
+// 409 listing the short lines when stock is insufficient
+func respondPlaceOrderError(c *gin.Context, err error) {
+    var stockErr *db.InsufficientStockError
+    if errors.As(err, &stockErr) {
+        response.JSON(c, "Insufficient stock", http.StatusConflict, models.InsufficientStockResponse{Items: stockErr.Items}, err)
+        return
+    }
+    var apiErr *apiError.Error
+    if errors.As(err, &apiErr) {
+        response.JSON(c, "", apiErr.Status, nil, apiErr)
+        return
     }
+    response.JSON(c, "Failed to place order", http.StatusInternalServerError, nil, err)
 }
 
 // handleListUserOrders retrieves the list of orders for the authenticated user.
 // @Summary Retrieve user orders
-// @Description Get a list of orders placed by the authenticated user
+// @Description Get the orders placed by the authenticated user with their lines, newest first
 // @Tags orders
-// @Accept json
-// @Param order_id path int true "ID of the order to be canceled (must be a valid order ID)"
 // @Produce json
-// @Success 200 {array} response.OrderResponse "List of user orders"
+// @Success 200 {array} models.Order "List of user orders"
 // @Failure 401 {object} response.ErrorResponse "Unauthorized"
 // @Failure 500 {object} response.ErrorResponse "Internal server error"
 // @Router /user/orders [get]
@@ -166,146 +121,168 @@ func (s *Server) handleListUserOrders() gin.HandlerFunc {
     }
 }
 
+// handleGetOrder retrieves an order with its lines
+// @Summary Get an order
+// @Description Get an order with its lines. Users can read their own orders; reading other users' orders requires the orders:read permission.
+// @Tags orders
+// @Produce json
+// @Param order_id path int true "Order ID"
+// @Success 200 {object} models.Order
+// @Failure 400 {object} response.ErrorResponse "Invalid order ID"
+// @Failure 403 {object} response.ErrorResponse "Forbidden"
+// @Failure 404 {object} response.ErrorResponse "Order not found"
+// @Failure 500 {object} response.ErrorResponse "Internal server error"
+// @Router /user/orders/{order_id} [get]
+func (s *Server) handleGetOrder() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		order, ok := s.readableOrder(c)
+		if !ok {
+			return
+		}
+		response.JSON(c, "Order retrieved successfully", http.StatusOK, order, nil)
+	}
+}
+
+// handleListOrderStatusEvents retrieves an order's status history
+// @Summary Get an order's status history
+// @Description List every status transition of an order, oldest first, with who made it, when and why. Users can read their own orders' history; other users' orders require the orders:read permission.
+// @Tags orders
+// @Produce json
+// @Param order_id path int true "Order ID"
+// @Success 200 {array} models.OrderStatusEvent
+// @Failure 400 {object} response.ErrorResponse "Invalid order ID"
+// @Failure 403 {object} response.ErrorResponse "Forbidden"
+// @Failure 404 {object} response.ErrorResponse "Order not found"
+// @Failure 500 {object} response.ErrorResponse "Internal server error"
+// @Router /user/orders/{order_id}/history [get]
+func (s *Server) handleListOrderStatusEvents() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		order, ok := s.readableOrder(c)
+		if !ok {
+			return
+		}
+		events, err := s.OrderService.ListOrderStatusEvents(order.ID)
+		if err != nil {
+			response.JSON(c, "", err.Status, nil, err)
+			return
+		}
+		response.JSON(c, "Order history retrieved successfully", http.StatusOK, events, nil)
+	}
+}
+
+// readableOrder loads the order of the order_id path parameter when it is
+// the user's own or the user holds the orders:read permission, and responds
+// with the error otherwise
+func (s *Server) readableOrder(c *gin.Context) (*models.Order, bool) {
+	orderID, ok := orderIDParam(c)
+	if !ok {
+		return nil, false
+	}
+	order, err := s.OrderService.GetOrder(orderID)
+	if err != nil {
+		response.JSON(c, "", err.Status, nil, err)
+		return nil, false
+	}
+	if order.UserID != c.GetUint("userID") && !s.hasPermission(c, models.PermissionOrdersRead) {
+		response.JSON(c, "Access denied: You cannot view this order", http.StatusForbidden, nil, nil)
+		return nil, false
+	}
+	return order, true
+}
+
+// orderIDParam parses the order_id path parameter, responding with 400 if it is invalid
+func orderIDParam(c *gin.Context) (uint, bool) {
+	orderID64, err := strconv.ParseUint(c.Param("order_id"), 10, 32)
+	if err != nil {
+		response.JSON(c, "Invalid order ID", http.StatusBadRequest, nil, err)
+		return 0, false
+	}
+	return uint(orderID64), true
+}
+
 // handleCancelOrder cancels an order for the authenticated user.
 // @Summary Cancel an order
-// @Description Cancel an order by ID for the authenticated user
+// @Description Cancel a pending order and return its stock. Users can cancel their own orders; cancelling other users' orders requires the orders:cancel_any permission. The optional reason is kept in the order's status history.
 // @Tags orders
 // @Accept json
 // @Produce json
 // @Param order_id path int true "ID of the order to be canceled"
-// @Success 200 {string} string "Order canceled successfully"
+// @Param reason body models.CancelOrderRequest false "Why the order is canceled"
+// @Success 200 {object} models.Order "Order canceled successfully"
 // @Failure 400 {object} response.ErrorResponse "Bad request"
 // @Failure 401 {object} response.ErrorResponse "Unauthorized"
 // @Failure 403 {object} response.ErrorResponse "Forbidden"
 // @Failure 404 {object} response.ErrorResponse "Order not found"
+// @Failure 409 {object} response.ErrorResponse "The order is no longer pending"
 // @Failure 500 {object} response.ErrorResponse "Internal server error"
 // @Router /cancel/order/{order_id} [patch]
 func (s *Server) handleCancelOrder() gin.HandlerFunc {
-    return func(c *gin.Context) {
-        userRole, _ := c.Get("user_role")
-        userID, _ := c.Get("userID")
-        orderIDStr := c.Param("order_id")
-        fmt.Println("Order ID parameter:", orderIDStr) 
-        if orderIDStr == "" {
-            response.JSON(c, "Order ID cannot be empty", http.StatusBadRequest, nil, nil)
-            return
-        }
-        orderID64, err := strconv.ParseUint(orderIDStr, 10, 32) 
-        if err != nil {
-            response.JSON(c, "Invalid order ID", http.StatusBadRequest, nil, err)
-            return
-        }
-        
-        orderID := uint(orderID64) 
-        order, err := s.OrderRepo.LoadOrderDetails(orderID)
-        if err != nil {
-            response.JSON(c, "Failed to load order details", http.StatusInternalServerError, nil, err)
-            return
-        }
-        if order == nil {
-            response.JSON(c, "Order not found", http.StatusNotFound, nil, nil)
-            return
-        }
-
-        if order.Status != "Pending" {
-            response.JSON(c, "Only pending orders can be canceled", http.StatusBadRequest, nil, nil)
-            return
-        }
-
-        if userRole != "Admin" && order.UserID != userID {
-            response.JSON(c, "Access denied: You cannot cancel this order", http.StatusForbidden, nil, nil)
-            return
-        }
-
-        // Update the order status to "Canceled"
-        err = s.OrderRepo.CancelOrder(orderID)
-        if err != nil {
-            response.JSON(c, "Failed to cancel order", http.StatusInternalServerError, nil, err)
-            return
-        }
-
-        response.JSON(c, "Order canceled successfully", http.StatusOK, nil, nil)
-    }
-}
-
-type UpdateStatusRequest struct {
-    Status string `json:"status"`
+	return func(c *gin.Context) {
+		userID := c.GetUint("userID")
+		orderID, ok := orderIDParam(c)
+		if !ok {
+			return
+		}
+		var request models.CancelOrderRequest
+		if c.Request.ContentLength != 0 {
+			if err := decode(c, &request); err != nil {
+				response.JSON(c, "", apiError.ErrBadRequest.Status, nil, err)
+				return
+			}
+		}
+
+		order, apiErr := s.OrderService.GetOrder(orderID)
+		if apiErr != nil {
+			response.JSON(c, "", apiErr.Status, nil, apiErr)
+			return
+		}
+		if order.UserID != userID && !s.hasPermission(c, models.PermissionOrdersCancelAny) {
+			response.JSON(c, "Access denied: You cannot cancel this order", http.StatusForbidden, nil, nil)
+			return
+		}
+
+		order, apiErr = s.OrderService.CancelOrder(orderID, userID, request.Reason)
+		if apiErr != nil {
+			response.JSON(c, "", apiErr.Status, nil, apiErr)
+			return
+		}
+		response.JSON(c, "Order canceled successfully", http.StatusOK, order, nil)
+	}
 }
 
 // handleUpdateOrderStatus updates the status of an order for the authenticated admin user.
 // @Summary Update an order status
-// @Description Update the status of an order by ID for the authenticated admin user
+// @Description Move an order along its status graph: Pending -> Paid -> Processing -> Shipped -> Delivered, Pending -> Canceled, and Paid, Processing or Delivered -> Refunded. Paid and Refunded are only reached by paying or refunding the order. Canceling an order returns its stock. The transition is recorded in the order's status history with the optional reason. (requires the orders:update_status permission)
 // @Tags orders
 // @Accept json
 // @Produce json
 // @Param order_id path int true "ID of the order to be updated"
-// @Param status body UpdateStatusRequest true "New status for the order (must be one of Pending, Canceled, Completed, Shipped)"
-// @Success 200 {string} string "Order status updated successfully"
+// @Param status body models.UpdateOrderStatusRequest true "New status and reason"
+// @Success 200 {object} models.Order "Order status updated successfully"
 // @Failure 400 {object} response.ErrorResponse "Bad request"
 // @Failure 401 {object} response.ErrorResponse "Unauthorized"
 // @Failure 403 {object} response.ErrorResponse "Forbidden"
 // @Failure 404 {object} response.ErrorResponse "Order not found"
+// @Failure 409 {object} response.ErrorResponse "The transition is not allowed from the order's status, or is made by a payment"
 // @Failure 500 {object} response.ErrorResponse "Internal server error"
 // @Router /update/order/{order_id} [patch]
 func (s *Server) handleUpdateOrderStatus() gin.HandlerFunc {
-    return func(c *gin.Context) {
-        userRole, _ := c.Get("user_role")
-        if userRole != "Admin" {
-            response.JSON(c, "Only admin users can update the order status", http.StatusForbidden, nil, nil)
-            return
-        }
-
-        orderIDStr := c.Param("order_id")
-        if orderIDStr == "" {
-            response.JSON(c, "Order ID cannot be empty", http.StatusBadRequest, nil, nil)
-            return
-        }
-
-        orderID64, err := strconv.ParseUint(orderIDStr, 10, 32)
-        if err != nil {
-            response.JSON(c, "Invalid order ID", http.StatusBadRequest, nil, err)
-            return
-        }
-        
-        orderID := uint(orderID64)
-        order, err := s.OrderRepo.LoadOrderDetails(orderID)
-        if err != nil {
-            response.JSON(c, "Failed to load order details", http.StatusInternalServerError, nil, err)
-            return
-        }
-        if order == nil {
-            response.JSON(c, "Order not found", http.StatusNotFound, nil, nil)
-            return
-        }
-
-        var req UpdateStatusRequest
-        if err := c.ShouldBindJSON(&req); err != nil {
-            response.JSON(c, "Invalid JSON format", http.StatusBadRequest, nil, err)
-            return
-        }
-        newStatus := req.Status
-
-        allowedStatuses := []string{"Pending", "Canceled", "Completed", "Shipped"}
-        isValidStatus := false
-        for _, status := range allowedStatuses {
-            if newStatus == status {
-                isValidStatus = true
-                break
-            }
-        }
-        if !isValidStatus {
-            response.JSON(c, "Invalid status value", http.StatusBadRequest, nil, nil)
-            return
-        }
-
-        err = s.OrderRepo.UpdateOrderStatus(orderID, newStatus)
-        if err != nil {
-            response.JSON(c, "Failed to update order status", http.StatusInternalServerError, nil, err)
-            return
-        }
-
-        response.JSON(c, "Order status updated successfully", http.StatusOK, nil, nil)
-    }
+	return func(c *gin.Context) {
+		orderID, ok := orderIDParam(c)
+		if !ok {
+			return
+		}
+		var request models.UpdateOrderStatusRequest
+		if err := decode(c, &request); err != nil {
+			response.JSON(c, "", apiError.ErrBadRequest.Status, nil, err)
+			return
+		}
+
+		order, err := s.OrderService.UpdateOrderStatus(orderID, c.GetUint("userID"), request.Status, request.Reason)
+		if err != nil {
+			response.JSON(c, "", err.Status, nil, err)
+			return
+		}
+		response.JSON(c, "Order status updated successfully", http.StatusOK, order, nil)
+	}
 }
-
-
@@ -0,0 +1,49 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/techagentng/ecommerce-api/db"
+	"github.com/techagentng/ecommerce-api/models"
+)
+
+func TestRespondPlaceOrderErrorListsShortLines(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodPost, "/api/v1/user/place/order", nil)
+
+	variantID := uint(7)
+	shortages := []models.StockShortage{
+		{ProductID: 1, Requested: 3, Available: 1},
+		{ProductID: 2, VariantID: &variantID, SKU: "MUG-RED", Requested: 2, Available: 0},
+	}
+	respondPlaceOrderError(c, fmt.Errorf("placing order: %w", &db.InsufficientStockError{Items: shortages}))
+
+	if w.Code != http.StatusConflict {
+		t.Fatalf("got status %d, want %d", w.Code, http.StatusConflict)
+	}
+	var body struct {
+		Data models.InsufficientStockResponse `json:"data"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatal(err)
+	}
+	if len(body.Data.Items) != len(shortages) {
+		t.Fatalf("got %d short lines, want %d: %s", len(body.Data.Items), len(shortages), w.Body.String())
+	}
+	for i, item := range body.Data.Items {
+		want := shortages[i]
+		if item.ProductID != want.ProductID || item.SKU != want.SKU || item.Requested != want.Requested || item.Available != want.Available {
+			t.Errorf("line %d: got %+v, want %+v", i, item, want)
+		}
+	}
+	if body.Data.Items[1].VariantID == nil || *body.Data.Items[1].VariantID != variantID {
+		t.Errorf("the variant of line 1 is missing")
+	}
+}
@@ -0,0 +1,113 @@
+package server
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/techagentng/ecommerce-api/errors"
+	"github.com/techagentng/ecommerce-api/models"
+	"github.com/techagentng/ecommerce-api/server/response"
+)
+
+// handlePayOrder pays a pending order
+// @Summary Pay an order
+// @Description Pay one of the user's pending orders, e.g. right after checking out the cart. The order's total is authorized and captured with the payment method token from the payment provider, and the order becomes Paid only once the capture succeeded. A declined payment leaves the order pending so it can be paid again. Amounts are in minor units of the currency.
+// @Tags orders
+// @Accept json
+// @Produce json
+// @Param order_id path int true "Order ID"
+// @Param Idempotency-Key header string false "Unique key per payment attempt; a retry with the same key and body replays the first response"
+// @Param payment body models.PayOrderRequest true "Payment method token"
+// @Success 201 {object} models.Payment "Payment captured, the order is paid"
+// @Failure 400 {object} response.ErrorResponse "Invalid request"
+// @Failure 402 {object} response.ErrorResponse "The payment was declined"
+// @Failure 404 {object} response.ErrorResponse "Order not found"
+// @Failure 409 {object} response.ErrorResponse "The order is not pending or is already being paid, or a request with the same Idempotency-Key is in progress"
+// @Failure 422 {object} response.ErrorResponse "Idempotency-Key reused with a different request"
+// @Failure 502 {object} response.ErrorResponse "The payment provider could not be reached"
+// @Failure 503 {object} response.ErrorResponse "Payments are disabled"
+// @Router /user/orders/{order_id}/pay [post]
+func (s *Server) handlePayOrder() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		orderID, ok := orderIDParam(c)
+		if !ok {
+			return
+		}
+		var request models.PayOrderRequest
+		if err := decode(c, &request); err != nil {
+			response.JSON(c, "", errors.ErrBadRequest.Status, nil, err)
+			return
+		}
+		user := c.MustGet("user").(*models.User)
+		payment, err := s.PaymentService.PayOrder(orderID, user, &request)
+		if err != nil {
+			response.JSON(c, "", err.Status, nil, err)
+			return
+		}
+		response.JSON(c, "Order paid successfully", http.StatusCreated, payment, nil)
+	}
+}
+
+// handleListOrderPayments lists an order's payment attempts
+// @Summary List an order's payments
+// @Description List every attempt to pay an order, oldest first, with its status, amount in minor units and why it failed. Users can read their own orders' payments; other users' orders require the orders:read permission.
+// @Tags orders
+// @Produce json
+// @Param order_id path int true "Order ID"
+// @Success 200 {array} models.Payment
+// @Failure 400 {object} response.ErrorResponse "Invalid order ID"
+// @Failure 403 {object} response.ErrorResponse "Forbidden"
+// @Failure 404 {object} response.ErrorResponse "Order not found"
+// @Router /user/orders/{order_id}/payments [get]
+func (s *Server) handleListOrderPayments() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		order, ok := s.readableOrder(c)
+		if !ok {
+			return
+		}
+		payments, err := s.PaymentService.ListOrderPayments(order.ID)
+		if err != nil {
+			response.JSON(c, "", err.Status, nil, err)
+			return
+		}
+		response.JSON(c, "Order payments retrieved successfully", http.StatusOK, payments, nil)
+	}
+}
+
+// handleRefundOrder refunds a paid order
+// @Summary Refund an order
+// @Description Refund the captured payment of a paid, processing or delivered order through the payment provider and move the order to Refunded. Stock is returned unless the order was shipped. The optional reason is kept in the order's status history. (requires the payments:refund permission)
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Param order_id path int true "Order ID"
+// @Param Idempotency-Key header string false "Unique key per refund; a retry with the same key and body replays the first response"
+// @Param reason body models.RefundOrderRequest false "Why the order is refunded"
+// @Success 200 {object} models.Order "Order refunded"
+// @Failure 403 {object} response.ErrorResponse "Missing permission"
+// @Failure 404 {object} response.ErrorResponse "Order not found"
+// @Failure 409 {object} response.ErrorResponse "The order cannot be refunded from its status, or the provider declined the refund"
+// @Failure 502 {object} response.ErrorResponse "The payment provider could not be reached"
+// @Failure 503 {object} response.ErrorResponse "Payments are disabled"
+// @Router /admin/orders/{order_id}/refund [post]
+func (s *Server) handleRefundOrder() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		orderID, ok := orderIDParam(c)
+		if !ok {
+			return
+		}
+		var request models.RefundOrderRequest
+		if c.Request.ContentLength != 0 {
+			if err := decode(c, &request); err != nil {
+				response.JSON(c, "", errors.ErrBadRequest.Status, nil, err)
+				return
+			}
+		}
+		order, err := s.PaymentService.RefundOrder(orderID, c.GetUint("userID"), request.Reason)
+		if err != nil {
+			response.JSON(c, "", err.Status, nil, err)
+			return
+		}
+		response.JSON(c, "Order refunded successfully", http.StatusOK, order, nil)
+	}
+}
@@ -13,33 +13,27 @@ import (
 
 // handleCreateProduct handles the creation of a new product
 // @Summary Create a new product
-// @Description Only admin can create a new product
+// @Description Create a new product (requires the products:create permission)
 // @Tags products
 // @Accept json
 // @Produce json
 // @Param product body Product true "Product information"
 // @Success 201 {object} Product
-// @Failure 403 {object} response.ErrorResponse "Only admin users can create products"
+// @Failure 403 {object} response.ErrorResponse "Missing products:create permission"
 // @Failure 400 {object} response.ErrorResponse "Invalid input"
 // @Failure 500 {object} response.ErrorResponse "Internal server error"
 // @Router /products [post]
 func (s *Server) handleCreateProduct() gin.HandlerFunc {
     return func(c *gin.Context) {
-        userRole, _ := c.Get("user_role")
-        if userRole != "Admin" {
-            response.JSON(c, "Only admin users can create products", http.StatusForbidden, nil, nil)
-            return
-        }
-
         var product models.Product
         if err := c.ShouldBindJSON(&product); err != nil {
             response.JSON(c, "Invalid JSON format", http.StatusBadRequest, nil, err)
             return
         }
 
-        createdProduct, err := s.ProductRepo.CreateProduct(&product) 
+        createdProduct, err := s.ProductService.CreateProduct(&product)
         if err != nil {
-            response.JSON(c, "Failed to create product", http.StatusInternalServerError, nil, err)
+            response.JSON(c, "", err.Status, nil, err)
             return
         }
 
@@ -47,26 +41,54 @@ func (s *Server) handleCreateProduct() gin.HandlerFunc {
     }
 }
 
+// handleListProducts lists products
+// @Summary List products
+// @Description List products with offset or cursor pagination, filters and sorting (requires the products:read permission)
+// @Tags Products
+// @Produce json
+// @Param page query int false "Page number, starting at 1"
+// @Param page_size query int false "Page size, at most 100"
+// @Param cursor query string false "next_cursor of the previous page"
+// @Param name query string false "Name contains"
+// @Param min_price query number false "Minimum price"
+// @Param max_price query number false "Maximum price"
+// @Param in_stock query bool false "Only products in stock (true) or out of stock (false)"
+// @Param category query int false "Category ID, including its subcategories"
+// @Param sort query string false "id, name or price, prefixed with - for descending"
+// @Success 200 {object} models.ProductListResponse
+// @Failure 400 {object} response.ErrorResponse "Invalid query"
+// @Failure 403 {object} response.ErrorResponse "Missing permission"
+// @Router /products [get]
+func (s *Server) handleListProducts() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var query models.ProductListQuery
+		if err := c.ShouldBindQuery(&query); err != nil {
+			response.JSON(c, "Invalid query", http.StatusBadRequest, nil, err)
+			return
+		}
+		products, err := s.ProductService.ListProducts(&query)
+		if err != nil {
+			response.JSON(c, "", err.Status, nil, err)
+			return
+		}
+		response.JSON(c, "Products retrieved successfully", http.StatusOK, products, nil)
+	}
+}
+
 // handleReadProduct retrieves a product by ID
 // @Summary Retrieve a product by ID
-// @Description Get product details by ID (admin only)
+// @Description Get product details by ID (requires the products:read permission)
 // @Tags Products
 // @Accept json
 // @Produce json
 // @Param product_id path int true "Product ID"
 // @Success 200 {object} Product "Success"
-// @Failure 403 {object} response.ErrorResponse "Only admin users can access this endpoint"
+// @Failure 403 {object} response.ErrorResponse "Missing permission"
 // @Failure 404 {object} response.ErrorResponse "Product not found"
 // @Failure 500 {object} response.ErrorResponse "Internal server error"
 // @Router /products/{product_id} [get]
 func (s *Server) handleReadProduct() gin.HandlerFunc {
     return func(c *gin.Context) {
-        userRole, _ := c.Get("user_role")
-        if userRole != "Admin" {
-            response.JSON(c, "Only admin users can access this endpoint", http.StatusForbidden, nil, nil)
-            return
-        }
-
         productIDStr := c.Param("product_id")
         if productIDStr == "" {
             response.JSON(c, "Product ID cannot be empty", http.StatusBadRequest, nil, nil)
@@ -96,7 +118,7 @@ func (s *Server) handleReadProduct() gin.HandlerFunc {
 
 // handleUpdateProduct updates a product by ID
 // @Summary Update a product by ID
-// @Description Update product details by ID (admin only)
+// @Description Update product details by ID. The stock is not changed; use a stock adjustment. (requires the products:update permission)
 // @Tags Products
 // @Accept json
 // @Produce json
@@ -104,18 +126,12 @@ func (s *Server) handleReadProduct() gin.HandlerFunc {
 // @Param product body Product true "Product details"
 // @Success 200 {object} response.SuccessResponse "Success"
 // @Failure 400 {object} response.ErrorResponse "Invalid request format"
-// @Failure 403 {object} response.ErrorResponse "Only admin users can access this endpoint"
+// @Failure 403 {object} response.ErrorResponse "Missing permission"
 // @Failure 404 {object} response.ErrorResponse "Product not found"
 // @Failure 500 {object} response.ErrorResponse "Internal server error"
 // @Router /products/{product_id} [put]
 func (s *Server) handleUpdateProduct() gin.HandlerFunc {
     return func(c *gin.Context) {
-        userRole, _ := c.Get("user_role")
-        if userRole != "Admin" {
-            response.JSON(c, "Only admin users can access this endpoint", http.StatusForbidden, nil, nil)
-            return
-        }
-
         productIDStr := c.Param("product_id")
         if productIDStr == "" {
             response.JSON(c, "Product ID cannot be empty", http.StatusBadRequest, nil, nil)
@@ -136,12 +152,8 @@ func (s *Server) handleUpdateProduct() gin.HandlerFunc {
         }
 
         product.ID = productID
-        if err := s.ProductRepo.UpdateProduct(&product); err != nil {
-            if errors.Is(err, gorm.ErrRecordNotFound) {
-                response.JSON(c, "Product not found", http.StatusNotFound, nil, nil)
-                return
-            }
-            response.JSON(c, "Failed to update product", http.StatusInternalServerError, nil, err)
+        if err := s.ProductService.UpdateProduct(&product); err != nil {
+            response.JSON(c, "", err.Status, nil, err)
             return
         }
 
@@ -151,24 +163,18 @@ func (s *Server) handleUpdateProduct() gin.HandlerFunc {
 
 // handleDeleteProduct deletes a product by ID
 // @Summary Delete a product by ID
-// @Description Delete a product from the inventory (admin only)
+// @Description Delete a product from the inventory (requires the products:delete permission)
 // @Tags Products
 // @Accept json
 // @Produce json
 // @Param product_id path int true "Product ID"
 // @Success 204 "No Content"
-// @Failure 403 {object} response.ErrorResponse "Only admin users can access this endpoint"
+// @Failure 403 {object} response.ErrorResponse "Missing permission"
 // @Failure 404 {object} response.ErrorResponse "Product not found"
 // @Failure 500 {object} response.ErrorResponse "Internal server error"
 // @Router /products/{product_id} [delete]
 func (s *Server) handleDeleteProduct() gin.HandlerFunc {
     return func(c *gin.Context) {
-        userRole, _ := c.Get("user_role")
-        if userRole != "Admin" {
-            response.JSON(c, "Only admin users can access this endpoint", http.StatusForbidden, nil, nil)
-            return
-        }
-
         productIDStr := c.Param("product_id")
         if productIDStr == "" {
             response.JSON(c, "Product ID cannot be empty", http.StatusBadRequest, nil, nil)
@@ -182,12 +188,8 @@ func (s *Server) handleDeleteProduct() gin.HandlerFunc {
         }
         
         productID := uint(productID64)
-        if err := s.ProductRepo.DeleteProduct(productID); err != nil {
-            if errors.Is(err, gorm.ErrRecordNotFound) {
-                response.JSON(c, "Product not found", http.StatusNotFound, nil, nil)
-                return
-            }
-            response.JSON(c, "Failed to delete product", http.StatusInternalServerError, nil, err)
+        if err := s.ProductService.DeleteProduct(productID); err != nil {
+            response.JSON(c, "", err.Status, nil, err)
             return
         }
 
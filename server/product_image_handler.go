@@ -0,0 +1,203 @@
+package server
+
+import (
+	"errors"
+	"mime/multipart"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	apiError "github.com/techagentng/ecommerce-api/errors"
+	"github.com/techagentng/ecommerce-api/models"
+	"github.com/techagentng/ecommerce-api/server/response"
+)
+
+// handleListProductImages lists a product's image gallery
+// @Summary List product images
+// @Description List a product's images in gallery order (requires the products:read permission)
+// @Tags Products
+// @Produce json
+// @Param product_id path int true "Product ID"
+// @Success 200 {array} models.ProductImage
+// @Failure 403 {object} response.ErrorResponse "Missing permission"
+// @Failure 404 {object} response.ErrorResponse "Product not found"
+// @Router /products/{product_id}/images [get]
+func (s *Server) handleListProductImages() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		productID, ok := productIDParam(c)
+		if !ok {
+			return
+		}
+		images, err := s.ProductImageService.ListImages(productID)
+		if err != nil {
+			response.JSON(c, "", err.Status, nil, err)
+			return
+		}
+		response.JSON(c, "Images retrieved successfully", http.StatusOK, images, nil)
+	}
+}
+
+// handleAddProductImage uploads an image to a product's gallery
+// @Summary Add a product image
+// @Description Upload a JPEG, PNG or GIF image to the end of a product's gallery. The image is validated by decoding it, stripped of metadata and stored as thumbnail, medium and large renditions. (requires the products:update permission)
+// @Tags Products
+// @Accept multipart/form-data
+// @Produce json
+// @Param product_id path int true "Product ID"
+// @Param image formData file true "Image"
+// @Param alt_text formData string false "Alternative text"
+// @Success 201 {object} models.ProductImage
+// @Failure 400 {object} response.ErrorResponse "Missing or invalid file"
+// @Failure 403 {object} response.ErrorResponse "Missing permission"
+// @Failure 404 {object} response.ErrorResponse "Product not found"
+// @Failure 409 {object} response.ErrorResponse "Gallery is full"
+// @Failure 413 {object} response.ErrorResponse "Image too large"
+// @Failure 415 {object} response.ErrorResponse "Not a supported image type"
+// @Router /products/{product_id}/images [post]
+func (s *Server) handleAddProductImage() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		productID, ok := productIDParam(c)
+		if !ok {
+			return
+		}
+		file, ok := s.imageUpload(c, "image")
+		if !ok {
+			return
+		}
+		defer file.Close()
+
+		image, err := s.ProductImageService.AddImage(productID, file, c.PostForm("alt_text"))
+		if err != nil {
+			response.JSON(c, "", err.Status, nil, err)
+			return
+		}
+		response.JSON(c, "Image added successfully", http.StatusCreated, image, nil)
+	}
+}
+
+// handleUpdateProductImage changes an image's alt text or position
+// @Summary Update a product image
+// @Description Change an image's alt text or move it to another position in the gallery (requires the products:update permission)
+// @Tags Products
+// @Accept json
+// @Produce json
+// @Param product_id path int true "Product ID"
+// @Param image_id path int true "Image ID"
+// @Param image body models.UpdateProductImageRequest true "Changes"
+// @Success 200 {object} models.ProductImage
+// @Failure 400 {object} response.ErrorResponse "Invalid request"
+// @Failure 403 {object} response.ErrorResponse "Missing permission"
+// @Failure 404 {object} response.ErrorResponse "Image not found"
+// @Router /products/{product_id}/images/{image_id} [patch]
+func (s *Server) handleUpdateProductImage() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		productID, ok := productIDParam(c)
+		if !ok {
+			return
+		}
+		imageID, ok := imageIDParam(c)
+		if !ok {
+			return
+		}
+		var imageRequest models.UpdateProductImageRequest
+		if err := decode(c, &imageRequest); err != nil {
+			response.JSON(c, "", apiError.ErrBadRequest.Status, nil, err)
+			return
+		}
+		image, err := s.ProductImageService.UpdateImage(productID, imageID, &imageRequest)
+		if err != nil {
+			response.JSON(c, "", err.Status, nil, err)
+			return
+		}
+		response.JSON(c, "Image updated successfully", http.StatusOK, image, nil)
+	}
+}
+
+// handleReorderProductImages sets the gallery order
+// @Summary Reorder product images
+// @Description Set the gallery order by listing every image ID of the product (requires the products:update permission)
+// @Tags Products
+// @Accept json
+// @Produce json
+// @Param product_id path int true "Product ID"
+// @Param order body models.ReorderProductImagesRequest true "Image IDs in their new order"
+// @Success 200 {array} models.ProductImage
+// @Failure 400 {object} response.ErrorResponse "Invalid request"
+// @Failure 403 {object} response.ErrorResponse "Missing permission"
+// @Failure 404 {object} response.ErrorResponse "Product not found"
+// @Router /products/{product_id}/images/order [put]
+func (s *Server) handleReorderProductImages() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		productID, ok := productIDParam(c)
+		if !ok {
+			return
+		}
+		var orderRequest models.ReorderProductImagesRequest
+		if err := decode(c, &orderRequest); err != nil {
+			response.JSON(c, "", apiError.ErrBadRequest.Status, nil, err)
+			return
+		}
+		images, err := s.ProductImageService.ReorderImages(productID, &orderRequest)
+		if err != nil {
+			response.JSON(c, "", err.Status, nil, err)
+			return
+		}
+		response.JSON(c, "Images reordered successfully", http.StatusOK, images, nil)
+	}
+}
+
+// handleDeleteProductImage removes an image from a product's gallery
+// @Summary Delete a product image
+// @Description Remove an image from the gallery and delete the stored file (requires the products:update permission)
+// @Tags Products
+// @Param product_id path int true "Product ID"
+// @Param image_id path int true "Image ID"
+// @Success 204 "No Content"
+// @Failure 403 {object} response.ErrorResponse "Missing permission"
+// @Failure 404 {object} response.ErrorResponse "Image not found"
+// @Router /products/{product_id}/images/{image_id} [delete]
+func (s *Server) handleDeleteProductImage() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		productID, ok := productIDParam(c)
+		if !ok {
+			return
+		}
+		imageID, ok := imageIDParam(c)
+		if !ok {
+			return
+		}
+		if err := s.ProductImageService.DeleteImage(productID, imageID); err != nil {
+			response.JSON(c, "", err.Status, nil, err)
+			return
+		}
+		c.Status(http.StatusNoContent)
+	}
+}
+
+// imageUpload returns the file uploaded in a multipart form field. Request
+// bodies are capped a little above Config.MaxImageSize, responding with 413
+// for larger ones.
+func (s *Server) imageUpload(c *gin.Context, field string) (multipart.File, bool) {
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, s.Config.MaxImageSize+1<<20)
+	file, _, err := c.Request.FormFile(field)
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			response.JSON(c, "Image too large", http.StatusRequestEntityTooLarge, nil, err)
+			return nil, false
+		}
+		response.JSON(c, field+" is required", http.StatusBadRequest, nil, err)
+		return nil, false
+	}
+	return file, true
+}
+
+// imageIDParam parses the image_id path parameter, responding with 400 if it is invalid
+func imageIDParam(c *gin.Context) (uint, bool) {
+	imageID64, err := strconv.ParseUint(c.Param("image_id"), 10, 32)
+	if err != nil {
+		response.JSON(c, "Invalid image ID", http.StatusBadRequest, nil, err)
+		return 0, false
+	}
+	return uint(imageID64), true
+}
@@ -0,0 +1,123 @@
+package server
+
+import (
+	"errors"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/techagentng/ecommerce-api/models"
+	"github.com/techagentng/ecommerce-api/server/response"
+)
+
+// importMaxBytes caps the size of an uploaded import file
+const importMaxBytes = 32 << 20
+
+// handleImportProducts creates and updates products in bulk
+// @Summary Import products
+// @Description Upsert products from a CSV file (header sku,name,description,price,quantity,stock) or NDJSON file, matching existing products by SKU, then by name. Rows are validated like product creation; any invalid row rejects the whole file with a per-line report. Send the file as the request body or as the multipart field "file". (requires the products:create and products:update permissions)
+// @Tags products
+// @Accept text/csv,application/x-ndjson,multipart/form-data
+// @Produce json
+// @Param format query string false "csv or ndjson, detected from the content type or file name when omitted"
+// @Param dry_run query bool false "Validate and report without writing"
+// @Success 200 {object} models.ImportReport
+// @Failure 400 {object} response.ErrorResponse "Unreadable file"
+// @Failure 403 {object} response.ErrorResponse "Missing permission"
+// @Failure 413 {object} response.ErrorResponse "File too large"
+// @Failure 422 {object} models.ImportReport "Invalid rows, nothing was written"
+// @Router /products/import [post]
+func (s *Server) handleImportProducts() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		dryRun, _ := strconv.ParseBool(c.Query("dry_run"))
+		c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, importMaxBytes)
+
+		var body io.Reader = c.Request.Body
+		format := c.Query("format")
+		mediaType, _, _ := mime.ParseMediaType(c.GetHeader("Content-Type"))
+		if mediaType == "multipart/form-data" {
+			file, header, err := c.Request.FormFile("file")
+			if err != nil {
+				var tooLarge *http.MaxBytesError
+				if errors.As(err, &tooLarge) {
+					response.JSON(c, "Import file too large", http.StatusRequestEntityTooLarge, nil, err)
+					return
+				}
+				response.JSON(c, "file is required", http.StatusBadRequest, nil, err)
+				return
+			}
+			defer file.Close()
+			body = file
+			if format == "" {
+				format = importFormat(strings.TrimPrefix(filepath.Ext(header.Filename), "."))
+			}
+		} else if format == "" {
+			format = importFormat(mediaType)
+		}
+
+		report, err := s.ProductService.ImportProducts(format, body, dryRun)
+		if err != nil {
+			response.JSON(c, "", err.Status, nil, err)
+			return
+		}
+		switch {
+		case len(report.Errors) > 0:
+			response.JSON(c, "Import rejected, no products were written", http.StatusUnprocessableEntity, report, nil)
+		case dryRun:
+			response.JSON(c, "Dry run passed, no products were written", http.StatusOK, report, nil)
+		default:
+			response.JSON(c, "Products imported successfully", http.StatusOK, report, nil)
+		}
+	}
+}
+
+// handleExportProducts streams every product as CSV or NDJSON
+// @Summary Export products
+// @Description Stream the catalog in the format the import endpoint reads (requires the products:read permission)
+// @Tags products
+// @Produce text/csv,application/x-ndjson
+// @Param format query string false "csv (default) or ndjson"
+// @Success 200 {file} file
+// @Failure 400 {object} response.ErrorResponse "Unknown format"
+// @Failure 403 {object} response.ErrorResponse "Missing permission"
+// @Router /products/export [get]
+func (s *Server) handleExportProducts() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		format := c.DefaultQuery("format", models.FormatCSV)
+		var contentType string
+		switch format {
+		case models.FormatCSV:
+			contentType = "text/csv; charset=utf-8"
+		case models.FormatNDJSON:
+			contentType = "application/x-ndjson"
+		default:
+			response.JSON(c, "format must be csv or ndjson", http.StatusBadRequest, nil, nil)
+			return
+		}
+
+		c.Header("Content-Type", contentType)
+		c.Header("Content-Disposition", `attachment; filename="products.`+format+`"`)
+		c.Status(http.StatusOK)
+		if err := s.ProductService.ExportProducts(format, c.Writer); err != nil {
+			// The status line has been sent; all we can do is cut the stream short
+			log.Printf("Error exporting products: %v", err)
+			c.Abort()
+		}
+	}
+}
+
+// importFormat maps a content type or file extension to an import format
+func importFormat(value string) string {
+	switch strings.ToLower(value) {
+	case "csv", "text/csv":
+		return models.FormatCSV
+	case "ndjson", "jsonl", "application/x-ndjson", "application/ndjson", "application/jsonl", "application/x-jsonlines":
+		return models.FormatNDJSON
+	}
+	return ""
+}
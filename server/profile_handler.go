@@ -0,0 +1,97 @@
+package server
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/techagentng/ecommerce-api/errors"
+	"github.com/techagentng/ecommerce-api/models"
+	"github.com/techagentng/ecommerce-api/server/response"
+)
+
+// handleGetProfile returns the authenticated user's account
+// @Summary Get my profile
+// @Description Get the authenticated user's account details
+// @Tags profile
+// @Produce json
+// @Success 200 {object} models.UserResponse
+// @Failure 401 {object} response.ErrorResponse "Unauthorized"
+// @Router /me [get]
+func (s *Server) handleGetProfile() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		profile, err := s.AuthService.GetProfile(c.GetUint("userID"))
+		if err != nil {
+			response.JSON(c, "", err.Status, nil, err)
+			return
+		}
+		response.JSON(c, "Profile retrieved successfully", http.StatusOK, profile, nil)
+	}
+}
+
+// handleUpdateProfile updates the authenticated user's account
+// @Summary Update my profile
+// @Description Update the full name, username, telephone or email. Changing the email requires verifying the new address.
+// @Tags profile
+// @Accept json
+// @Produce json
+// @Param profile body models.UpdateProfileRequest true "Fields to change"
+// @Success 200 {object} models.UserResponse
+// @Failure 400 {object} response.ErrorResponse "Invalid request"
+// @Failure 401 {object} response.ErrorResponse "Unauthorized"
+// @Failure 409 {object} response.ErrorResponse "Username, telephone or email already in use"
+// @Router /me [patch]
+func (s *Server) handleUpdateProfile() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var profileRequest models.UpdateProfileRequest
+		if err := decode(c, &profileRequest); err != nil {
+			response.JSON(c, "", errors.ErrBadRequest.Status, nil, err)
+			return
+		}
+		profile, apiErr := s.AuthService.UpdateProfile(c.GetUint("userID"), &profileRequest)
+		if apiErr != nil {
+			response.JSON(c, "", apiErr.Status, nil, apiErr)
+			return
+		}
+		response.JSON(c, "Profile updated successfully", http.StatusOK, profile, nil)
+	}
+}
+
+// handleUpdateProfileImage replaces the authenticated user's profile image
+// @Summary Replace my profile image
+// @Description Upload a new profile image
+// @Tags profile
+// @Accept multipart/form-data
+// @Produce json
+// @Param profile_image formData file true "Profile image"
+// @Success 200 {object} models.UserResponse
+// @Failure 400 {object} response.ErrorResponse "Missing or invalid file"
+// @Failure 401 {object} response.ErrorResponse "Unauthorized"
+// @Router /me/profile-image [put]
+func (s *Server) handleUpdateProfileImage() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if err := c.Request.ParseMultipartForm(10 << 20); err != nil {
+			response.JSON(c, "", http.StatusBadRequest, nil, err)
+			return
+		}
+
+		file, _, err := c.Request.FormFile("profile_image")
+		if err != nil {
+			response.JSON(c, "profile_image is required", http.StatusBadRequest, nil, err)
+			return
+		}
+
+		userID := c.GetUint("userID")
+		filePath, uploadErr := s.uploadProfileImage(file)
+		if uploadErr != nil {
+			response.JSON(c, "", uploadErr.Status, nil, uploadErr)
+			return
+		}
+
+		profile, apiErr := s.AuthService.UpdateProfileImage(userID, filePath)
+		if apiErr != nil {
+			response.JSON(c, "", apiErr.Status, nil, apiErr)
+			return
+		}
+		response.JSON(c, "Profile image updated successfully", http.StatusOK, profile, nil)
+	}
+}
@@ -0,0 +1,53 @@
+package response
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// CacheableJSON writes a successful response like JSON with an ETag computed
+// from the body. A request whose If-None-Match shows it already has this
+// response gets 304 Not Modified without a body. There is no Last-Modified:
+// catalog responses change when related rows, like variants and images, are
+// added or deleted without moving any timestamp, so only the ETag is reliable.
+func CacheableJSON(c *gin.Context, message string, data interface{}, maxAge time.Duration) {
+	body, err := json.Marshal(gin.H{
+		"message": message,
+		"data":    data,
+		"errors":  "",
+		"status":  http.StatusText(http.StatusOK),
+	})
+	if err != nil {
+		InternalServerError(c)
+		return
+	}
+	sum := sha256.Sum256(body)
+	etag := `"` + hex.EncodeToString(sum[:16]) + `"`
+
+	c.Header("ETag", etag)
+	c.Header("Cache-Control", "public, max-age="+strconv.Itoa(int(maxAge/time.Second)))
+
+	if notModified(c.Request, etag) {
+		c.Status(http.StatusNotModified)
+		return
+	}
+	c.Data(http.StatusOK, "application/json; charset=utf-8", body)
+}
+
+// notModified reports whether the request's If-None-Match matches the etag
+func notModified(r *http.Request, etag string) bool {
+	for _, candidate := range strings.Split(r.Header.Get("If-None-Match"), ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		if candidate == etag || candidate == "*" {
+			return true
+		}
+	}
+	return false
+}
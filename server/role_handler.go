@@ -0,0 +1,136 @@
+package server
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/techagentng/ecommerce-api/errors"
+	"github.com/techagentng/ecommerce-api/models"
+	"github.com/techagentng/ecommerce-api/server/response"
+)
+
+// handleListRoles lists all roles with their permissions
+// @Summary List roles
+// @Description List all roles and their permissions (requires the roles:manage permission)
+// @Tags admin
+// @Produce json
+// @Success 200 {array} models.Role
+// @Failure 403 {object} response.ErrorResponse "Missing permission"
+// @Failure 500 {object} response.ErrorResponse "Internal server error"
+// @Router /admin/roles [get]
+func (s *Server) handleListRoles() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		roles, err := s.RoleService.ListRoles()
+		if err != nil {
+			response.JSON(c, "Failed to list roles", http.StatusInternalServerError, nil, err)
+			return
+		}
+		response.JSON(c, "Roles retrieved successfully", http.StatusOK, roles, nil)
+	}
+}
+
+// handleListPermissions lists all known permissions
+// @Summary List permissions
+// @Description List every permission that can be assigned to a role (requires the roles:manage permission)
+// @Tags admin
+// @Produce json
+// @Success 200 {array} models.Permission
+// @Failure 403 {object} response.ErrorResponse "Missing permission"
+// @Failure 500 {object} response.ErrorResponse "Internal server error"
+// @Router /admin/permissions [get]
+func (s *Server) handleListPermissions() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		permissions, err := s.RoleService.ListPermissions()
+		if err != nil {
+			response.JSON(c, "Failed to list permissions", http.StatusInternalServerError, nil, err)
+			return
+		}
+		response.JSON(c, "Permissions retrieved successfully", http.StatusOK, permissions, nil)
+	}
+}
+
+// handleCreateRole creates a new role
+// @Summary Create a role
+// @Description Create a role with an initial set of permissions (requires the roles:manage permission)
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Param role body models.CreateRoleRequest true "Role name and permissions"
+// @Success 201 {object} models.Role
+// @Failure 400 {object} response.ErrorResponse "Invalid request or unknown permission"
+// @Failure 403 {object} response.ErrorResponse "Missing permission"
+// @Failure 409 {object} response.ErrorResponse "Role already exists"
+// @Router /admin/roles [post]
+func (s *Server) handleCreateRole() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var roleRequest models.CreateRoleRequest
+		if err := decode(c, &roleRequest); err != nil {
+			response.JSON(c, "", errors.ErrBadRequest.Status, nil, err)
+			return
+		}
+		role, err := s.RoleService.CreateRole(&roleRequest)
+		if err != nil {
+			response.JSON(c, "", err.Status, nil, err)
+			return
+		}
+		response.JSON(c, "Role created successfully", http.StatusCreated, role, nil)
+	}
+}
+
+// handleAssignPermissions replaces the permissions of a role
+// @Summary Assign permissions to a role
+// @Description Replace the permissions of a role (requires the roles:manage permission)
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Param role_name path string true "Role name"
+// @Param permissions body models.AssignPermissionsRequest true "Permissions"
+// @Success 200 {object} models.Role
+// @Failure 400 {object} response.ErrorResponse "Invalid request or unknown permission"
+// @Failure 403 {object} response.ErrorResponse "Missing permission"
+// @Failure 404 {object} response.ErrorResponse "Role not found"
+// @Router /admin/roles/{role_name}/permissions [put]
+func (s *Server) handleAssignPermissions() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var assignRequest models.AssignPermissionsRequest
+		if err := decode(c, &assignRequest); err != nil {
+			response.JSON(c, "", errors.ErrBadRequest.Status, nil, err)
+			return
+		}
+		role, err := s.RoleService.AssignPermissions(c.Param("role_name"), assignRequest.Permissions)
+		if err != nil {
+			response.JSON(c, "", err.Status, nil, err)
+			return
+		}
+		response.JSON(c, "Permissions assigned successfully", http.StatusOK, role, nil)
+	}
+}
+
+// handleSetRoleMFA sets whether members of a role must enroll in MFA
+// @Summary Set a role's MFA policy
+// @Description Require members of a role to enable MFA before using anything but the MFA enrollment endpoints (requires the roles:manage permission)
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Param role_name path string true "Role name"
+// @Param policy body models.SetRoleMFARequest true "MFA policy"
+// @Success 200 {object} models.Role
+// @Failure 400 {object} response.ErrorResponse "Invalid request"
+// @Failure 403 {object} response.ErrorResponse "Missing permission"
+// @Failure 404 {object} response.ErrorResponse "Role not found"
+// @Router /admin/roles/{role_name}/mfa [put]
+func (s *Server) handleSetRoleMFA() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var mfaRequest models.SetRoleMFARequest
+		if err := decode(c, &mfaRequest); err != nil {
+			response.JSON(c, "", errors.ErrBadRequest.Status, nil, err)
+			return
+		}
+		role, err := s.RoleService.SetRequireMFA(c.Param("role_name"), mfaRequest.RequireMFA)
+		if err != nil {
+			response.JSON(c, "", err.Status, nil, err)
+			return
+		}
+		response.JSON(c, "Role MFA policy updated", http.StatusOK, role, nil)
+	}
+}
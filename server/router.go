@@ -2,11 +2,13 @@ package server
 
 import (
 	"fmt"
+	"net/url"
 	"time"
 
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
 	"github.com/swaggo/gin-swagger"
+	"github.com/techagentng/ecommerce-api/models"
 	 "github.com/swaggo/gin-swagger/swaggerFiles"
 	
 )
@@ -36,13 +38,20 @@ func (s *Server) setupRouter() *gin.Engine {
 	r.Use(gin.Recovery())
 	r.Use(cors.New(cors.Config{
 		AllowAllOrigins:  true,
-		AllowMethods:     []string{"GET", "POST", "PUT", "DELETE"},
-		AllowHeaders:     []string{"Origin", "Authorization", "Content-Type"},
+		AllowMethods:     []string{"GET", "POST", "PUT", "PATCH", "DELETE"},
+		AllowHeaders:     []string{"Origin", "Authorization", "Content-Type", "If-None-Match", "Idempotency-Key"},
+		ExposeHeaders:    []string{"ETag", "Idempotent-Replayed"},
 		AllowCredentials: true,
 		MaxAge:           12 * time.Hour,
 	}))
 
 	r.MaxMultipartMemory = 32 << 20
+	if s.Config.BlobStore == "local" {
+		// Serve uploads from the local blob store at the path of its base URL
+		if baseURL, err := url.Parse(s.Config.BlobBaseURL); err == nil && baseURL.Path != "" {
+			r.Static(baseURL.Path, s.Config.BlobDir)
+		}
+	}
 	s.defineRoutes(r)
 
 	r.GET("/swagger/*any", ginSwagger.WrapHandler(swaggerFiles.Handler))
@@ -51,20 +60,98 @@ func (s *Server) setupRouter() *gin.Engine {
 }
 
 func (s *Server) defineRoutes(router *gin.Engine) {
+	router.GET("/.well-known/jwks.json", s.handleJWKS())
+
 	apirouter := router.Group("/api/v1")
 	apirouter.POST("/auth/signup", s.handleSignup())
 	apirouter.POST("/auth/login", s.handleLogin())
+	apirouter.POST("/auth/refresh", s.handleRefreshToken())
+	apirouter.GET("/auth/verify", s.handleVerifyEmail())
+	apirouter.POST("/auth/verify/resend", s.handleResendVerification())
+	apirouter.POST("/auth/password/forgot", s.handleForgotPassword())
+	apirouter.POST("/auth/password/reset", s.handleResetPassword())
+	apirouter.POST("/auth/mfa/verify", s.handleVerifyMFA())
+	apirouter.GET("/products/search", s.handleSearchProducts())
+	apirouter.GET("/catalog/products", s.handleListCatalog())
+	apirouter.GET("/catalog/products/:product_id", s.handleGetCatalogProduct())
+	apirouter.GET("/catalog/categories", s.handleListCategories())
+	apirouter.GET("/catalog/categories/:category_id", s.handleGetCategory())
+
+	// The cart works for guests and users alike
+	cart := apirouter.Group("/cart")
+	cart.Use(s.OptionalAuthorize())
+	cart.GET("", s.handleGetCart())
+	cart.POST("/items", s.handleAddCartItem())
+	cart.PATCH("/items/:item_id", s.handleUpdateCartItem())
+	cart.DELETE("/items/:item_id", s.handleRemoveCartItem())
+
+	// Routes reachable before a user has satisfied their role's MFA policy
+	authenticated := apirouter.Group("/")
+	authenticated.Use(s.Authorize())
 
-	authorized := apirouter.Group("/")
-	authorized.Use(s.Authorize())
+	authenticated.POST("/auth/logout", s.handleLogout())
+	authenticated.POST("/auth/logout/all", s.handleLogoutEverywhere())
+	authenticated.POST("/auth/mfa/enroll", s.handleEnrollMFA())
+	authenticated.POST("/auth/mfa/confirm", s.handleConfirmMFA())
+	authenticated.POST("/auth/mfa/disable", s.handleDisableMFA())
+	authenticated.POST("/auth/mfa/recovery-codes", s.handleRegenerateRecoveryCodes())
+	authenticated.GET("/me", s.handleGetProfile())
+
+	authorized := authenticated.Group("/")
+	authorized.Use(s.EnforceMFAPolicy())
+
+	authorized.POST("/auth/password/change", s.handleChangePassword())
+	authorized.PATCH("/me", s.handleUpdateProfile())
+	authorized.PUT("/me/profile-image", s.handleUpdateProfileImage())
 
 	// Define user-related routes
-	authorized.POST("/user/place/order", s.handlePlaceOrder())
+	authorized.POST("/user/place/order", s.Idempotent(), s.handlePlaceOrder())
 	authorized.GET("/user/orders", s.handleListUserOrders())
+	authorized.GET("/user/orders/:order_id", s.handleGetOrder())
+	authorized.GET("/user/orders/:order_id/history", s.handleListOrderStatusEvents())
+	authorized.POST("/user/orders/:order_id/pay", s.Idempotent(), s.handlePayOrder())
+	authorized.GET("/user/orders/:order_id/payments", s.handleListOrderPayments())
+	authorized.POST("/cart/checkout", s.Idempotent(), s.handleCheckoutCart())
 	authorized.PATCH("/cancel/order/:order_id", s.handleCancelOrder())
-	authorized.PATCH("/update/order/:order_id", s.handleUpdateOrderStatus())
-	authorized.POST("/products", s.handleCreateProduct())
-	authorized.GET("/products/:product_id", s.handleReadProduct())
-	authorized.PUT("/products/:product_id", s.handleUpdateProduct())
-	authorized.DELETE("/products/:product_id", s.handleDeleteProduct())
+	authorized.PATCH("/update/order/:order_id", s.RequirePermission(models.PermissionOrdersUpdateStatus), s.handleUpdateOrderStatus())
+	authorized.POST("/products", s.RequirePermission(models.PermissionProductsCreate), s.handleCreateProduct())
+	authorized.GET("/products", s.RequirePermission(models.PermissionProductsRead), s.handleListProducts())
+	authorized.POST("/products/import", s.RequirePermission(models.PermissionProductsCreate), s.RequirePermission(models.PermissionProductsUpdate), s.handleImportProducts())
+	authorized.GET("/products/export", s.RequirePermission(models.PermissionProductsRead), s.handleExportProducts())
+	authorized.GET("/products/:product_id", s.RequirePermission(models.PermissionProductsRead), s.handleReadProduct())
+	authorized.PUT("/products/:product_id", s.RequirePermission(models.PermissionProductsUpdate), s.handleUpdateProduct())
+	authorized.DELETE("/products/:product_id", s.RequirePermission(models.PermissionProductsDelete), s.handleDeleteProduct())
+	authorized.PUT("/products/:product_id/categories", s.RequirePermission(models.PermissionProductsUpdate), s.handleSetProductCategories())
+	authorized.GET("/products/:product_id/images", s.RequirePermission(models.PermissionProductsRead), s.handleListProductImages())
+	authorized.POST("/products/:product_id/images", s.RequirePermission(models.PermissionProductsUpdate), s.handleAddProductImage())
+	authorized.PUT("/products/:product_id/images/order", s.RequirePermission(models.PermissionProductsUpdate), s.handleReorderProductImages())
+	authorized.PATCH("/products/:product_id/images/:image_id", s.RequirePermission(models.PermissionProductsUpdate), s.handleUpdateProductImage())
+	authorized.DELETE("/products/:product_id/images/:image_id", s.RequirePermission(models.PermissionProductsUpdate), s.handleDeleteProductImage())
+	authorized.GET("/products/:product_id/variants", s.RequirePermission(models.PermissionProductsRead), s.handleListVariants())
+	authorized.POST("/products/:product_id/variants", s.RequirePermission(models.PermissionProductsUpdate), s.handleCreateVariant())
+	authorized.POST("/products/:product_id/variants/generate", s.RequirePermission(models.PermissionProductsUpdate), s.handleGenerateVariants())
+	authorized.PATCH("/products/:product_id/variants/:variant_id", s.RequirePermission(models.PermissionProductsUpdate), s.handleUpdateVariant())
+	authorized.DELETE("/products/:product_id/variants/:variant_id", s.RequirePermission(models.PermissionProductsUpdate), s.handleDeleteVariant())
+
+	admin := authorized.Group("/admin")
+	admin.GET("/users", s.RequirePermission(models.PermissionUsersRead), s.handleListUsers())
+	admin.GET("/users/:user_id", s.RequirePermission(models.PermissionUsersRead), s.handleGetUser())
+	admin.PUT("/users/:user_id/role", s.RequirePermission(models.PermissionUsersManage), s.handleAssignUserRole())
+	admin.POST("/users/:user_id/suspend", s.RequirePermission(models.PermissionUsersManage), s.handleSuspendUser())
+	admin.POST("/users/:user_id/unsuspend", s.RequirePermission(models.PermissionUsersManage), s.handleUnsuspendUser())
+	admin.DELETE("/users/:user_id", s.RequirePermission(models.PermissionUsersManage), s.handleDeleteUser())
+	admin.POST("/users/:user_id/unlock", s.RequirePermission(models.PermissionUsersManage), s.handleUnlockUser())
+	admin.POST("/users/:user_id/reset-mfa", s.RequirePermission(models.PermissionUsersManage), s.handleResetUserMFA())
+	admin.POST("/users/:user_id/revoke-sessions", s.RequirePermission(models.PermissionUsersRevokeSessions), s.handleRevokeUserSessions())
+	admin.GET("/roles", s.RequirePermission(models.PermissionRolesManage), s.handleListRoles())
+	admin.POST("/roles", s.RequirePermission(models.PermissionRolesManage), s.handleCreateRole())
+	admin.PUT("/roles/:role_name/permissions", s.RequirePermission(models.PermissionRolesManage), s.handleAssignPermissions())
+	admin.PUT("/roles/:role_name/mfa", s.RequirePermission(models.PermissionRolesManage), s.handleSetRoleMFA())
+	admin.POST("/categories", s.RequirePermission(models.PermissionCategoriesManage), s.handleCreateCategory())
+	admin.PATCH("/categories/:category_id", s.RequirePermission(models.PermissionCategoriesManage), s.handleUpdateCategory())
+	admin.DELETE("/categories/:category_id", s.RequirePermission(models.PermissionCategoriesManage), s.handleDeleteCategory())
+	admin.GET("/permissions", s.RequirePermission(models.PermissionRolesManage), s.handleListPermissions())
+	admin.POST("/products/:product_id/stock/adjustments", s.RequirePermission(models.PermissionInventoryManage), s.Idempotent(), s.handleAdjustStock())
+	admin.GET("/products/:product_id/stock/movements", s.RequirePermission(models.PermissionInventoryManage), s.handleListStockMovements())
+	admin.POST("/orders/:order_id/refund", s.RequirePermission(models.PermissionPaymentsRefund), s.Idempotent(), s.handleRefundOrder())
 }
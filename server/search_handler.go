@@ -0,0 +1,37 @@
+package server
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/techagentng/ecommerce-api/models"
+	"github.com/techagentng/ecommerce-api/server/response"
+)
+
+// handleSearchProducts searches the catalog
+// @Summary Search products
+// @Description Full-text search over product names and descriptions, best matches first. Every word must match, as a prefix of a product word; longer words tolerate a typo. Matched words are wrapped in <mark> tags in the highlight.
+// @Tags catalog
+// @Produce json
+// @Param q query string true "Search text"
+// @Param page query int false "Page number, starting at 1"
+// @Param page_size query int false "Page size, at most 100"
+// @Success 200 {object} models.ProductSearchResponse
+// @Failure 400 {object} response.ErrorResponse "Missing or invalid query"
+// @Failure 500 {object} response.ErrorResponse "Internal server error"
+// @Router /products/search [get]
+func (s *Server) handleSearchProducts() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var query models.ProductSearchQuery
+		if err := c.ShouldBindQuery(&query); err != nil {
+			response.JSON(c, "Invalid query", http.StatusBadRequest, nil, err)
+			return
+		}
+		results, err := s.ProductService.SearchProducts(&query)
+		if err != nil {
+			response.JSON(c, "", err.Status, nil, err)
+			return
+		}
+		response.JSON(c, "Products retrieved successfully", http.StatusOK, results, nil)
+	}
+}
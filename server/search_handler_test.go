@@ -0,0 +1,142 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/techagentng/ecommerce-api/config"
+	"github.com/techagentng/ecommerce-api/db"
+	"github.com/techagentng/ecommerce-api/models"
+	"github.com/techagentng/ecommerce-api/services"
+)
+
+// memoryProductRepo serves the products of a test. Methods the tests do not
+// reach panic through the embedded nil interface.
+type memoryProductRepo struct {
+	db.ProductRepository
+	products map[uint]*models.Product
+}
+
+func (r *memoryProductRepo) FindProductsByIDs(ids []uint) ([]*models.Product, error) {
+	var products []*models.Product
+	for _, id := range ids {
+		if product, ok := r.products[id]; ok {
+			products = append(products, product)
+		}
+	}
+	return products, nil
+}
+
+// memoryVariantRepo holds the variant counts of a test's products
+type memoryVariantRepo struct {
+	db.VariantRepository
+	counts map[uint]db.VariantCounts
+}
+
+func (r *memoryVariantRepo) CountVariantsByProductIDs(productIDs []uint) (map[uint]db.VariantCounts, error) {
+	counts := map[uint]db.VariantCounts{}
+	for _, id := range productIDs {
+		if c, ok := r.counts[id]; ok {
+			counts[id] = c
+		}
+	}
+	return counts, nil
+}
+
+func newSearchTestServer(t *testing.T, variantCounts map[uint]db.VariantCounts, products ...*models.Product) *gin.Engine {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	conf := &config.Config{}
+	index := db.NewMemorySearchIndex()
+	repo := &memoryProductRepo{products: map[uint]*models.Product{}}
+	for _, product := range products {
+		repo.products[product.ID] = product
+		if err := index.IndexProduct(product); err != nil {
+			t.Fatal(err)
+		}
+	}
+	s := &Server{
+		Config:         conf,
+		ProductService: services.NewProductService(repo, nil, &memoryVariantRepo{counts: variantCounts}, nil, index, nil, conf),
+	}
+	router := gin.New()
+	s.defineRoutes(router)
+	return router
+}
+
+func searchProducts(t *testing.T, router *gin.Engine, query url.Values) (int, models.ProductSearchResponse) {
+	t.Helper()
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/v1/products/search?"+query.Encode(), nil))
+	var body struct {
+		Data models.ProductSearchResponse `json:"data"`
+	}
+	if w.Code == http.StatusOK {
+		if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return w.Code, body.Data
+}
+
+func TestSearchProductsRanksAndHighlights(t *testing.T) {
+	router := newSearchTestServer(t, map[uint]db.VariantCounts{
+		2: {Variants: 2, InStock: 1},
+	},
+		&models.Product{ID: 1, Name: "Leather belt", Description: "Pairs with <b>boots</b>", Price: 30, Stock: 0},
+		&models.Product{ID: 2, Name: "Hiking boots", Description: "Waterproof", Price: 120, Stock: 0},
+		&models.Product{ID: 3, Name: "Wool socks", Description: "Warm", Price: 8, Stock: 4},
+	)
+
+	status, results := searchProducts(t, router, url.Values{"q": {"boots"}})
+	if status != http.StatusOK {
+		t.Fatalf("got status %d", status)
+	}
+	if results.Total != 2 || len(results.Results) != 2 {
+		t.Fatalf("got %d of %d results, want 2", len(results.Results), results.Total)
+	}
+	first, second := results.Results[0], results.Results[1]
+	if first.ID != 2 || second.ID != 1 {
+		t.Errorf("got products %d, %d, want the name match 2 before 1", first.ID, second.ID)
+	}
+	if want := "Hiking <mark>boots</mark>"; first.Highlight.Name != want {
+		t.Errorf("got name highlight %q, want %q", first.Highlight.Name, want)
+	}
+	if want := "Pairs with &lt;b&gt;<mark>boots</mark>&lt;/b&gt;"; second.Highlight.Snippet != want {
+		t.Errorf("got snippet %q, want %q", second.Highlight.Snippet, want)
+	}
+	if !first.Available {
+		t.Error("a product with a variant in stock is shown as unavailable")
+	}
+	if second.Available {
+		t.Error("a product without stock is shown as available")
+	}
+}
+
+func TestSearchProductsPages(t *testing.T) {
+	router := newSearchTestServer(t, nil,
+		&models.Product{ID: 1, Name: "Mug"},
+		&models.Product{ID: 2, Name: "Mug"},
+		&models.Product{ID: 3, Name: "Mug"},
+	)
+
+	status, results := searchProducts(t, router, url.Values{"q": {"mug"}, "page": {"2"}, "page_size": {"2"}})
+	if status != http.StatusOK {
+		t.Fatalf("got status %d", status)
+	}
+	if results.Total != 3 || results.Page != 2 || len(results.Results) != 1 || results.Results[0].ID != 3 {
+		t.Errorf("got %+v, want product 3 of 3 on page 2", results)
+	}
+}
+
+func TestSearchProductsRequiresQuery(t *testing.T) {
+	router := newSearchTestServer(t, nil)
+
+	if status, _ := searchProducts(t, router, url.Values{"q": {"  "}}); status != http.StatusBadRequest {
+		t.Errorf("got status %d for an empty query, want %d", status, http.StatusBadRequest)
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"github.com/techagentng/ecommerce-api/config"
 	"github.com/techagentng/ecommerce-api/db"
 	"github.com/techagentng/ecommerce-api/services"
+	"github.com/techagentng/ecommerce-api/services/jwt"
 	"log"
 	"net/http"
 	"os"
@@ -15,13 +16,26 @@ import (
 )
 
 type Server struct {
-	Config         *config.Config
-	AuthRepository db.AuthRepository
-	AuthService    services.AuthService
-	OrderService   services.OrderService
-	OrderRepo      db.OrderRepository
-	ProductRepo	db.ProductRepository
-	DB             db.GormDB
+	Config              *config.Config
+	Keyring             *jwt.Keyring
+	AuthRepository      db.AuthRepository
+	AuthService         services.AuthService
+	OrderService        services.OrderService
+	ProductService      services.ProductService
+	CategoryService     services.CategoryService
+	VariantService      services.VariantService
+	ProductImageService services.ProductImageService
+	MediaService        services.MediaService
+	StockService        services.StockService
+	IdempotencyService  services.IdempotencyService
+	CartService         services.CartService
+	PaymentService      services.PaymentService
+	RoleService         services.RoleService
+	UserAdminService    services.UserAdminService
+	OrderRepo           db.OrderRepository
+	ProductRepo         db.ProductRepository
+	VariantRepo         db.VariantRepository
+	DB                  db.GormDB
 }
 
 // Server serves requests to DB with rout
@@ -42,10 +56,48 @@ func (s *Server) Start() {
 		}
 	}()
 
+	stopSweeper := s.startTokenSweeper(s.Config.TokenSweepInterval)
+	defer stopSweeper()
+
 	log.Printf("Server started on %s\n", PORT)
 	gracefulShutdown(srv)
 }
 
+// startTokenSweeper periodically purges expired blacklist entries, refresh
+// tokens, idempotency keys and abandoned carts so the tables do not grow
+// forever. The returned func stops it.
+func (s *Server) startTokenSweeper(interval time.Duration) func() {
+	if interval <= 0 {
+		interval = time.Hour
+	}
+	ticker := time.NewTicker(interval)
+	done := make(chan struct{})
+
+	go func() {
+		for {
+			select {
+			case <-ticker.C:
+				if err := s.AuthService.PurgeExpiredTokens(); err != nil {
+					log.Printf("token sweeper: %v", err)
+				}
+				if err := s.IdempotencyService.PurgeExpiredKeys(); err != nil {
+					log.Printf("token sweeper: %v", err)
+				}
+				if err := s.CartService.PurgeExpiredCarts(); err != nil {
+					log.Printf("token sweeper: %v", err)
+				}
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	return func() {
+		ticker.Stop()
+		close(done)
+	}
+}
+
 func gracefulShutdown(srv *http.Server) {
 	// Wait for interrupt signal to gracefully shutdown the server with
 	// a timeout of 5 seconds.
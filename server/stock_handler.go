@@ -0,0 +1,80 @@
+package server
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/techagentng/ecommerce-api/errors"
+	"github.com/techagentng/ecommerce-api/models"
+	"github.com/techagentng/ecommerce-api/server/response"
+)
+
+// handleAdjustStock records a stock adjustment
+// @Summary Adjust stock
+// @Description Restock or correct the stock of a product, or of one of its variants with variant_id, by a positive or negative change. The adjustment is recorded in the stock ledger with the admin as its actor. (requires the inventory:manage permission)
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Param product_id path int true "Product ID"
+// @Param Idempotency-Key header string false "Unique key per adjustment; a retry with the same key and body replays the first response"
+// @Param adjustment body models.StockAdjustmentRequest true "Change, reason (restock or adjustment) and note"
+// @Success 201 {object} models.StockMovement
+// @Failure 400 {object} response.ErrorResponse "Invalid request"
+// @Failure 403 {object} response.ErrorResponse "Missing permission"
+// @Failure 404 {object} response.ErrorResponse "Product or variant not found"
+// @Failure 409 {object} response.ErrorResponse "The stock would become negative, or a request with the same Idempotency-Key is in progress"
+// @Failure 422 {object} response.ErrorResponse "Idempotency-Key reused with a different request"
+// @Router /admin/products/{product_id}/stock/adjustments [post]
+func (s *Server) handleAdjustStock() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		productID, ok := productIDParam(c)
+		if !ok {
+			return
+		}
+		var request models.StockAdjustmentRequest
+		if err := decode(c, &request); err != nil {
+			response.JSON(c, "", errors.ErrBadRequest.Status, nil, err)
+			return
+		}
+		movement, err := s.StockService.AdjustStock(productID, c.GetUint("userID"), &request)
+		if err != nil {
+			response.JSON(c, "", err.Status, nil, err)
+			return
+		}
+		response.JSON(c, "Stock adjusted successfully", http.StatusCreated, movement, nil)
+	}
+}
+
+// handleListStockMovements lists a product's stock history
+// @Summary List stock movements
+// @Description List the stock ledger of a product, or of one of its variants with variant_id, newest first. Each movement records its change, the balance after it, the reason, the actor and the order it belongs to. (requires the inventory:manage permission)
+// @Tags admin
+// @Produce json
+// @Param product_id path int true "Product ID"
+// @Param variant_id query int false "Variant ID"
+// @Param page query int false "Page number, starting at 1"
+// @Param page_size query int false "Page size, at most 200"
+// @Success 200 {object} models.StockMovementListResponse
+// @Failure 400 {object} response.ErrorResponse "Invalid query"
+// @Failure 403 {object} response.ErrorResponse "Missing permission"
+// @Failure 404 {object} response.ErrorResponse "Product or variant not found"
+// @Router /admin/products/{product_id}/stock/movements [get]
+func (s *Server) handleListStockMovements() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		productID, ok := productIDParam(c)
+		if !ok {
+			return
+		}
+		var query models.StockMovementQuery
+		if err := c.ShouldBindQuery(&query); err != nil {
+			response.JSON(c, "Invalid query", http.StatusBadRequest, nil, err)
+			return
+		}
+		movements, err := s.StockService.ListStockMovements(productID, &query)
+		if err != nil {
+			response.JSON(c, "", err.Status, nil, err)
+			return
+		}
+		response.JSON(c, "Stock movements retrieved successfully", http.StatusOK, movements, nil)
+	}
+}
@@ -0,0 +1,192 @@
+package server
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/techagentng/ecommerce-api/errors"
+	"github.com/techagentng/ecommerce-api/models"
+	"github.com/techagentng/ecommerce-api/server/response"
+)
+
+// handleListVariants lists the variants of a product
+// @Summary List product variants
+// @Description List a product's variants with their SKU, effective price, stock and options (requires the products:read permission)
+// @Tags Products
+// @Produce json
+// @Param product_id path int true "Product ID"
+// @Success 200 {array} models.VariantResponse
+// @Failure 403 {object} response.ErrorResponse "Missing permission"
+// @Failure 404 {object} response.ErrorResponse "Product not found"
+// @Router /products/{product_id}/variants [get]
+func (s *Server) handleListVariants() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		productID, ok := productIDParam(c)
+		if !ok {
+			return
+		}
+		variants, err := s.VariantService.ListVariants(productID)
+		if err != nil {
+			response.JSON(c, "", err.Status, nil, err)
+			return
+		}
+		response.JSON(c, "Variants retrieved successfully", http.StatusOK, variants, nil)
+	}
+}
+
+// handleCreateVariant adds a variant to a product
+// @Summary Create a product variant
+// @Description Add a variant with its own SKU, stock and optional price override. New option names and values are added to the product. (requires the products:update permission)
+// @Tags Products
+// @Accept json
+// @Produce json
+// @Param product_id path int true "Product ID"
+// @Param variant body models.CreateVariantRequest true "Variant"
+// @Success 201 {object} models.VariantResponse
+// @Failure 400 {object} response.ErrorResponse "Invalid request"
+// @Failure 403 {object} response.ErrorResponse "Missing permission"
+// @Failure 404 {object} response.ErrorResponse "Product not found"
+// @Failure 409 {object} response.ErrorResponse "SKU or option combination in use"
+// @Router /products/{product_id}/variants [post]
+func (s *Server) handleCreateVariant() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		productID, ok := productIDParam(c)
+		if !ok {
+			return
+		}
+		var variantRequest models.CreateVariantRequest
+		if err := decode(c, &variantRequest); err != nil {
+			response.JSON(c, "", errors.ErrBadRequest.Status, nil, err)
+			return
+		}
+		variant, err := s.VariantService.CreateVariant(productID, &variantRequest)
+		if err != nil {
+			response.JSON(c, "", err.Status, nil, err)
+			return
+		}
+		response.JSON(c, "Variant created successfully", http.StatusCreated, variant, nil)
+	}
+}
+
+// handleGenerateVariants generates a variant matrix
+// @Summary Generate product variants
+// @Description Create a variant for every combination of the given option values that does not exist yet, e.g. size x colour (requires the products:update permission)
+// @Tags Products
+// @Accept json
+// @Produce json
+// @Param product_id path int true "Product ID"
+// @Param matrix body models.GenerateVariantsRequest true "Options and defaults"
+// @Success 201 {array} models.VariantResponse
+// @Failure 400 {object} response.ErrorResponse "Invalid request"
+// @Failure 403 {object} response.ErrorResponse "Missing permission"
+// @Failure 404 {object} response.ErrorResponse "Product not found"
+// @Failure 409 {object} response.ErrorResponse "Generated SKU in use"
+// @Router /products/{product_id}/variants/generate [post]
+func (s *Server) handleGenerateVariants() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		productID, ok := productIDParam(c)
+		if !ok {
+			return
+		}
+		var generateRequest models.GenerateVariantsRequest
+		if err := decode(c, &generateRequest); err != nil {
+			response.JSON(c, "", errors.ErrBadRequest.Status, nil, err)
+			return
+		}
+		variants, err := s.VariantService.GenerateVariants(productID, &generateRequest)
+		if err != nil {
+			response.JSON(c, "", err.Status, nil, err)
+			return
+		}
+		response.JSON(c, "Variants generated successfully", http.StatusCreated, variants, nil)
+	}
+}
+
+// handleUpdateVariant updates a variant
+// @Summary Update a product variant
+// @Description Change a variant's SKU or price override. Stock is changed with a stock adjustment. (requires the products:update permission)
+// @Tags Products
+// @Accept json
+// @Produce json
+// @Param product_id path int true "Product ID"
+// @Param variant_id path int true "Variant ID"
+// @Param variant body models.UpdateVariantRequest true "Changes"
+// @Success 200 {object} models.VariantResponse
+// @Failure 400 {object} response.ErrorResponse "Invalid request"
+// @Failure 403 {object} response.ErrorResponse "Missing permission"
+// @Failure 404 {object} response.ErrorResponse "Variant not found"
+// @Failure 409 {object} response.ErrorResponse "SKU in use"
+// @Router /products/{product_id}/variants/{variant_id} [patch]
+func (s *Server) handleUpdateVariant() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		productID, ok := productIDParam(c)
+		if !ok {
+			return
+		}
+		variantID, ok := variantIDParam(c)
+		if !ok {
+			return
+		}
+		var updateRequest models.UpdateVariantRequest
+		if err := decode(c, &updateRequest); err != nil {
+			response.JSON(c, "", errors.ErrBadRequest.Status, nil, err)
+			return
+		}
+		variant, err := s.VariantService.UpdateVariant(productID, variantID, &updateRequest)
+		if err != nil {
+			response.JSON(c, "", err.Status, nil, err)
+			return
+		}
+		response.JSON(c, "Variant updated successfully", http.StatusOK, variant, nil)
+	}
+}
+
+// handleDeleteVariant deletes a variant
+// @Summary Delete a product variant
+// @Description Delete a variant. Existing order items keep its SKU. (requires the products:update permission)
+// @Tags Products
+// @Produce json
+// @Param product_id path int true "Product ID"
+// @Param variant_id path int true "Variant ID"
+// @Success 204 "No Content"
+// @Failure 403 {object} response.ErrorResponse "Missing permission"
+// @Failure 404 {object} response.ErrorResponse "Variant not found"
+// @Router /products/{product_id}/variants/{variant_id} [delete]
+func (s *Server) handleDeleteVariant() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		productID, ok := productIDParam(c)
+		if !ok {
+			return
+		}
+		variantID, ok := variantIDParam(c)
+		if !ok {
+			return
+		}
+		if err := s.VariantService.DeleteVariant(productID, variantID); err != nil {
+			response.JSON(c, "", err.Status, nil, err)
+			return
+		}
+		c.Status(http.StatusNoContent)
+	}
+}
+
+// productIDParam parses the product_id path parameter, responding with 400 if it is invalid
+func productIDParam(c *gin.Context) (uint, bool) {
+	productID64, err := strconv.ParseUint(c.Param("product_id"), 10, 32)
+	if err != nil {
+		response.JSON(c, "Invalid product ID", http.StatusBadRequest, nil, err)
+		return 0, false
+	}
+	return uint(productID64), true
+}
+
+// variantIDParam parses the variant_id path parameter, responding with 400 if it is invalid
+func variantIDParam(c *gin.Context) (uint, bool) {
+	variantID64, err := strconv.ParseUint(c.Param("variant_id"), 10, 32)
+	if err != nil {
+		response.JSON(c, "Invalid variant ID", http.StatusBadRequest, nil, err)
+		return 0, false
+	}
+	return uint(variantID64), true
+}
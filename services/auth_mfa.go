@@ -0,0 +1,263 @@
+package services
+
+import (
+	"crypto/rand"
+	"encoding/base32"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	gofrsUUID "github.com/gofrs/uuid"
+	"github.com/google/uuid"
+	apiError "github.com/techagentng/ecommerce-api/errors"
+	"github.com/techagentng/ecommerce-api/models"
+	"github.com/techagentng/ecommerce-api/services/jwt"
+	"github.com/techagentng/ecommerce-api/services/totp"
+)
+
+const recoveryCodeCount = 10
+
+// EnrollMFA generates a new TOTP secret for the user. MFA is not enforced until
+// the secret is confirmed with ConfirmMFA.
+func (a *authService) EnrollMFA(userID uint) (*models.MFAEnrollResponse, *apiError.Error) {
+	user, err := a.authRepo.FindUserByID(userID)
+	if err != nil {
+		return nil, apiError.New("user not found", http.StatusNotFound)
+	}
+	if user.MFAEnabled {
+		return nil, apiError.New("MFA is already enabled", http.StatusConflict)
+	}
+
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		log.Printf("Error generating TOTP secret for user %d: %v", user.ID, err)
+		return nil, apiError.ErrInternalServerError
+	}
+	if err := a.authRepo.UpdateUser(user.ID, map[string]interface{}{"mfa_secret": secret}); err != nil {
+		log.Printf("Error storing TOTP secret for user %d: %v", user.ID, err)
+		return nil, apiError.ErrInternalServerError
+	}
+
+	return &models.MFAEnrollResponse{
+		Secret: secret,
+		URI:    totp.URI(a.Config.MFAIssuer, user.Email, secret),
+	}, nil
+}
+
+// ConfirmMFA enables MFA once the user proves their authenticator produces
+// valid codes, and returns a fresh set of recovery codes
+func (a *authService) ConfirmMFA(userID uint, code string) (*models.MFARecoveryCodesResponse, *apiError.Error) {
+	user, err := a.authRepo.FindUserByID(userID)
+	if err != nil {
+		return nil, apiError.New("user not found", http.StatusNotFound)
+	}
+	if user.MFAEnabled {
+		return nil, apiError.New("MFA is already enabled", http.StatusConflict)
+	}
+	if user.MFASecret == "" {
+		return nil, apiError.New("start MFA enrollment first", http.StatusBadRequest)
+	}
+
+	if apiErr := a.verifyTOTP(user, code); apiErr != nil {
+		return nil, apiErr
+	}
+	if err := a.authRepo.UpdateUser(user.ID, map[string]interface{}{"mfa_enabled": true}); err != nil {
+		log.Printf("Error enabling MFA for user %d: %v", user.ID, err)
+		return nil, apiError.ErrInternalServerError
+	}
+	return a.newRecoveryCodes(user.ID)
+}
+
+// DisableMFA turns MFA off after checking a current code. Members of roles that
+// require MFA cannot disable it.
+func (a *authService) DisableMFA(userID uint, code string) *apiError.Error {
+	user, err := a.authRepo.FindUserByID(userID)
+	if err != nil {
+		return apiError.New("user not found", http.StatusNotFound)
+	}
+	if !user.MFAEnabled {
+		return apiError.New("MFA is not enabled", http.StatusBadRequest)
+	}
+	role, apiErr := a.roleForUser(user)
+	if apiErr != nil {
+		return apiErr
+	}
+	if role.RequireMFA {
+		return apiError.New("your role requires MFA", http.StatusForbidden)
+	}
+	if apiErr := a.verifySecondFactor(user, code); apiErr != nil {
+		return apiErr
+	}
+
+	return a.clearMFA(user.ID)
+}
+
+// RegenerateRecoveryCodes replaces the user's recovery codes after checking a current code
+func (a *authService) RegenerateRecoveryCodes(userID uint, code string) (*models.MFARecoveryCodesResponse, *apiError.Error) {
+	user, err := a.authRepo.FindUserByID(userID)
+	if err != nil {
+		return nil, apiError.New("user not found", http.StatusNotFound)
+	}
+	if !user.MFAEnabled {
+		return nil, apiError.New("MFA is not enabled", http.StatusBadRequest)
+	}
+	if apiErr := a.verifyTOTP(user, code); apiErr != nil {
+		return nil, apiErr
+	}
+	return a.newRecoveryCodes(user.ID)
+}
+
+// VerifyMFA completes a login by exchanging an MFA challenge token and a TOTP
+// or recovery code for a token pair. Failures count towards the login lockout.
+func (a *authService) VerifyMFA(mfaToken string, code string, clientIP string) (*models.LoginResponse, *apiError.Error) {
+	claims, err := jwt.ValidateAndGetClaims(mfaToken, a.keys)
+	if err != nil || jwt.TokenType(claims) != jwt.MFAChallengeTokenType {
+		return nil, apiError.New("invalid or expired MFA token", http.StatusUnauthorized)
+	}
+	userID, _ := claims["id"].(float64)
+
+	user, err := a.authRepo.FindUserByID(uint(userID))
+	if err != nil {
+		return nil, apiError.New("invalid or expired MFA token", http.StatusUnauthorized)
+	}
+	if !user.IsActive() {
+		return nil, apiError.New(apiError.InActiveUserError.Error(), http.StatusUnauthorized)
+	}
+	if jwt.TokenVersion(claims) != user.TokenVersion || !user.MFAEnabled {
+		return nil, apiError.New("invalid or expired MFA token", http.StatusUnauthorized)
+	}
+
+	if apiErr := a.loginThrottle.Check(user.Email, clientIP); apiErr != nil {
+		return nil, apiErr
+	}
+	if apiErr := a.verifySecondFactor(user, code); apiErr != nil {
+		a.loginThrottle.RecordFailure(user.Email, clientIP)
+		return nil, apiErr
+	}
+	a.loginThrottle.RecordSuccess(user.Email)
+
+	role, apiErr := a.roleForUser(user)
+	if apiErr != nil {
+		return nil, apiErr
+	}
+	return a.issueTokenPair(user, role.Name, uuid.New().String())
+}
+
+// ResetMFA removes a user's MFA enrollment, e.g. after losing their device
+func (a *authService) ResetMFA(userID uint) *apiError.Error {
+	if _, err := a.authRepo.FindUserByID(userID); err != nil {
+		return apiError.New("user not found", http.StatusNotFound)
+	}
+	return a.clearMFA(userID)
+}
+
+// mfaChallenge is the login response for users with MFA enabled
+func (a *authService) mfaChallenge(user *models.User) (*models.LoginResponse, *apiError.Error) {
+	token, err := jwt.GenerateMFAChallengeToken(a.keys, user.ID, user.TokenVersion)
+	if err != nil {
+		log.Printf("Error generating MFA challenge for user %s: %v", user.Email, err)
+		return nil, apiError.ErrInternalServerError
+	}
+	return &models.LoginResponse{
+		MFARequired: true,
+		MFAToken:    token,
+	}, nil
+}
+
+func (a *authService) roleForUser(user *models.User) (*models.Role, *apiError.Error) {
+	roleID, err := gofrsUUID.FromString(user.RoleID.String())
+	if err != nil {
+		log.Printf("Error converting RoleID for user %s: %v", user.Email, err)
+		return nil, apiError.New("unable to convert role ID", http.StatusInternalServerError)
+	}
+	role, err := a.authRepo.FindRoleByID(roleID)
+	if err != nil {
+		log.Printf("Error fetching role for user %s: %v", user.Email, err)
+		return nil, apiError.New("unable to fetch role", http.StatusInternalServerError)
+	}
+	return role, nil
+}
+
+// verifySecondFactor accepts either a TOTP code or an unused recovery code
+func (a *authService) verifySecondFactor(user *models.User, code string) *apiError.Error {
+	if len(strings.TrimSpace(code)) == totp.Digits {
+		return a.verifyTOTP(user, code)
+	}
+
+	used, err := a.authRepo.UseRecoveryCode(user.ID, hashToken(normalizeRecoveryCode(code)), time.Now().Unix())
+	if err != nil {
+		log.Printf("Error using recovery code for user %d: %v", user.ID, err)
+		return apiError.ErrInternalServerError
+	}
+	if !used {
+		return apiError.New("invalid MFA code", http.StatusUnauthorized)
+	}
+	return nil
+}
+
+func (a *authService) verifyTOTP(user *models.User, code string) *apiError.Error {
+	step, ok := totp.Validate(user.MFASecret, strings.TrimSpace(code), time.Now())
+	if !ok {
+		return apiError.New("invalid MFA code", http.StatusUnauthorized)
+	}
+	fresh, err := a.authRepo.MarkMFAStepUsed(user.ID, step)
+	if err != nil {
+		log.Printf("Error recording MFA step for user %d: %v", user.ID, err)
+		return apiError.ErrInternalServerError
+	}
+	if !fresh {
+		return apiError.New("MFA code has already been used", http.StatusUnauthorized)
+	}
+	return nil
+}
+
+func (a *authService) newRecoveryCodes(userID uint) (*models.MFARecoveryCodesResponse, *apiError.Error) {
+	codes := make([]string, 0, recoveryCodeCount)
+	hashes := make([]string, 0, recoveryCodeCount)
+	for i := 0; i < recoveryCodeCount; i++ {
+		code, err := generateRecoveryCode()
+		if err != nil {
+			log.Printf("Error generating recovery codes for user %d: %v", userID, err)
+			return nil, apiError.ErrInternalServerError
+		}
+		codes = append(codes, code)
+		hashes = append(hashes, hashToken(normalizeRecoveryCode(code)))
+	}
+	if err := a.authRepo.ReplaceRecoveryCodes(userID, hashes); err != nil {
+		log.Printf("Error storing recovery codes for user %d: %v", userID, err)
+		return nil, apiError.ErrInternalServerError
+	}
+	return &models.MFARecoveryCodesResponse{RecoveryCodes: codes}, nil
+}
+
+func (a *authService) clearMFA(userID uint) *apiError.Error {
+	err := a.authRepo.UpdateUser(userID, map[string]interface{}{
+		"mfa_secret":         "",
+		"mfa_enabled":        false,
+		"mfa_last_used_step": 0,
+	})
+	if err != nil {
+		log.Printf("Error disabling MFA for user %d: %v", userID, err)
+		return apiError.ErrInternalServerError
+	}
+	if err := a.authRepo.ReplaceRecoveryCodes(userID, nil); err != nil {
+		log.Printf("Error deleting recovery codes for user %d: %v", userID, err)
+		return apiError.ErrInternalServerError
+	}
+	return nil
+}
+
+// generateRecoveryCode returns a code like "k3j9d-2mf8a"
+func generateRecoveryCode() (string, error) {
+	b := make([]byte, 7)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	code := strings.ToLower(base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(b))[:10]
+	return code[:5] + "-" + code[5:], nil
+}
+
+func normalizeRecoveryCode(code string) string {
+	return strings.ToLower(strings.NewReplacer("-", "", " ", "").Replace(code))
+}
@@ -1,9 +1,15 @@
 package services
 
 import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
+	"fmt"
 	"log"
 	"net/http"
+	"net/url"
+	"time"
 
 	"github.com/google/uuid"
 	gofrsUUID "github.com/gofrs/uuid"
@@ -12,6 +18,7 @@ import (
 	apiError "github.com/techagentng/ecommerce-api/errors"
 	"github.com/techagentng/ecommerce-api/models"
 	"github.com/techagentng/ecommerce-api/services/jwt"
+	"github.com/techagentng/ecommerce-api/services/mailer"
 	"golang.org/x/crypto/bcrypt"
 	"gorm.io/gorm"
 )
@@ -20,19 +27,45 @@ import (
 type AuthService interface {
 	GetRoleByName(name string) (*models.Role, error)
 	SignupUser(request *models.User) (*models.User, error)
-	LoginUser(request *models.LoginRequest) (*models.LoginResponse, *apiError.Error)
+	LoginUser(request *models.LoginRequest, clientIP string) (*models.LoginResponse, *apiError.Error)
+	RefreshToken(refreshToken string) (*models.LoginResponse, *apiError.Error)
+	Logout(accessToken string, refreshToken string) *apiError.Error
+	RevokeAllSessions(userID uint) *apiError.Error
+	PurgeExpiredTokens() error
+	VerifyEmail(token string) *apiError.Error
+	ResendVerificationEmail(email string) *apiError.Error
+	ForgotPassword(email string) *apiError.Error
+	ResetPassword(token string, newPassword string) *apiError.Error
+	ChangePassword(userID uint, oldPassword string, newPassword string) *apiError.Error
+	GetProfile(userID uint) (*models.UserResponse, *apiError.Error)
+	UpdateProfile(userID uint, request *models.UpdateProfileRequest) (*models.UserResponse, *apiError.Error)
+	UpdateProfileImage(userID uint, imageURL string) (*models.UserResponse, *apiError.Error)
+	EnrollMFA(userID uint) (*models.MFAEnrollResponse, *apiError.Error)
+	ConfirmMFA(userID uint, code string) (*models.MFARecoveryCodesResponse, *apiError.Error)
+	DisableMFA(userID uint, code string) *apiError.Error
+	RegenerateRecoveryCodes(userID uint, code string) (*models.MFARecoveryCodesResponse, *apiError.Error)
+	VerifyMFA(mfaToken string, code string, clientIP string) (*models.LoginResponse, *apiError.Error)
+	ResetMFA(userID uint) *apiError.Error
 }
 
 // authService struct
 type authService struct {
-	Config   *config.Config
-	authRepo db.AuthRepository
+	Config         *config.Config
+	authRepo       db.AuthRepository
+	mailer         mailer.Mailer
+	passwordPolicy *PasswordPolicy
+	loginThrottle  *LoginThrottle
+	keys           *jwt.Keyring
 }
 
-func NewAuthService(authRepo db.AuthRepository, conf *config.Config) AuthService {
+func NewAuthService(authRepo db.AuthRepository, m mailer.Mailer, passwordPolicy *PasswordPolicy, loginThrottle *LoginThrottle, keys *jwt.Keyring, conf *config.Config) AuthService {
 	return &authService{
-		Config:   conf,
-		authRepo: authRepo,
+		Config:         conf,
+		authRepo:       authRepo,
+		mailer:         m,
+		passwordPolicy: passwordPolicy,
+		loginThrottle:  loginThrottle,
+		keys:           keys,
 	}
 }
 
@@ -63,6 +96,10 @@ func (s *authService) SignupUser(user *models.User) (*models.User, error) {
 		return nil, apiError.GetUniqueContraintError(err)
 	}
 
+	if err := s.passwordPolicy.Validate(user.Password); err != nil {
+		return nil, err
+	}
+
 	// Hash the password
 	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(user.Password), bcrypt.DefaultCost)
 	if err != nil {
@@ -86,15 +123,26 @@ func (s *authService) SignupUser(user *models.User) (*models.User, error) {
 		return nil, apiError.ErrInternalServerError
 	}
 
+	// The account exists even if the email fails; the user can ask for a resend
+	if err := s.sendVerificationEmail(createdUser); err != nil {
+		log.Printf("SignupUser error sending verification email to %s: %v", createdUser.Email, err)
+	}
+
 	return createdUser, nil
 }
 
-// LoginUser logs in a user and returns the login response
-func (a *authService) LoginUser(loginRequest *models.LoginRequest) (*models.LoginResponse, *apiError.Error) {
+// LoginUser logs in a user and returns the login response. Failed attempts are
+// counted per account and per client IP and lead to a temporary lockout.
+func (a *authService) LoginUser(loginRequest *models.LoginRequest, clientIP string) (*models.LoginResponse, *apiError.Error) {
+    if err := a.loginThrottle.Check(loginRequest.Email, clientIP); err != nil {
+        return nil, err
+    }
+
     // Find the user by email
     foundUser, err := a.authRepo.FindUserByEmail(loginRequest.Email)
     if err != nil {
         if errors.Is(err, gorm.ErrRecordNotFound) {
+            a.loginThrottle.RecordFailure(loginRequest.Email, clientIP)
             return nil, apiError.New("invalid email or password", http.StatusUnprocessableEntity)
         }
         log.Printf("Error finding user by email: %v", err)
@@ -103,9 +151,14 @@ func (a *authService) LoginUser(loginRequest *models.LoginRequest) (*models.Logi
 
     // Verify user password
     if err := foundUser.VerifyPassword(loginRequest.Password); err != nil {
-        log.Printf("Invalid password for user %s", foundUser.Email)
+        a.loginThrottle.RecordFailure(loginRequest.Email, clientIP)
         return nil, apiError.ErrInvalidPassword
     }
+    a.loginThrottle.RecordSuccess(loginRequest.Email)
+
+    if !foundUser.IsActive() {
+        return nil, apiError.New(apiError.InActiveUserError.Error(), http.StatusUnauthorized)
+    }
 
     if foundUser.RoleID == uuid.Nil {
         log.Printf("User %s does not have a role assigned", foundUser.Email)
@@ -126,24 +179,501 @@ func (a *authService) LoginUser(loginRequest *models.LoginRequest) (*models.Logi
         return nil, apiError.New("unable to fetch role", http.StatusInternalServerError)
     }
     
+    // Users with MFA get a short-lived challenge instead of tokens
+    if foundUser.MFAEnabled {
+        return a.mfaChallenge(foundUser)
+    }
+
     roleName := role.Name
     log.Printf("Generating token pair for user %s with role %s", foundUser.Email, roleName)
-    accessToken, refreshToken, err := jwt.GenerateTokenPair(foundUser.Email, a.Config.JWTSecret, foundUser.AdminStatus, foundUser.ID, roleName)
-    if err != nil {
-        log.Printf("Error generating token pair for user %s: %v", foundUser.Email, err)
-        return nil, apiError.ErrInternalServerError
-    }
+    // Every login starts a new refresh token family
+    return a.issueTokenPair(foundUser, roleName, uuid.New().String())
+}
+
+// RefreshToken exchanges a refresh token for a new token pair. Refresh tokens
+// are single use: the presented token is marked used and replaced by a new one
+// in the same family. Presenting an already used token revokes the family.
+func (a *authService) RefreshToken(refreshToken string) (*models.LoginResponse, *apiError.Error) {
+	claims, err := jwt.ValidateAndGetClaims(refreshToken, a.keys)
+	if err != nil {
+		return nil, apiError.New("invalid refresh token", http.StatusUnauthorized)
+	}
+	if jwt.TokenType(claims) != jwt.RefreshTokenType {
+		return nil, apiError.New("invalid refresh token", http.StatusUnauthorized)
+	}
+
+	tokenID, _ := claims["jti"].(string)
+	if tokenID == "" {
+		return nil, apiError.New("invalid refresh token", http.StatusUnauthorized)
+	}
+
+	storedToken, err := a.authRepo.FindRefreshTokenByTokenID(tokenID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, apiError.New("invalid refresh token", http.StatusUnauthorized)
+		}
+		log.Printf("Error finding refresh token %s: %v", tokenID, err)
+		return nil, apiError.ErrInternalServerError
+	}
+	if storedToken.RevokedAt != 0 {
+		return nil, apiError.New("refresh token has been revoked", http.StatusUnauthorized)
+	}
+
+	now := time.Now().Unix()
+	marked, err := a.authRepo.MarkRefreshTokenUsed(tokenID, now)
+	if err != nil {
+		log.Printf("Error marking refresh token %s as used: %v", tokenID, err)
+		return nil, apiError.ErrInternalServerError
+	}
+	if !marked {
+		log.Printf("Refresh token reuse detected for user %d, revoking family %s", storedToken.UserID, storedToken.FamilyID)
+		if err := a.authRepo.RevokeRefreshTokenFamily(storedToken.FamilyID, now); err != nil {
+			log.Printf("Error revoking refresh token family %s: %v", storedToken.FamilyID, err)
+			return nil, apiError.ErrInternalServerError
+		}
+		return nil, apiError.New("refresh token reuse detected", http.StatusUnauthorized)
+	}
+
+	user, err := a.authRepo.FindUserByID(storedToken.UserID)
+	if err != nil {
+		log.Printf("Error finding user %d for refresh: %v", storedToken.UserID, err)
+		return nil, apiError.New("invalid refresh token", http.StatusUnauthorized)
+	}
+	if !user.IsActive() {
+		return nil, apiError.New(apiError.InActiveUserError.Error(), http.StatusUnauthorized)
+	}
+	if jwt.TokenVersion(claims) != user.TokenVersion {
+		return nil, apiError.New("refresh token has been revoked", http.StatusUnauthorized)
+	}
+
+	convertedRoleID, err := gofrsUUID.FromString(user.RoleID.String())
+	if err != nil {
+		log.Printf("Error converting RoleID for user %s: %v", user.Email, err)
+		return nil, apiError.New("unable to convert role ID", http.StatusInternalServerError)
+	}
+	role, err := a.authRepo.FindRoleByID(convertedRoleID)
+	if err != nil {
+		log.Printf("Error fetching role for user %s: %v", user.Email, err)
+		return nil, apiError.New("unable to fetch role", http.StatusInternalServerError)
+	}
+
+	return a.issueTokenPair(user, role.Name, storedToken.FamilyID)
+}
+
+// issueTokenPair generates a token pair for the user and records the refresh
+// token under familyID
+func (a *authService) issueTokenPair(user *models.User, roleName string, familyID string) (*models.LoginResponse, *apiError.Error) {
+	tokenID := uuid.New().String()
+	accessToken, refreshToken, err := jwt.GenerateTokenPair(user.Email, a.keys, user.AdminStatus, user.ID, roleName, user.TokenVersion, tokenID, familyID)
+	if err != nil {
+		log.Printf("Error generating token pair for user %s: %v", user.Email, err)
+		return nil, apiError.ErrInternalServerError
+	}
+
+	err = a.authRepo.CreateRefreshToken(&models.RefreshToken{
+		TokenID:   tokenID,
+		FamilyID:  familyID,
+		UserID:    user.ID,
+		ExpiresAt: time.Now().Add(jwt.RefreshTokenValidity).Unix(),
+	})
+	if err != nil {
+		log.Printf("Error storing refresh token for user %s: %v", user.Email, err)
+		return nil, apiError.ErrInternalServerError
+	}
+
+	return &models.LoginResponse{
+		UserResponse: models.UserResponse{
+			ID:        user.ID,
+			Fullname:  user.Fullname,
+			Username:  user.Username,
+			Telephone: user.Telephone,
+			Email:     user.Email,
+			RoleName:  roleName,
+		},
+		AccessToken:  accessToken,
+		RefreshToken: refreshToken,
+	}, nil
+}
+
+// Logout revokes the given access token and, when provided, the refresh token
+// family it was issued with
+func (a *authService) Logout(accessToken string, refreshToken string) *apiError.Error {
+	claims, err := jwt.ValidateAndGetClaims(accessToken, a.keys)
+	if err != nil {
+		return apiError.New("invalid access token", http.StatusUnauthorized)
+	}
+	userID, _ := claims["id"].(float64)
+	email, _ := claims["email"].(string)
+
+	err = a.authRepo.AddToBlacklist(&models.Blacklist{
+		Token:     jwt.TokenKey(accessToken, claims),
+		Email:     email,
+		UserID:    uint(userID),
+		ExpiresAt: jwt.ExpiresAt(claims),
+	})
+	if err != nil {
+		log.Printf("Error blacklisting token for user %s: %v", email, err)
+		return apiError.ErrInternalServerError
+	}
+
+	if refreshToken == "" {
+		return nil
+	}
+
+	refreshClaims, err := jwt.ValidateAndGetClaims(refreshToken, a.keys)
+	if err != nil || jwt.TokenType(refreshClaims) != jwt.RefreshTokenType {
+		return apiError.New("invalid refresh token", http.StatusBadRequest)
+	}
+	if refreshUserID, _ := refreshClaims["id"].(float64); refreshUserID != userID {
+		return apiError.New("refresh token does not belong to user", http.StatusForbidden)
+	}
+	familyID, _ := refreshClaims["family"].(string)
+	if err := a.authRepo.RevokeRefreshTokenFamily(familyID, time.Now().Unix()); err != nil {
+		log.Printf("Error revoking refresh token family %s: %v", familyID, err)
+		return apiError.ErrInternalServerError
+	}
+	return nil
+}
+
+// RevokeAllSessions invalidates every access and refresh token issued to the
+// user by bumping their token version
+func (a *authService) RevokeAllSessions(userID uint) *apiError.Error {
+	if err := a.authRepo.IncrementTokenVersion(userID); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return apiError.New("user not found", http.StatusNotFound)
+		}
+		log.Printf("Error incrementing token version for user %d: %v", userID, err)
+		return apiError.ErrInternalServerError
+	}
+	if err := a.authRepo.RevokeUserRefreshTokens(userID, time.Now().Unix()); err != nil {
+		log.Printf("Error revoking refresh tokens for user %d: %v", userID, err)
+		return apiError.ErrInternalServerError
+	}
+	return nil
+}
+
+// PurgeExpiredTokens deletes blacklist entries, refresh token records and login
+// attempt counters that have expired
+func (a *authService) PurgeExpiredTokens() error {
+	now := time.Now().Unix()
+	blacklisted, err := a.authRepo.DeleteExpiredBlacklist(now)
+	if err != nil {
+		return err
+	}
+	refreshTokens, err := a.authRepo.DeleteExpiredRefreshTokens(now)
+	if err != nil {
+		return err
+	}
+	loginAttempts, err := a.loginThrottle.PurgeExpired()
+	if err != nil {
+		return err
+	}
+	if blacklisted > 0 || refreshTokens > 0 || loginAttempts > 0 {
+		log.Printf("Purged %d expired blacklist entries, %d expired refresh tokens and %d expired login attempts", blacklisted, refreshTokens, loginAttempts)
+	}
+	return nil
+}
+
+// VerifyEmail marks the email address in a verification token as verified
+func (a *authService) VerifyEmail(token string) *apiError.Error {
+	claims, err := jwt.ValidateAndGetClaims(token, a.keys)
+	if err != nil || jwt.TokenType(claims) != jwt.EmailVerificationTokenType {
+		return apiError.New("invalid or expired verification token", http.StatusBadRequest)
+	}
+	userID, _ := claims["id"].(float64)
+	email, _ := claims["email"].(string)
+
+	user, err := a.authRepo.FindUserByID(uint(userID))
+	if err != nil {
+		return apiError.New("invalid or expired verification token", http.StatusBadRequest)
+	}
+	// The token was issued for an address the user no longer has
+	if user.Email != email {
+		return apiError.New("invalid or expired verification token", http.StatusBadRequest)
+	}
+	if user.IsEmailActive {
+		return nil
+	}
+
+	if err := a.authRepo.SetEmailActive(user.ID); err != nil {
+		log.Printf("Error activating email for user %s: %v", user.Email, err)
+		return apiError.ErrInternalServerError
+	}
+	return nil
+}
 
-    return &models.LoginResponse{
-        UserResponse: models.UserResponse{
-            ID:        foundUser.ID,
-            Fullname:  foundUser.Fullname,
-            Username:  foundUser.Username,
-            Telephone: foundUser.Telephone,
-            Email:     foundUser.Email,
-            RoleName:  roleName, 
-        },
-        AccessToken:  accessToken,
-        RefreshToken: refreshToken,
-    }, nil
-}
\ No newline at end of file
+// ResendVerificationEmail sends a new verification email, at most once per
+// Config.VerificationResendInterval. Unknown and already verified addresses
+// are ignored, as are requests within the interval, so every address gets the
+// same response and the endpoint cannot be used to discover accounts.
+func (a *authService) ResendVerificationEmail(email string) *apiError.Error {
+	user, err := a.authRepo.FindUserByEmail(email)
+	if err != nil || user.IsEmailActive {
+		return nil
+	}
+
+	nextAllowed := time.Unix(user.VerificationSentAt, 0).Add(a.Config.VerificationResendInterval)
+	if time.Now().Before(nextAllowed) {
+		log.Printf("Verification email to user %d not resent, the last one was sent less than %s ago", user.ID, a.Config.VerificationResendInterval)
+		return nil
+	}
+
+	if err := a.sendVerificationEmail(user); err != nil {
+		log.Printf("Error resending verification email to %s: %v", user.Email, err)
+		return apiError.New("unable to send verification email", http.StatusInternalServerError)
+	}
+	return nil
+}
+
+func (a *authService) sendVerificationEmail(user *models.User) error {
+	token, err := jwt.GenerateEmailVerificationToken(user.Email, a.keys, user.ID)
+	if err != nil {
+		return err
+	}
+
+	link := fmt.Sprintf("%s/api/v1/auth/verify?token=%s", a.Config.BaseUrl, url.QueryEscape(token))
+	err = a.mailer.Send(mailer.Message{
+		To:      user.Email,
+		Subject: "Verify your email address",
+		Body: fmt.Sprintf("Hi %s,\n\nPlease verify your email address by opening the link below:\n\n%s\n\nThe link expires in %s.\n",
+			user.Fullname, link, jwt.EmailVerificationTokenValidity),
+	})
+	if err != nil {
+		return err
+	}
+
+	return a.authRepo.SetVerificationSentAt(user.ID, time.Now().Unix())
+}
+
+// ForgotPassword emails a single-use password reset token. Unknown addresses
+// are ignored so the endpoint cannot be used to discover accounts.
+func (a *authService) ForgotPassword(email string) *apiError.Error {
+	user, err := a.authRepo.FindUserByEmail(email)
+	if err != nil {
+		return nil
+	}
+
+	token, err := generateRandomToken()
+	if err != nil {
+		log.Printf("Error generating password reset token: %v", err)
+		return apiError.ErrInternalServerError
+	}
+
+	err = a.authRepo.CreatePasswordReset(&models.PasswordReset{
+		UserID:    user.ID,
+		TokenHash: hashToken(token),
+		ExpiresAt: time.Now().Add(a.Config.PasswordResetTokenValidity).Unix(),
+	})
+	if err != nil {
+		log.Printf("Error storing password reset token for user %s: %v", user.Email, err)
+		return apiError.ErrInternalServerError
+	}
+
+	err = a.mailer.Send(mailer.Message{
+		To:      user.Email,
+		Subject: "Reset your password",
+		Body: fmt.Sprintf("Hi %s,\n\nUse the token below to reset your password:\n\n%s\n\nThe token expires in %s. If you did not request a reset you can ignore this email.\n",
+			user.Fullname, token, a.Config.PasswordResetTokenValidity),
+	})
+	if err != nil {
+		log.Printf("Error sending password reset email to %s: %v", user.Email, err)
+		return apiError.New("unable to send password reset email", http.StatusInternalServerError)
+	}
+	return nil
+}
+
+// ResetPassword sets a new password using a token from ForgotPassword and
+// revokes the user's existing sessions
+func (a *authService) ResetPassword(token string, newPassword string) *apiError.Error {
+	reset, err := a.authRepo.FindPasswordResetByTokenHash(hashToken(token))
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return apiError.New("invalid or expired reset token", http.StatusBadRequest)
+		}
+		log.Printf("Error finding password reset token: %v", err)
+		return apiError.ErrInternalServerError
+	}
+	if reset.UsedAt != 0 || time.Now().Unix() > reset.ExpiresAt {
+		return apiError.New("invalid or expired reset token", http.StatusBadRequest)
+	}
+
+	if err := a.passwordPolicy.Validate(newPassword); err != nil {
+		return err
+	}
+
+	consumed, err := a.authRepo.MarkPasswordResetUsed(reset.ID, time.Now().Unix())
+	if err != nil {
+		log.Printf("Error consuming password reset token: %v", err)
+		return apiError.ErrInternalServerError
+	}
+	if !consumed {
+		return apiError.New("invalid or expired reset token", http.StatusBadRequest)
+	}
+
+	return a.setPassword(reset.UserID, newPassword)
+}
+
+// ChangePassword replaces the password of a logged in user after checking the
+// old one and revokes the user's existing sessions
+func (a *authService) ChangePassword(userID uint, oldPassword string, newPassword string) *apiError.Error {
+	user, err := a.authRepo.FindUserByID(userID)
+	if err != nil {
+		return apiError.New("user not found", http.StatusNotFound)
+	}
+	if err := user.VerifyPassword(oldPassword); err != nil {
+		return apiError.New("old password is incorrect", http.StatusUnauthorized)
+	}
+	if oldPassword == newPassword {
+		return apiError.New("new password must be different from the old password", http.StatusBadRequest)
+	}
+	if err := a.passwordPolicy.Validate(newPassword); err != nil {
+		return err
+	}
+
+	return a.setPassword(user.ID, newPassword)
+}
+
+func (a *authService) setPassword(userID uint, password string) *apiError.Error {
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		log.Printf("Error hashing password for user %d: %v", userID, err)
+		return apiError.ErrInternalServerError
+	}
+	if err := a.authRepo.UpdateUserPassword(userID, string(hashedPassword)); err != nil {
+		log.Printf("Error updating password for user %d: %v", userID, err)
+		return apiError.ErrInternalServerError
+	}
+	if err := a.authRepo.InvalidatePasswordResets(userID, time.Now().Unix()); err != nil {
+		log.Printf("Error invalidating password reset tokens for user %d: %v", userID, err)
+	}
+	return a.RevokeAllSessions(userID)
+}
+
+// generateRandomToken returns 32 random bytes, hex encoded
+func generateRandomToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// GetProfile returns the user's own account details
+func (a *authService) GetProfile(userID uint) (*models.UserResponse, *apiError.Error) {
+	user, err := a.authRepo.FindUserByID(userID)
+	if err != nil {
+		return nil, apiError.New("user not found", http.StatusNotFound)
+	}
+	return a.toUserResponse(user)
+}
+
+// UpdateProfile applies the fields set in request. Changing the email address
+// marks it unverified and sends a verification email to the new address. A
+// username, telephone or email another user has is returned as 409, also when
+// a concurrent update takes it after the check and the unique index refuses it.
+func (a *authService) UpdateProfile(userID uint, request *models.UpdateProfileRequest) (*models.UserResponse, *apiError.Error) {
+	user, err := a.authRepo.FindUserByID(userID)
+	if err != nil {
+		return nil, apiError.New("user not found", http.StatusNotFound)
+	}
+
+	fields := map[string]interface{}{}
+	if request.Fullname != nil {
+		fields["fullname"] = *request.Fullname
+	}
+	unique := []struct {
+		column string
+		value  *string
+		old    string
+	}{
+		{"username", request.Username, user.Username},
+		{"telephone", request.Telephone, user.Telephone},
+		{"email", request.Email, user.Email},
+	}
+	for _, field := range unique {
+		if field.value == nil || *field.value == field.old {
+			continue
+		}
+		taken, err := a.authRepo.IsUserFieldTaken(field.column, *field.value, user.ID)
+		if err != nil {
+			log.Printf("Error checking %s uniqueness for user %d: %v", field.column, user.ID, err)
+			return nil, apiError.ErrInternalServerError
+		}
+		if taken {
+			return nil, apiError.New(fmt.Sprintf("%s is already in use", field.column), http.StatusConflict)
+		}
+		fields[field.column] = *field.value
+	}
+
+	_, emailChanged := fields["email"]
+	if emailChanged {
+		fields["is_email_active"] = false
+	}
+	if len(fields) == 0 {
+		return a.toUserResponse(user)
+	}
+
+	if err := a.authRepo.UpdateUser(user.ID, fields); err != nil {
+		// Another request may have taken the value since it was checked
+		if apiError.IsUniqueConstraintError(err) {
+			return nil, apiError.New(apiError.GetUniqueContraintError(err).Message, http.StatusConflict)
+		}
+		log.Printf("Error updating profile of user %d: %v", user.ID, err)
+		return nil, apiError.ErrInternalServerError
+	}
+
+	updatedUser, err := a.authRepo.FindUserByID(user.ID)
+	if err != nil {
+		log.Printf("Error fetching updated user %d: %v", user.ID, err)
+		return nil, apiError.ErrInternalServerError
+	}
+	if emailChanged {
+		if err := a.sendVerificationEmail(updatedUser); err != nil {
+			log.Printf("Error sending verification email to %s: %v", updatedUser.Email, err)
+		}
+	}
+	return a.toUserResponse(updatedUser)
+}
+
+// UpdateProfileImage replaces the user's profile image URL
+func (a *authService) UpdateProfileImage(userID uint, imageURL string) (*models.UserResponse, *apiError.Error) {
+	if err := a.authRepo.UpdateUser(userID, map[string]interface{}{"thumb_nail_url": imageURL}); err != nil {
+		log.Printf("Error updating profile image of user %d: %v", userID, err)
+		return nil, apiError.ErrInternalServerError
+	}
+	return a.GetProfile(userID)
+}
+
+// toUserResponse builds the public view of a user with the role name resolved
+func (a *authService) toUserResponse(user *models.User) (*models.UserResponse, *apiError.Error) {
+	roleName := ""
+	if user.RoleID != uuid.Nil {
+		convertedRoleID, err := gofrsUUID.FromString(user.RoleID.String())
+		if err != nil {
+			log.Printf("Error converting RoleID for user %s: %v", user.Email, err)
+			return nil, apiError.New("unable to convert role ID", http.StatusInternalServerError)
+		}
+		role, err := a.authRepo.FindRoleByID(convertedRoleID)
+		if err != nil {
+			log.Printf("Error fetching role for user %s: %v", user.Email, err)
+			return nil, apiError.New("unable to fetch role", http.StatusInternalServerError)
+		}
+		roleName = role.Name
+	}
+
+	return &models.UserResponse{
+		ID:              user.ID,
+		Fullname:        user.Fullname,
+		Username:        user.Username,
+		Telephone:       user.Telephone,
+		Email:           user.Email,
+		RoleName:        roleName,
+		ThumbNailURL:    user.ThumbNailURL,
+		IsEmailVerified: user.IsEmailActive,
+	}, nil
+}
@@ -0,0 +1,46 @@
+package services
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/techagentng/ecommerce-api/db"
+	"github.com/techagentng/ecommerce-api/models"
+)
+
+// racedAuthRepo has a user whose new email passes the uniqueness check but is
+// taken by a concurrent update before the user is updated
+type racedAuthRepo struct {
+	db.AuthRepository
+}
+
+func (r *racedAuthRepo) FindUserByID(id uint) (*models.User, error) {
+	return &models.User{ID: id, Email: "ada@example.com"}, nil
+}
+
+func (r *racedAuthRepo) IsUserFieldTaken(column string, value string, excludeUserID uint) (bool, error) {
+	return false, nil
+}
+
+func (r *racedAuthRepo) UpdateUser(userID uint, fields map[string]interface{}) error {
+	return &pgconn.PgError{
+		Code:           "23505",
+		Message:        `duplicate key value violates unique constraint "uni_users_email"`,
+		Detail:         "Key (email)=(obi@example.com) already exists.",
+		ConstraintName: "uni_users_email",
+	}
+}
+
+func TestUpdateProfileReportsUniqueViolationAsConflict(t *testing.T) {
+	service := &authService{authRepo: &racedAuthRepo{}}
+	email := "obi@example.com"
+
+	_, apiErr := service.UpdateProfile(1, &models.UpdateProfileRequest{Email: &email})
+	if apiErr == nil || apiErr.Status != http.StatusConflict {
+		t.Fatalf("got %v, want 409", apiErr)
+	}
+	if apiErr.Message != "email must be unique" {
+		t.Errorf("got message %q", apiErr.Message)
+	}
+}
@@ -0,0 +1,34 @@
+package blobstore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/techagentng/ecommerce-api/config"
+)
+
+// ErrInvalidKey is returned for keys that are empty or escape the store
+var ErrInvalidKey = errors.New("invalid blob key")
+
+// BlobStore stores uploaded files under a key and serves them from a public URL
+type BlobStore interface {
+	Put(ctx context.Context, key string, body io.Reader, size int64, contentType string) error
+	// Delete removes the blob; deleting a missing blob is not an error
+	Delete(ctx context.Context, key string) error
+	URL(key string) string
+}
+
+// New returns the BlobStore selected by Config.BlobStore. S3 is the default;
+// "local" writes files to Config.BlobDir for local development.
+func New(conf *config.Config) (BlobStore, error) {
+	switch conf.BlobStore {
+	case "", "s3":
+		return NewS3Store(conf.AWSRegion, conf.AWSBucket)
+	case "local":
+		return NewLocalStore(conf.BlobDir, conf.BlobBaseURL)
+	default:
+		return nil, fmt.Errorf("unknown blob store %q", conf.BlobStore)
+	}
+}
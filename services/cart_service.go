@@ -0,0 +1,407 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/techagentng/ecommerce-api/config"
+	"github.com/techagentng/ecommerce-api/db"
+	apiError "github.com/techagentng/ecommerce-api/errors"
+	"github.com/techagentng/ecommerce-api/models"
+	"gorm.io/gorm"
+)
+
+// maxCartItemQuantity caps the quantity of a cart line
+const maxCartItemQuantity = 1000
+
+// CartService manages the carts of users and guests. Carts are priced from
+// the catalog each time they are returned, and checking out turns the user's
+// cart into an order through OrderService.PlaceOrder.
+type CartService interface {
+	GetCart(owner models.CartOwner) (*models.CartResponse, *apiError.Error)
+	AddItem(owner models.CartOwner, request *models.AddCartItemRequest) (*models.CartResponse, *apiError.Error)
+	UpdateItem(owner models.CartOwner, itemID uint, request *models.UpdateCartItemRequest) (*models.CartResponse, *apiError.Error)
+	RemoveItem(owner models.CartOwner, itemID uint) (*models.CartResponse, *apiError.Error)
+	MergeGuestCart(userID uint, guestToken string) *apiError.Error
+	Checkout(userID uint) (*models.Order, error)
+	NewGuestToken() (string, *apiError.Error)
+	PurgeExpiredCarts() error
+}
+
+type cartService struct {
+	Config       *config.Config
+	cartRepo     db.CartRepository
+	productRepo  db.ProductRepository
+	variantRepo  db.VariantRepository
+	orderService OrderService
+}
+
+// NewCartService constructor function
+func NewCartService(cartRepo db.CartRepository, productRepo db.ProductRepository, variantRepo db.VariantRepository, orderService OrderService, conf *config.Config) CartService {
+	return &cartService{
+		Config:       conf,
+		cartRepo:     cartRepo,
+		productRepo:  productRepo,
+		variantRepo:  variantRepo,
+		orderService: orderService,
+	}
+}
+
+// GetCart returns the owner's priced cart, or an empty cart if there is none
+func (s *cartService) GetCart(owner models.CartOwner) (*models.CartResponse, *apiError.Error) {
+	cart, apiErr := s.findCart(owner)
+	if apiErr != nil {
+		return nil, apiErr
+	}
+	return s.priceCart(cart)
+}
+
+// AddItem adds a product, or one of its variants, to the owner's cart, which
+// is created on the first item. A product with variants is added by variant.
+// Stock is not reserved: the priced cart warns about lines that are short.
+func (s *cartService) AddItem(owner models.CartOwner, request *models.AddCartItemRequest) (*models.CartResponse, *apiError.Error) {
+	product, err := s.productRepo.FindProductByID(request.ProductID)
+	if err != nil {
+		log.Printf("Error finding product %d: %v", request.ProductID, err)
+		return nil, apiError.ErrInternalServerError
+	}
+	if product == nil {
+		return nil, apiError.New(fmt.Sprintf("product %d not found", request.ProductID), http.StatusNotFound)
+	}
+	unitPrice := product.Price
+	if request.VariantID == nil {
+		variantCount, err := s.variantRepo.CountVariants(product.ID)
+		if err != nil {
+			log.Printf("Error counting variants of product %d: %v", product.ID, err)
+			return nil, apiError.ErrInternalServerError
+		}
+		if variantCount > 0 {
+			return nil, apiError.New(fmt.Sprintf("variant_id is required for product %d, it has variants", product.ID), http.StatusBadRequest)
+		}
+	} else {
+		variant, err := s.variantRepo.FindVariantByID(*request.VariantID)
+		if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			log.Printf("Error finding variant %d: %v", *request.VariantID, err)
+			return nil, apiError.ErrInternalServerError
+		}
+		if variant == nil || variant.ProductID != product.ID {
+			return nil, apiError.New(fmt.Sprintf("variant %d not found", *request.VariantID), http.StatusNotFound)
+		}
+		unitPrice = variant.EffectivePrice(product)
+	}
+
+	cart, apiErr := s.findOrCreateCart(owner)
+	if apiErr != nil {
+		return nil, apiErr
+	}
+	for _, item := range cart.Items {
+		if item.ProductID == request.ProductID && sameVariant(item.VariantID, request.VariantID) &&
+			item.Quantity+request.Quantity > maxCartItemQuantity {
+			return nil, apiError.New(fmt.Sprintf("a cart line can hold at most %d units", maxCartItemQuantity), http.StatusBadRequest)
+		}
+	}
+
+	item := &models.CartItem{
+		ProductID:      request.ProductID,
+		VariantID:      request.VariantID,
+		Quantity:       request.Quantity,
+		AddedUnitPrice: unitPrice,
+	}
+	if err := s.cartRepo.AddCartItem(cart.ID, item, s.expiresAt()); err != nil {
+		log.Printf("Error adding product %d to cart %d: %v", request.ProductID, cart.ID, err)
+		return nil, apiError.ErrInternalServerError
+	}
+	return s.GetCart(owner)
+}
+
+// UpdateItem sets the quantity of a line of the owner's cart
+func (s *cartService) UpdateItem(owner models.CartOwner, itemID uint, request *models.UpdateCartItemRequest) (*models.CartResponse, *apiError.Error) {
+	cart, apiErr := s.findCart(owner)
+	if apiErr != nil {
+		return nil, apiErr
+	}
+	if cart == nil {
+		return nil, apiError.New("cart item not found", http.StatusNotFound)
+	}
+	if err := s.cartRepo.UpdateCartItemQuantity(cart.ID, itemID, request.Quantity, s.expiresAt()); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, apiError.New("cart item not found", http.StatusNotFound)
+		}
+		log.Printf("Error updating item %d of cart %d: %v", itemID, cart.ID, err)
+		return nil, apiError.ErrInternalServerError
+	}
+	return s.GetCart(owner)
+}
+
+// RemoveItem removes a line from the owner's cart
+func (s *cartService) RemoveItem(owner models.CartOwner, itemID uint) (*models.CartResponse, *apiError.Error) {
+	cart, apiErr := s.findCart(owner)
+	if apiErr != nil {
+		return nil, apiErr
+	}
+	if cart == nil {
+		return nil, apiError.New("cart item not found", http.StatusNotFound)
+	}
+	if err := s.cartRepo.DeleteCartItem(cart.ID, itemID, s.expiresAt()); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, apiError.New("cart item not found", http.StatusNotFound)
+		}
+		log.Printf("Error removing item %d of cart %d: %v", itemID, cart.ID, err)
+		return nil, apiError.ErrInternalServerError
+	}
+	return s.GetCart(owner)
+}
+
+// MergeGuestCart moves the lines of a guest cart into the user's cart, adding
+// up the quantities of lines in both, and deletes the guest cart. Nothing
+// happens when the token has no cart.
+func (s *cartService) MergeGuestCart(userID uint, guestToken string) *apiError.Error {
+	guestCart, apiErr := s.findCart(models.CartOwner{GuestToken: guestToken})
+	if apiErr != nil || guestCart == nil {
+		return apiErr
+	}
+	userCart, apiErr := s.findOrCreateCart(models.CartOwner{UserID: userID})
+	if apiErr != nil {
+		return apiErr
+	}
+	if err := s.cartRepo.MergeCarts(guestCart.ID, userCart.ID, s.expiresAt()); err != nil {
+		log.Printf("Error merging cart %d into cart %d of user %d: %v", guestCart.ID, userCart.ID, userID, err)
+		return apiError.ErrInternalServerError
+	}
+	return nil
+}
+
+// Checkout places an order for the lines of the user's cart and removes those
+// lines from the cart; lines added meanwhile stay. The order is priced and its stock reserved by
+// OrderService.PlaceOrder, whose errors are returned as they are: a
+// *db.InsufficientStockError when lines are short, *apiError.Error otherwise.
+func (s *cartService) Checkout(userID uint) (*models.Order, error) {
+	cart, apiErr := s.findCart(models.CartOwner{UserID: userID})
+	if apiErr != nil {
+		return nil, apiErr
+	}
+	if cart == nil || len(cart.Items) == 0 {
+		return nil, apiError.New("the cart is empty", http.StatusBadRequest)
+	}
+
+	order := &models.Order{UserID: userID}
+	for _, item := range cart.Items {
+		order.Items = append(order.Items, models.OrderItem{
+			ProductID: item.ProductID,
+			VariantID: item.VariantID,
+			Quantity:  item.Quantity,
+		})
+	}
+	order, err := s.orderService.PlaceOrder(order)
+	if err != nil {
+		return nil, err
+	}
+
+	// The order stands even if the cart cannot be emptied
+	if err := s.cartRepo.RemoveOrderedItems(cart.ID, cart.Items, s.expiresAt()); err != nil {
+		log.Printf("Error emptying cart %d after order %d: %v", cart.ID, order.ID, err)
+	}
+	return order, nil
+}
+
+// NewGuestToken returns a token that identifies a new guest cart
+func (s *cartService) NewGuestToken() (string, *apiError.Error) {
+	token, err := generateRandomToken()
+	if err != nil {
+		log.Printf("Error generating cart token: %v", err)
+		return "", apiError.ErrInternalServerError
+	}
+	return token, nil
+}
+
+// PurgeExpiredCarts deletes the carts that were abandoned for longer than CartTTL
+func (s *cartService) PurgeExpiredCarts() error {
+	_, err := s.cartRepo.DeleteExpiredCarts(time.Now().Unix())
+	return err
+}
+
+// findCart returns the owner's cart, nil if there is none. An expired cart
+// that was not purged yet is returned empty.
+func (s *cartService) findCart(owner models.CartOwner) (*models.Cart, *apiError.Error) {
+	var cart *models.Cart
+	var err error
+	switch {
+	case owner.UserID != 0:
+		cart, err = s.cartRepo.FindCartByUserID(owner.UserID)
+	case owner.GuestToken != "":
+		cart, err = s.cartRepo.FindCartByTokenHash(hashToken(owner.GuestToken))
+	default:
+		return nil, nil
+	}
+	if err != nil {
+		log.Printf("Error finding cart: %v", err)
+		return nil, apiError.ErrInternalServerError
+	}
+	if cart != nil && cart.ExpiresAt < time.Now().Unix() && len(cart.Items) > 0 {
+		if err := s.cartRepo.ClearCart(cart.ID); err != nil {
+			log.Printf("Error emptying expired cart %d: %v", cart.ID, err)
+			return nil, apiError.ErrInternalServerError
+		}
+		cart.Items = nil
+	}
+	return cart, nil
+}
+
+// findOrCreateCart returns the owner's cart, creating it if there is none
+func (s *cartService) findOrCreateCart(owner models.CartOwner) (*models.Cart, *apiError.Error) {
+	cart, apiErr := s.findCart(owner)
+	if apiErr != nil || cart != nil {
+		return cart, apiErr
+	}
+	cart = &models.Cart{ExpiresAt: s.expiresAt()}
+	if owner.UserID != 0 {
+		cart.UserID = &owner.UserID
+	} else if owner.GuestToken != "" {
+		tokenHash := hashToken(owner.GuestToken)
+		cart.TokenHash = &tokenHash
+	} else {
+		return nil, apiError.New("a cart token is required", http.StatusBadRequest)
+	}
+	cart, err := s.cartRepo.CreateCart(cart)
+	if err != nil {
+		log.Printf("Error creating cart: %v", err)
+		return nil, apiError.ErrInternalServerError
+	}
+	return cart, nil
+}
+
+// priceCart prices the cart's lines from the current catalog and warns about
+// lines that cannot be ordered as they are
+func (s *cartService) priceCart(cart *models.Cart) (*models.CartResponse, *apiError.Error) {
+	cartResponse := &models.CartResponse{Items: []models.CartLineResponse{}}
+	if cart == nil {
+		return cartResponse, nil
+	}
+	cartResponse.ID = cart.ID
+	cartResponse.ExpiresAt = cart.ExpiresAt
+	cartResponse.CanCheckout = len(cart.Items) > 0
+
+	var productIDs, variantIDs, withoutVariantIDs []uint
+	for _, item := range cart.Items {
+		productIDs = append(productIDs, item.ProductID)
+		if item.VariantID != nil {
+			variantIDs = append(variantIDs, *item.VariantID)
+		} else {
+			withoutVariantIDs = append(withoutVariantIDs, item.ProductID)
+		}
+	}
+	products, err := s.productRepo.FindProductsByIDs(productIDs)
+	if err != nil {
+		log.Printf("Error finding the products of cart %d: %v", cart.ID, err)
+		return nil, apiError.ErrInternalServerError
+	}
+	variants, err := s.variantRepo.FindVariantsByIDs(variantIDs)
+	if err != nil {
+		log.Printf("Error finding the variants of cart %d: %v", cart.ID, err)
+		return nil, apiError.ErrInternalServerError
+	}
+	// Lines without a variant are only valid for products without variants
+	variantCounts, err := s.variantRepo.CountVariantsByProductIDs(withoutVariantIDs)
+	if err != nil {
+		log.Printf("Error counting the variants of cart %d: %v", cart.ID, err)
+		return nil, apiError.ErrInternalServerError
+	}
+	productsByID := make(map[uint]*models.Product, len(products))
+	for _, product := range products {
+		productsByID[product.ID] = product
+	}
+	variantsByID := make(map[uint]*models.ProductVariant, len(variants))
+	for _, variant := range variants {
+		variantsByID[variant.ID] = variant
+	}
+
+	var subtotal int64
+	for _, item := range cart.Items {
+		line := priceCartLine(item, productsByID[item.ProductID], variantsByID, variantCounts)
+		cartResponse.Items = append(cartResponse.Items, line)
+		cartResponse.ItemCount += line.Quantity
+		if line.Warning == "" || line.Warning == models.CartWarningPriceChanged {
+			subtotal += models.MinorUnits(line.TotalPrice)
+		} else {
+			cartResponse.CanCheckout = false
+		}
+	}
+	cartResponse.Subtotal = models.FromMinorUnits(subtotal)
+	return cartResponse, nil
+}
+
+// priceCartLine prices a cart line from its product, nil if the product is
+// gone, or from its variant. variantCounts holds the counts of the products
+// with variants.
+func priceCartLine(item models.CartItem, product *models.Product, variantsByID map[uint]*models.ProductVariant, variantCounts map[uint]db.VariantCounts) models.CartLineResponse {
+	line := models.CartLineResponse{
+		ID:             item.ID,
+		ProductID:      item.ProductID,
+		VariantID:      item.VariantID,
+		Quantity:       item.Quantity,
+		AddedUnitPrice: item.AddedUnitPrice,
+	}
+	if product == nil {
+		line.Warning = models.CartWarningUnavailable
+		line.Message = "this product is no longer available"
+		return line
+	}
+	line.Name = product.Name
+
+	var stock int
+	if item.VariantID != nil {
+		variant := variantsByID[*item.VariantID]
+		if variant == nil || variant.ProductID != product.ID {
+			line.Warning = models.CartWarningUnavailable
+			line.Message = "this variant is no longer available"
+			return line
+		}
+		line.SKU = variant.SKU
+		line.UnitPrice = variant.EffectivePrice(product)
+		stock = variant.Stock
+	} else {
+		if product.SKU != nil {
+			line.SKU = *product.SKU
+		}
+		line.UnitPrice = product.Price
+		if variantCounts[product.ID].Variants > 0 {
+			line.Warning = models.CartWarningVariantRequired
+			line.Message = "choose a variant of this product"
+			return line
+		}
+		stock = product.Stock
+	}
+	line.TotalPrice = models.FromMinorUnits(models.MinorUnits(line.UnitPrice) * int64(line.Quantity))
+
+	line.Available = line.Quantity
+	switch {
+	case stock <= 0:
+		line.Available = 0
+		line.Warning = models.CartWarningOutOfStock
+		line.Message = "out of stock"
+	case stock < line.Quantity:
+		line.Available = stock
+		line.Warning = models.CartWarningLowStock
+		line.Message = fmt.Sprintf("only %d left in stock", stock)
+	case line.UnitPrice != line.AddedUnitPrice:
+		line.Warning = models.CartWarningPriceChanged
+		line.Message = fmt.Sprintf("the price changed from %.2f to %.2f", line.AddedUnitPrice, line.UnitPrice)
+	}
+	return line
+}
+
+// expiresAt is the expiry of a cart changed now
+func (s *cartService) expiresAt() int64 {
+	return time.Now().Add(s.Config.CartTTL).Unix()
+}
+
+// sameVariant reports whether two optional variant IDs are equal
+func sameVariant(a, b *uint) bool {
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+	return *a == *b
+}
@@ -0,0 +1,154 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"github.com/techagentng/ecommerce-api/config"
+	"github.com/techagentng/ecommerce-api/db"
+	"github.com/techagentng/ecommerce-api/models"
+)
+
+// stubCartRepo serves one cart and records the lines removed at checkout.
+// Methods the tests do not reach panic through the embedded nil interface.
+type stubCartRepo struct {
+	db.CartRepository
+	cart    *models.Cart
+	removed []models.CartItem
+}
+
+func (r *stubCartRepo) FindCartByUserID(userID uint) (*models.Cart, error) {
+	cart := *r.cart
+	cart.Items = append([]models.CartItem(nil), r.cart.Items...)
+	return &cart, nil
+}
+
+func (r *stubCartRepo) RemoveOrderedItems(cartID uint, ordered []models.CartItem, expiresAt int64) error {
+	r.removed = append(r.removed, ordered...)
+	return nil
+}
+
+type stubCatalogRepo struct {
+	db.ProductRepository
+	products map[uint]*models.Product
+}
+
+func (r *stubCatalogRepo) FindProductsByIDs(ids []uint) ([]*models.Product, error) {
+	var products []*models.Product
+	for _, id := range ids {
+		if product, ok := r.products[id]; ok {
+			products = append(products, product)
+		}
+	}
+	return products, nil
+}
+
+// stubVariantRepo counts how often variants are counted
+type stubVariantRepo struct {
+	db.VariantRepository
+	variants   map[uint]*models.ProductVariant
+	countCalls int
+	countedIDs []uint
+	counts     map[uint]db.VariantCounts
+}
+
+func (r *stubVariantRepo) FindVariantsByIDs(ids []uint) ([]*models.ProductVariant, error) {
+	var variants []*models.ProductVariant
+	for _, id := range ids {
+		if variant, ok := r.variants[id]; ok {
+			variants = append(variants, variant)
+		}
+	}
+	return variants, nil
+}
+
+func (r *stubVariantRepo) CountVariantsByProductIDs(productIDs []uint) (map[uint]db.VariantCounts, error) {
+	r.countCalls++
+	r.countedIDs = append(r.countedIDs, productIDs...)
+	counts := map[uint]db.VariantCounts{}
+	for _, id := range productIDs {
+		if c, ok := r.counts[id]; ok {
+			counts[id] = c
+		}
+	}
+	return counts, nil
+}
+
+// stubOrderService places every order it is given
+type stubOrderService struct {
+	OrderService
+	placed []*models.Order
+}
+
+func (o *stubOrderService) PlaceOrder(order *models.Order) (*models.Order, error) {
+	order.ID = uint(len(o.placed) + 1)
+	o.placed = append(o.placed, order)
+	return order, nil
+}
+
+func TestPriceCartCountsVariantsInOneQuery(t *testing.T) {
+	variantID := uint(30)
+	cartRepo := &stubCartRepo{cart: &models.Cart{ID: 1, ExpiresAt: time.Now().Add(time.Hour).Unix(), Items: []models.CartItem{
+		{ID: 1, ProductID: 10, Quantity: 1, AddedUnitPrice: 5},
+		{ID: 2, ProductID: 11, Quantity: 2, AddedUnitPrice: 7},
+		{ID: 3, ProductID: 12, VariantID: &variantID, Quantity: 1, AddedUnitPrice: 9},
+	}}}
+	variantRepo := &stubVariantRepo{
+		variants: map[uint]*models.ProductVariant{variantID: {ID: variantID, ProductID: 12, SKU: "CAP-RED", Stock: 3}},
+		counts:   map[uint]db.VariantCounts{11: {Variants: 2, InStock: 2}},
+	}
+	service := NewCartService(cartRepo, &stubCatalogRepo{products: map[uint]*models.Product{
+		10: {ID: 10, Name: "Mug", Price: 5, Stock: 4},
+		11: {ID: 11, Name: "Shirt", Price: 7, Stock: 0},
+		12: {ID: 12, Name: "Cap", Price: 9},
+	}}, variantRepo, &stubOrderService{}, &config.Config{CartTTL: time.Hour})
+
+	cart, apiErr := service.GetCart(models.CartOwner{UserID: 1})
+	if apiErr != nil {
+		t.Fatal(apiErr)
+	}
+	if variantRepo.countCalls != 1 {
+		t.Errorf("variants were counted in %d queries, want 1", variantRepo.countCalls)
+	}
+	if len(variantRepo.countedIDs) != 2 {
+		t.Errorf("counted the variants of products %v, want those of the lines without a variant", variantRepo.countedIDs)
+	}
+	if len(cart.Items) != 3 {
+		t.Fatalf("got %d lines, want 3", len(cart.Items))
+	}
+	if cart.Items[0].Warning != "" || cart.Items[2].Warning != "" {
+		t.Errorf("got warnings %q and %q, want none", cart.Items[0].Warning, cart.Items[2].Warning)
+	}
+	if cart.Items[1].Warning != models.CartWarningVariantRequired {
+		t.Errorf("got warning %q for a product with variants, want %q", cart.Items[1].Warning, models.CartWarningVariantRequired)
+	}
+	if cart.CanCheckout {
+		t.Error("a cart with a line that needs a variant can be checked out")
+	}
+}
+
+func TestCheckoutRemovesOnlyOrderedLines(t *testing.T) {
+	cartRepo := &stubCartRepo{cart: &models.Cart{ID: 1, ExpiresAt: time.Now().Add(time.Hour).Unix(), Items: []models.CartItem{
+		{ID: 1, ProductID: 10, Quantity: 2},
+		{ID: 2, ProductID: 11, Quantity: 1},
+	}}}
+	orders := &stubOrderService{}
+	service := NewCartService(cartRepo, &stubCatalogRepo{}, &stubVariantRepo{}, orders, &config.Config{CartTTL: time.Hour})
+
+	order, err := service.Checkout(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(orders.placed) != 1 || len(order.Items) != 2 {
+		t.Fatalf("placed %d orders with %d lines, want 1 with 2", len(orders.placed), len(order.Items))
+	}
+	if len(cartRepo.removed) != 2 {
+		t.Fatalf("removed %d lines, want the 2 that were ordered", len(cartRepo.removed))
+	}
+	for i, item := range cartRepo.removed {
+		want := cartRepo.cart.Items[i]
+		if item.ID != want.ID || item.Quantity != want.Quantity {
+			t.Errorf("removed line %d with quantity %d, want line %d with quantity %d", item.ID, item.Quantity, want.ID, want.Quantity)
+		}
+	}
+}
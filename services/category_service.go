@@ -0,0 +1,279 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/techagentng/ecommerce-api/config"
+	"github.com/techagentng/ecommerce-api/db"
+	apiError "github.com/techagentng/ecommerce-api/errors"
+	"github.com/techagentng/ecommerce-api/models"
+	"gorm.io/gorm"
+)
+
+// CategoryService manages the category tree and product membership
+type CategoryService interface {
+	ListCategoryTree() ([]models.CategoryNode, *apiError.Error)
+	GetCategory(categoryID uint) (*models.CategoryResponse, *apiError.Error)
+	CreateCategory(request *models.CreateCategoryRequest) (*models.CategoryResponse, *apiError.Error)
+	UpdateCategory(categoryID uint, request *models.UpdateCategoryRequest) (*models.CategoryResponse, *apiError.Error)
+	DeleteCategory(categoryID uint) *apiError.Error
+	SetProductCategories(productID uint, categoryIDs []uint) ([]models.Category, *apiError.Error)
+}
+
+type categoryService struct {
+	Config       *config.Config
+	categoryRepo db.CategoryRepository
+	productRepo  db.ProductRepository
+}
+
+// NewCategoryService constructor function
+func NewCategoryService(categoryRepo db.CategoryRepository, productRepo db.ProductRepository, conf *config.Config) CategoryService {
+	return &categoryService{
+		Config:       conf,
+		categoryRepo: categoryRepo,
+		productRepo:  productRepo,
+	}
+}
+
+// ListCategoryTree returns the root categories with their subcategories nested
+func (s *categoryService) ListCategoryTree() ([]models.CategoryNode, *apiError.Error) {
+	categories, err := s.categoryRepo.ListCategories()
+	if err != nil {
+		log.Printf("Error listing categories: %v", err)
+		return nil, apiError.New("unable to list categories", http.StatusInternalServerError)
+	}
+
+	children := map[uint][]models.Category{}
+	var roots []models.Category
+	for _, category := range categories {
+		if category.ParentID == nil {
+			roots = append(roots, category)
+		} else {
+			children[*category.ParentID] = append(children[*category.ParentID], category)
+		}
+	}
+
+	var build func(categories []models.Category) []models.CategoryNode
+	build = func(categories []models.Category) []models.CategoryNode {
+		nodes := make([]models.CategoryNode, 0, len(categories))
+		for _, category := range categories {
+			nodes = append(nodes, models.CategoryNode{
+				ID:       category.ID,
+				Name:     category.Name,
+				Slug:     category.Slug,
+				Children: build(children[category.ID]),
+			})
+		}
+		return nodes
+	}
+	return build(roots), nil
+}
+
+func (s *categoryService) GetCategory(categoryID uint) (*models.CategoryResponse, *apiError.Error) {
+	category, apiErr := s.findCategory(categoryID)
+	if apiErr != nil {
+		return nil, apiErr
+	}
+	return s.toCategoryResponse(category)
+}
+
+func (s *categoryService) CreateCategory(request *models.CreateCategoryRequest) (*models.CategoryResponse, *apiError.Error) {
+	slug, apiErr := s.uniqueSlug(request.Slug, request.Name, 0)
+	if apiErr != nil {
+		return nil, apiErr
+	}
+
+	category := &models.Category{
+		Name:     strings.TrimSpace(request.Name),
+		Slug:     slug,
+		ParentID: request.ParentID,
+	}
+
+	category, err := s.categoryRepo.CreateCategory(category)
+	if errors.Is(err, db.ErrParentCategoryNotFound) {
+		return nil, apiError.New("parent category not found", http.StatusBadRequest)
+	}
+	if err != nil {
+		log.Printf("Error creating category %s: %v", request.Name, err)
+		return nil, apiError.New("unable to create category", http.StatusInternalServerError)
+	}
+	return s.toCategoryResponse(category)
+}
+
+// UpdateCategory renames or moves a category. A category cannot be moved
+// below itself or one of its descendants.
+func (s *categoryService) UpdateCategory(categoryID uint, request *models.UpdateCategoryRequest) (*models.CategoryResponse, *apiError.Error) {
+	category, apiErr := s.findCategory(categoryID)
+	if apiErr != nil {
+		return nil, apiErr
+	}
+	if request.MoveToRoot && request.ParentID != nil {
+		return nil, apiError.New("set either parent_id or move_to_root", http.StatusBadRequest)
+	}
+
+	if request.Name != nil {
+		if strings.TrimSpace(*request.Name) == "" {
+			return nil, apiError.New("name cannot be empty", http.StatusBadRequest)
+		}
+		category.Name = strings.TrimSpace(*request.Name)
+	}
+	if request.Slug != nil {
+		slug, apiErr := s.uniqueSlug(*request.Slug, category.Name, category.ID)
+		if apiErr != nil {
+			return nil, apiErr
+		}
+		category.Slug = slug
+	}
+
+	// The repo checks the new parent and the cycle with both rows locked
+	move := request.MoveToRoot || request.ParentID != nil
+	if move {
+		category.ParentID = request.ParentID
+	}
+
+	if err := s.categoryRepo.UpdateCategory(category, move); err != nil {
+		switch {
+		case errors.Is(err, db.ErrParentCategoryNotFound):
+			return nil, apiError.New("parent category not found", http.StatusBadRequest)
+		case errors.Is(err, db.ErrCategoryCycle):
+			return nil, apiError.New("a category cannot be moved below itself", http.StatusBadRequest)
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			return nil, apiError.New("category not found", http.StatusNotFound)
+		}
+		log.Printf("Error updating category %d: %v", category.ID, err)
+		return nil, apiError.New("unable to update category", http.StatusInternalServerError)
+	}
+	return s.toCategoryResponse(category)
+}
+
+// DeleteCategory deletes a category. Its subcategories move up to its parent
+// and its products stay in the catalog.
+func (s *categoryService) DeleteCategory(categoryID uint) *apiError.Error {
+	if _, err := s.categoryRepo.DeleteCategory(categoryID); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return apiError.New("category not found", http.StatusNotFound)
+		}
+		log.Printf("Error deleting category %d: %v", categoryID, err)
+		return apiError.New("unable to delete category", http.StatusInternalServerError)
+	}
+	return nil
+}
+
+// SetProductCategories replaces the categories a product belongs to
+func (s *categoryService) SetProductCategories(productID uint, categoryIDs []uint) ([]models.Category, *apiError.Error) {
+	product, err := s.productRepo.FindProductByID(productID)
+	if err != nil {
+		log.Printf("Error finding product %d: %v", productID, err)
+		return nil, apiError.ErrInternalServerError
+	}
+	if product == nil {
+		return nil, apiError.New("product not found", http.StatusNotFound)
+	}
+
+	categories, err := s.categoryRepo.FindCategoriesByIDs(categoryIDs)
+	if err != nil {
+		log.Printf("Error finding categories %v: %v", categoryIDs, err)
+		return nil, apiError.ErrInternalServerError
+	}
+	found := map[uint]bool{}
+	for _, category := range categories {
+		found[category.ID] = true
+	}
+	for _, id := range categoryIDs {
+		if !found[id] {
+			return nil, apiError.New(fmt.Sprintf("category %d not found", id), http.StatusBadRequest)
+		}
+	}
+
+	if err := s.categoryRepo.SetProductCategories(product, categories); err != nil {
+		log.Printf("Error setting categories of product %d: %v", productID, err)
+		return nil, apiError.New("unable to set product categories", http.StatusInternalServerError)
+	}
+	return categories, nil
+}
+
+func (s *categoryService) findCategory(categoryID uint) (*models.Category, *apiError.Error) {
+	category, err := s.categoryRepo.FindCategoryByID(categoryID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, apiError.New("category not found", http.StatusNotFound)
+		}
+		log.Printf("Error finding category %d: %v", categoryID, err)
+		return nil, apiError.ErrInternalServerError
+	}
+	return category, nil
+}
+
+// toCategoryResponse adds the breadcrumbs, read from the ancestor IDs in the path
+func (s *categoryService) toCategoryResponse(category *models.Category) (*models.CategoryResponse, *apiError.Error) {
+	ids := categoryPathIDs(category.Path)
+	ancestors, err := s.categoryRepo.FindCategoriesByIDs(ids)
+	if err != nil {
+		log.Printf("Error finding ancestors of category %d: %v", category.ID, err)
+		return nil, apiError.ErrInternalServerError
+	}
+	byID := map[uint]models.Category{}
+	for _, ancestor := range ancestors {
+		byID[ancestor.ID] = ancestor
+	}
+	byID[category.ID] = *category
+
+	response := &models.CategoryResponse{
+		ID:          category.ID,
+		Name:        category.Name,
+		Slug:        category.Slug,
+		ParentID:    category.ParentID,
+		Breadcrumbs: make([]models.CategoryCrumb, 0, len(ids)),
+	}
+	for _, id := range ids {
+		if crumb, ok := byID[id]; ok {
+			response.Breadcrumbs = append(response.Breadcrumbs, models.CategoryCrumb{ID: crumb.ID, Name: crumb.Name, Slug: crumb.Slug})
+		}
+	}
+	return response, nil
+}
+
+// uniqueSlug normalizes the requested slug, or derives one from the name,
+// and rejects it if another category uses it
+func (s *categoryService) uniqueSlug(slug string, name string, categoryID uint) (string, *apiError.Error) {
+	if strings.TrimSpace(slug) == "" {
+		slug = name
+	}
+	slug = slugify(slug)
+	if slug == "" {
+		return "", apiError.New("slug must contain letters or digits", http.StatusBadRequest)
+	}
+
+	taken, err := s.categoryRepo.IsSlugTaken(slug, categoryID)
+	if err != nil {
+		log.Printf("Error checking category slug %s: %v", slug, err)
+		return "", apiError.ErrInternalServerError
+	}
+	if taken {
+		return "", apiError.New(fmt.Sprintf("slug %s is already in use", slug), http.StatusConflict)
+	}
+	return slug, nil
+}
+
+var nonSlugChars = regexp.MustCompile(`[^a-z0-9]+`)
+
+func slugify(value string) string {
+	return strings.Trim(nonSlugChars.ReplaceAllString(strings.ToLower(value), "-"), "-")
+}
+
+// categoryPathIDs parses a path like "/1/4/9/" into its IDs, root first
+func categoryPathIDs(path string) []uint {
+	var ids []uint
+	for _, part := range strings.Split(strings.Trim(path, "/"), "/") {
+		if id, err := strconv.ParseUint(part, 10, 32); err == nil {
+			ids = append(ids, uint(id))
+		}
+	}
+	return ids
+}
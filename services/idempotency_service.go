@@ -0,0 +1,92 @@
+package services
+
+import (
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/techagentng/ecommerce-api/config"
+	"github.com/techagentng/ecommerce-api/db"
+	apiError "github.com/techagentng/ecommerce-api/errors"
+	"github.com/techagentng/ecommerce-api/models"
+)
+
+// IdempotencyService lets a request made with an Idempotency-Key run once per
+// user and key. BeginRequest returns the key's record: while its StatusCode is
+// zero the caller holds the key and must finish with CompleteRequest or
+// ReleaseRequest; otherwise the record holds the response to replay.
+type IdempotencyService interface {
+	BeginRequest(userID uint, key string, requestHash string) (*models.IdempotencyKey, *apiError.Error)
+	CompleteRequest(record *models.IdempotencyKey, statusCode int, contentType string, body []byte)
+	ReleaseRequest(record *models.IdempotencyKey)
+	PurgeExpiredKeys() error
+}
+
+type idempotencyService struct {
+	Config          *config.Config
+	idempotencyRepo db.IdempotencyRepository
+}
+
+// NewIdempotencyService constructor function
+func NewIdempotencyService(idempotencyRepo db.IdempotencyRepository, conf *config.Config) IdempotencyService {
+	return &idempotencyService{
+		Config:          conf,
+		idempotencyRepo: idempotencyRepo,
+	}
+}
+
+// BeginRequest claims the key for a request, or returns the response stored
+// for it. A key reused with a different request is rejected with 422, and one
+// whose request is still in flight with 409.
+func (i *idempotencyService) BeginRequest(userID uint, key string, requestHash string) (*models.IdempotencyKey, *apiError.Error) {
+	now := time.Now()
+	record := &models.IdempotencyKey{
+		UserID:      userID,
+		Key:         key,
+		RequestHash: requestHash,
+		LockedUntil: now.Add(i.Config.IdempotencyLockTimeout).Unix(),
+		ExpiresAt:   now.Add(i.Config.IdempotencyKeyTTL).Unix(),
+		CreatedAt:   now.Unix(),
+	}
+	existing, err := i.idempotencyRepo.AcquireIdempotencyKey(record, now.Unix())
+	if err != nil {
+		log.Printf("Error acquiring idempotency key for user %d: %v", userID, err)
+		return nil, apiError.ErrInternalServerError
+	}
+	if existing == nil {
+		return record, nil
+	}
+	if existing.RequestHash != requestHash {
+		return nil, apiError.New("the Idempotency-Key was already used with a different request", http.StatusUnprocessableEntity)
+	}
+	if existing.StatusCode == 0 {
+		return nil, apiError.New("a request with this Idempotency-Key is still being processed, retry later", http.StatusConflict)
+	}
+	return existing, nil
+}
+
+// CompleteRequest stores the response of a held key. A failure is only
+// logged: the response was already sent, and the key's lock passes so a
+// retry runs again.
+func (i *idempotencyService) CompleteRequest(record *models.IdempotencyKey, statusCode int, contentType string, body []byte) {
+	record.StatusCode = statusCode
+	record.ContentType = contentType
+	record.ResponseBody = body
+	if err := i.idempotencyRepo.SaveIdempotentResponse(record); err != nil {
+		log.Printf("Error saving idempotent response for user %d: %v", record.UserID, err)
+	}
+}
+
+// ReleaseRequest gives up a held key without storing a response, so the
+// request can be retried, e.g. after a server error
+func (i *idempotencyService) ReleaseRequest(record *models.IdempotencyKey) {
+	if err := i.idempotencyRepo.ReleaseIdempotencyKey(record); err != nil {
+		log.Printf("Error releasing idempotency key for user %d: %v", record.UserID, err)
+	}
+}
+
+// PurgeExpiredKeys deletes the keys that can no longer be replayed
+func (i *idempotencyService) PurgeExpiredKeys() error {
+	_, err := i.idempotencyRepo.DeleteExpiredIdempotencyKeys(time.Now().Unix())
+	return err
+}
@@ -0,0 +1,161 @@
+// Package imaging decodes, orients, resizes and re-encodes uploaded images
+// using only the standard library decoders (JPEG, PNG and GIF).
+package imaging
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/draw"
+	_ "image/gif"
+	"image/jpeg"
+	"image/png"
+	"io"
+)
+
+// JPEGQuality is the quality opaque images are re-encoded with
+const JPEGQuality = 85
+
+var (
+	// ErrUnsupportedFormat is returned for data that is not a JPEG, PNG or GIF image
+	ErrUnsupportedFormat = errors.New("unsupported image format")
+	// ErrTooManyPixels is returned before decoding images larger than allowed
+	ErrTooManyPixels = errors.New("image dimensions are too large")
+)
+
+// Decode decodes an image and applies its EXIF orientation, so the result is
+// upright and carries no metadata. Images with more than maxPixels pixels are
+// rejected from their header, before any pixel data is allocated.
+func Decode(data []byte, maxPixels int) (*image.RGBA, error) {
+	config, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		if errors.Is(err, image.ErrFormat) {
+			return nil, ErrUnsupportedFormat
+		}
+		return nil, err
+	}
+	if config.Width <= 0 || config.Height <= 0 {
+		return nil, ErrUnsupportedFormat
+	}
+	if config.Width*config.Height > maxPixels || config.Width > maxPixels || config.Height > maxPixels {
+		return nil, ErrTooManyPixels
+	}
+
+	src, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	bounds := src.Bounds()
+	rgba := image.NewRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	draw.Draw(rgba, rgba.Bounds(), src, bounds.Min, draw.Src)
+
+	if format == "jpeg" {
+		rgba = orient(rgba, exifOrientation(data))
+	}
+	return rgba, nil
+}
+
+// Fit scales an image down so neither side exceeds maxSize, keeping its
+// aspect ratio. Smaller images are returned unchanged.
+func Fit(src *image.RGBA, maxSize int) *image.RGBA {
+	w, h := src.Bounds().Dx(), src.Bounds().Dy()
+	if w <= maxSize && h <= maxSize {
+		return src
+	}
+	dw, dh := maxSize, maxSize
+	if w > h {
+		dh = max(1, h*maxSize/w)
+	} else {
+		dw = max(1, w*maxSize/h)
+	}
+	return resize(src, dw, dh)
+}
+
+// Encode writes an opaque image as JPEG and an image with transparency as
+// PNG, returning the content type written
+func Encode(w io.Writer, img *image.RGBA) (string, error) {
+	if img.Opaque() {
+		return "image/jpeg", jpeg.Encode(w, img, &jpeg.Options{Quality: JPEGQuality})
+	}
+	encoder := png.Encoder{CompressionLevel: png.BestCompression}
+	return "image/png", encoder.Encode(w, img)
+}
+
+// resize scales src to dw x dh with a box filter: every destination pixel is
+// the coverage weighted average of the source pixels under it. Filtering in
+// two separable passes keeps it O(pixels).
+func resize(src *image.RGBA, dw int, dh int) *image.RGBA {
+	sw, sh := src.Bounds().Dx(), src.Bounds().Dy()
+
+	// Horizontal pass: sw x sh -> dw x sh
+	horizontal := make([]float64, dw*sh*4)
+	xWeights := boxWeights(sw, dw)
+	for y := 0; y < sh; y++ {
+		row := src.Pix[y*src.Stride:]
+		for x, weights := range xWeights {
+			var acc [4]float64
+			for _, wt := range weights {
+				p := row[wt.index*4:]
+				acc[0] += float64(p[0]) * wt.weight
+				acc[1] += float64(p[1]) * wt.weight
+				acc[2] += float64(p[2]) * wt.weight
+				acc[3] += float64(p[3]) * wt.weight
+			}
+			copy(horizontal[(y*dw+x)*4:], acc[:])
+		}
+	}
+
+	// Vertical pass: dw x sh -> dw x dh
+	dst := image.NewRGBA(image.Rect(0, 0, dw, dh))
+	yWeights := boxWeights(sh, dh)
+	for y, weights := range yWeights {
+		for x := 0; x < dw; x++ {
+			var acc [4]float64
+			for _, wt := range weights {
+				p := horizontal[(wt.index*dw+x)*4:]
+				acc[0] += p[0] * wt.weight
+				acc[1] += p[1] * wt.weight
+				acc[2] += p[2] * wt.weight
+				acc[3] += p[3] * wt.weight
+			}
+			d := dst.Pix[y*dst.Stride+x*4:]
+			for i := range acc {
+				d[i] = clamp(acc[i])
+			}
+		}
+	}
+	return dst
+}
+
+type boxWeight struct {
+	index  int
+	weight float64
+}
+
+// boxWeights returns, for every destination pixel, the source pixels it
+// covers and the normalised share of each
+func boxWeights(srcSize int, dstSize int) [][]boxWeight {
+	scale := float64(srcSize) / float64(dstSize)
+	weights := make([][]boxWeight, dstSize)
+	for d := range weights {
+		start, end := float64(d)*scale, float64(d+1)*scale
+		for s := int(start); s < srcSize && float64(s) < end; s++ {
+			coverage := min(end, float64(s+1)) - max(start, float64(s))
+			if coverage > 0 {
+				weights[d] = append(weights[d], boxWeight{index: s, weight: coverage / scale})
+			}
+		}
+	}
+	return weights
+}
+
+func clamp(v float64) uint8 {
+	v += 0.5
+	if v < 0 {
+		return 0
+	}
+	if v > 255 {
+		return 255
+	}
+	return uint8(v)
+}
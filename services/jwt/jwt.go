@@ -1,36 +1,43 @@
 package jwt
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
 	"github.com/golang-jwt/jwt"
+	"github.com/google/uuid"
 	"github.com/techagentng/ecommerce-api/errors"
 	"net/http"
+	"strconv"
 	"time"
 )
 
 const AccessTokenValidity = time.Hour * 24 * 7
 const RefreshTokenValidity = time.Hour * 24 * 30
+const EmailVerificationTokenValidity = time.Hour * 24
+const MFAChallengeTokenValidity = time.Minute * 5
+
+// Values of the "type" claim
+const (
+	AccessTokenType  = "access_token"
+	RefreshTokenType = "refresh_token"
+	// EmailVerificationTokenType tokens are only accepted by /auth/verify
+	EmailVerificationTokenType = "email_verification"
+	// MFAChallengeTokenType tokens are only accepted by /auth/mfa/verify
+	MFAChallengeTokenType = "mfa_challenge"
+)
 
 // verifyAccessToken verifies a token
-func verifyToken(tokenString string, secret string) (*jwt.Token, error) {
-	return jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, fmt.Errorf("Unexpected signing method: %v", token.Header["alg"])
-		}
-		return []byte(secret), nil
-	})
-}
-
-func isJWTSecretEmpty(secret string) bool {
-	return secret == ""
+func verifyToken(tokenString string, keys *Keyring) (*jwt.Token, error) {
+	return jwt.Parse(tokenString, keys.keyFunc)
 }
 
 func isAccessTokenEmpty(token string) bool {
 	return token == ""
 }
 
-func ValidateToken(token string, secret string) (*jwt.Token, error) {
-	tk, err := verifyToken(token, secret)
+func ValidateToken(token string, keys *Keyring) (*jwt.Token, error) {
+	tk, err := verifyToken(token, keys)
 	if err != nil { // TODO: remove
 		return nil, fmt.Errorf("invalid token1: %v", err) // TODO: probably need to errors.NEw
 	}
@@ -48,11 +55,32 @@ func getClaims(token *jwt.Token) (jwt.MapClaims, error) {
 	return claims, claims.Valid()
 }
 
-func ValidateAndGetClaims(tokenString string, secret string) (jwt.MapClaims, error) {
+// verifyStandardClaims checks the registered claims every token we issue carries
+func verifyStandardClaims(claims jwt.MapClaims, keys *Keyring) error {
+	if !claims.VerifyIssuer(keys.Issuer, true) {
+		return fmt.Errorf("unexpected issuer")
+	}
+	if !claims.VerifyAudience(keys.Audience, true) {
+		return fmt.Errorf("unexpected audience")
+	}
+	if _, ok := claims["iat"].(float64); !ok {
+		return fmt.Errorf("missing iat claim")
+	}
+	for _, name := range []string{"jti", "sub"} {
+		if value, _ := claims[name].(string); value == "" {
+			return fmt.Errorf("missing %s claim", name)
+		}
+	}
+	return nil
+}
+
+// ValidateAndGetClaims verifies the token's signature with the keyring and
+// checks its exp, iat, iss, aud, jti and sub claims
+func ValidateAndGetClaims(tokenString string, keys *Keyring) (jwt.MapClaims, error) {
 	if tokenString == "" {
 		return nil, errors.New("invalid token (token is empty)", http.StatusUnauthorized)
 	}
-	token, err := ValidateToken(tokenString, secret)
+	token, err := ValidateToken(tokenString, keys)
 	if err != nil {
 		return nil, fmt.Errorf("failed to validate token: %v", err)
 	}
@@ -60,35 +88,57 @@ func ValidateAndGetClaims(tokenString string, secret string) (jwt.MapClaims, err
 	if err != nil {
 		return nil, fmt.Errorf("failed to get claims: %v", err)
 	}
+	if err := verifyStandardClaims(claims, keys); err != nil {
+		return nil, fmt.Errorf("failed to validate claims: %v", err)
+	}
 	return claims, nil
 }
 
+// standardClaims returns the registered claims for a token about user id that
+// is valid for validity. tokenID becomes the jti, a random one is generated if
+// it is empty.
+func standardClaims(keys *Keyring, id uint, validity time.Duration, tokenID string) jwt.MapClaims {
+	if tokenID == "" {
+		tokenID = uuid.New().String()
+	}
+	now := time.Now()
+	return jwt.MapClaims{
+		"iss": keys.Issuer,
+		"aud": keys.Audience,
+		"sub": strconv.FormatUint(uint64(id), 10),
+		"iat": now.Unix(),
+		"exp": now.Add(validity).Unix(),
+		"jti": tokenID,
+	}
+}
+
 // GenerateToken generates only an access token
-func GenerateToken(email string, secret string, isAdmin bool, id uint, roleName string) (string, error) {
-	if secret == "" {
-		// Return a descriptive error message for missing secret
-		return "", errors.New("secret key is required", errors.ErrBadRequest.Status)
+func GenerateToken(email string, keys *Keyring, isAdmin bool, id uint, roleName string, tokenVersion int) (string, error) {
+	if keys == nil {
+		// Return a descriptive error message for missing keys
+		return "", errors.New("signing keys are required", errors.ErrBadRequest.Status)
 	}
 
 	// Generate claims with the role name
-	claims := GenerateClaims(email, isAdmin, id, roleName)
+	claims := GenerateClaims(keys, email, isAdmin, id, roleName, tokenVersion)
 
 	// Create and sign the token
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	tokenString, err := token.SignedString([]byte(secret))
+	tokenString, err := keys.Sign(claims)
 	if err != nil {
 		return "", err
 	}
 	return tokenString, nil
 }
 
-func GenerateTokenPair(email string, secret string, isAdmin bool, id uint, roleName string) (accessToken string, refreshToken string, err error) {
-	accessToken, err = GenerateToken(email, secret, isAdmin, id, roleName)
+// GenerateTokenPair generates an access token and a refresh token identified by
+// tokenID that belongs to the given token family
+func GenerateTokenPair(email string, keys *Keyring, isAdmin bool, id uint, roleName string, tokenVersion int, tokenID string, familyID string) (accessToken string, refreshToken string, err error) {
+	accessToken, err = GenerateToken(email, keys, isAdmin, id, roleName, tokenVersion)
 	if err != nil {
 		return "", "", err
 	}
 
-	refreshToken, err = GenerateRefreshToken(email, secret, isAdmin, id, roleName)
+	refreshToken, err = GenerateRefreshToken(email, keys, isAdmin, id, roleName, tokenVersion, tokenID, familyID)
 	if err != nil {
 		return "", "", err
 	}
@@ -96,39 +146,94 @@ func GenerateTokenPair(email string, secret string, isAdmin bool, id uint, roleN
 	return accessToken, refreshToken, nil
 }
 
-func GenerateRefreshToken(email string, secret string, isAdmin bool, id uint, roleName string) (string, error) {
-	if secret == "" {
-		return "", errors.New("secret key is required", errors.ErrInternalServerError.Status)
+func GenerateRefreshToken(email string, keys *Keyring, isAdmin bool, id uint, roleName string, tokenVersion int, tokenID string, familyID string) (string, error) {
+	if keys == nil {
+		return "", errors.New("signing keys are required", errors.ErrInternalServerError.Status)
 	}
 
 	// Create claims with role information if needed
-	refreshTokenClaims := jwt.MapClaims{
-		"email":    email,
-		"exp":      time.Now().Add(RefreshTokenValidity).Unix(),
-		"is_admin": isAdmin,
-		"id":       id,
-		"role":     roleName, // Include roleName if applicable
-		"type":     "refresh_token",
+	refreshTokenClaims := standardClaims(keys, id, RefreshTokenValidity, tokenID)
+	refreshTokenClaims["email"] = email
+	refreshTokenClaims["is_admin"] = isAdmin
+	refreshTokenClaims["id"] = id
+	refreshTokenClaims["role"] = roleName // Include roleName if applicable
+	refreshTokenClaims["type"] = RefreshTokenType
+	refreshTokenClaims["family"] = familyID
+	refreshTokenClaims["ver"] = tokenVersion
+
+	// Sign and get the complete encoded token as a string using the active key
+	return keys.Sign(refreshTokenClaims)
+}
+
+func GenerateClaims(keys *Keyring, email string, isAdmin bool, id uint, roleName string, tokenVersion int) jwt.MapClaims {
+	accessClaims := standardClaims(keys, id, AccessTokenValidity, "")
+	accessClaims["email"] = email
+	accessClaims["is_admin"] = isAdmin
+	accessClaims["id"] = id
+	accessClaims["role"] = roleName
+	accessClaims["type"] = AccessTokenType
+	accessClaims["ver"] = tokenVersion
+	return accessClaims
+}
+
+// GenerateEmailVerificationToken generates a token proving ownership of email.
+// It is bound to the address so changing the email invalidates it.
+func GenerateEmailVerificationToken(email string, keys *Keyring, id uint) (string, error) {
+	if keys == nil {
+		return "", errors.New("signing keys are required", errors.ErrInternalServerError.Status)
 	}
 
-	refreshToken := jwt.NewWithClaims(jwt.SigningMethodHS256, refreshTokenClaims)
+	claims := standardClaims(keys, id, EmailVerificationTokenValidity, "")
+	claims["email"] = email
+	claims["id"] = id
+	claims["type"] = EmailVerificationTokenType
+	return keys.Sign(claims)
+}
 
-	// Sign and get the complete encoded token as a string using the secret
-	refreshTokenString, err := refreshToken.SignedString([]byte(secret))
-	if err != nil {
-		return "", err
+// GenerateMFAChallengeToken generates a short-lived token proving the user
+// passed the password step of a login that still needs a second factor
+func GenerateMFAChallengeToken(keys *Keyring, id uint, tokenVersion int) (string, error) {
+	if keys == nil {
+		return "", errors.New("signing keys are required", errors.ErrInternalServerError.Status)
 	}
 
-	return refreshTokenString, nil
+	claims := standardClaims(keys, id, MFAChallengeTokenValidity, "")
+	claims["id"] = id
+	claims["type"] = MFAChallengeTokenType
+	claims["ver"] = tokenVersion
+	return keys.Sign(claims)
 }
 
-func GenerateClaims(email string, isAdmin bool, id uint, roleName string) jwt.MapClaims {
-	accessClaims := jwt.MapClaims{
-		"email":    email,
-		"exp":      time.Now().Add(AccessTokenValidity).Unix(),
-		"is_admin": isAdmin,
-		"id":       id,
-		"role":     roleName,
+// TokenType returns the "type" claim. Tokens issued before the claim existed
+// are access tokens.
+func TokenType(claims jwt.MapClaims) string {
+	tokenType, ok := claims["type"].(string)
+	if !ok || tokenType == "" {
+		return AccessTokenType
 	}
-	return accessClaims
+	return tokenType
+}
+
+// TokenVersion returns the "ver" claim, which must match User.TokenVersion for
+// the token to be accepted. Tokens issued before the claim existed are version 0.
+func TokenVersion(claims jwt.MapClaims) int {
+	version, _ := claims["ver"].(float64)
+	return int(version)
+}
+
+// TokenKey returns the key a token is blacklisted under: its "jti" claim, or
+// the hex SHA-256 of the token for tokens issued without one. The raw token is
+// never stored.
+func TokenKey(tokenString string, claims jwt.MapClaims) string {
+	if tokenID, ok := claims["jti"].(string); ok && tokenID != "" {
+		return tokenID
+	}
+	sum := sha256.Sum256([]byte(tokenString))
+	return hex.EncodeToString(sum[:])
+}
+
+// ExpiresAt returns the "exp" claim as a unix timestamp
+func ExpiresAt(claims jwt.MapClaims) int64 {
+	exp, _ := claims["exp"].(float64)
+	return int64(exp)
 }
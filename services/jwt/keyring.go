@@ -0,0 +1,280 @@
+package jwt
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"sort"
+
+	"github.com/golang-jwt/jwt"
+	"github.com/techagentng/ecommerce-api/config"
+)
+
+// Signing methods accepted in Config.JWTSigningMethod
+const (
+	SigningMethodHS256 = "HS256"
+	SigningMethodRS256 = "RS256"
+	SigningMethodEdDSA = "EdDSA"
+)
+
+// verificationKey is a public key tokens may be verified with
+type verificationKey struct {
+	kid    string
+	method jwt.SigningMethod
+	key    crypto.PublicKey
+}
+
+// Keyring signs tokens with a single active key and verifies them with any of
+// its verification keys, selected by the "kid" header. Keeping the previous
+// public key in the keyring after a rotation keeps its tokens valid until
+// they expire.
+//
+// In HS256 mode tokens are signed and verified with Config.JWTSecret. In
+// asymmetric mode a configured JWTSecret is still accepted for verifying
+// HS256 tokens so sessions survive the switch.
+type Keyring struct {
+	Issuer   string
+	Audience string
+
+	method     jwt.SigningMethod
+	kid        string
+	signingKey interface{}
+	secret     []byte
+	keys       map[string]verificationKey
+}
+
+// NewHMACKeyring returns a keyring that signs and verifies with a shared secret
+func NewHMACKeyring(secret string, issuer string, audience string) (*Keyring, error) {
+	if secret == "" {
+		return nil, fmt.Errorf("jwt secret is required for %s signing", SigningMethodHS256)
+	}
+	return &Keyring{
+		Issuer:     issuer,
+		Audience:   audience,
+		method:     jwt.SigningMethodHS256,
+		signingKey: []byte(secret),
+		secret:     []byte(secret),
+		keys:       map[string]verificationKey{},
+	}, nil
+}
+
+// LoadKeyring builds the keyring described by the config. For RS256 and EdDSA
+// the active key is read from Config.JWTPrivateKeyFile and further
+// verification keys from Config.JWTPublicKeyFiles.
+func LoadKeyring(conf *config.Config) (*Keyring, error) {
+	switch conf.JWTSigningMethod {
+	case "", SigningMethodHS256:
+		return NewHMACKeyring(conf.JWTSecret, conf.JWTIssuer, conf.JWTAudience)
+	case SigningMethodRS256, SigningMethodEdDSA:
+	default:
+		return nil, fmt.Errorf("unsupported jwt signing method %q", conf.JWTSigningMethod)
+	}
+
+	if conf.JWTPrivateKeyFile == "" {
+		return nil, fmt.Errorf("jwt private key file is required for %s signing", conf.JWTSigningMethod)
+	}
+	privateKey, err := readPEMKey(conf.JWTPrivateKeyFile)
+	if err != nil {
+		return nil, err
+	}
+	signer, ok := privateKey.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("%s does not contain a private key", conf.JWTPrivateKeyFile)
+	}
+
+	keyring := &Keyring{
+		Issuer:     conf.JWTIssuer,
+		Audience:   conf.JWTAudience,
+		signingKey: privateKey,
+		keys:       map[string]verificationKey{},
+	}
+	if conf.JWTSecret != "" {
+		keyring.secret = []byte(conf.JWTSecret)
+	}
+
+	active, err := keyring.addVerificationKey(signer.Public())
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", conf.JWTPrivateKeyFile, err)
+	}
+	if active.method.Alg() != conf.JWTSigningMethod {
+		return nil, fmt.Errorf("%s holds a %s key but the signing method is %s", conf.JWTPrivateKeyFile, active.method.Alg(), conf.JWTSigningMethod)
+	}
+	keyring.method = active.method
+	keyring.kid = active.kid
+
+	for _, file := range conf.JWTPublicKeyFiles {
+		key, err := readPEMKey(file)
+		if err != nil {
+			return nil, err
+		}
+		if signer, ok := key.(crypto.Signer); ok {
+			key = signer.Public()
+		}
+		if _, err := keyring.addVerificationKey(key); err != nil {
+			return nil, fmt.Errorf("%s: %v", file, err)
+		}
+	}
+	return keyring, nil
+}
+
+// KeyID returns the "kid" of the active signing key, empty in HS256 mode
+func (k *Keyring) KeyID() string {
+	return k.kid
+}
+
+// Sign signs the claims with the active key
+func (k *Keyring) Sign(claims jwt.MapClaims) (string, error) {
+	token := jwt.NewWithClaims(k.method, claims)
+	if k.kid != "" {
+		token.Header["kid"] = k.kid
+	}
+	return token.SignedString(k.signingKey)
+}
+
+// keyFunc selects the verification key for a token from its alg and kid headers
+func (k *Keyring) keyFunc(token *jwt.Token) (interface{}, error) {
+	if _, ok := token.Method.(*jwt.SigningMethodHMAC); ok {
+		if k.secret == nil || token.Method != jwt.SigningMethodHS256 {
+			return nil, fmt.Errorf("Unexpected signing method: %v", token.Header["alg"])
+		}
+		return k.secret, nil
+	}
+
+	kid, _ := token.Header["kid"].(string)
+	key, ok := k.keys[kid]
+	if !ok {
+		return nil, fmt.Errorf("unknown signing key %q", kid)
+	}
+	if token.Method.Alg() != key.method.Alg() {
+		return nil, fmt.Errorf("Unexpected signing method: %v", token.Header["alg"])
+	}
+	return key.key, nil
+}
+
+// JWK is a public key in JSON Web Key format (RFC 7517)
+type JWK struct {
+	Kty string `json:"kty"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+}
+
+// JWKS is a JSON Web Key Set
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+// JWKS returns the public verification keys. The shared secret is never
+// published, so it is empty in HS256 mode.
+func (k *Keyring) JWKS() JWKS {
+	set := JWKS{Keys: make([]JWK, 0, len(k.keys))}
+	for _, key := range k.keys {
+		jwk, _ := toJWK(key.key)
+		jwk.Use = "sig"
+		jwk.Alg = key.method.Alg()
+		jwk.Kid = key.kid
+		set.Keys = append(set.Keys, jwk)
+	}
+	sort.Slice(set.Keys, func(i, j int) bool { return set.Keys[i].Kid < set.Keys[j].Kid })
+	return set
+}
+
+func (k *Keyring) addVerificationKey(publicKey crypto.PublicKey) (verificationKey, error) {
+	var method jwt.SigningMethod
+	switch publicKey.(type) {
+	case *rsa.PublicKey:
+		method = jwt.SigningMethodRS256
+	case ed25519.PublicKey:
+		method = jwt.SigningMethodEdDSA
+	default:
+		return verificationKey{}, fmt.Errorf("unsupported key type %T", publicKey)
+	}
+
+	jwk, err := toJWK(publicKey)
+	if err != nil {
+		return verificationKey{}, err
+	}
+	key := verificationKey{kid: thumbprint(jwk), method: method, key: publicKey}
+	k.keys[key.kid] = key
+	return key, nil
+}
+
+// toJWK returns the key material members of a JWK
+func toJWK(publicKey crypto.PublicKey) (JWK, error) {
+	switch key := publicKey.(type) {
+	case *rsa.PublicKey:
+		return JWK{
+			Kty: "RSA",
+			N:   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		}, nil
+	case ed25519.PublicKey:
+		return JWK{
+			Kty: "OKP",
+			Crv: "Ed25519",
+			X:   base64.RawURLEncoding.EncodeToString(key),
+		}, nil
+	}
+	return JWK{}, fmt.Errorf("unsupported key type %T", publicKey)
+}
+
+// thumbprint computes the RFC 7638 thumbprint of a key, used as its kid so the
+// same key always gets the same kid
+func thumbprint(jwk JWK) string {
+	var members interface{}
+	if jwk.Kty == "RSA" {
+		// Field order is significant: the required members, sorted
+		members = struct {
+			E   string `json:"e"`
+			Kty string `json:"kty"`
+			N   string `json:"n"`
+		}{jwk.E, jwk.Kty, jwk.N}
+	} else {
+		members = struct {
+			Crv string `json:"crv"`
+			Kty string `json:"kty"`
+			X   string `json:"x"`
+		}{jwk.Crv, jwk.Kty, jwk.X}
+	}
+	encoded, _ := json.Marshal(members)
+	sum := sha256.Sum256(encoded)
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// readPEMKey reads a PKCS#8, PKCS#1 or PKIX encoded key from a PEM file
+func readPEMKey(file string) (interface{}, error) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read key: %v", err)
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("%s is not PEM encoded", file)
+	}
+
+	if key, err := x509.ParsePKCS8PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	if key, err := x509.ParsePKIXPublicKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	if key, err := x509.ParsePKCS1PublicKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	return nil, fmt.Errorf("%s does not contain a supported RSA or Ed25519 key", file)
+}
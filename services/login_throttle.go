@@ -0,0 +1,128 @@
+package services
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/techagentng/ecommerce-api/config"
+	"github.com/techagentng/ecommerce-api/db"
+	apiError "github.com/techagentng/ecommerce-api/errors"
+)
+
+// LoginThrottle counts failed logins per account and per client IP. Once the
+// failures in Config.LoginFailureWindow reach the limit the account (423) or IP
+// (429) is locked, with the lockout doubling on each further failure up to
+// Config.LoginLockoutMax.
+type LoginThrottle struct {
+	Config *config.Config
+	store  db.LoginAttemptStore
+}
+
+func NewLoginThrottle(store db.LoginAttemptStore, conf *config.Config) *LoginThrottle {
+	return &LoginThrottle{
+		Config: conf,
+		store:  store,
+	}
+}
+
+func accountKey(email string) string {
+	return "account:" + strings.ToLower(strings.TrimSpace(email))
+}
+
+func ipKey(ip string) string {
+	return "ip:" + ip
+}
+
+// Check returns an error if the account or client IP is currently locked out
+func (t *LoginThrottle) Check(email string, ip string) *apiError.Error {
+	now := time.Now()
+	if locked, err := t.lockedUntil(accountKey(email), now); err != nil {
+		return err
+	} else if !locked.IsZero() {
+		return apiError.New(fmt.Sprintf("account is temporarily locked after too many failed logins, try again in %s", retryIn(now, locked)), http.StatusLocked)
+	}
+	if ip == "" {
+		return nil
+	}
+	if locked, err := t.lockedUntil(ipKey(ip), now); err != nil {
+		return err
+	} else if !locked.IsZero() {
+		return apiError.New(fmt.Sprintf("too many failed logins, try again in %s", retryIn(now, locked)), http.StatusTooManyRequests)
+	}
+	return nil
+}
+
+// RecordFailure counts a failed login for the account and client IP
+func (t *LoginThrottle) RecordFailure(email string, ip string) {
+	t.recordFailure(accountKey(email), t.Config.LoginMaxFailures)
+	if ip != "" {
+		t.recordFailure(ipKey(ip), t.Config.LoginIPMaxFailures)
+	}
+}
+
+// RecordSuccess clears the account's failed logins. The IP counter is left to
+// expire since other accounts may be guessed from the same address.
+func (t *LoginThrottle) RecordSuccess(email string) {
+	if err := t.store.DeleteLoginAttempt(accountKey(email)); err != nil {
+		log.Printf("Error clearing login attempts for %s: %v", email, err)
+	}
+}
+
+// Unlock removes an account lockout
+func (t *LoginThrottle) Unlock(email string) error {
+	return t.store.DeleteLoginAttempt(accountKey(email))
+}
+
+// PurgeExpired deletes records whose window and lockout have both passed
+func (t *LoginThrottle) PurgeExpired() (int64, error) {
+	return t.store.DeleteExpiredLoginAttempts(time.Now().Unix())
+}
+
+func (t *LoginThrottle) lockedUntil(key string, now time.Time) (time.Time, *apiError.Error) {
+	attempt, err := t.store.GetLoginAttempt(key)
+	if err != nil {
+		log.Printf("Error reading login attempts for %s: %v", key, err)
+		return time.Time{}, apiError.ErrInternalServerError
+	}
+	if attempt == nil || attempt.LockedUntil <= now.Unix() {
+		return time.Time{}, nil
+	}
+	return time.Unix(attempt.LockedUntil, 0), nil
+}
+
+func (t *LoginThrottle) recordFailure(key string, maxFailures int) {
+	now := time.Now()
+	// Failures older than the window no longer count
+	windowStart := now.Add(-t.Config.LoginFailureWindow)
+	attempt, err := t.store.IncrementLoginFailures(key, now.Unix(), windowStart.Unix(), now.Add(t.Config.LoginFailureWindow).Unix())
+	if err != nil {
+		log.Printf("Error recording failed login for %s: %v", key, err)
+		return
+	}
+	if maxFailures <= 0 || attempt.Failures < maxFailures {
+		return
+	}
+
+	lockout := t.lockoutDuration(attempt.Failures - maxFailures)
+	log.Printf("Locking %s for %s after %d failed logins", key, lockout, attempt.Failures)
+	if err := t.store.LockLoginAttempt(key, now.Add(lockout).Unix()); err != nil {
+		log.Printf("Error locking %s: %v", key, err)
+	}
+}
+
+// lockoutDuration is LoginLockoutBase doubled for every failure past the limit
+func (t *LoginThrottle) lockoutDuration(excess int) time.Duration {
+	lockout := float64(t.Config.LoginLockoutBase) * math.Pow(2, float64(excess))
+	if lockout > float64(t.Config.LoginLockoutMax) {
+		return t.Config.LoginLockoutMax
+	}
+	return time.Duration(lockout)
+}
+
+func retryIn(now time.Time, until time.Time) string {
+	return until.Sub(now).Round(time.Second).String()
+}
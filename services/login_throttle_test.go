@@ -0,0 +1,66 @@
+package services
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/techagentng/ecommerce-api/config"
+	"github.com/techagentng/ecommerce-api/db"
+)
+
+func TestRecordFailureCountsConcurrentFailures(t *testing.T) {
+	store := db.NewMemoryLoginAttemptStore()
+	throttle := NewLoginThrottle(store, &config.Config{
+		LoginMaxFailures:   5,
+		LoginFailureWindow: 15 * time.Minute,
+		LoginLockoutBase:   time.Minute,
+		LoginLockoutMax:    time.Hour,
+	})
+
+	const failures = 50
+	var wg sync.WaitGroup
+	for i := 0; i < failures; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			throttle.RecordFailure("jane@example.com", "")
+		}()
+	}
+	wg.Wait()
+
+	attempt, err := store.GetLoginAttempt(accountKey("jane@example.com"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if attempt.Failures != failures {
+		t.Errorf("got %d failures, want %d", attempt.Failures, failures)
+	}
+	if apiErr := throttle.Check("jane@example.com", ""); apiErr == nil {
+		t.Error("account is not locked after too many failures")
+	}
+}
+
+func TestRecordFailureRestartsCountAfterWindow(t *testing.T) {
+	store := db.NewMemoryLoginAttemptStore()
+	now := time.Now()
+	key := accountKey("jane@example.com")
+	old := now.Add(-time.Hour).Unix()
+	if _, err := store.IncrementLoginFailures(key, old, old, old); err != nil {
+		t.Fatal(err)
+	}
+
+	throttle := NewLoginThrottle(store, &config.Config{
+		LoginMaxFailures:   5,
+		LoginFailureWindow: 15 * time.Minute,
+	})
+	throttle.RecordFailure("jane@example.com", "")
+
+	attempt, err := store.GetLoginAttempt(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if attempt.Failures != 1 {
+		t.Errorf("got %d failures, want the count to restart at 1", attempt.Failures)
+	}
+}
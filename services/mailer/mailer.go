@@ -0,0 +1,35 @@
+package mailer
+
+import (
+	"fmt"
+
+	"github.com/techagentng/ecommerce-api/config"
+)
+
+// Message is a plain text email
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Mailer delivers emails to users
+type Mailer interface {
+	Send(msg Message) error
+}
+
+// New returns the Mailer selected by Config.MailerDriver. SMTP is the default;
+// "file" writes messages to Config.MailDir and "memory" keeps them in memory
+// for local development.
+func New(conf *config.Config) (Mailer, error) {
+	switch conf.MailerDriver {
+	case "", "smtp":
+		return NewSMTPMailer(conf.SMTPHost, conf.SMTPPort, conf.SMTPUsername, conf.SMTPPassword, conf.MailFrom), nil
+	case "file":
+		return NewFileMailer(conf.MailDir)
+	case "memory":
+		return NewMemoryMailer(), nil
+	default:
+		return nil, fmt.Errorf("unknown mailer driver %q", conf.MailerDriver)
+	}
+}
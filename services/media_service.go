@@ -0,0 +1,130 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"path"
+
+	"github.com/techagentng/ecommerce-api/config"
+	apiError "github.com/techagentng/ecommerce-api/errors"
+	"github.com/techagentng/ecommerce-api/models"
+	"github.com/techagentng/ecommerce-api/services/blobstore"
+	"github.com/techagentng/ecommerce-api/services/imaging"
+)
+
+// imageRenditions are the sizes every uploaded image is stored in, by the
+// longest side in pixels. Images are never scaled up.
+var imageRenditions = []struct {
+	name    string
+	maxSize int
+}{
+	{models.RenditionThumbnail, 150},
+	{models.RenditionMedium, 600},
+	{models.RenditionLarge, 1600},
+}
+
+// imageExtensions maps the content types images are re-encoded to to the
+// extension of their blob keys
+var imageExtensions = map[string]string{
+	"image/jpeg": ".jpg",
+	"image/png":  ".png",
+}
+
+// MediaService validates uploads and keeps them in the blob store
+type MediaService interface {
+	StoreImage(prefix string, r io.Reader) (*models.StoredImage, *apiError.Error)
+	DeleteImage(key string, contentType string) error
+}
+
+type mediaService struct {
+	Config    *config.Config
+	blobStore blobstore.BlobStore
+}
+
+// NewMediaService constructor function
+func NewMediaService(blobStore blobstore.BlobStore, conf *config.Config) MediaService {
+	return &mediaService{
+		Config:    conf,
+		blobStore: blobStore,
+	}
+}
+
+// StoreImage decodes an uploaded JPEG, PNG or GIF image and stores it in
+// every rendition size below prefix/<sha256 of the upload>/. Decoding and
+// re-encoding drops EXIF and other metadata after the EXIF orientation has
+// been applied. Uploading the same file again reuses the same keys.
+func (m *mediaService) StoreImage(prefix string, r io.Reader) (*models.StoredImage, *apiError.Error) {
+	data, err := io.ReadAll(io.LimitReader(r, m.Config.MaxImageSize+1))
+	if err != nil {
+		return nil, apiError.New("unable to read image", http.StatusBadRequest)
+	}
+	if int64(len(data)) > m.Config.MaxImageSize {
+		return nil, apiError.New(fmt.Sprintf("image must not be larger than %d bytes", m.Config.MaxImageSize), http.StatusRequestEntityTooLarge)
+	}
+	if len(data) == 0 {
+		return nil, apiError.New("image is empty", http.StatusBadRequest)
+	}
+
+	img, err := imaging.Decode(data, m.Config.MaxImagePixels)
+	if err != nil {
+		switch {
+		case errors.Is(err, imaging.ErrUnsupportedFormat):
+			return nil, apiError.New("image must be a JPEG, PNG or GIF file", http.StatusUnsupportedMediaType)
+		case errors.Is(err, imaging.ErrTooManyPixels):
+			return nil, apiError.New(fmt.Sprintf("image must not have more than %d pixels", m.Config.MaxImagePixels), http.StatusRequestEntityTooLarge)
+		}
+		return nil, apiError.New("image is corrupt or truncated", http.StatusBadRequest)
+	}
+
+	sum := sha256.Sum256(data)
+	stored := &models.StoredImage{
+		Key:        path.Join(prefix, hex.EncodeToString(sum[:])),
+		Renditions: make(map[string]models.ImageRendition, len(imageRenditions)),
+	}
+	for _, spec := range imageRenditions {
+		resized := imaging.Fit(img, spec.maxSize)
+		var buf bytes.Buffer
+		contentType, err := imaging.Encode(&buf, resized)
+		if err != nil {
+			log.Printf("Error encoding %s rendition of %s: %v", spec.name, stored.Key, err)
+			return nil, apiError.ErrInternalServerError
+		}
+		stored.ContentType = contentType
+
+		key := renditionKey(stored.Key, spec.name, contentType)
+		if err := m.blobStore.Put(context.TODO(), key, bytes.NewReader(buf.Bytes()), int64(buf.Len()), contentType); err != nil {
+			log.Printf("Error storing blob %s: %v", key, err)
+			return nil, apiError.New("unable to store image", http.StatusInternalServerError)
+		}
+		stored.Renditions[spec.name] = models.ImageRendition{
+			Key:    key,
+			URL:    m.blobStore.URL(key),
+			Width:  resized.Bounds().Dx(),
+			Height: resized.Bounds().Dy(),
+			Size:   int64(buf.Len()),
+		}
+	}
+	return stored, nil
+}
+
+// DeleteImage deletes every rendition stored under key. Callers must make
+// sure nothing else references the key, identical uploads share it.
+func (m *mediaService) DeleteImage(key string, contentType string) error {
+	for _, spec := range imageRenditions {
+		if err := m.blobStore.Delete(context.TODO(), renditionKey(key, spec.name, contentType)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func renditionKey(key string, rendition string, contentType string) string {
+	return path.Join(key, rendition+imageExtensions[contentType])
+}
@@ -2,10 +2,10 @@ package services
 
 import (
 	"errors"
+	"fmt"
 	"log"
 	"net/http"
 
-	"github.com/google/uuid"
 	"github.com/techagentng/ecommerce-api/config"
 	"github.com/techagentng/ecommerce-api/db"
 	apiError "github.com/techagentng/ecommerce-api/errors"
@@ -15,36 +15,106 @@ import (
 type OrderService interface {
 	PlaceOrder(order *models.Order) (*models.Order, error)
 	ListUserOrders(userID uint) ([]models.Order, error)
-	CancelOrder(orderID uuid.UUID) (*models.Order, error)
-	UpdateOrderStatus(orderID uuid.UUID, status string) (*models.Order, error)
+	GetOrder(orderID uint) (*models.Order, *apiError.Error)
+	CancelOrder(orderID uint, actorID uint, reason string) (*models.Order, *apiError.Error)
+	UpdateOrderStatus(orderID uint, actorID uint, status models.OrderStatus, reason string) (*models.Order, *apiError.Error)
+	ApplyPaymentStatus(orderID uint, actorID uint, status models.OrderStatus, reason string) (*models.Order, *apiError.Error)
+	ListOrderStatusEvents(orderID uint) ([]models.OrderStatusEvent, *apiError.Error)
 }
 type orderService struct {
-	Config    *config.Config
-	orderRepo db.OrderRepository
+	Config      *config.Config
+	orderRepo   db.OrderRepository
+	productRepo db.ProductRepository
+	variantRepo db.VariantRepository
 }
 
 // NewOrderService constructor function
-func NewOrderService(orderRepo db.OrderRepository, conf *config.Config) OrderService {
+func NewOrderService(orderRepo db.OrderRepository, productRepo db.ProductRepository, variantRepo db.VariantRepository, conf *config.Config) OrderService {
 	return &orderService{
-		Config:    conf,
-		orderRepo: orderRepo,
+		Config:      conf,
+		orderRepo:   orderRepo,
+		productRepo: productRepo,
+		variantRepo: variantRepo,
 	}
 }
 
-// PlaceOrder allows a user to place a new order
+// PlaceOrder prices the order's lines from the catalog and saves the order
+// with its lines. Lines of products with variants must name a variant, which
+// sets the price. A *db.InsufficientStockError listing every short line is
+// returned when the stock cannot be reserved; other failures are
+// *apiError.Error.
 func (o *orderService) PlaceOrder(order *models.Order) (*models.Order, error) {
-	if err,_ := o.orderRepo.CreateOrder(order); err != nil {
+	if len(order.Items) == 0 {
+		return nil, apiError.New("an order needs at least one item", http.StatusBadRequest)
+	}
+	for i := range order.Items {
+		if apiErr := o.priceOrderItem(&order.Items[i]); apiErr != nil {
+			return nil, apiErr
+		}
+	}
+
+	if err := o.orderRepo.CreateOrder(order); err != nil {
+		var stockErr *db.InsufficientStockError
+		if errors.As(err, &stockErr) {
+			return nil, stockErr
+		}
 		log.Printf("Error placing order: %v", err)
 		return nil, apiError.New("unable to place order", http.StatusInternalServerError)
 	}
 	return order, nil
 }
 
+// priceOrderItem copies the name, SKU and price of the line's product, or of
+// its variant, into the line
+func (o *orderService) priceOrderItem(item *models.OrderItem) *apiError.Error {
+	if item.Quantity < 1 {
+		return apiError.New("quantity must be at least 1", http.StatusBadRequest)
+	}
+	product, err := o.productRepo.FindProductByID(item.ProductID)
+	if err != nil {
+		log.Printf("Error finding product %d: %v", item.ProductID, err)
+		return apiError.ErrInternalServerError
+	}
+	if product == nil {
+		return apiError.New(fmt.Sprintf("product %d not found", item.ProductID), http.StatusBadRequest)
+	}
+	item.Name = product.Name
+	item.UnitPrice = product.Price
+	item.SKU = ""
+	if product.SKU != nil {
+		item.SKU = *product.SKU
+	}
+
+	if item.VariantID == nil {
+		variantCount, err := o.variantRepo.CountVariants(product.ID)
+		if err != nil {
+			log.Printf("Error counting variants of product %d: %v", product.ID, err)
+			return apiError.ErrInternalServerError
+		}
+		if variantCount > 0 {
+			return apiError.New(fmt.Sprintf("variant_id is required for product %d, it has variants", product.ID), http.StatusBadRequest)
+		}
+		return nil
+	}
+
+	variant, err := o.variantRepo.FindVariantByID(*item.VariantID)
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		log.Printf("Error finding variant %d: %v", *item.VariantID, err)
+		return apiError.ErrInternalServerError
+	}
+	if variant == nil || variant.ProductID != product.ID {
+		return apiError.New(fmt.Sprintf("variant %d not found", *item.VariantID), http.StatusBadRequest)
+	}
+	item.UnitPrice = variant.EffectivePrice(product)
+	item.SKU = variant.SKU
+	return nil
+}
+
 // ListUserOrders retrieves all orders for a specific user
 func (o *orderService) ListUserOrders(userID uint) ([]models.Order, error) {
     orders, err := o.orderRepo.FindOrdersByUserID(userID) 
     if err != nil {
-        log.Printf("Error fetching orders for user %s: %v", userID, err)
+        log.Printf("Error fetching orders for user %d: %v", userID, err)
         return nil, apiError.New("unable to fetch user orders", http.StatusInternalServerError)
     }
 
@@ -56,52 +126,76 @@ func (o *orderService) ListUserOrders(userID uint) ([]models.Order, error) {
     return ordersResponse, nil
 }
 
-// UpdateOrderStatus allows an admin to update the status of an order
-func (o *orderService) UpdateOrderStatus(orderID uuid.UUID, status string) (*models.Order, error) {
-	order, err := o.orderRepo.GetOrderByID(orderID)
+// GetOrder returns an order with its lines
+func (o *orderService) GetOrder(orderID uint) (*models.Order, *apiError.Error) {
+	order, err := o.orderRepo.LoadOrderDetails(orderID)
 	if err != nil {
-		if errors.Is(err, gorm.ErrRecordNotFound) {
-			return nil, apiError.New("order not found", http.StatusNotFound)
-		}
-		log.Printf("Error fetching order: %v", err)
-		return nil, apiError.New("unable to fetch order", http.StatusInternalServerError)
+		log.Printf("Error loading order %d: %v", orderID, err)
+		return nil, apiError.ErrInternalServerError
+	}
+	if order == nil {
+		return nil, apiError.New("order not found", http.StatusNotFound)
 	}
-
-	order.Status = status
-    if err := o.orderRepo.UpdateOrderStatus(order.ID, status); err != nil {
-        log.Printf("Error updating order status: %v", err)
-        return nil, apiError.New("unable to update order status", http.StatusInternalServerError)
-    }
 	return order, nil
 }
 
-// Service function to cancel an order
-func (o *orderService) CancelOrder(orderID uuid.UUID) (*models.Order, error) {
-	order, err := o.orderRepo.FindOrderByID(orderID)
-	if err != nil {
-		if errors.Is(err, gorm.ErrRecordNotFound) {
-			return nil, apiError.New("order not found", http.StatusNotFound)
-		}
-		log.Printf("Error retrieving order for cancellation: %v", err)
-		return nil, apiError.New("unable to retrieve order for cancellation", http.StatusInternalServerError)
+// UpdateOrderStatus moves an order to another status on behalf of actorID.
+// Only the transitions of the order status graph are allowed; calling an
+// order off before it was shipped returns its stock. Paid and Refunded are
+// reached through payments, so money and status cannot disagree.
+func (o *orderService) UpdateOrderStatus(orderID uint, actorID uint, status models.OrderStatus, reason string) (*models.Order, *apiError.Error) {
+	if !status.Valid() {
+		return nil, apiError.New(fmt.Sprintf("unknown order status %q", status), http.StatusBadRequest)
+	}
+	if status == models.OrderStatusPaid || status == models.OrderStatusRefunded {
+		return nil, apiError.New(fmt.Sprintf("an order becomes %s through its payment", status), http.StatusConflict)
 	}
+	return o.transitionOrder(orderID, actorID, status, reason)
+}
 
-	if order.Status != "Pending" {
-		return nil, apiError.New("only pending orders can be canceled", http.StatusBadRequest)
+// ApplyPaymentStatus moves an order to Paid once its payment was captured, or
+// to Refunded once it was refunded. It is meant for PaymentService.
+func (o *orderService) ApplyPaymentStatus(orderID uint, actorID uint, status models.OrderStatus, reason string) (*models.Order, *apiError.Error) {
+	if status != models.OrderStatusPaid && status != models.OrderStatusRefunded {
+		return nil, apiError.New(fmt.Sprintf("a payment cannot make an order %s", status), http.StatusBadRequest)
 	}
+	return o.transitionOrder(orderID, actorID, status, reason)
+}
 
-	// Update the order status to 'Canceled'
-	order.Status = "Canceled"
-	if err := o.orderRepo.UpdateOrder(order); err != nil {
-		log.Printf(
-			"Error updating order status to 'Canceled' for order ID %v. Details: %v",
-			order.ID,
-			err,
-		)
-		return nil, apiError.New("unable to cancel order due to a database error", http.StatusInternalServerError)
+// transitionOrder moves an order along the order status graph
+func (o *orderService) transitionOrder(orderID uint, actorID uint, status models.OrderStatus, reason string) (*models.Order, *apiError.Error) {
+	order, apiErr := o.GetOrder(orderID)
+	if apiErr != nil {
+		return nil, apiErr
+	}
+	if !order.Status.CanTransitionTo(status) {
+		return nil, apiError.New(fmt.Sprintf("an order cannot move from %s to %s", order.Status, status), http.StatusConflict)
 	}
 
-	log.Printf("Order with ID %v successfully canceled", orderID)
+	if err := o.orderRepo.TransitionOrderStatus(order, status, actorID, reason); err != nil {
+		if errors.Is(err, db.ErrOrderStatusChanged) {
+			return nil, apiError.New("the order status was changed by another request, reload the order", http.StatusConflict)
+		}
+		log.Printf("Error moving order %d from %s to %s: %v", order.ID, order.Status, status, err)
+		return nil, apiError.New("unable to update order status", http.StatusInternalServerError)
+	}
 	return order, nil
 }
 
+// CancelOrder cancels a pending order on behalf of actorID and returns its stock
+func (o *orderService) CancelOrder(orderID uint, actorID uint, reason string) (*models.Order, *apiError.Error) {
+	return o.transitionOrder(orderID, actorID, models.OrderStatusCanceled, reason)
+}
+
+// ListOrderStatusEvents returns an order's status history, oldest first
+func (o *orderService) ListOrderStatusEvents(orderID uint) ([]models.OrderStatusEvent, *apiError.Error) {
+	events, err := o.orderRepo.ListOrderStatusEvents(orderID)
+	if err != nil {
+		log.Printf("Error listing status history of order %d: %v", orderID, err)
+		return nil, apiError.ErrInternalServerError
+	}
+	if events == nil {
+		events = []models.OrderStatusEvent{}
+	}
+	return events, nil
+}
@@ -0,0 +1,59 @@
+package services
+
+import (
+	"bufio"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/techagentng/ecommerce-api/config"
+	apiError "github.com/techagentng/ecommerce-api/errors"
+)
+
+// PasswordPolicy validates new passwords against a minimum length and a list
+// of known breached passwords
+type PasswordPolicy struct {
+	MinLength int
+	breached  map[string]struct{}
+}
+
+// NewPasswordPolicy builds the policy from config. Config.BreachedPasswordsFile,
+// when set, is a text file with one password per line.
+func NewPasswordPolicy(conf *config.Config) (*PasswordPolicy, error) {
+	policy := &PasswordPolicy{
+		MinLength: conf.PasswordMinLength,
+		breached:  map[string]struct{}{},
+	}
+	if conf.BreachedPasswordsFile == "" {
+		return policy, nil
+	}
+
+	file, err := os.Open(conf.BreachedPasswordsFile)
+	if err != nil {
+		return nil, fmt.Errorf("unable to open breached passwords file: %v", err)
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		if password := strings.TrimSpace(scanner.Text()); password != "" {
+			policy.breached[strings.ToLower(password)] = struct{}{}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("unable to read breached passwords file: %v", err)
+	}
+	return policy, nil
+}
+
+// Validate returns an error describing why password is not acceptable
+func (p *PasswordPolicy) Validate(password string) *apiError.Error {
+	if len([]rune(password)) < p.MinLength {
+		return apiError.New(fmt.Sprintf("password must be at least %d characters long", p.MinLength), http.StatusBadRequest)
+	}
+	if _, ok := p.breached[strings.ToLower(password)]; ok {
+		return apiError.New("password has appeared in a data breach, please choose another", http.StatusBadRequest)
+	}
+	return nil
+}
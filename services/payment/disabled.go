@@ -0,0 +1,33 @@
+package payment
+
+import "context"
+
+// disabledProvider is used when no provider may take payments, e.g. in
+// production until a real provider is configured. Every operation fails with
+// ErrUnavailable, so orders can still be placed and are paid once a provider
+// is configured.
+type disabledProvider struct{}
+
+func NewDisabledProvider() PaymentProvider {
+	return disabledProvider{}
+}
+
+func (disabledProvider) Name() string {
+	return "disabled"
+}
+
+func (disabledProvider) Authorize(ctx context.Context, request AuthorizeRequest) (*Authorization, error) {
+	return nil, ErrUnavailable
+}
+
+func (disabledProvider) Capture(ctx context.Context, transactionID string, amount int64) error {
+	return ErrUnavailable
+}
+
+func (disabledProvider) Void(ctx context.Context, transactionID string) error {
+	return ErrUnavailable
+}
+
+func (disabledProvider) Refund(ctx context.Context, transactionID string, amount int64) error {
+	return ErrUnavailable
+}
@@ -0,0 +1,115 @@
+package payment
+
+import (
+	"context"
+	"fmt"
+	"sync"
+)
+
+// Payment methods the fake provider understands. Any other method is approved.
+const (
+	FakeMethodDeclined      = "fake_declined"
+	FakeMethodCaptureFails  = "fake_capture_declined"
+	FakeMethodProviderError = "fake_provider_error"
+)
+
+// FakeProvider is a deterministic PaymentProvider for tests and local
+// development. It moves no money: the payment method decides the outcome, and
+// transactions are kept in memory and named after the payment reference, so
+// the same calls always give the same results.
+type FakeProvider struct {
+	mu           sync.Mutex
+	transactions map[string]*fakeTransaction
+}
+
+type fakeTransaction struct {
+	method     string
+	authorized int64
+	captured   int64
+	refunded   int64
+	voided     bool
+}
+
+func NewFakeProvider() *FakeProvider {
+	return &FakeProvider{transactions: make(map[string]*fakeTransaction)}
+}
+
+func (p *FakeProvider) Name() string {
+	return "fake"
+}
+
+func (p *FakeProvider) Authorize(ctx context.Context, request AuthorizeRequest) (*Authorization, error) {
+	switch request.Method {
+	case FakeMethodDeclined:
+		return nil, &DeclineError{Code: "card_declined", Message: "the card was declined"}
+	case FakeMethodProviderError:
+		return nil, fmt.Errorf("fake provider unavailable")
+	}
+	if request.Amount <= 0 {
+		return nil, &DeclineError{Code: "invalid_amount", Message: "the amount must be positive"}
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	id := "fake_" + request.Reference
+	if _, ok := p.transactions[id]; !ok {
+		p.transactions[id] = &fakeTransaction{method: request.Method, authorized: request.Amount}
+	}
+	return &Authorization{TransactionID: id, Amount: p.transactions[id].authorized}, nil
+}
+
+func (p *FakeProvider) Capture(ctx context.Context, transactionID string, amount int64) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	transaction, err := p.transaction(transactionID)
+	if err != nil {
+		return err
+	}
+	switch {
+	case transaction.method == FakeMethodCaptureFails:
+		return &DeclineError{Code: "capture_declined", Message: "the capture was declined"}
+	case transaction.voided:
+		return &DeclineError{Code: "voided", Message: "the authorization was voided"}
+	case transaction.captured+amount > transaction.authorized:
+		return &DeclineError{Code: "amount_too_large", Message: "the amount exceeds the authorization"}
+	}
+	transaction.captured += amount
+	return nil
+}
+
+func (p *FakeProvider) Void(ctx context.Context, transactionID string) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	transaction, err := p.transaction(transactionID)
+	if err != nil {
+		return err
+	}
+	if transaction.captured > 0 {
+		return &DeclineError{Code: "captured", Message: "a captured payment is refunded, not voided"}
+	}
+	transaction.voided = true
+	return nil
+}
+
+func (p *FakeProvider) Refund(ctx context.Context, transactionID string, amount int64) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	transaction, err := p.transaction(transactionID)
+	if err != nil {
+		return err
+	}
+	if amount <= 0 || transaction.refunded+amount > transaction.captured {
+		return &DeclineError{Code: "amount_too_large", Message: "the amount exceeds what was captured"}
+	}
+	transaction.refunded += amount
+	return nil
+}
+
+// transaction returns the transaction with the ID; p.mu must be held
+func (p *FakeProvider) transaction(transactionID string) (*fakeTransaction, error) {
+	transaction, ok := p.transactions[transactionID]
+	if !ok {
+		return nil, &DeclineError{Code: "not_found", Message: fmt.Sprintf("no transaction %s", transactionID)}
+	}
+	return transaction, nil
+}
@@ -0,0 +1,85 @@
+package payment
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+
+	"github.com/techagentng/ecommerce-api/config"
+)
+
+// ErrDeclined is returned, wrapped in a *DeclineError, when the provider
+// refuses an operation, e.g. a card without funds. Other errors mean the
+// provider could not be reached or failed, and the operation may be retried.
+var ErrDeclined = errors.New("payment declined")
+
+// ErrUnavailable is returned when payments are disabled
+var ErrUnavailable = errors.New("payments are disabled")
+
+// DeclineError says why the provider declined an operation
+type DeclineError struct {
+	Code    string
+	Message string
+}
+
+func (e *DeclineError) Error() string {
+	return fmt.Sprintf("%v: %s", ErrDeclined, e.Message)
+}
+
+func (e *DeclineError) Unwrap() error {
+	return ErrDeclined
+}
+
+// AuthorizeRequest holds a payment to authorize. Amount is in minor units of
+// Currency, e.g. kobo or cents. Reference is unique per payment attempt, so
+// a provider can recognise a retried request. Method is the token the client
+// got from the provider for the customer's card or account.
+type AuthorizeRequest struct {
+	Reference string
+	Amount    int64
+	Currency  string
+	Email     string
+	Method    string
+}
+
+// Authorization is a hold on the customer's funds. TransactionID is the
+// provider's reference, which the other operations take.
+type Authorization struct {
+	TransactionID string
+	Amount        int64
+}
+
+// PaymentProvider moves money through a payment service. Funds are first
+// authorized, then captured, or voided to release the hold; captured funds can
+// be refunded in part or in full. Amounts are in minor units.
+type PaymentProvider interface {
+	Name() string
+	Authorize(ctx context.Context, request AuthorizeRequest) (*Authorization, error)
+	Capture(ctx context.Context, transactionID string, amount int64) error
+	Void(ctx context.Context, transactionID string) error
+	Refund(ctx context.Context, transactionID string, amount int64) error
+}
+
+// New returns the PaymentProvider selected by Config.PaymentProvider: "fake",
+// a deterministic provider for tests and local development, or "disabled",
+// which refuses every payment. The fake provider moves no money, so when
+// Config.Env is "prod" payments are disabled instead and a warning is logged;
+// the server still starts and takes orders. Adapters for services like
+// Paystack or Stripe implement PaymentProvider and are added here.
+func New(conf *config.Config) (PaymentProvider, error) {
+	switch conf.PaymentProvider {
+	case "fake":
+		if conf.Env == "prod" {
+			log.Printf("Warning: the fake payment provider cannot be used in production, payments are disabled")
+			return NewDisabledProvider(), nil
+		}
+		return NewFakeProvider(), nil
+	case "disabled":
+		return NewDisabledProvider(), nil
+	case "":
+		return nil, fmt.Errorf("no payment provider is configured")
+	default:
+		return nil, fmt.Errorf("unknown payment provider %q", conf.PaymentProvider)
+	}
+}
@@ -0,0 +1,258 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/techagentng/ecommerce-api/config"
+	"github.com/techagentng/ecommerce-api/db"
+	apiError "github.com/techagentng/ecommerce-api/errors"
+	"github.com/techagentng/ecommerce-api/models"
+	"github.com/techagentng/ecommerce-api/services/payment"
+)
+
+// paymentAttemptTimeout is how long a payment attempt that neither failed nor
+// was captured keeps others from starting, e.g. after a crash mid-payment
+const paymentAttemptTimeout = 10 * time.Minute
+
+// errPaymentsDisabled is returned while the disabled provider is configured
+var errPaymentsDisabled = apiError.New("payments are currently disabled", http.StatusServiceUnavailable)
+
+// PaymentService pays and refunds orders through the PaymentProvider. An order
+// only becomes Paid once its payment is captured.
+type PaymentService interface {
+	PayOrder(orderID uint, user *models.User, request *models.PayOrderRequest) (*models.Payment, *apiError.Error)
+	RefundOrder(orderID uint, actorID uint, reason string) (*models.Order, *apiError.Error)
+	ListOrderPayments(orderID uint) ([]models.Payment, *apiError.Error)
+}
+
+type paymentService struct {
+	Config       *config.Config
+	paymentRepo  db.PaymentRepository
+	orderService OrderService
+	provider     payment.PaymentProvider
+}
+
+// NewPaymentService constructor function
+func NewPaymentService(paymentRepo db.PaymentRepository, orderService OrderService, provider payment.PaymentProvider, conf *config.Config) PaymentService {
+	return &paymentService{
+		Config:       conf,
+		paymentRepo:  paymentRepo,
+		orderService: orderService,
+		provider:     provider,
+	}
+}
+
+// PayOrder pays the user's pending order with the payment method: the order's
+// total is authorized, then captured, and only then is the order moved to
+// Paid. A declined payment is recorded as failed and returned as 402, and the
+// order stays pending so it can be paid again. Should the order change while
+// it is paid, the captured payment is refunded.
+func (p *paymentService) PayOrder(orderID uint, user *models.User, request *models.PayOrderRequest) (*models.Payment, *apiError.Error) {
+	order, apiErr := p.orderService.GetOrder(orderID)
+	if apiErr != nil {
+		return nil, apiErr
+	}
+	if order.UserID != user.ID {
+		return nil, apiError.New("order not found", http.StatusNotFound)
+	}
+	if order.Status != models.OrderStatusPending {
+		return nil, apiError.New(fmt.Sprintf("the order is %s, only pending orders can be paid", order.Status), http.StatusConflict)
+	}
+	amount := order.TotalMinorUnits()
+	if amount <= 0 {
+		return nil, apiError.New("the order has nothing to pay", http.StatusBadRequest)
+	}
+
+	attempt := &models.Payment{
+		OrderID:  order.ID,
+		Provider: p.provider.Name(),
+		Amount:   amount,
+		Currency: p.Config.PaymentCurrency,
+		Status:   models.PaymentStatusPending,
+	}
+	if err := p.paymentRepo.CreatePayment(attempt, time.Now().Add(-paymentAttemptTimeout)); err != nil {
+		switch {
+		case errors.Is(err, db.ErrPaymentInProgress):
+			return nil, apiError.New("the order is already paid or being paid", http.StatusConflict)
+		case errors.Is(err, db.ErrOrderStatusChanged):
+			return nil, apiError.New("the order is no longer pending", http.StatusConflict)
+		}
+		log.Printf("Error creating payment for order %d: %v", order.ID, err)
+		return nil, apiError.ErrInternalServerError
+	}
+
+	ctx := context.TODO()
+	authorization, err := p.provider.Authorize(ctx, payment.AuthorizeRequest{
+		Reference: fmt.Sprintf("order-%d-payment-%d", order.ID, attempt.ID),
+		Amount:    amount,
+		Currency:  attempt.Currency,
+		Email:     user.Email,
+		Method:    request.PaymentMethod,
+	})
+	if err != nil {
+		return nil, p.failPayment(attempt, err)
+	}
+	attempt.TransactionID = authorization.TransactionID
+	attempt.Status = models.PaymentStatusAuthorized
+	if apiErr := p.savePayment(attempt); apiErr != nil {
+		if err := p.provider.Void(ctx, attempt.TransactionID); err != nil {
+			log.Printf("Error voiding payment %d of order %d: %v", attempt.ID, order.ID, err)
+		}
+		return nil, apiErr
+	}
+
+	if err := p.provider.Capture(ctx, attempt.TransactionID, amount); err != nil {
+		if voidErr := p.provider.Void(ctx, attempt.TransactionID); voidErr != nil {
+			log.Printf("Error voiding payment %d of order %d: %v", attempt.ID, order.ID, voidErr)
+		}
+		return nil, p.failPayment(attempt, err)
+	}
+	attempt.Status = models.PaymentStatusCaptured
+	if apiErr := p.savePayment(attempt); apiErr != nil {
+		// An unrecorded capture would leave the customer charged for an
+		// unpaid order: give the money back
+		p.refundUnrecorded(ctx, attempt)
+		return nil, apiErr
+	}
+
+	if _, apiErr := p.orderService.ApplyPaymentStatus(order.ID, user.ID, models.OrderStatusPaid, fmt.Sprintf("payment %d captured", attempt.ID)); apiErr != nil {
+		// The order was canceled meanwhile: give the money back
+		if err := p.provider.Refund(ctx, attempt.TransactionID, amount); err != nil {
+			log.Printf("Error refunding payment %d of order %d, which could not be marked paid: %v", attempt.ID, order.ID, err)
+			return nil, apiErr
+		}
+		attempt.Status = models.PaymentStatusRefunded
+		attempt.RefundedAmount = amount
+		if apiErr := p.savePayment(attempt); apiErr != nil {
+			return nil, apiErr
+		}
+		return nil, apiError.New("the order changed while it was paid, the payment was refunded", http.StatusConflict)
+	}
+	return attempt, nil
+}
+
+// RefundOrder refunds what was captured for an order and moves the order to
+// Refunded on behalf of actorID, returning its stock unless it was shipped.
+// The payment is claimed before the provider is asked, so concurrent requests
+// refund it once, and the refund is recorded together with the order's move
+// to Refunded. Orders that were never paid through a provider are only moved
+// to Refunded.
+func (p *paymentService) RefundOrder(orderID uint, actorID uint, reason string) (*models.Order, *apiError.Error) {
+	order, apiErr := p.orderService.GetOrder(orderID)
+	if apiErr != nil {
+		return nil, apiErr
+	}
+	if !order.Status.CanTransitionTo(models.OrderStatusRefunded) {
+		return nil, apiError.New(fmt.Sprintf("a %s order cannot be refunded", order.Status), http.StatusConflict)
+	}
+
+	attempt, err := p.paymentRepo.ClaimRefund(order.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, db.ErrOrderStatusChanged):
+			return nil, apiError.New("the order status was changed by another request, reload the order", http.StatusConflict)
+		case errors.Is(err, db.ErrRefundInProgress):
+			return nil, apiError.New("the order is already being refunded", http.StatusConflict)
+		}
+		log.Printf("Error claiming the payment of order %d for a refund: %v", order.ID, err)
+		return nil, apiError.ErrInternalServerError
+	}
+	if attempt == nil {
+		return p.orderService.ApplyPaymentStatus(order.ID, actorID, models.OrderStatusRefunded, reason)
+	}
+
+	amount := attempt.Amount - attempt.RefundedAmount
+	if err := p.provider.Refund(context.TODO(), attempt.TransactionID, amount); err != nil {
+		if releaseErr := p.paymentRepo.ReleaseRefund(attempt); releaseErr != nil {
+			log.Printf("Error releasing payment %d of order %d after a failed refund: %v", attempt.ID, order.ID, releaseErr)
+		}
+		if errors.Is(err, payment.ErrUnavailable) {
+			return nil, errPaymentsDisabled
+		}
+		var decline *payment.DeclineError
+		if errors.As(err, &decline) {
+			return nil, apiError.New(fmt.Sprintf("the refund was declined: %s", decline.Message), http.StatusConflict)
+		}
+		log.Printf("Error refunding payment %d of order %d: %v", attempt.ID, order.ID, err)
+		return nil, apiError.New("the payment provider could not be reached, try again", http.StatusBadGateway)
+	}
+
+	attempt.Status = models.PaymentStatusRefunded
+	attempt.RefundedAmount = attempt.Amount
+	if err := p.paymentRepo.CompleteRefund(attempt, order, actorID, reason); err != nil {
+		// The payment stays refunding, so it is not refunded twice
+		log.Printf("Error recording the refund of payment %d of order %d, which the provider refunded: %v", attempt.ID, order.ID, err)
+		return nil, apiError.New("the payment was refunded but could not be recorded", http.StatusInternalServerError)
+	}
+	if order.Status != models.OrderStatusRefunded {
+		return nil, apiError.New(fmt.Sprintf("the payment was refunded, but the order became %s meanwhile and was left as it is", order.Status), http.StatusConflict)
+	}
+	return order, nil
+}
+
+// ListOrderPayments returns an order's payment attempts, oldest first
+func (p *paymentService) ListOrderPayments(orderID uint) ([]models.Payment, *apiError.Error) {
+	payments, err := p.paymentRepo.ListPaymentsByOrderID(orderID)
+	if err != nil {
+		log.Printf("Error listing payments of order %d: %v", orderID, err)
+		return nil, apiError.ErrInternalServerError
+	}
+	if payments == nil {
+		payments = []models.Payment{}
+	}
+	return payments, nil
+}
+
+// failPayment records why the provider did not take a payment. A decline is
+// the customer's to fix and returned as 402, disabled payments as 503 and
+// other errors as 502.
+func (p *paymentService) failPayment(attempt *models.Payment, err error) *apiError.Error {
+	attempt.Status = models.PaymentStatusFailed
+	if errors.Is(err, payment.ErrUnavailable) {
+		attempt.FailureCode = "payments_disabled"
+		attempt.FailureMessage = "payments are disabled"
+		if apiErr := p.savePayment(attempt); apiErr != nil {
+			return apiErr
+		}
+		return errPaymentsDisabled
+	}
+	var decline *payment.DeclineError
+	if errors.As(err, &decline) {
+		attempt.FailureCode = decline.Code
+		attempt.FailureMessage = decline.Message
+		if apiErr := p.savePayment(attempt); apiErr != nil {
+			return apiErr
+		}
+		return apiError.New(fmt.Sprintf("the payment was declined: %s", decline.Message), http.StatusPaymentRequired)
+	}
+
+	log.Printf("Error processing payment %d of order %d: %v", attempt.ID, attempt.OrderID, err)
+	attempt.FailureCode = "provider_error"
+	attempt.FailureMessage = "the payment provider could not be reached"
+	if apiErr := p.savePayment(attempt); apiErr != nil {
+		return apiErr
+	}
+	return apiError.New("the payment provider could not be reached, try again", http.StatusBadGateway)
+}
+
+// savePayment stores a payment's new status
+func (p *paymentService) savePayment(attempt *models.Payment) *apiError.Error {
+	if err := p.paymentRepo.UpdatePayment(attempt); err != nil {
+		log.Printf("Error saving payment %d of order %d as %s: %v", attempt.ID, attempt.OrderID, attempt.Status, err)
+		return apiError.New("the payment could not be recorded", http.StatusInternalServerError)
+	}
+	return nil
+}
+
+// refundUnrecorded refunds a capture that could not be recorded. The payment
+// keeps the status it was last saved with.
+func (p *paymentService) refundUnrecorded(ctx context.Context, attempt *models.Payment) {
+	if err := p.provider.Refund(ctx, attempt.TransactionID, attempt.Amount); err != nil {
+		log.Printf("Error refunding unrecorded capture of payment %d of order %d: %v", attempt.ID, attempt.OrderID, err)
+	}
+}
@@ -0,0 +1,363 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/techagentng/ecommerce-api/config"
+	"github.com/techagentng/ecommerce-api/db"
+	apiError "github.com/techagentng/ecommerce-api/errors"
+	"github.com/techagentng/ecommerce-api/models"
+	"github.com/techagentng/ecommerce-api/services/payment"
+)
+
+// paymentLedger keeps the orders and payments of a test in memory. It is the
+// PaymentRepository of the service under test, and backs the OrderService
+// stub the service moves orders with.
+type paymentLedger struct {
+	mu       sync.Mutex
+	orders   map[uint]*models.Order
+	payments []*models.Payment
+}
+
+func newPaymentLedger(orders ...*models.Order) *paymentLedger {
+	ledger := &paymentLedger{orders: map[uint]*models.Order{}}
+	for _, order := range orders {
+		ledger.orders[order.ID] = order
+	}
+	return ledger
+}
+
+func (l *paymentLedger) CreatePayment(payment *models.Payment, staleBefore time.Time) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.orders[payment.OrderID].Status != models.OrderStatusPending {
+		return db.ErrOrderStatusChanged
+	}
+	for _, existing := range l.payments {
+		if existing.OrderID == payment.OrderID && (existing.Status == models.PaymentStatusCaptured ||
+			existing.Status == models.PaymentStatusPending || existing.Status == models.PaymentStatusAuthorized ||
+			existing.Status == models.PaymentStatusRefunding) {
+			return db.ErrPaymentInProgress
+		}
+	}
+	payment.ID = uint(len(l.payments) + 1)
+	stored := *payment
+	l.payments = append(l.payments, &stored)
+	return nil
+}
+
+func (l *paymentLedger) UpdatePayment(payment *models.Payment) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	stored := *payment
+	l.payments[payment.ID-1] = &stored
+	return nil
+}
+
+func (l *paymentLedger) ListPaymentsByOrderID(orderID uint) ([]models.Payment, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	var payments []models.Payment
+	for _, payment := range l.payments {
+		if payment.OrderID == orderID {
+			payments = append(payments, *payment)
+		}
+	}
+	return payments, nil
+}
+
+func (l *paymentLedger) ClaimRefund(orderID uint) (*models.Payment, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if !l.orders[orderID].Status.CanTransitionTo(models.OrderStatusRefunded) {
+		return nil, db.ErrOrderStatusChanged
+	}
+	for _, payment := range l.payments {
+		if payment.OrderID != orderID {
+			continue
+		}
+		switch payment.Status {
+		case models.PaymentStatusRefunding:
+			return nil, db.ErrRefundInProgress
+		case models.PaymentStatusCaptured:
+			payment.Status = models.PaymentStatusRefunding
+			claimed := *payment
+			return &claimed, nil
+		}
+	}
+	return nil, nil
+}
+
+func (l *paymentLedger) ReleaseRefund(payment *models.Payment) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.payments[payment.ID-1].Status != models.PaymentStatusRefunding {
+		return db.ErrRefundNotClaimed
+	}
+	l.payments[payment.ID-1].Status = models.PaymentStatusCaptured
+	return nil
+}
+
+func (l *paymentLedger) CompleteRefund(payment *models.Payment, order *models.Order, actorID uint, reason string) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.payments[payment.ID-1].Status != models.PaymentStatusRefunding {
+		return db.ErrRefundNotClaimed
+	}
+	stored := *payment
+	l.payments[payment.ID-1] = &stored
+	current := l.orders[order.ID]
+	if current.Status.CanTransitionTo(models.OrderStatusRefunded) {
+		current.Status = models.OrderStatusRefunded
+	}
+	order.Status = current.Status
+	return nil
+}
+
+func (l *paymentLedger) payment(id uint) models.Payment {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return *l.payments[id-1]
+}
+
+func (l *paymentLedger) orderStatus(id uint) models.OrderStatus {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.orders[id].Status
+}
+
+// ledgerOrderService moves the orders of a paymentLedger
+type ledgerOrderService struct {
+	OrderService
+	ledger *paymentLedger
+}
+
+func (o *ledgerOrderService) GetOrder(orderID uint) (*models.Order, *apiError.Error) {
+	o.ledger.mu.Lock()
+	defer o.ledger.mu.Unlock()
+	order, ok := o.ledger.orders[orderID]
+	if !ok {
+		return nil, apiError.New("order not found", http.StatusNotFound)
+	}
+	found := *order
+	return &found, nil
+}
+
+func (o *ledgerOrderService) ApplyPaymentStatus(orderID uint, actorID uint, status models.OrderStatus, reason string) (*models.Order, *apiError.Error) {
+	o.ledger.mu.Lock()
+	defer o.ledger.mu.Unlock()
+	order := o.ledger.orders[orderID]
+	if !order.Status.CanTransitionTo(status) {
+		return nil, apiError.New(fmt.Sprintf("an order cannot move from %s to %s", order.Status, status), http.StatusConflict)
+	}
+	order.Status = status
+	moved := *order
+	return &moved, nil
+}
+
+// countingProvider counts the refunds the fake provider is asked for
+type countingProvider struct {
+	*payment.FakeProvider
+	mu      sync.Mutex
+	refunds int
+}
+
+func (p *countingProvider) Refund(ctx context.Context, transactionID string, amount int64) error {
+	p.mu.Lock()
+	p.refunds++
+	p.mu.Unlock()
+	return p.FakeProvider.Refund(ctx, transactionID, amount)
+}
+
+func newPaymentTest(orders ...*models.Order) (PaymentService, *paymentLedger, *countingProvider) {
+	ledger := newPaymentLedger(orders...)
+	provider := &countingProvider{FakeProvider: payment.NewFakeProvider()}
+	conf := &config.Config{PaymentCurrency: "NGN"}
+	return NewPaymentService(ledger, &ledgerOrderService{ledger: ledger}, provider, conf), ledger, provider
+}
+
+func pendingOrder(id uint, userID uint) *models.Order {
+	return &models.Order{ID: id, UserID: userID, Status: models.OrderStatusPending, Items: []models.OrderItem{
+		{ProductID: 1, Quantity: 2, UnitPrice: 12.5},
+		{ProductID: 2, Quantity: 1, UnitPrice: 35.67},
+	}}
+}
+
+func TestPayOrderMarksOrderPaidOnCapture(t *testing.T) {
+	user := &models.User{ID: 7, Email: "jane@example.com"}
+	service, ledger, _ := newPaymentTest(pendingOrder(1, user.ID))
+
+	attempt, apiErr := service.PayOrder(1, user, &models.PayOrderRequest{PaymentMethod: "tok_visa"})
+	if apiErr != nil {
+		t.Fatal(apiErr)
+	}
+	if attempt.Status != models.PaymentStatusCaptured || attempt.Amount != 6067 {
+		t.Errorf("got a %s payment of %d, want a captured payment of 6067", attempt.Status, attempt.Amount)
+	}
+	if stored := ledger.payment(attempt.ID); stored.Status != models.PaymentStatusCaptured || stored.TransactionID == "" {
+		t.Errorf("stored payment is %s with transaction %q", stored.Status, stored.TransactionID)
+	}
+	if status := ledger.orderStatus(1); status != models.OrderStatusPaid {
+		t.Errorf("order is %s, want %s", status, models.OrderStatusPaid)
+	}
+
+	if _, apiErr := service.PayOrder(1, user, &models.PayOrderRequest{PaymentMethod: "tok_visa"}); apiErr == nil || apiErr.Status != http.StatusConflict {
+		t.Errorf("got %v paying a paid order, want 409", apiErr)
+	}
+}
+
+func TestPayOrderLeavesOrderPendingWhenDeclined(t *testing.T) {
+	for _, test := range []struct {
+		method string
+		status int
+	}{
+		{payment.FakeMethodDeclined, http.StatusPaymentRequired},
+		{payment.FakeMethodCaptureFails, http.StatusPaymentRequired},
+		{payment.FakeMethodProviderError, http.StatusBadGateway},
+	} {
+		t.Run(test.method, func(t *testing.T) {
+			user := &models.User{ID: 7}
+			service, ledger, _ := newPaymentTest(pendingOrder(1, user.ID))
+
+			_, apiErr := service.PayOrder(1, user, &models.PayOrderRequest{PaymentMethod: test.method})
+			if apiErr == nil || apiErr.Status != test.status {
+				t.Fatalf("got %v, want status %d", apiErr, test.status)
+			}
+			if stored := ledger.payment(1); stored.Status != models.PaymentStatusFailed || stored.FailureCode == "" {
+				t.Errorf("stored payment is %s with failure code %q, want it failed", stored.Status, stored.FailureCode)
+			}
+			if status := ledger.orderStatus(1); status != models.OrderStatusPending {
+				t.Errorf("order is %s, want it still %s", status, models.OrderStatusPending)
+			}
+
+			// The failed attempt does not keep the order from being paid
+			if _, apiErr := service.PayOrder(1, user, &models.PayOrderRequest{PaymentMethod: "tok_visa"}); apiErr != nil {
+				t.Errorf("paying again failed: %v", apiErr)
+			}
+		})
+	}
+}
+
+func TestRefundOrderRefundsCapturedPaymentOnce(t *testing.T) {
+	user := &models.User{ID: 7}
+	service, ledger, provider := newPaymentTest(pendingOrder(1, user.ID))
+	attempt, apiErr := service.PayOrder(1, user, &models.PayOrderRequest{PaymentMethod: "tok_visa"})
+	if apiErr != nil {
+		t.Fatal(apiErr)
+	}
+
+	const requests = 10
+	var wg sync.WaitGroup
+	refunded := make([]bool, requests)
+	for i := 0; i < requests; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			order, apiErr := service.RefundOrder(1, 99, "damaged")
+			refunded[i] = apiErr == nil && order.Status == models.OrderStatusRefunded
+			if apiErr != nil && apiErr.Status != http.StatusConflict {
+				t.Errorf("got %v, want success or 409", apiErr)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	succeeded := 0
+	for _, ok := range refunded {
+		if ok {
+			succeeded++
+		}
+	}
+	if succeeded != 1 || provider.refunds != 1 {
+		t.Errorf("%d requests refunded with %d provider refunds, want 1 and 1", succeeded, provider.refunds)
+	}
+	if stored := ledger.payment(attempt.ID); stored.Status != models.PaymentStatusRefunded || stored.RefundedAmount != stored.Amount {
+		t.Errorf("stored payment is %s with %d of %d refunded", stored.Status, stored.RefundedAmount, stored.Amount)
+	}
+	if status := ledger.orderStatus(1); status != models.OrderStatusRefunded {
+		t.Errorf("order is %s, want %s", status, models.OrderStatusRefunded)
+	}
+}
+
+func TestRefundOrderReleasesPaymentWhenProviderDeclines(t *testing.T) {
+	user := &models.User{ID: 7}
+	service, ledger, provider := newPaymentTest(pendingOrder(1, user.ID))
+	attempt, apiErr := service.PayOrder(1, user, &models.PayOrderRequest{PaymentMethod: "tok_visa"})
+	if apiErr != nil {
+		t.Fatal(apiErr)
+	}
+	// Refunded behind the service's back, so the provider declines the refund
+	if err := provider.FakeProvider.Refund(context.Background(), attempt.TransactionID, attempt.Amount); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, apiErr := service.RefundOrder(1, 99, "damaged"); apiErr == nil || apiErr.Status != http.StatusConflict {
+		t.Fatalf("got %v, want the decline as 409", apiErr)
+	}
+	if stored := ledger.payment(attempt.ID); stored.Status != models.PaymentStatusCaptured {
+		t.Errorf("stored payment is %s, want it back to captured", stored.Status)
+	}
+	if status := ledger.orderStatus(1); status != models.OrderStatusPaid {
+		t.Errorf("order is %s, want it still %s", status, models.OrderStatusPaid)
+	}
+}
+
+func TestRefundOrderWithoutPaymentOnlyMovesOrder(t *testing.T) {
+	order := pendingOrder(1, 7)
+	order.Status = models.OrderStatusPaid
+	service, ledger, provider := newPaymentTest(order)
+
+	refundedOrder, apiErr := service.RefundOrder(1, 99, "paid in cash")
+	if apiErr != nil {
+		t.Fatal(apiErr)
+	}
+	if refundedOrder.Status != models.OrderStatusRefunded || ledger.orderStatus(1) != models.OrderStatusRefunded {
+		t.Errorf("order is %s, want %s", ledger.orderStatus(1), models.OrderStatusRefunded)
+	}
+	if provider.refunds != 0 {
+		t.Errorf("the provider was asked for %d refunds, want none", provider.refunds)
+	}
+}
+
+func TestPaymentsDisabledInProduction(t *testing.T) {
+	provider, err := payment.New(&config.Config{Env: "prod", PaymentProvider: "fake"})
+	if err != nil {
+		t.Fatalf("the fake provider in prod kept the server from starting: %v", err)
+	}
+	ledger := newPaymentLedger(pendingOrder(1, 7))
+	service := NewPaymentService(ledger, &ledgerOrderService{ledger: ledger}, provider, &config.Config{PaymentCurrency: "NGN"})
+
+	_, apiErr := service.PayOrder(1, &models.User{ID: 7}, &models.PayOrderRequest{PaymentMethod: "tok_visa"})
+	if apiErr == nil || apiErr.Status != http.StatusServiceUnavailable {
+		t.Fatalf("got %v, want 503", apiErr)
+	}
+	if status := ledger.orderStatus(1); status != models.OrderStatusPending {
+		t.Errorf("order is %s, want it still %s", status, models.OrderStatusPending)
+	}
+}
+
+func TestPayOrderChargesTheTotalShown(t *testing.T) {
+	order := &models.Order{ID: 1, UserID: 7, Status: models.OrderStatusPending, Items: []models.OrderItem{
+		{ProductID: 1, Quantity: 3, UnitPrice: 0.1},
+		{ProductID: 2, Quantity: 7, UnitPrice: 19.99},
+		{ProductID: 3, Quantity: 1, UnitPrice: 0.2},
+	}}
+	order.CalculateTotals()
+	service, _, _ := newPaymentTest(order)
+
+	attempt, apiErr := service.PayOrder(1, &models.User{ID: 7}, &models.PayOrderRequest{PaymentMethod: "tok_visa"})
+	if apiErr != nil {
+		t.Fatal(apiErr)
+	}
+	if attempt.Amount != 14043 || order.TotalPrice != 140.43 {
+		t.Errorf("charged %d for a total of %v, want 14043 for 140.43", attempt.Amount, order.TotalPrice)
+	}
+	if shown := fmt.Sprintf("%.2f", order.Items[1].TotalPrice); shown != "139.93" {
+		t.Errorf("line total is %s, want 139.93", shown)
+	}
+}
@@ -0,0 +1,248 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+
+	"github.com/techagentng/ecommerce-api/config"
+	"github.com/techagentng/ecommerce-api/db"
+	apiError "github.com/techagentng/ecommerce-api/errors"
+	"github.com/techagentng/ecommerce-api/models"
+	"gorm.io/gorm"
+)
+
+const maxAltTextLength = 255
+
+// ProductImageService manages the ordered image gallery of a product
+type ProductImageService interface {
+	ListImages(productID uint) ([]models.ProductImage, *apiError.Error)
+	AddImage(productID uint, image io.Reader, altText string) (*models.ProductImage, *apiError.Error)
+	UpdateImage(productID uint, imageID uint, request *models.UpdateProductImageRequest) (*models.ProductImage, *apiError.Error)
+	ReorderImages(productID uint, request *models.ReorderProductImagesRequest) ([]models.ProductImage, *apiError.Error)
+	DeleteImage(productID uint, imageID uint) *apiError.Error
+}
+
+type productImageService struct {
+	Config       *config.Config
+	imageRepo    db.ProductImageRepository
+	productRepo  db.ProductRepository
+	mediaService MediaService
+}
+
+// NewProductImageService constructor function
+func NewProductImageService(imageRepo db.ProductImageRepository, productRepo db.ProductRepository, mediaService MediaService, conf *config.Config) ProductImageService {
+	return &productImageService{
+		Config:       conf,
+		imageRepo:    imageRepo,
+		productRepo:  productRepo,
+		mediaService: mediaService,
+	}
+}
+
+func (p *productImageService) ListImages(productID uint) ([]models.ProductImage, *apiError.Error) {
+	if apiErr := p.ensureProduct(productID); apiErr != nil {
+		return nil, apiErr
+	}
+	return p.listImages(productID)
+}
+
+// AddImage stores an uploaded image and appends it to the end of the gallery
+func (p *productImageService) AddImage(productID uint, image io.Reader, altText string) (*models.ProductImage, *apiError.Error) {
+	if len(altText) > maxAltTextLength {
+		return nil, apiError.New(fmt.Sprintf("alt_text must not be longer than %d characters", maxAltTextLength), http.StatusBadRequest)
+	}
+	if apiErr := p.ensureProduct(productID); apiErr != nil {
+		return nil, apiErr
+	}
+	count, err := p.imageRepo.CountProductImages(productID)
+	if err != nil {
+		log.Printf("Error counting images of product %d: %v", productID, err)
+		return nil, apiError.ErrInternalServerError
+	}
+	if count >= int64(p.Config.MaxProductImages) {
+		return nil, apiError.New(fmt.Sprintf("a product can have at most %d images", p.Config.MaxProductImages), http.StatusConflict)
+	}
+
+	stored, apiErr := p.mediaService.StoreImage("products", image)
+	if apiErr != nil {
+		return nil, apiErr
+	}
+	large := stored.Renditions[models.RenditionLarge]
+	productImage := &models.ProductImage{
+		ProductID:    productID,
+		Key:          stored.Key,
+		URL:          large.URL,
+		MediumURL:    stored.Renditions[models.RenditionMedium].URL,
+		ThumbnailURL: stored.Renditions[models.RenditionThumbnail].URL,
+		Width:        large.Width,
+		Height:       large.Height,
+		AltText:      altText,
+		Position:     int(count),
+		ContentType:  stored.ContentType,
+		Size:         large.Size,
+	}
+	if err := p.imageRepo.CreateProductImage(productImage); err != nil {
+		log.Printf("Error creating image of product %d: %v", productID, err)
+		p.releaseImage(productImage)
+		return nil, apiError.New("unable to add image", http.StatusInternalServerError)
+	}
+	return productImage, nil
+}
+
+// UpdateImage changes an image's alt text and moves it to another position in
+// the gallery
+func (p *productImageService) UpdateImage(productID uint, imageID uint, request *models.UpdateProductImageRequest) (*models.ProductImage, *apiError.Error) {
+	image, apiErr := p.findImage(productID, imageID)
+	if apiErr != nil {
+		return nil, apiErr
+	}
+
+	if request.AltText != nil {
+		image.AltText = *request.AltText
+		if err := p.imageRepo.UpdateProductImage(image); err != nil {
+			log.Printf("Error updating image %d: %v", image.ID, err)
+			return nil, apiError.New("unable to update image", http.StatusInternalServerError)
+		}
+	}
+
+	if request.Position != nil && *request.Position != image.Position {
+		images, apiErr := p.listImages(productID)
+		if apiErr != nil {
+			return nil, apiErr
+		}
+		ids := make([]uint, 0, len(images))
+		for _, other := range images {
+			if other.ID != image.ID {
+				ids = append(ids, other.ID)
+			}
+		}
+		position := *request.Position
+		if position > len(ids) {
+			position = len(ids)
+		}
+		ids = append(ids[:position], append([]uint{image.ID}, ids[position:]...)...)
+		if err := p.imageRepo.SetProductImagePositions(productID, ids); err != nil {
+			log.Printf("Error reordering images of product %d: %v", productID, err)
+			return nil, apiError.New("unable to update image", http.StatusInternalServerError)
+		}
+		image.Position = position
+	}
+	return image, nil
+}
+
+// ReorderImages sets the gallery order. Every image of the product must be
+// listed exactly once.
+func (p *productImageService) ReorderImages(productID uint, request *models.ReorderProductImagesRequest) ([]models.ProductImage, *apiError.Error) {
+	if apiErr := p.ensureProduct(productID); apiErr != nil {
+		return nil, apiErr
+	}
+	images, apiErr := p.listImages(productID)
+	if apiErr != nil {
+		return nil, apiErr
+	}
+
+	remaining := make(map[uint]bool, len(images))
+	for _, image := range images {
+		remaining[image.ID] = true
+	}
+	for _, id := range request.ImageIDs {
+		if !remaining[id] {
+			return nil, apiError.New(fmt.Sprintf("image %d is not an image of this product or is listed twice", id), http.StatusBadRequest)
+		}
+		delete(remaining, id)
+	}
+	if len(remaining) > 0 {
+		return nil, apiError.New("image_ids must list every image of the product", http.StatusBadRequest)
+	}
+
+	if err := p.imageRepo.SetProductImagePositions(productID, request.ImageIDs); err != nil {
+		log.Printf("Error reordering images of product %d: %v", productID, err)
+		return nil, apiError.New("unable to reorder images", http.StatusInternalServerError)
+	}
+	return p.listImages(productID)
+}
+
+// DeleteImage removes an image from the gallery and deletes its blob
+func (p *productImageService) DeleteImage(productID uint, imageID uint) *apiError.Error {
+	image, apiErr := p.findImage(productID, imageID)
+	if apiErr != nil {
+		return apiErr
+	}
+	if err := p.imageRepo.DeleteProductImage(image); err != nil {
+		log.Printf("Error deleting image %d: %v", image.ID, err)
+		return apiError.New("unable to delete image", http.StatusInternalServerError)
+	}
+	p.releaseImage(image)
+	return nil
+}
+
+func (p *productImageService) listImages(productID uint) ([]models.ProductImage, *apiError.Error) {
+	images, err := p.imageRepo.ListProductImages(productID)
+	if err != nil {
+		log.Printf("Error listing images of product %d: %v", productID, err)
+		return nil, apiError.New("unable to list images", http.StatusInternalServerError)
+	}
+	if images == nil {
+		images = []models.ProductImage{}
+	}
+	return images, nil
+}
+
+func (p *productImageService) ensureProduct(productID uint) *apiError.Error {
+	product, err := p.productRepo.FindProductByID(productID)
+	if err != nil {
+		log.Printf("Error finding product %d: %v", productID, err)
+		return apiError.ErrInternalServerError
+	}
+	if product == nil {
+		return apiError.New("product not found", http.StatusNotFound)
+	}
+	return nil
+}
+
+func (p *productImageService) findImage(productID uint, imageID uint) (*models.ProductImage, *apiError.Error) {
+	image, err := p.imageRepo.FindProductImageByID(imageID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, apiError.New("image not found", http.StatusNotFound)
+		}
+		log.Printf("Error finding image %d: %v", imageID, err)
+		return nil, apiError.ErrInternalServerError
+	}
+	if image.ProductID != productID {
+		return nil, apiError.New("image not found", http.StatusNotFound)
+	}
+	return image, nil
+}
+
+func (p *productImageService) releaseImage(image *models.ProductImage) {
+	releaseProductImages(p.imageRepo, p.mediaService, []models.ProductImage{*image})
+}
+
+// releaseProductImages deletes the blobs of removed product images unless
+// another gallery image still uses them: the same upload is stored once and
+// shared. A failure only leaves orphaned files behind, so it is logged
+// rather than reported.
+func releaseProductImages(imageRepo db.ProductImageRepository, mediaService MediaService, images []models.ProductImage) {
+	released := map[string]bool{}
+	for _, image := range images {
+		if released[image.Key] {
+			continue
+		}
+		released[image.Key] = true
+		count, err := imageRepo.CountProductImagesByKey(image.Key)
+		if err != nil {
+			log.Printf("Error counting references to %s: %v", image.Key, err)
+			continue
+		}
+		if count > 0 {
+			continue
+		}
+		if err := mediaService.DeleteImage(image.Key, image.ContentType); err != nil {
+			log.Printf("Error deleting blobs of %s: %v", image.Key, err)
+		}
+	}
+}
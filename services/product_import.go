@@ -0,0 +1,330 @@
+package services
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/techagentng/ecommerce-api/db"
+	apiError "github.com/techagentng/ecommerce-api/errors"
+	"github.com/techagentng/ecommerce-api/models"
+)
+
+const exportBatchSize = 500
+
+// productValidator checks imported rows against the binding tags of
+// models.Product, the rules handleCreateProduct applies to JSON bodies.
+// Errors name fields by their JSON name.
+var productValidator = newProductValidator()
+
+func newProductValidator() *validator.Validate {
+	validate := validator.New()
+	validate.SetTagName("binding")
+	validate.RegisterTagNameFunc(func(field reflect.StructField) string {
+		return strings.Split(field.Tag.Get("json"), ",")[0]
+	})
+	return validate
+}
+
+// ImportProducts creates and updates products from a CSV or NDJSON file.
+// Every row is validated first; a single invalid row rejects the whole file
+// and the report lists the problems of all rows. Valid files are written in
+// one transaction, or only checked when dryRun is set.
+func (p *productService) ImportProducts(format string, r io.Reader, dryRun bool) (*models.ImportReport, *apiError.Error) {
+	var rows []models.ImportRow
+	var rowErrors []models.ImportRowError
+	var apiErr *apiError.Error
+	switch format {
+	case models.FormatCSV:
+		rows, rowErrors, apiErr = p.parseProductCSV(r)
+	case models.FormatNDJSON:
+		rows, rowErrors, apiErr = p.parseProductNDJSON(r)
+	default:
+		return nil, apiError.New("format must be csv or ndjson", http.StatusBadRequest)
+	}
+	if apiErr != nil {
+		return nil, apiErr
+	}
+
+	report := &models.ImportReport{
+		DryRun: dryRun,
+		Rows:   len(rows) + len(rowErrors),
+		Errors: rowErrors,
+	}
+	if report.Rows == 0 {
+		return nil, apiError.New("the file has no rows", http.StatusBadRequest)
+	}
+
+	seenSKUs := map[string]int{}
+	seenNames := map[string]int{}
+	for _, row := range rows {
+		report.Errors = append(report.Errors, validateImportRow(row)...)
+		if sku := row.Product.SKU; sku != nil {
+			if line, ok := seenSKUs[*sku]; ok {
+				report.Errors = append(report.Errors, models.ImportRowError{Line: row.Line, Field: "sku", Message: fmt.Sprintf("duplicates the SKU on line %d", line)})
+			}
+			seenSKUs[*sku] = row.Line
+		} else {
+			if line, ok := seenNames[row.Product.Name]; ok {
+				report.Errors = append(report.Errors, models.ImportRowError{Line: row.Line, Field: "name", Message: fmt.Sprintf("duplicates the name on line %d; add a sku to tell the products apart", line)})
+			}
+			seenNames[row.Product.Name] = row.Line
+		}
+	}
+	if len(report.Errors) > 0 {
+		sort.SliceStable(report.Errors, func(i, j int) bool { return report.Errors[i].Line < report.Errors[j].Line })
+		return report, nil
+	}
+
+	products := make([]*models.Product, len(rows))
+	for i := range rows {
+		products[i] = &rows[i].Product
+	}
+	created, err := p.productRepo.ImportProducts(products, dryRun)
+	if err != nil {
+		var rowErr *db.ImportRowError
+		if errors.As(err, &rowErr) {
+			log.Printf("Error importing line %d: %v", rows[rowErr.Index].Line, rowErr.Err)
+			report.Errors = append(report.Errors, models.ImportRowError{Line: rows[rowErr.Index].Line, Message: "could not be saved, e.g. because its SKU belongs to another product"})
+			return report, nil
+		}
+		log.Printf("Error importing products: %v", err)
+		return nil, apiError.New("unable to import products", http.StatusInternalServerError)
+	}
+
+	for i, product := range products {
+		if created[i] {
+			report.Created++
+		} else {
+			report.Updated++
+		}
+		if !dryRun {
+			p.indexProduct(product)
+		}
+	}
+	report.Committed = !dryRun
+	report.Errors = []models.ImportRowError{}
+	return report, nil
+}
+
+// ExportProducts writes every product as CSV or NDJSON, in the format
+// ImportProducts reads. Products are loaded in batches and written as they
+// arrive.
+func (p *productService) ExportProducts(format string, w io.Writer) error {
+	switch format {
+	case models.FormatCSV:
+		writer := csv.NewWriter(w)
+		if err := writer.Write(models.ProductCSVHeader); err != nil {
+			return err
+		}
+		err := p.productRepo.EachProduct(exportBatchSize, func(products []*models.Product) error {
+			for _, product := range products {
+				sku := ""
+				if product.SKU != nil {
+					sku = *product.SKU
+				}
+				record := []string{
+					sku,
+					product.Name,
+					product.Description,
+					strconv.FormatFloat(product.Price, 'f', -1, 64),
+					strconv.Itoa(product.Quantity),
+					strconv.Itoa(product.Stock),
+				}
+				if err := writer.Write(record); err != nil {
+					return err
+				}
+			}
+			writer.Flush()
+			return writer.Error()
+		})
+		if err != nil {
+			return err
+		}
+		writer.Flush()
+		return writer.Error()
+	case models.FormatNDJSON:
+		encoder := json.NewEncoder(w)
+		return p.productRepo.EachProduct(exportBatchSize, func(products []*models.Product) error {
+			for _, product := range products {
+				if err := encoder.Encode(toExportProduct(product)); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+	default:
+		return fmt.Errorf("unknown export format %q", format)
+	}
+}
+
+// exportProduct is a product as written to NDJSON: the importable fields only
+type exportProduct struct {
+	SKU         *string `json:"sku,omitempty"`
+	Name        string  `json:"name"`
+	Description string  `json:"description"`
+	Price       float64 `json:"price"`
+	Quantity    int     `json:"quantity"`
+	Stock       int     `json:"stock"`
+}
+
+func toExportProduct(product *models.Product) exportProduct {
+	return exportProduct{
+		SKU:         product.SKU,
+		Name:        product.Name,
+		Description: product.Description,
+		Price:       product.Price,
+		Quantity:    product.Quantity,
+		Stock:       product.Stock,
+	}
+}
+
+// parseProductCSV reads a CSV file whose first line names its columns
+func (p *productService) parseProductCSV(r io.Reader) ([]models.ImportRow, []models.ImportRowError, *apiError.Error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	header, err := reader.Read()
+	if err != nil {
+		return nil, nil, apiError.New("unable to read the CSV header", http.StatusBadRequest)
+	}
+	columns := map[string]int{}
+	for i, name := range header {
+		columns[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	for _, required := range []string{"name", "price"} {
+		if _, ok := columns[required]; !ok {
+			return nil, nil, apiError.New(fmt.Sprintf("the CSV header has no %s column", required), http.StatusBadRequest)
+		}
+	}
+
+	var rows []models.ImportRow
+	var rowErrors []models.ImportRowError
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			var parseErr *csv.ParseError
+			if !errors.As(err, &parseErr) {
+				return nil, nil, apiError.New("unable to read the CSV file", http.StatusBadRequest)
+			}
+			rowErrors = append(rowErrors, models.ImportRowError{Line: parseErr.Line, Message: parseErr.Err.Error()})
+			continue
+		}
+		line, _ := reader.FieldPos(0)
+		if apiErr := p.checkImportSize(len(rows) + len(rowErrors)); apiErr != nil {
+			return nil, nil, apiErr
+		}
+
+		value := func(column string) string {
+			if i, ok := columns[column]; ok && i < len(record) {
+				return strings.TrimSpace(record[i])
+			}
+			return ""
+		}
+		row := models.ImportRow{Line: line}
+		row.Product.Name = value("name")
+		row.Product.Description = value("description")
+		if sku := value("sku"); sku != "" {
+			row.Product.SKU = &sku
+		}
+
+		var fieldErrors []models.ImportRowError
+		parse := func(column string, set func(string) error) {
+			if v := value(column); v != "" {
+				if err := set(v); err != nil {
+					fieldErrors = append(fieldErrors, models.ImportRowError{Line: line, Field: column, Message: fmt.Sprintf("%q is not a number", v)})
+				}
+			}
+		}
+		parse("price", func(v string) (err error) { row.Product.Price, err = strconv.ParseFloat(v, 64); return })
+		parse("quantity", func(v string) (err error) { row.Product.Quantity, err = strconv.Atoi(v); return })
+		parse("stock", func(v string) (err error) { row.Product.Stock, err = strconv.Atoi(v); return })
+		if len(fieldErrors) > 0 {
+			rowErrors = append(rowErrors, fieldErrors...)
+			continue
+		}
+		rows = append(rows, row)
+	}
+	return rows, rowErrors, nil
+}
+
+// parseProductNDJSON reads one JSON product per line, skipping blank lines
+func (p *productService) parseProductNDJSON(r io.Reader) ([]models.ImportRow, []models.ImportRowError, *apiError.Error) {
+	var rows []models.ImportRow
+	var rowErrors []models.ImportRowError
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" {
+			continue
+		}
+		if apiErr := p.checkImportSize(len(rows) + len(rowErrors)); apiErr != nil {
+			return nil, nil, apiErr
+		}
+
+		var product exportProduct
+		decoder := json.NewDecoder(strings.NewReader(text))
+		decoder.DisallowUnknownFields()
+		if err := decoder.Decode(&product); err != nil {
+			rowErrors = append(rowErrors, models.ImportRowError{Line: line, Message: "invalid JSON: " + err.Error()})
+			continue
+		}
+		if product.SKU != nil && strings.TrimSpace(*product.SKU) == "" {
+			product.SKU = nil
+		}
+		rows = append(rows, models.ImportRow{Line: line, Product: models.Product{
+			SKU:         product.SKU,
+			Name:        product.Name,
+			Description: product.Description,
+			Price:       product.Price,
+			Quantity:    product.Quantity,
+			Stock:       product.Stock,
+		}})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, nil, apiError.New(fmt.Sprintf("unable to read line %d: %v", line+1, err), http.StatusBadRequest)
+	}
+	return rows, rowErrors, nil
+}
+
+func (p *productService) checkImportSize(rows int) *apiError.Error {
+	if rows >= p.Config.ImportMaxRows {
+		return apiError.New(fmt.Sprintf("import files are limited to %d rows", p.Config.ImportMaxRows), http.StatusRequestEntityTooLarge)
+	}
+	return nil
+}
+
+func validateImportRow(row models.ImportRow) []models.ImportRowError {
+	err := productValidator.Struct(&row.Product)
+	if err == nil {
+		return nil
+	}
+	var validationErrors validator.ValidationErrors
+	if !errors.As(err, &validationErrors) {
+		return []models.ImportRowError{{Line: row.Line, Message: err.Error()}}
+	}
+	rowErrors := make([]models.ImportRowError, 0, len(validationErrors))
+	for _, fieldErr := range validationErrors {
+		message := "failed the " + fieldErr.Tag() + " rule"
+		if fieldErr.Param() != "" {
+			message += " (" + fieldErr.Param() + ")"
+		}
+		rowErrors = append(rowErrors, models.ImportRowError{Line: row.Line, Field: fieldErr.Field(), Message: message})
+	}
+	return rowErrors
+}
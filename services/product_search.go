@@ -0,0 +1,114 @@
+package services
+
+import (
+	"log"
+	"net/http"
+	"strings"
+
+	apiError "github.com/techagentng/ecommerce-api/errors"
+	"github.com/techagentng/ecommerce-api/models"
+)
+
+const maxSearchQueryLength = 200
+
+// SearchProducts returns a page of catalog products matching a free text
+// query, best matches first, with the matched words highlighted
+func (p *productService) SearchProducts(query *models.ProductSearchQuery) (*models.ProductSearchResponse, *apiError.Error) {
+	query.Q = strings.TrimSpace(query.Q)
+	if query.Q == "" {
+		return nil, apiError.New("q is required", http.StatusBadRequest)
+	}
+	if len(query.Q) > maxSearchQueryLength {
+		return nil, apiError.New("q is too long", http.StatusBadRequest)
+	}
+	if query.Page < 1 {
+		query.Page = 1
+	}
+	if query.PageSize < 1 {
+		query.PageSize = defaultProductPageSize
+	}
+	if query.PageSize > maxProductPageSize {
+		query.PageSize = maxProductPageSize
+	}
+
+	hits, total, err := p.searchIndex.Search(query.Q, query.PageSize, (query.Page-1)*query.PageSize)
+	if err != nil {
+		log.Printf("Error searching products for %q: %v", query.Q, err)
+		return nil, apiError.New("unable to search products", http.StatusInternalServerError)
+	}
+
+	ids := make([]uint, 0, len(hits))
+	for _, hit := range hits {
+		ids = append(ids, hit.ProductID)
+	}
+	products, err := p.productRepo.FindProductsByIDs(ids)
+	if err != nil {
+		log.Printf("Error loading search results: %v", err)
+		return nil, apiError.ErrInternalServerError
+	}
+	variantCounts, apiErr := p.countVariants(products)
+	if apiErr != nil {
+		return nil, apiErr
+	}
+	byID := make(map[uint]*models.Product, len(products))
+	for _, product := range products {
+		byID[product.ID] = product
+	}
+
+	response := &models.ProductSearchResponse{
+		Results:  make([]models.ProductSearchResult, 0, len(hits)),
+		Total:    total,
+		Page:     query.Page,
+		PageSize: query.PageSize,
+	}
+	for _, hit := range hits {
+		// The index may briefly reference a product that was just deleted
+		product, ok := byID[hit.ProductID]
+		if !ok {
+			continue
+		}
+		response.Results = append(response.Results, models.ProductSearchResult{
+			CatalogProduct: toCatalogProduct(product, variantCounts),
+			Highlight: models.SearchHighlight{
+				Name:    hit.NameHighlight,
+				Snippet: hit.Snippet,
+			},
+		})
+	}
+	return response, nil
+}
+
+// RebuildSearchIndex indexes every product, e.g. to fill the memory index on
+// startup
+func (p *productService) RebuildSearchIndex() error {
+	query := &models.ProductListQuery{PageSize: maxProductPageSize, Sort: models.ProductSortID}
+	for {
+		products, _, err := p.productRepo.ListProducts(query)
+		if err != nil {
+			return err
+		}
+		// ListProducts returns one product more than a page when another follows
+		more := len(products) > query.PageSize
+		if more {
+			products = products[:query.PageSize]
+		}
+		for _, product := range products {
+			if err := p.searchIndex.IndexProduct(product); err != nil {
+				return err
+			}
+		}
+		if !more {
+			return nil
+		}
+		query.After = &models.ProductCursor{Sort: query.Sort, ID: products[len(products)-1].ID}
+	}
+}
+
+// indexProduct updates the search index after a product write. A failure is
+// only logged: the product is saved and is picked up again when it is next
+// updated or the index is rebuilt.
+func (p *productService) indexProduct(product *models.Product) {
+	if err := p.searchIndex.IndexProduct(product); err != nil {
+		log.Printf("Error indexing product %d: %v", product.ID, err)
+	}
+}
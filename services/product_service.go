@@ -0,0 +1,319 @@
+package services
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+
+	"github.com/techagentng/ecommerce-api/config"
+	"github.com/techagentng/ecommerce-api/db"
+	apiError "github.com/techagentng/ecommerce-api/errors"
+	"github.com/techagentng/ecommerce-api/models"
+	"gorm.io/gorm"
+)
+
+const (
+	defaultProductPageSize = 20
+	maxProductPageSize     = 100
+)
+
+// ProductService manages products and lists them for admins and the public catalog
+type ProductService interface {
+	CreateProduct(product *models.Product) (*models.Product, *apiError.Error)
+	UpdateProduct(product *models.Product) *apiError.Error
+	DeleteProduct(productID uint) *apiError.Error
+	ListProducts(query *models.ProductListQuery) (*models.ProductListResponse, *apiError.Error)
+	ListCatalog(query *models.ProductListQuery) (*models.CatalogListResponse, *apiError.Error)
+	GetCatalogProduct(productID uint) (*models.CatalogProduct, *apiError.Error)
+	SearchProducts(query *models.ProductSearchQuery) (*models.ProductSearchResponse, *apiError.Error)
+	ImportProducts(format string, r io.Reader, dryRun bool) (*models.ImportReport, *apiError.Error)
+	ExportProducts(format string, w io.Writer) error
+	RebuildSearchIndex() error
+}
+
+type productService struct {
+	Config       *config.Config
+	productRepo  db.ProductRepository
+	categoryRepo db.CategoryRepository
+	variantRepo  db.VariantRepository
+	imageRepo    db.ProductImageRepository
+	searchIndex  db.SearchIndex
+	mediaService MediaService
+}
+
+// NewProductService constructor function
+func NewProductService(productRepo db.ProductRepository, categoryRepo db.CategoryRepository, variantRepo db.VariantRepository, imageRepo db.ProductImageRepository, searchIndex db.SearchIndex, mediaService MediaService, conf *config.Config) ProductService {
+	return &productService{
+		Config:       conf,
+		productRepo:  productRepo,
+		categoryRepo: categoryRepo,
+		variantRepo:  variantRepo,
+		imageRepo:    imageRepo,
+		searchIndex:  searchIndex,
+		mediaService: mediaService,
+	}
+}
+
+// CreateProduct stores a new product and adds it to the search index. Its
+// stock opens the product's stock ledger.
+func (p *productService) CreateProduct(product *models.Product) (*models.Product, *apiError.Error) {
+	// Older clients send the opening stock as quantity
+	if product.Stock == 0 && product.Quantity > 0 {
+		product.Stock = product.Quantity
+	}
+	created, err := p.productRepo.CreateProduct(product)
+	if err != nil {
+		log.Printf("Error creating product: %v", err)
+		return nil, apiError.New("unable to create product", http.StatusInternalServerError)
+	}
+	p.indexProduct(created)
+	return created, nil
+}
+
+// UpdateProduct replaces a product's fields, except its stock, and reindexes it
+func (p *productService) UpdateProduct(product *models.Product) *apiError.Error {
+	if apiErr := p.ensureProductExists(product.ID); apiErr != nil {
+		return apiErr
+	}
+	if err := p.productRepo.UpdateProduct(product); err != nil {
+		log.Printf("Error updating product %d: %v", product.ID, err)
+		return apiError.New("unable to update product", http.StatusInternalServerError)
+	}
+	p.indexProduct(product)
+	return nil
+}
+
+// DeleteProduct deletes a product with its image blobs and removes it from the
+// search index
+func (p *productService) DeleteProduct(productID uint) *apiError.Error {
+	if apiErr := p.ensureProductExists(productID); apiErr != nil {
+		return apiErr
+	}
+	images, err := p.imageRepo.ListProductImages(productID)
+	if err != nil {
+		log.Printf("Error listing images of product %d: %v", productID, err)
+		return apiError.ErrInternalServerError
+	}
+	if err := p.productRepo.DeleteProduct(productID); err != nil {
+		log.Printf("Error deleting product %d: %v", productID, err)
+		return apiError.New("unable to delete product", http.StatusInternalServerError)
+	}
+	releaseProductImages(p.imageRepo, p.mediaService, images)
+	if err := p.searchIndex.RemoveProduct(productID); err != nil {
+		log.Printf("Error removing product %d from the search index: %v", productID, err)
+	}
+	return nil
+}
+
+func (p *productService) ensureProductExists(productID uint) *apiError.Error {
+	product, err := p.productRepo.FindProductByID(productID)
+	if err != nil {
+		log.Printf("Error finding product %d: %v", productID, err)
+		return apiError.ErrInternalServerError
+	}
+	if product == nil {
+		return apiError.New("product not found", http.StatusNotFound)
+	}
+	return nil
+}
+
+// ListProducts returns a page of products. A page is selected by offset with
+// query.Page or by keyset with query.Cursor; next_cursor is set whenever
+// another page follows, whichever was used.
+func (p *productService) ListProducts(query *models.ProductListQuery) (*models.ProductListResponse, *apiError.Error) {
+	if query.PageSize < 1 {
+		query.PageSize = defaultProductPageSize
+	}
+	if query.PageSize > maxProductPageSize {
+		query.PageSize = maxProductPageSize
+	}
+	if query.Sort == "" {
+		query.Sort = models.ProductSortID
+	}
+	switch query.SortKey() {
+	case models.ProductSortID, models.ProductSortName, models.ProductSortPrice:
+	default:
+		return nil, apiError.New("sort must be one of id, name or price, optionally prefixed with -", http.StatusBadRequest)
+	}
+	if query.MinPrice != nil && query.MaxPrice != nil && *query.MinPrice > *query.MaxPrice {
+		return nil, apiError.New("min_price cannot be greater than max_price", http.StatusBadRequest)
+	}
+
+	if query.Category != nil {
+		category, err := p.categoryRepo.FindCategoryByID(*query.Category)
+		if err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return nil, apiError.New("category not found", http.StatusBadRequest)
+			}
+			log.Printf("Error finding category %d: %v", *query.Category, err)
+			return nil, apiError.ErrInternalServerError
+		}
+		query.CategoryPath = category.Path
+	}
+
+	if query.Cursor != "" {
+		if query.Page > 1 {
+			return nil, apiError.New("use either page or cursor, not both", http.StatusBadRequest)
+		}
+		cursor, err := decodeProductCursor(query.Cursor)
+		if err != nil || cursor.Sort != query.Sort {
+			return nil, apiError.New("invalid cursor", http.StatusBadRequest)
+		}
+		query.After = cursor
+	} else if query.Page < 1 {
+		query.Page = 1
+	}
+
+	products, total, err := p.productRepo.ListProducts(query)
+	if err != nil {
+		log.Printf("Error listing products: %v", err)
+		return nil, apiError.New("unable to list products", http.StatusInternalServerError)
+	}
+
+	response := &models.ProductListResponse{
+		Products: products,
+		Total:    total,
+		Page:     query.Page,
+		PageSize: query.PageSize,
+	}
+	if len(products) > query.PageSize {
+		response.Products = products[:query.PageSize]
+		last := response.Products[query.PageSize-1]
+		response.NextCursor = encodeProductCursor(&models.ProductCursor{
+			Sort:  query.Sort,
+			ID:    last.ID,
+			Name:  last.Name,
+			Price: last.Price,
+		})
+	}
+	if response.Products == nil {
+		response.Products = []*models.Product{}
+	}
+	return response, nil
+}
+
+// ListCatalog lists products as customers see them, with the same pagination,
+// filters and sorting as ListProducts
+func (p *productService) ListCatalog(query *models.ProductListQuery) (*models.CatalogListResponse, *apiError.Error) {
+	list, apiErr := p.ListProducts(query)
+	if apiErr != nil {
+		return nil, apiErr
+	}
+	variantCounts, apiErr := p.countVariants(list.Products)
+	if apiErr != nil {
+		return nil, apiErr
+	}
+
+	response := &models.CatalogListResponse{
+		Products:   make([]models.CatalogProduct, 0, len(list.Products)),
+		Total:      list.Total,
+		Page:       list.Page,
+		PageSize:   list.PageSize,
+		NextCursor: list.NextCursor,
+	}
+	for _, product := range list.Products {
+		response.Products = append(response.Products, toCatalogProduct(product, variantCounts))
+	}
+	return response, nil
+}
+
+func (p *productService) GetCatalogProduct(productID uint) (*models.CatalogProduct, *apiError.Error) {
+	product, err := p.productRepo.FindProductByID(productID)
+	if err != nil {
+		log.Printf("Error finding product %d: %v", productID, err)
+		return nil, apiError.ErrInternalServerError
+	}
+	if product == nil {
+		return nil, apiError.New("product not found", http.StatusNotFound)
+	}
+	catalogProduct := toCatalogProduct(product, nil)
+
+	variants, err := p.variantRepo.ListVariants(product.ID)
+	if err != nil {
+		log.Printf("Error listing variants of product %d: %v", productID, err)
+		return nil, apiError.ErrInternalServerError
+	}
+	for _, variant := range variants {
+		catalogProduct.Variants = append(catalogProduct.Variants, models.CatalogVariant{
+			ID:        variant.ID,
+			SKU:       variant.SKU,
+			Price:     variant.EffectivePrice(product),
+			Available: variant.Stock > 0,
+			Options:   variant.Options(),
+		})
+	}
+	images, err := p.imageRepo.ListProductImages(product.ID)
+	if err != nil {
+		log.Printf("Error listing images of product %d: %v", productID, err)
+		return nil, apiError.ErrInternalServerError
+	}
+	for _, image := range images {
+		catalogProduct.Images = append(catalogProduct.Images, models.CatalogImage{
+			URL:          image.URL,
+			MediumURL:    image.MediumURL,
+			ThumbnailURL: image.ThumbnailURL,
+			AltText:      image.AltText,
+		})
+	}
+
+	if len(variants) > 0 {
+		catalogProduct.Available = false
+		for _, variant := range catalogProduct.Variants {
+			catalogProduct.Available = catalogProduct.Available || variant.Available
+		}
+	}
+	return &catalogProduct, nil
+}
+
+// countVariants counts the variants of the products in one query, for
+// toCatalogProduct
+func (p *productService) countVariants(products []*models.Product) (map[uint]db.VariantCounts, *apiError.Error) {
+	productIDs := make([]uint, 0, len(products))
+	for _, product := range products {
+		productIDs = append(productIDs, product.ID)
+	}
+	variantCounts, err := p.variantRepo.CountVariantsByProductIDs(productIDs)
+	if err != nil {
+		log.Printf("Error counting variants of products %v: %v", productIDs, err)
+		return nil, apiError.ErrInternalServerError
+	}
+	return variantCounts, nil
+}
+
+// toCatalogProduct builds the customer view of a product. A product with
+// variants is available when one of them is in stock, so variantCounts should
+// hold its counts; others are available while they have stock.
+func toCatalogProduct(product *models.Product, variantCounts map[uint]db.VariantCounts) models.CatalogProduct {
+	available := product.Stock > 0
+	if counts, ok := variantCounts[product.ID]; ok {
+		available = counts.InStock > 0
+	}
+	return models.CatalogProduct{
+		ID:          product.ID,
+		Name:        product.Name,
+		Description: product.Description,
+		Price:       product.Price,
+		Available:   available,
+	}
+}
+
+// Cursors are opaque to clients: base64url encoded JSON
+func encodeProductCursor(cursor *models.ProductCursor) string {
+	data, _ := json.Marshal(cursor)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodeProductCursor(value string) (*models.ProductCursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return nil, err
+	}
+	var cursor models.ProductCursor
+	if err := json.Unmarshal(data, &cursor); err != nil {
+		return nil, err
+	}
+	return &cursor, nil
+}
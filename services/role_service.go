@@ -0,0 +1,208 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/techagentng/ecommerce-api/config"
+	"github.com/techagentng/ecommerce-api/db"
+	apiError "github.com/techagentng/ecommerce-api/errors"
+	"github.com/techagentng/ecommerce-api/models"
+	"gorm.io/gorm"
+)
+
+// RoleService resolves roles to permissions and manages roles
+type RoleService interface {
+	HasPermission(roleName string, permission string) (bool, error)
+	ListRoles() ([]*models.Role, error)
+	ListPermissions() ([]*models.Permission, error)
+	CreateRole(request *models.CreateRoleRequest) (*models.Role, *apiError.Error)
+	AssignPermissions(roleName string, permissions []string) (*models.Role, *apiError.Error)
+	RequiresMFA(roleName string) (bool, error)
+	SetRequireMFA(roleName string, requireMFA bool) (*models.Role, *apiError.Error)
+}
+
+type cachedPermissions struct {
+	permissions map[string]struct{}
+	requireMFA  bool
+	expiresAt   time.Time
+}
+
+type roleService struct {
+	Config   *config.Config
+	roleRepo db.RoleRepository
+
+	mu    sync.RWMutex
+	cache map[string]cachedPermissions
+}
+
+// NewRoleService constructor function
+func NewRoleService(roleRepo db.RoleRepository, conf *config.Config) RoleService {
+	return &roleService{
+		Config:   conf,
+		roleRepo: roleRepo,
+		cache:    map[string]cachedPermissions{},
+	}
+}
+
+// HasPermission reports whether the role grants permission. A role's
+// permission set is cached for Config.PermissionCacheTTL.
+func (r *roleService) HasPermission(roleName string, permission string) (bool, error) {
+	cached, err := r.cachedRole(roleName)
+	if err != nil {
+		return false, err
+	}
+	_, ok := cached.permissions[permission]
+	return ok, nil
+}
+
+// RequiresMFA reports whether members of the role must have MFA enabled
+func (r *roleService) RequiresMFA(roleName string) (bool, error) {
+	cached, err := r.cachedRole(roleName)
+	if err != nil {
+		return false, err
+	}
+	return cached.requireMFA, nil
+}
+
+func (r *roleService) cachedRole(roleName string) (cachedPermissions, error) {
+	r.mu.RLock()
+	cached, ok := r.cache[roleName]
+	r.mu.RUnlock()
+	if ok && time.Now().Before(cached.expiresAt) {
+		return cached, nil
+	}
+
+	cached = cachedPermissions{
+		permissions: map[string]struct{}{},
+		expiresAt:   time.Now().Add(r.Config.PermissionCacheTTL),
+	}
+	role, err := r.roleRepo.FindRoleWithPermissions(roleName)
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return cachedPermissions{}, err
+	}
+	// An unknown role is cached as having no permissions
+	if role != nil {
+		for _, permission := range role.Permissions {
+			cached.permissions[permission.Name] = struct{}{}
+		}
+		cached.requireMFA = role.RequireMFA
+	}
+
+	r.mu.Lock()
+	r.cache[roleName] = cached
+	r.mu.Unlock()
+	return cached, nil
+}
+
+func (r *roleService) invalidate(roleName string) {
+	r.mu.Lock()
+	delete(r.cache, roleName)
+	r.mu.Unlock()
+}
+
+func (r *roleService) ListRoles() ([]*models.Role, error) {
+	return r.roleRepo.ListRoles()
+}
+
+func (r *roleService) ListPermissions() ([]*models.Permission, error) {
+	return r.roleRepo.ListPermissions()
+}
+
+// CreateRole creates a new role with the given permissions
+func (r *roleService) CreateRole(request *models.CreateRoleRequest) (*models.Role, *apiError.Error) {
+	if _, err := r.roleRepo.FindRoleWithPermissions(request.Name); err == nil {
+		return nil, apiError.New(fmt.Sprintf("role %s already exists", request.Name), http.StatusConflict)
+	} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+		log.Printf("Error finding role %s: %v", request.Name, err)
+		return nil, apiError.ErrInternalServerError
+	}
+
+	permissions, apiErr := r.resolvePermissions(request.Permissions)
+	if apiErr != nil {
+		return nil, apiErr
+	}
+
+	role, err := r.roleRepo.CreateRole(&models.Role{Name: request.Name, Permissions: permissions})
+	if err != nil {
+		log.Printf("Error creating role %s: %v", request.Name, err)
+		return nil, apiError.New("unable to create role", http.StatusInternalServerError)
+	}
+	r.invalidate(role.Name)
+	return role, nil
+}
+
+// AssignPermissions replaces the permissions of a role
+func (r *roleService) AssignPermissions(roleName string, permissionNames []string) (*models.Role, *apiError.Error) {
+	role, err := r.roleRepo.FindRoleWithPermissions(roleName)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, apiError.New("role not found", http.StatusNotFound)
+		}
+		log.Printf("Error finding role %s: %v", roleName, err)
+		return nil, apiError.ErrInternalServerError
+	}
+
+	permissions, apiErr := r.resolvePermissions(permissionNames)
+	if apiErr != nil {
+		return nil, apiErr
+	}
+
+	if err := r.roleRepo.ReplaceRolePermissions(role, permissions); err != nil {
+		log.Printf("Error assigning permissions to role %s: %v", roleName, err)
+		return nil, apiError.New("unable to assign permissions", http.StatusInternalServerError)
+	}
+	r.invalidate(role.Name)
+	role.Permissions = permissions
+	return role, nil
+}
+
+// SetRequireMFA sets whether members of the role must enroll in MFA
+func (r *roleService) SetRequireMFA(roleName string, requireMFA bool) (*models.Role, *apiError.Error) {
+	role, err := r.roleRepo.FindRoleWithPermissions(roleName)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, apiError.New("role not found", http.StatusNotFound)
+		}
+		log.Printf("Error finding role %s: %v", roleName, err)
+		return nil, apiError.ErrInternalServerError
+	}
+
+	if err := r.roleRepo.SetRoleRequireMFA(role.ID, requireMFA); err != nil {
+		log.Printf("Error updating MFA policy of role %s: %v", roleName, err)
+		return nil, apiError.New("unable to update role", http.StatusInternalServerError)
+	}
+	r.invalidate(role.Name)
+	role.RequireMFA = requireMFA
+	return role, nil
+}
+
+// resolvePermissions loads the named permissions, rejecting unknown names
+func (r *roleService) resolvePermissions(names []string) ([]models.Permission, *apiError.Error) {
+	permissions, err := r.roleRepo.FindPermissionsByNames(names)
+	if err != nil {
+		log.Printf("Error finding permissions %v: %v", names, err)
+		return nil, apiError.ErrInternalServerError
+	}
+
+	found := map[string]bool{}
+	for _, permission := range permissions {
+		found[permission.Name] = true
+	}
+	var unknown []string
+	for _, name := range names {
+		if !found[name] {
+			unknown = append(unknown, name)
+		}
+	}
+	if len(unknown) > 0 {
+		sort.Strings(unknown)
+		return nil, apiError.New(fmt.Sprintf("unknown permissions: %v", unknown), http.StatusBadRequest)
+	}
+	return permissions, nil
+}
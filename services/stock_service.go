@@ -0,0 +1,134 @@
+package services
+
+import (
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/techagentng/ecommerce-api/config"
+	"github.com/techagentng/ecommerce-api/db"
+	apiError "github.com/techagentng/ecommerce-api/errors"
+	"github.com/techagentng/ecommerce-api/models"
+	"gorm.io/gorm"
+)
+
+const (
+	defaultStockPageSize = 50
+	maxStockPageSize     = 200
+)
+
+// StockService adjusts stock through the ledger and reports on it
+type StockService interface {
+	AdjustStock(productID uint, actorID uint, request *models.StockAdjustmentRequest) (*models.StockMovement, *apiError.Error)
+	ListStockMovements(productID uint, query *models.StockMovementQuery) (*models.StockMovementListResponse, *apiError.Error)
+	ReconcileStock(fix bool) ([]models.StockDrift, error)
+}
+
+type stockService struct {
+	Config      *config.Config
+	stockRepo   db.StockRepository
+	productRepo db.ProductRepository
+	variantRepo db.VariantRepository
+}
+
+// NewStockService constructor function
+func NewStockService(stockRepo db.StockRepository, productRepo db.ProductRepository, variantRepo db.VariantRepository, conf *config.Config) StockService {
+	return &stockService{
+		Config:      conf,
+		stockRepo:   stockRepo,
+		productRepo: productRepo,
+		variantRepo: variantRepo,
+	}
+}
+
+// AdjustStock restocks or corrects the stock of a product, or of one of its
+// variants, on behalf of actorID
+func (s *stockService) AdjustStock(productID uint, actorID uint, request *models.StockAdjustmentRequest) (*models.StockMovement, *apiError.Error) {
+	movement := &models.StockMovement{
+		ProductID: productID,
+		VariantID: request.VariantID,
+		Change:    request.Change,
+		Reason:    request.Reason,
+		ActorID:   &actorID,
+		Note:      request.Note,
+	}
+	if err := s.stockRepo.AdjustStock(movement); err != nil {
+		switch {
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			if request.VariantID != nil {
+				return nil, apiError.New("variant not found", http.StatusNotFound)
+			}
+			return nil, apiError.New("product not found", http.StatusNotFound)
+		case errors.Is(err, db.ErrInsufficientStock):
+			return nil, apiError.New("the adjustment would make the stock negative", http.StatusConflict)
+		}
+		log.Printf("Error adjusting stock of product %d: %v", productID, err)
+		return nil, apiError.New("unable to adjust stock", http.StatusInternalServerError)
+	}
+	return movement, nil
+}
+
+// ListStockMovements returns a page of the stock history of a product, or of
+// one of its variants, newest first
+func (s *stockService) ListStockMovements(productID uint, query *models.StockMovementQuery) (*models.StockMovementListResponse, *apiError.Error) {
+	product, err := s.productRepo.FindProductByID(productID)
+	if err != nil {
+		log.Printf("Error finding product %d: %v", productID, err)
+		return nil, apiError.ErrInternalServerError
+	}
+	if product == nil {
+		return nil, apiError.New("product not found", http.StatusNotFound)
+	}
+	if query.VariantID != nil {
+		variant, err := s.variantRepo.FindVariantByID(*query.VariantID)
+		if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			log.Printf("Error finding variant %d: %v", *query.VariantID, err)
+			return nil, apiError.ErrInternalServerError
+		}
+		if variant == nil || variant.ProductID != productID {
+			return nil, apiError.New("variant not found", http.StatusNotFound)
+		}
+	}
+	if query.Page < 1 {
+		query.Page = 1
+	}
+	if query.PageSize < 1 {
+		query.PageSize = defaultStockPageSize
+	}
+	if query.PageSize > maxStockPageSize {
+		query.PageSize = maxStockPageSize
+	}
+
+	movements, total, err := s.stockRepo.ListStockMovements(productID, query)
+	if err != nil {
+		log.Printf("Error listing stock movements of product %d: %v", productID, err)
+		return nil, apiError.New("unable to list stock movements", http.StatusInternalServerError)
+	}
+	if movements == nil {
+		movements = []models.StockMovement{}
+	}
+	return &models.StockMovementListResponse{
+		Movements: movements,
+		Total:     total,
+		Page:      query.Page,
+		PageSize:  query.PageSize,
+	}, nil
+}
+
+// ReconcileStock returns every product and variant whose stock differs from
+// its ledger. With fix, their stock is set to the ledger balance.
+func (s *stockService) ReconcileStock(fix bool) ([]models.StockDrift, error) {
+	drift, err := s.stockRepo.FindStockDrift()
+	if err != nil {
+		return nil, err
+	}
+	if !fix {
+		return drift, nil
+	}
+	for i := range drift {
+		if err := s.stockRepo.SyncStockToLedger(&drift[i]); err != nil {
+			return nil, err
+		}
+	}
+	return drift, nil
+}
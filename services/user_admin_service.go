@@ -0,0 +1,267 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/techagentng/ecommerce-api/config"
+	"github.com/techagentng/ecommerce-api/db"
+	apiError "github.com/techagentng/ecommerce-api/errors"
+	"github.com/techagentng/ecommerce-api/models"
+	"gorm.io/gorm"
+)
+
+const (
+	defaultUserPageSize = 20
+	maxUserPageSize     = 100
+)
+
+// UserAdminService lets admins inspect and manage user accounts. Every change
+// is recorded in the admin audit log with the acting admin's ID.
+type UserAdminService interface {
+	ListUsers(query *models.UserListQuery) (*models.UserListResponse, *apiError.Error)
+	GetUser(userID uint) (*models.AdminUserResponse, *apiError.Error)
+	AssignRole(actorID uint, userID uint, roleName string) (*models.AdminUserResponse, *apiError.Error)
+	SuspendUser(actorID uint, userID uint, reason string) *apiError.Error
+	UnsuspendUser(actorID uint, userID uint) *apiError.Error
+	DeleteUser(actorID uint, userID uint) *apiError.Error
+	RevokeSessions(actorID uint, userID uint) *apiError.Error
+	UnlockUser(actorID uint, userID uint) *apiError.Error
+	ResetMFA(actorID uint, userID uint) *apiError.Error
+}
+
+type userAdminService struct {
+	Config        *config.Config
+	userRepo      db.UserRepository
+	authRepo      db.AuthRepository
+	authService   AuthService
+	loginThrottle *LoginThrottle
+}
+
+// NewUserAdminService constructor function
+func NewUserAdminService(userRepo db.UserRepository, authRepo db.AuthRepository, authService AuthService, loginThrottle *LoginThrottle, conf *config.Config) UserAdminService {
+	return &userAdminService{
+		Config:        conf,
+		userRepo:      userRepo,
+		authRepo:      authRepo,
+		authService:   authService,
+		loginThrottle: loginThrottle,
+	}
+}
+
+func (u *userAdminService) ListUsers(query *models.UserListQuery) (*models.UserListResponse, *apiError.Error) {
+	if query.Page < 1 {
+		query.Page = 1
+	}
+	if query.PageSize < 1 {
+		query.PageSize = defaultUserPageSize
+	}
+	if query.PageSize > maxUserPageSize {
+		query.PageSize = maxUserPageSize
+	}
+	switch query.Status {
+	case "", "active", "suspended", "unverified", "deleted":
+	default:
+		return nil, apiError.New("status must be one of active, suspended, unverified or deleted", http.StatusBadRequest)
+	}
+
+	users, total, err := u.userRepo.ListUsers(query)
+	if err != nil {
+		log.Printf("Error listing users: %v", err)
+		return nil, apiError.New("unable to list users", http.StatusInternalServerError)
+	}
+
+	response := &models.UserListResponse{
+		Users:    make([]models.AdminUserResponse, 0, len(users)),
+		Total:    total,
+		Page:     query.Page,
+		PageSize: query.PageSize,
+	}
+	for _, user := range users {
+		response.Users = append(response.Users, toAdminUserResponse(user))
+	}
+	return response, nil
+}
+
+func (u *userAdminService) GetUser(userID uint) (*models.AdminUserResponse, *apiError.Error) {
+	user, apiErr := u.findUser(userID)
+	if apiErr != nil {
+		return nil, apiErr
+	}
+	response := toAdminUserResponse(user)
+	return &response, nil
+}
+
+// AssignRole moves the user to another role. Existing tokens carry the old
+// role, so the user's sessions are revoked.
+func (u *userAdminService) AssignRole(actorID uint, userID uint, roleName string) (*models.AdminUserResponse, *apiError.Error) {
+	user, apiErr := u.findUser(userID)
+	if apiErr != nil {
+		return nil, apiErr
+	}
+
+	role, err := u.authRepo.FindRoleByName(roleName)
+	if err != nil {
+		return nil, apiError.New(fmt.Sprintf("role %s not found", roleName), http.StatusBadRequest)
+	}
+
+	if err := u.userRepo.UpdateUserRole(user.ID, role.ID); err != nil {
+		log.Printf("Error assigning role %s to user %d: %v", roleName, user.ID, err)
+		return nil, apiError.New("unable to assign role", http.StatusInternalServerError)
+	}
+	if apiErr := u.authService.RevokeAllSessions(user.ID); apiErr != nil {
+		return nil, apiErr
+	}
+	u.audit(actorID, user.ID, models.AuditActionAssignRole, fmt.Sprintf("%s -> %s", user.Role.Name, role.Name))
+
+	user.RoleID = role.ID
+	user.Role = *role
+	response := toAdminUserResponse(user)
+	return &response, nil
+}
+
+// SuspendUser blocks the user from authenticating and revokes their sessions
+func (u *userAdminService) SuspendUser(actorID uint, userID uint, reason string) *apiError.Error {
+	if actorID == userID {
+		return apiError.New("you cannot suspend your own account", http.StatusBadRequest)
+	}
+	user, apiErr := u.findUser(userID)
+	if apiErr != nil {
+		return apiErr
+	}
+
+	if err := u.userRepo.SetUserSuspended(user.ID, time.Now().Unix(), reason); err != nil {
+		log.Printf("Error suspending user %d: %v", user.ID, err)
+		return apiError.New("unable to suspend user", http.StatusInternalServerError)
+	}
+	if apiErr := u.authService.RevokeAllSessions(user.ID); apiErr != nil {
+		return apiErr
+	}
+	u.audit(actorID, user.ID, models.AuditActionSuspend, reason)
+	return nil
+}
+
+func (u *userAdminService) UnsuspendUser(actorID uint, userID uint) *apiError.Error {
+	user, apiErr := u.findUser(userID)
+	if apiErr != nil {
+		return apiErr
+	}
+
+	if err := u.userRepo.SetUserSuspended(user.ID, 0, ""); err != nil {
+		log.Printf("Error lifting suspension of user %d: %v", user.ID, err)
+		return apiError.New("unable to unsuspend user", http.StatusInternalServerError)
+	}
+	u.audit(actorID, user.ID, models.AuditActionUnsuspend, "")
+	return nil
+}
+
+// DeleteUser soft deletes the user so their orders keep a valid owner
+func (u *userAdminService) DeleteUser(actorID uint, userID uint) *apiError.Error {
+	if actorID == userID {
+		return apiError.New("you cannot delete your own account", http.StatusBadRequest)
+	}
+	user, apiErr := u.findUser(userID)
+	if apiErr != nil {
+		return apiErr
+	}
+	if user.DeletedAt != 0 {
+		return apiError.New("user not found", http.StatusNotFound)
+	}
+
+	if err := u.userRepo.SoftDeleteUser(user.ID, time.Now().Unix()); err != nil {
+		log.Printf("Error deleting user %d: %v", user.ID, err)
+		return apiError.New("unable to delete user", http.StatusInternalServerError)
+	}
+	if apiErr := u.authService.RevokeAllSessions(user.ID); apiErr != nil {
+		return apiErr
+	}
+	u.audit(actorID, user.ID, models.AuditActionDelete, "")
+	return nil
+}
+
+func (u *userAdminService) RevokeSessions(actorID uint, userID uint) *apiError.Error {
+	if apiErr := u.authService.RevokeAllSessions(userID); apiErr != nil {
+		return apiErr
+	}
+	u.audit(actorID, userID, models.AuditActionRevokeSessions, "")
+	return nil
+}
+
+// UnlockUser clears a login lockout on the user's account
+func (u *userAdminService) UnlockUser(actorID uint, userID uint) *apiError.Error {
+	user, apiErr := u.findUser(userID)
+	if apiErr != nil {
+		return apiErr
+	}
+	if err := u.loginThrottle.Unlock(user.Email); err != nil {
+		log.Printf("Error unlocking user %d: %v", user.ID, err)
+		return apiError.New("unable to unlock user", http.StatusInternalServerError)
+	}
+	u.audit(actorID, user.ID, models.AuditActionUnlock, "")
+	return nil
+}
+
+// ResetMFA removes the user's MFA enrollment so they can enroll a new device.
+// Their sessions are revoked since they may have been taken over.
+func (u *userAdminService) ResetMFA(actorID uint, userID uint) *apiError.Error {
+	user, apiErr := u.findUser(userID)
+	if apiErr != nil {
+		return apiErr
+	}
+	if apiErr := u.authService.ResetMFA(user.ID); apiErr != nil {
+		return apiErr
+	}
+	if apiErr := u.authService.RevokeAllSessions(user.ID); apiErr != nil {
+		return apiErr
+	}
+	u.audit(actorID, user.ID, models.AuditActionResetMFA, "")
+	return nil
+}
+
+func (u *userAdminService) findUser(userID uint) (*models.User, *apiError.Error) {
+	user, err := u.userRepo.FindUserWithRole(userID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, apiError.New("user not found", http.StatusNotFound)
+		}
+		log.Printf("Error finding user %d: %v", userID, err)
+		return nil, apiError.ErrInternalServerError
+	}
+	return user, nil
+}
+
+// audit records an admin action. A failure is logged rather than returned
+// because the change itself has already been applied.
+func (u *userAdminService) audit(actorID uint, userID uint, action string, details string) {
+	err := u.userRepo.CreateAuditLog(&models.AdminAuditLog{
+		ActorID:      actorID,
+		TargetUserID: userID,
+		Action:       action,
+		Details:      details,
+	})
+	if err != nil {
+		log.Printf("Error recording audit log %s by admin %d on user %d: %v", action, actorID, userID, err)
+	}
+}
+
+func toAdminUserResponse(user *models.User) models.AdminUserResponse {
+	return models.AdminUserResponse{
+		UserResponse: models.UserResponse{
+			ID:              user.ID,
+			Fullname:        user.Fullname,
+			Username:        user.Username,
+			Telephone:       user.Telephone,
+			Email:           user.Email,
+			RoleName:        user.Role.Name,
+			ThumbNailURL:    user.ThumbNailURL,
+			IsEmailVerified: user.IsEmailActive,
+		},
+		SuspendedAt:     user.SuspendedAt,
+		SuspendedReason: user.SuspendedReason,
+		CreatedAt:       user.CreatedAt,
+		DeletedAt:       user.DeletedAt,
+	}
+}
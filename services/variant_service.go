@@ -0,0 +1,401 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/techagentng/ecommerce-api/config"
+	"github.com/techagentng/ecommerce-api/db"
+	apiError "github.com/techagentng/ecommerce-api/errors"
+	"github.com/techagentng/ecommerce-api/models"
+	"gorm.io/gorm"
+)
+
+// maxGeneratedVariants bounds the size of a generated variant matrix
+const maxGeneratedVariants = 500
+
+// VariantService manages product options and variants
+type VariantService interface {
+	ListVariants(productID uint) ([]models.VariantResponse, *apiError.Error)
+	CreateVariant(productID uint, request *models.CreateVariantRequest) (*models.VariantResponse, *apiError.Error)
+	UpdateVariant(productID uint, variantID uint, request *models.UpdateVariantRequest) (*models.VariantResponse, *apiError.Error)
+	DeleteVariant(productID uint, variantID uint) *apiError.Error
+	GenerateVariants(productID uint, request *models.GenerateVariantsRequest) ([]models.VariantResponse, *apiError.Error)
+}
+
+type variantService struct {
+	Config      *config.Config
+	variantRepo db.VariantRepository
+	productRepo db.ProductRepository
+}
+
+// NewVariantService constructor function
+func NewVariantService(variantRepo db.VariantRepository, productRepo db.ProductRepository, conf *config.Config) VariantService {
+	return &variantService{
+		Config:      conf,
+		variantRepo: variantRepo,
+		productRepo: productRepo,
+	}
+}
+
+func (v *variantService) ListVariants(productID uint) ([]models.VariantResponse, *apiError.Error) {
+	product, apiErr := v.findProduct(productID)
+	if apiErr != nil {
+		return nil, apiErr
+	}
+	return v.listVariants(product)
+}
+
+// CreateVariant adds a single variant, adding any new option names and values to the product
+func (v *variantService) CreateVariant(productID uint, request *models.CreateVariantRequest) (*models.VariantResponse, *apiError.Error) {
+	product, apiErr := v.findProduct(productID)
+	if apiErr != nil {
+		return nil, apiErr
+	}
+	if len(request.Options) == 0 {
+		return nil, apiError.New("a variant needs at least one option", http.StatusBadRequest)
+	}
+	if request.Price != nil && *request.Price <= 0 {
+		return nil, apiError.New("price must be greater than 0", http.StatusBadRequest)
+	}
+	if request.Stock < 0 {
+		return nil, apiError.New("stock cannot be negative", http.StatusBadRequest)
+	}
+
+	names := make([]string, 0, len(request.Options))
+	for name := range request.Options {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	optionRequests := make([]models.OptionRequest, 0, len(names))
+	for _, name := range names {
+		optionRequests = append(optionRequests, models.OptionRequest{Name: name, Values: []string{request.Options[name]}})
+	}
+	if apiErr := validateOptionRequests(optionRequests); apiErr != nil {
+		return nil, apiErr
+	}
+
+	options, err := v.variantRepo.EnsureOptionValues(product.ID, optionRequests)
+	if err != nil {
+		log.Printf("Error saving options of product %d: %v", product.ID, err)
+		return nil, apiError.ErrInternalServerError
+	}
+	values := make([]models.ProductOptionValue, 0, len(names))
+	for _, name := range names {
+		values = append(values, findOptionValue(options, name, request.Options[name]))
+	}
+
+	variant := &models.ProductVariant{
+		ProductID:    product.ID,
+		SKU:          strings.TrimSpace(request.SKU),
+		Price:        request.Price,
+		Stock:        request.Stock,
+		OptionValues: values,
+		OptionKey:    optionKey(values),
+	}
+	existing, apiErr := v.existingOptionKeys(product.ID)
+	if apiErr != nil {
+		return nil, apiErr
+	}
+	if existing[variant.OptionKey] {
+		return nil, apiError.New("a variant with these options already exists", http.StatusConflict)
+	}
+	if apiErr := v.checkSKU(variant.SKU, 0); apiErr != nil {
+		return nil, apiErr
+	}
+
+	if err := v.variantRepo.CreateVariants([]*models.ProductVariant{variant}); err != nil {
+		log.Printf("Error creating variant %s: %v", variant.SKU, err)
+		return nil, apiError.New("unable to create variant", http.StatusInternalServerError)
+	}
+	response := toVariantResponse(product, variant)
+	return &response, nil
+}
+
+func (v *variantService) UpdateVariant(productID uint, variantID uint, request *models.UpdateVariantRequest) (*models.VariantResponse, *apiError.Error) {
+	product, apiErr := v.findProduct(productID)
+	if apiErr != nil {
+		return nil, apiErr
+	}
+	variant, apiErr := v.findVariant(product.ID, variantID)
+	if apiErr != nil {
+		return nil, apiErr
+	}
+
+	if request.SKU != nil {
+		sku := strings.TrimSpace(*request.SKU)
+		if sku == "" {
+			return nil, apiError.New("sku cannot be empty", http.StatusBadRequest)
+		}
+		if apiErr := v.checkSKU(sku, variant.ID); apiErr != nil {
+			return nil, apiErr
+		}
+		variant.SKU = sku
+	}
+	if request.ClearPrice && request.Price != nil {
+		return nil, apiError.New("set either price or clear_price", http.StatusBadRequest)
+	}
+	if request.Price != nil {
+		if *request.Price <= 0 {
+			return nil, apiError.New("price must be greater than 0", http.StatusBadRequest)
+		}
+		variant.Price = request.Price
+	}
+	if request.ClearPrice {
+		variant.Price = nil
+	}
+	if request.Stock != nil {
+		return nil, apiError.New("stock is changed with a stock adjustment", http.StatusBadRequest)
+	}
+
+	if err := v.variantRepo.UpdateVariant(variant); err != nil {
+		log.Printf("Error updating variant %d: %v", variant.ID, err)
+		return nil, apiError.New("unable to update variant", http.StatusInternalServerError)
+	}
+	response := toVariantResponse(product, variant)
+	return &response, nil
+}
+
+func (v *variantService) DeleteVariant(productID uint, variantID uint) *apiError.Error {
+	variant, apiErr := v.findVariant(productID, variantID)
+	if apiErr != nil {
+		return apiErr
+	}
+	if err := v.variantRepo.DeleteVariant(variant); err != nil {
+		log.Printf("Error deleting variant %d: %v", variant.ID, err)
+		return apiError.New("unable to delete variant", http.StatusInternalServerError)
+	}
+	return nil
+}
+
+// GenerateVariants creates a variant for every combination of the requested
+// option values that the product does not have yet, and returns all variants.
+// SKUs are the prefix followed by each value, e.g. TSHIRT-M-RED.
+func (v *variantService) GenerateVariants(productID uint, request *models.GenerateVariantsRequest) ([]models.VariantResponse, *apiError.Error) {
+	product, apiErr := v.findProduct(productID)
+	if apiErr != nil {
+		return nil, apiErr
+	}
+	if apiErr := validateOptionRequests(request.Options); apiErr != nil {
+		return nil, apiErr
+	}
+	if request.Price != nil && *request.Price <= 0 {
+		return nil, apiError.New("price must be greater than 0", http.StatusBadRequest)
+	}
+	if request.Stock < 0 {
+		return nil, apiError.New("stock cannot be negative", http.StatusBadRequest)
+	}
+	combinations := 1
+	for _, option := range request.Options {
+		combinations *= len(option.Values)
+		if combinations > maxGeneratedVariants {
+			return nil, apiError.New(fmt.Sprintf("at most %d variants can be generated at once", maxGeneratedVariants), http.StatusBadRequest)
+		}
+	}
+	prefix := strings.ToUpper(slugify(request.SKUPrefix))
+	if prefix == "" {
+		prefix = "P" + strconv.FormatUint(uint64(product.ID), 10)
+	}
+
+	options, err := v.variantRepo.EnsureOptionValues(product.ID, request.Options)
+	if err != nil {
+		log.Printf("Error saving options of product %d: %v", product.ID, err)
+		return nil, apiError.ErrInternalServerError
+	}
+	existing, apiErr := v.existingOptionKeys(product.ID)
+	if apiErr != nil {
+		return nil, apiErr
+	}
+
+	var variants []*models.ProductVariant
+	skus := map[string]bool{}
+	for _, combination := range cartesian(request.Options) {
+		values := make([]models.ProductOptionValue, 0, len(combination))
+		skuParts := []string{prefix}
+		for i, value := range combination {
+			values = append(values, findOptionValue(options, request.Options[i].Name, value))
+			skuParts = append(skuParts, strings.ToUpper(slugify(value)))
+		}
+		key := optionKey(values)
+		if existing[key] {
+			continue
+		}
+
+		sku := strings.Join(skuParts, "-")
+		if skus[sku] {
+			return nil, apiError.New(fmt.Sprintf("option values produce duplicate sku %s", sku), http.StatusBadRequest)
+		}
+		if apiErr := v.checkSKU(sku, 0); apiErr != nil {
+			return nil, apiErr
+		}
+		skus[sku] = true
+		variants = append(variants, &models.ProductVariant{
+			ProductID:    product.ID,
+			SKU:          sku,
+			Price:        request.Price,
+			Stock:        request.Stock,
+			OptionValues: values,
+			OptionKey:    key,
+		})
+	}
+
+	if err := v.variantRepo.CreateVariants(variants); err != nil {
+		log.Printf("Error generating variants of product %d: %v", product.ID, err)
+		return nil, apiError.New("unable to generate variants", http.StatusInternalServerError)
+	}
+	return v.listVariants(product)
+}
+
+func (v *variantService) listVariants(product *models.Product) ([]models.VariantResponse, *apiError.Error) {
+	variants, err := v.variantRepo.ListVariants(product.ID)
+	if err != nil {
+		log.Printf("Error listing variants of product %d: %v", product.ID, err)
+		return nil, apiError.New("unable to list variants", http.StatusInternalServerError)
+	}
+	responses := make([]models.VariantResponse, 0, len(variants))
+	for _, variant := range variants {
+		responses = append(responses, toVariantResponse(product, variant))
+	}
+	return responses, nil
+}
+
+func (v *variantService) findProduct(productID uint) (*models.Product, *apiError.Error) {
+	product, err := v.productRepo.FindProductByID(productID)
+	if err != nil {
+		log.Printf("Error finding product %d: %v", productID, err)
+		return nil, apiError.ErrInternalServerError
+	}
+	if product == nil {
+		return nil, apiError.New("product not found", http.StatusNotFound)
+	}
+	return product, nil
+}
+
+func (v *variantService) findVariant(productID uint, variantID uint) (*models.ProductVariant, *apiError.Error) {
+	variant, err := v.variantRepo.FindVariantByID(variantID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, apiError.New("variant not found", http.StatusNotFound)
+		}
+		log.Printf("Error finding variant %d: %v", variantID, err)
+		return nil, apiError.ErrInternalServerError
+	}
+	if variant.ProductID != productID {
+		return nil, apiError.New("variant not found", http.StatusNotFound)
+	}
+	return variant, nil
+}
+
+func (v *variantService) existingOptionKeys(productID uint) (map[string]bool, *apiError.Error) {
+	variants, err := v.variantRepo.ListVariants(productID)
+	if err != nil {
+		log.Printf("Error listing variants of product %d: %v", productID, err)
+		return nil, apiError.ErrInternalServerError
+	}
+	keys := make(map[string]bool, len(variants))
+	for _, variant := range variants {
+		keys[variant.OptionKey] = true
+	}
+	return keys, nil
+}
+
+func (v *variantService) checkSKU(sku string, variantID uint) *apiError.Error {
+	taken, err := v.variantRepo.IsSKUTaken(sku, variantID)
+	if err != nil {
+		log.Printf("Error checking sku %s: %v", sku, err)
+		return apiError.ErrInternalServerError
+	}
+	if taken {
+		return apiError.New(fmt.Sprintf("sku %s is already in use", sku), http.StatusConflict)
+	}
+	return nil
+}
+
+func validateOptionRequests(options []models.OptionRequest) *apiError.Error {
+	names := map[string]bool{}
+	for _, option := range options {
+		if strings.TrimSpace(option.Name) == "" {
+			return apiError.New("option names cannot be empty", http.StatusBadRequest)
+		}
+		if names[option.Name] {
+			return apiError.New(fmt.Sprintf("option %s is listed twice", option.Name), http.StatusBadRequest)
+		}
+		names[option.Name] = true
+
+		values := map[string]bool{}
+		for _, value := range option.Values {
+			if strings.TrimSpace(value) == "" {
+				return apiError.New(fmt.Sprintf("option %s has an empty value", option.Name), http.StatusBadRequest)
+			}
+			if values[value] {
+				return apiError.New(fmt.Sprintf("option %s lists %s twice", option.Name, value), http.StatusBadRequest)
+			}
+			values[value] = true
+		}
+	}
+	return nil
+}
+
+// findOptionValue returns the saved value of the named option, with the option set
+func findOptionValue(options []models.ProductOption, name string, value string) models.ProductOptionValue {
+	for _, option := range options {
+		if option.Name != name {
+			continue
+		}
+		for _, optionValue := range option.Values {
+			if optionValue.Value == value {
+				optionValue.Option = option
+				optionValue.Option.Values = nil
+				return optionValue
+			}
+		}
+	}
+	return models.ProductOptionValue{}
+}
+
+// optionKey identifies a combination of option values regardless of order
+func optionKey(values []models.ProductOptionValue) string {
+	ids := make([]int, 0, len(values))
+	for _, value := range values {
+		ids = append(ids, int(value.ID))
+	}
+	sort.Ints(ids)
+	parts := make([]string, 0, len(ids))
+	for _, id := range ids {
+		parts = append(parts, strconv.Itoa(id))
+	}
+	return strings.Join(parts, ",")
+}
+
+// cartesian returns every combination of the options' values, one value per option
+func cartesian(options []models.OptionRequest) [][]string {
+	combinations := [][]string{{}}
+	for _, option := range options {
+		var next [][]string
+		for _, combination := range combinations {
+			for _, value := range option.Values {
+				extended := append(append([]string{}, combination...), value)
+				next = append(next, extended)
+			}
+		}
+		combinations = next
+	}
+	return combinations
+}
+
+func toVariantResponse(product *models.Product, variant *models.ProductVariant) models.VariantResponse {
+	return models.VariantResponse{
+		ID:            variant.ID,
+		ProductID:     variant.ProductID,
+		SKU:           variant.SKU,
+		Price:         variant.EffectivePrice(product),
+		PriceOverride: variant.Price,
+		Stock:         variant.Stock,
+		Options:       variant.Options(),
+	}
+}